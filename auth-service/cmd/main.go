@@ -7,10 +7,16 @@ import (
 	"net"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	_ "github.com/lib/pq"
 	"github.com/meetohin/web-chat/auth-service/internal/handler"
+	"github.com/meetohin/web-chat/auth-service/internal/mailer"
+	"github.com/meetohin/web-chat/auth-service/internal/oidc"
+	"github.com/meetohin/web-chat/auth-service/internal/password"
 	"github.com/meetohin/web-chat/auth-service/internal/repository"
 	"github.com/meetohin/web-chat/auth-service/internal/service"
 	pb "github.com/meetohin/web-chat/auth-service/proto"
@@ -45,7 +51,12 @@ func main() {
 	log.Println("Successfully connected to PostgreSQL repository")
 
 	// Init PostgreSQL repository
-	userRepo := repository.NewPostgreSQLUserRepository(db)
+	hasherCfg := hasherConfig()
+	hasher, err := password.NewHasher(hasherCfg)
+	if err != nil {
+		log.Fatalf("Failed to create password hasher: %v", err)
+	}
+	userRepo := repository.NewPostgreSQLUserRepository(db, hasher)
 
 	// Create tables if not exist
 	if postgresRepo, ok := userRepo.(*repository.PostgreSQLUserRepository); ok {
@@ -62,7 +73,31 @@ func main() {
 	}
 
 	// Init services
-	authService := service.NewAuthService(userRepo)
+	throttle := service.DefaultLoginThrottleConfig()
+	throttle.MaxUserAttempts = getIntEnv("LOGIN_MAX_ATTEMPTS", throttle.MaxUserAttempts)
+	throttle.MaxIPAttempts = getIntEnv("LOGIN_MAX_IP_ATTEMPTS", throttle.MaxIPAttempts)
+	throttle.BaseDelay = getDurationEnv("LOGIN_BACKOFF_BASE", throttle.BaseDelay)
+	throttle.MaxDelay = getDurationEnv("LOGIN_BACKOFF_MAX", throttle.MaxDelay)
+	throttle.LockoutDuration = getDurationEnv("LOGIN_LOCKOUT_DURATION", throttle.LockoutDuration)
+	throttle.AttemptWindow = getDurationEnv("LOGIN_ATTEMPT_WINDOW", throttle.AttemptWindow)
+
+	mail, err := newMailer(getEnv("MAILER", "log"))
+	if err != nil {
+		log.Fatalf("Failed to create mailer: %v", err)
+	}
+
+	authService := service.NewAuthService(userRepo, service.Config{
+		PasswordPolicy:   passwordPolicy(hasherCfg.Algorithm),
+		LoginThrottle:    throttle,
+		AdminUsers:       getListEnv("ADMIN_USERS"),
+		Mailer:           mail,
+		PasswordResetTTL: getDurationEnv("PASSWORD_RESET_TTL", time.Hour),
+		PasswordResetURL: getEnv("PASSWORD_RESET_URL", "http://localhost:8080/reset-password"),
+		EmailVerifyTTL:   getDurationEnv("EMAIL_VERIFY_TTL", 48*time.Hour),
+		EmailVerifyURL:   getEnv("EMAIL_VERIFY_URL", "http://localhost:8080/verify-email"),
+		TOTPIssuer:       getEnv("TOTP_ISSUER", "Web Chat"),
+		OIDC:             oidcConfig(),
+	})
 	authHandler := handler.NewAuthHandler(authService)
 
 	// Configure gRPC server
@@ -92,9 +127,126 @@ func main() {
 	log.Println("Auth service stopped")
 }
 
+// newMailer creates the mailer selected by the MAILER environment variable
+func newMailer(kind string) (mailer.Mailer, error) {
+	switch kind {
+	case "log":
+		return mailer.NewLogMailer(), nil
+	case "file":
+		return mailer.NewFileMailer(getEnv("MAILER_DIR", "mail"))
+	case "smtp":
+		return mailer.NewSMTPMailer(mailer.SMTPConfig{
+			Host:     getEnv("SMTP_HOST", ""),
+			Port:     getEnv("SMTP_PORT", "587"),
+			Username: getEnv("SMTP_USERNAME", ""),
+			Password: getEnv("SMTP_PASSWORD", ""),
+			From:     getEnv("SMTP_FROM", ""),
+		})
+	default:
+		return nil, fmt.Errorf("unknown mailer %q", kind)
+	}
+}
+
+// hasherConfig reads the password hashing algorithm and its cost parameters
+func hasherConfig() password.HasherConfig {
+	cfg := password.DefaultHasherConfig()
+	cfg.Algorithm = getEnv("PASSWORD_HASH_ALGORITHM", cfg.Algorithm)
+	cfg.BcryptCost = getIntEnv("BCRYPT_COST", cfg.BcryptCost)
+	cfg.Argon2Memory = uint32(getIntEnv("ARGON2_MEMORY_KB", int(cfg.Argon2Memory)))
+	cfg.Argon2Time = uint32(getIntEnv("ARGON2_TIME", int(cfg.Argon2Time)))
+	cfg.Argon2Threads = uint8(getIntEnv("ARGON2_THREADS", int(cfg.Argon2Threads)))
+	cfg.MaxConcurrent = getIntEnv("PASSWORD_HASH_CONCURRENCY", cfg.MaxConcurrent)
+	return cfg
+}
+
+// passwordPolicy reads the password rules and loads the breached password list if configured
+func passwordPolicy(algorithm string) password.Policy {
+	policy := password.DefaultPolicy()
+	policy.MinLength = getIntEnv("PASSWORD_MIN_LENGTH", policy.MinLength)
+	policy.MaxLength = getIntEnv("PASSWORD_MAX_LENGTH", policy.MaxLength)
+	if algorithm == password.AlgorithmBcrypt && (policy.MaxLength <= 0 || policy.MaxLength > password.BcryptMaxLength) {
+		// bcrypt ignores everything after 72 bytes
+		log.Printf("Limiting passwords to %d characters for bcrypt", password.BcryptMaxLength)
+		policy.MaxLength = password.BcryptMaxLength
+	}
+	policy.RequireUpper = getEnv("PASSWORD_REQUIRE_UPPER", "false") == "true"
+	policy.RequireLower = getEnv("PASSWORD_REQUIRE_LOWER", "false") == "true"
+	policy.RequireDigit = getEnv("PASSWORD_REQUIRE_DIGIT", "false") == "true"
+	policy.RequireSymbol = getEnv("PASSWORD_REQUIRE_SYMBOL", "false") == "true"
+	policy.MinCharClasses = getIntEnv("PASSWORD_MIN_CHAR_CLASSES", policy.MinCharClasses)
+	policy.RejectSimilarToUsername = getEnv("PASSWORD_REJECT_SIMILAR", "true") == "true"
+
+	if path := getEnv("PASSWORD_BREACHED_LIST", ""); path != "" {
+		breached, err := password.LoadBreachedList(path)
+		if err != nil {
+			log.Fatalf("Failed to load breached password list: %v", err)
+		}
+		policy.Breached = breached
+		log.Printf("Breached password check enabled using %s", path)
+	}
+	return policy
+}
+
+// oidcConfig configures single sign-on if OIDC_ISSUER_URL is set
+func oidcConfig() *service.OIDCConfig {
+	issuer := getEnv("OIDC_ISSUER_URL", "")
+	if issuer == "" {
+		return nil
+	}
+
+	roleMapping := make(map[string]string)
+	for _, pair := range getListEnv("OIDC_ROLE_MAPPING") {
+		group, role, ok := strings.Cut(pair, "=")
+		if !ok || (role != service.RoleUser && role != service.RoleAdmin) {
+			log.Fatalf("Invalid OIDC_ROLE_MAPPING entry %q, expected group=user or group=admin", pair)
+		}
+		roleMapping[group] = role
+	}
+
+	verifier, err := oidc.NewVerifier(issuer, getEnv("OIDC_CLIENT_ID", ""), getEnv("OIDC_GROUPS_CLAIM", "groups"))
+	if err != nil {
+		log.Fatalf("Invalid single sign-on configuration: %v", err)
+	}
+
+	log.Printf("Single sign-on enabled with issuer %s", issuer)
+	return &service.OIDCConfig{
+		Verifier:      verifier,
+		RoleMapping:   roleMapping,
+		AutoProvision: getEnv("OIDC_AUTO_PROVISION", "true") == "true",
+	}
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
+
+func getIntEnv(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+func getListEnv(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
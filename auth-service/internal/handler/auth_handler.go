@@ -2,8 +2,19 @@ package handler
 
 import (
 	"context"
+	"errors"
+	"strings"
+
+	"github.com/meetohin/web-chat/auth-service/internal/repository"
 	"github.com/meetohin/web-chat/auth-service/internal/service"
 	pb "github.com/meetohin/web-chat/auth-service/proto"
+	"google.golang.org/grpc/metadata"
+)
+
+// Metadata keys describing the end user's device, set by the calling service
+const (
+	ClientIPMetadataKey  = "x-client-ip"
+	UserAgentMetadataKey = "x-user-agent"
 )
 
 type AuthHandler struct {
@@ -22,7 +33,7 @@ func (h *AuthHandler) Register(ctx context.Context, req *pb.RegisterRequest) (*p
 		return nil, ctx.Err()
 	}
 
-	err := h.authService.Register(req.Username, req.Password)
+	err := h.authService.Register(req.Username, req.Email, req.Password)
 	if err != nil {
 		return &pb.RegisterResponse{
 			Success: false,
@@ -41,12 +52,40 @@ func (h *AuthHandler) Login(ctx context.Context, req *pb.LoginRequest) (*pb.Logi
 		return nil, ctx.Err()
 	}
 
-	token, err := h.authService.Login(req.Username, req.Password)
+	result, err := h.authService.Login(req.Username, req.Password, clientInfo(ctx))
 	if err != nil {
+		return loginFailure(err), nil
+	}
+
+	return loginResult(result), nil
+}
+
+// loginResult answers a successful first login step with the token or the two-factor challenge
+func loginResult(result *service.LoginResult) *pb.LoginResponse {
+	if result.ChallengeToken != "" {
 		return &pb.LoginResponse{
-			Success: false,
-			Message: err.Error(),
-		}, nil
+			Success:           false,
+			Message:           "Two-factor authentication required",
+			TwoFactorRequired: true,
+			ChallengeToken:    result.ChallengeToken,
+		}
+	}
+
+	return &pb.LoginResponse{
+		Success: true,
+		Token:   result.Token,
+		Message: "Login successful",
+	}
+}
+
+func (h *AuthHandler) CompleteLogin(ctx context.Context, req *pb.CompleteLoginRequest) (*pb.LoginResponse, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	token, err := h.authService.CompleteLogin(req.ChallengeToken, req.Code, clientInfo(ctx))
+	if err != nil {
+		return loginFailure(err), nil
 	}
 
 	return &pb.LoginResponse{
@@ -56,20 +95,418 @@ func (h *AuthHandler) Login(ctx context.Context, req *pb.LoginRequest) (*pb.Logi
 	}, nil
 }
 
+func (h *AuthHandler) OIDCLogin(ctx context.Context, req *pb.OIDCLoginRequest) (*pb.LoginResponse, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	result, err := h.authService.OIDCLogin(req.IdToken, req.Nonce, clientInfo(ctx))
+	if err != nil {
+		return loginFailure(err), nil
+	}
+
+	return loginResult(result), nil
+}
+
+func (h *AuthHandler) EnrollTOTP(ctx context.Context, req *pb.EnrollTOTPRequest) (*pb.EnrollTOTPResponse, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	secret, uri, err := h.authService.EnrollTOTP(req.Token)
+	if err != nil {
+		return &pb.EnrollTOTPResponse{
+			Success: false,
+			Message: err.Error(),
+		}, nil
+	}
+
+	return &pb.EnrollTOTPResponse{
+		Success:         true,
+		Message:         "Scan the provisioning URI and confirm with a code",
+		Secret:          secret,
+		ProvisioningUri: uri,
+	}, nil
+}
+
+func (h *AuthHandler) ConfirmTOTP(ctx context.Context, req *pb.ConfirmTOTPRequest) (*pb.ConfirmTOTPResponse, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	codes, err := h.authService.ConfirmTOTP(req.Token, req.Code)
+	if err != nil {
+		return &pb.ConfirmTOTPResponse{
+			Success: false,
+			Message: err.Error(),
+		}, nil
+	}
+
+	return &pb.ConfirmTOTPResponse{
+		Success:       true,
+		Message:       "Two-factor authentication enabled",
+		RecoveryCodes: codes,
+	}, nil
+}
+
+func (h *AuthHandler) DisableTOTP(ctx context.Context, req *pb.DisableTOTPRequest) (*pb.DisableTOTPResponse, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	err := h.authService.DisableTOTP(req.Token, req.Password, req.Code, clientInfo(ctx))
+	if err != nil {
+		return &pb.DisableTOTPResponse{
+			Success: false,
+			Message: err.Error(),
+		}, nil
+	}
+
+	return &pb.DisableTOTPResponse{
+		Success: true,
+		Message: "Two-factor authentication disabled",
+	}, nil
+}
+
+// loginFailure builds the response for a rejected login, including throttling details
+func loginFailure(err error) *pb.LoginResponse {
+	resp := &pb.LoginResponse{
+		Success: false,
+		Message: err.Error(),
+	}
+	var throttled *service.LoginThrottledError
+	if errors.As(err, &throttled) {
+		resp.RetryAfterSeconds = int64(throttled.RetryAfter.Seconds()) + 1
+	}
+	return resp
+}
+
 func (h *AuthHandler) ValidateToken(ctx context.Context, req *pb.ValidateTokenRequest) (*pb.ValidateTokenResponse, error) {
 	if ctx.Err() != nil {
 		return nil, ctx.Err()
 	}
 
-	username, err := h.authService.ValidateToken(req.Token)
+	identity, err := h.authService.ValidateToken(req.Token)
 	if err != nil {
 		return &pb.ValidateTokenResponse{
 			Valid: false,
 		}, nil
 	}
 
+	// Report the effective role, so admins listed in ADMIN_USERS are recognised too
+	role := identity.Role
+	if h.authService.IsAdmin(identity) {
+		role = service.RoleAdmin
+	}
+
 	return &pb.ValidateTokenResponse{
-		Valid:    true,
+		Valid:         true,
+		Username:      identity.Username,
+		Email:         identity.Email,
+		EmailVerified: identity.EmailVerified,
+		Role:          role,
+		SessionId:     identity.SessionID,
+		Bot:           identity.Bot,
+		Scopes:        identity.Scopes,
+	}, nil
+}
+
+func (h *AuthHandler) UnlockAccount(ctx context.Context, req *pb.UnlockAccountRequest) (*pb.UnlockAccountResponse, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	err := h.authService.UnlockAccount(req.Token, req.Username, req.IpAddress)
+	if err != nil {
+		return &pb.UnlockAccountResponse{
+			Success: false,
+			Message: err.Error(),
+		}, nil
+	}
+
+	return &pb.UnlockAccountResponse{
+		Success: true,
+		Message: "Account unlocked",
+	}, nil
+}
+
+func (h *AuthHandler) ChangePassword(ctx context.Context, req *pb.ChangePasswordRequest) (*pb.ChangePasswordResponse, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	token, err := h.authService.ChangePassword(req.Token, req.OldPassword, req.NewPassword, clientInfo(ctx))
+	if err != nil {
+		return &pb.ChangePasswordResponse{
+			Success: false,
+			Message: err.Error(),
+		}, nil
+	}
+
+	return &pb.ChangePasswordResponse{
+		Success: true,
+		Message: "Password changed successfully",
+		Token:   token,
+	}, nil
+}
+
+func (h *AuthHandler) RequestPasswordReset(ctx context.Context, req *pb.RequestPasswordResetRequest) (*pb.RequestPasswordResetResponse, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	err := h.authService.RequestPasswordReset(req.Username)
+	if err != nil {
+		return &pb.RequestPasswordResetResponse{
+			Success: false,
+			Message: err.Error(),
+		}, nil
+	}
+
+	return &pb.RequestPasswordResetResponse{
+		Success: true,
+		Message: "If the account exists, reset instructions have been sent",
+	}, nil
+}
+
+func (h *AuthHandler) ResetPassword(ctx context.Context, req *pb.ResetPasswordRequest) (*pb.ResetPasswordResponse, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	err := h.authService.ResetPassword(req.ResetToken, req.NewPassword)
+	if err != nil {
+		return &pb.ResetPasswordResponse{
+			Success: false,
+			Message: err.Error(),
+		}, nil
+	}
+
+	return &pb.ResetPasswordResponse{
+		Success: true,
+		Message: "Password reset successfully",
+	}, nil
+}
+
+func (h *AuthHandler) VerifyEmail(ctx context.Context, req *pb.VerifyEmailRequest) (*pb.VerifyEmailResponse, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	err := h.authService.VerifyEmail(req.VerificationToken)
+	if err != nil {
+		return &pb.VerifyEmailResponse{
+			Success: false,
+			Message: err.Error(),
+		}, nil
+	}
+
+	return &pb.VerifyEmailResponse{
+		Success: true,
+		Message: "Email verified successfully",
+	}, nil
+}
+
+func (h *AuthHandler) ResendVerification(ctx context.Context, req *pb.ResendVerificationRequest) (*pb.ResendVerificationResponse, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	err := h.authService.ResendVerification(req.Token)
+	if err != nil {
+		return &pb.ResendVerificationResponse{
+			Success: false,
+			Message: err.Error(),
+		}, nil
+	}
+
+	return &pb.ResendVerificationResponse{
+		Success: true,
+		Message: "Verification email sent",
+	}, nil
+}
+
+func (h *AuthHandler) ListSessions(ctx context.Context, req *pb.ListSessionsRequest) (*pb.ListSessionsResponse, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	sessions, currentID, err := h.authService.ListSessions(req.Token)
+	if err != nil {
+		return &pb.ListSessionsResponse{
+			Success: false,
+			Message: err.Error(),
+		}, nil
+	}
+
+	resp := &pb.ListSessionsResponse{Success: true}
+	for _, session := range sessions {
+		resp.Sessions = append(resp.Sessions, &pb.Session{
+			Id:         session.ID,
+			UserAgent:  session.UserAgent,
+			IpAddress:  session.IPAddress,
+			CreatedAt:  session.CreatedAt.Unix(),
+			LastSeenAt: session.LastSeenAt.Unix(),
+			Current:    session.ID == currentID,
+		})
+	}
+	return resp, nil
+}
+
+func (h *AuthHandler) RevokeSession(ctx context.Context, req *pb.RevokeSessionRequest) (*pb.RevokeSessionResponse, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	err := h.authService.RevokeSession(req.Token, req.SessionId)
+	if err != nil {
+		return &pb.RevokeSessionResponse{
+			Success: false,
+			Message: err.Error(),
+		}, nil
+	}
+
+	return &pb.RevokeSessionResponse{
+		Success: true,
+		Message: "Session revoked",
+	}, nil
+}
+
+func (h *AuthHandler) CreateBot(ctx context.Context, req *pb.CreateBotRequest) (*pb.CreateBotResponse, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	err := h.authService.CreateBot(req.Token, req.Username)
+	if err != nil {
+		return &pb.CreateBotResponse{
+			Success: false,
+			Message: err.Error(),
+		}, nil
+	}
+
+	return &pb.CreateBotResponse{
+		Success: true,
+		Message: "Bot created",
+	}, nil
+}
+
+func (h *AuthHandler) ImportUser(ctx context.Context, req *pb.ImportUserRequest) (*pb.ImportUserResponse, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	username, created, err := h.authService.ImportUser(req.Token, req.Username, req.Email)
+	if err != nil {
+		return &pb.ImportUserResponse{
+			Success: false,
+			Message: err.Error(),
+		}, nil
+	}
+
+	return &pb.ImportUserResponse{
+		Success:  true,
+		Message:  "User mapped",
 		Username: username,
+		Created:  created,
+	}, nil
+}
+
+func (h *AuthHandler) CreateAPIKey(ctx context.Context, req *pb.CreateAPIKeyRequest) (*pb.CreateAPIKeyResponse, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	key, apiKey, err := h.authService.CreateAPIKey(req.Token, req.BotUsername, req.Name, req.Scopes)
+	if err != nil {
+		return &pb.CreateAPIKeyResponse{
+			Success: false,
+			Message: err.Error(),
+		}, nil
+	}
+
+	return &pb.CreateAPIKeyResponse{
+		Success: true,
+		Message: "API key created, store it now: it cannot be shown again",
+		Key:     key,
+		ApiKey:  apiKeyToProto(apiKey),
 	}, nil
 }
+
+func (h *AuthHandler) ListAPIKeys(ctx context.Context, req *pb.ListAPIKeysRequest) (*pb.ListAPIKeysResponse, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	keys, err := h.authService.ListAPIKeys(req.Token, req.BotUsername)
+	if err != nil {
+		return &pb.ListAPIKeysResponse{
+			Success: false,
+			Message: err.Error(),
+		}, nil
+	}
+
+	resp := &pb.ListAPIKeysResponse{Success: true}
+	for i := range keys {
+		resp.ApiKeys = append(resp.ApiKeys, apiKeyToProto(&keys[i]))
+	}
+	return resp, nil
+}
+
+func (h *AuthHandler) RevokeAPIKey(ctx context.Context, req *pb.RevokeAPIKeyRequest) (*pb.RevokeAPIKeyResponse, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	err := h.authService.RevokeAPIKey(req.Token, req.KeyId)
+	if err != nil {
+		return &pb.RevokeAPIKeyResponse{
+			Success: false,
+			Message: err.Error(),
+		}, nil
+	}
+
+	return &pb.RevokeAPIKeyResponse{
+		Success: true,
+		Message: "API key revoked",
+	}, nil
+}
+
+func apiKeyToProto(key *repository.APIKey) *pb.APIKey {
+	var lastUsedAt int64
+	if !key.LastUsedAt.IsZero() {
+		lastUsedAt = key.LastUsedAt.Unix()
+	}
+	return &pb.APIKey{
+		Id:          key.ID,
+		BotUsername: key.Username,
+		Name:        key.Name,
+		Prefix:      key.Prefix,
+		Scopes:      key.Scopes,
+		CreatedBy:   key.CreatedBy,
+		CreatedAt:   key.CreatedAt.Unix(),
+		LastUsedAt:  lastUsedAt,
+		Revoked:     !key.RevokedAt.IsZero(),
+	}
+}
+
+// clientInfo returns the end user's IP and user agent passed in metadata by the
+// calling service. The gRPC peer address is deliberately not used: it belongs to
+// the calling service and would make every user share one per-IP failure counter.
+func clientInfo(ctx context.Context) service.ClientInfo {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return service.ClientInfo{}
+	}
+	return service.ClientInfo{
+		IP:        firstValue(md, ClientIPMetadataKey),
+		UserAgent: firstValue(md, UserAgentMetadataKey),
+	}
+}
+
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return strings.TrimSpace(values[0])
+	}
+	return ""
+}
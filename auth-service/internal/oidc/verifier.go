@@ -0,0 +1,287 @@
+// Package oidc verifies ID tokens issued by an OpenID Connect provider
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jwksRefreshInterval limits how often unknown key IDs trigger a JWKS refetch
+const jwksRefreshInterval = time.Minute
+
+// Claims are the ID token claims the auth service uses
+type Claims struct {
+	Issuer            string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+	Name              string
+	Groups            []string
+}
+
+// Verifier validates ID tokens against the provider's published signing keys
+type Verifier struct {
+	issuer      string
+	clientID    string
+	groupsClaim string
+	httpClient  *http.Client
+
+	mu        sync.Mutex
+	jwksURI   string
+	keys      map[string]interface{}
+	fetchedAt time.Time
+}
+
+// NewVerifier creates a verifier for tokens issued by issuer to clientID.
+// groupsClaim names the claim holding the user's groups.
+func NewVerifier(issuer, clientID, groupsClaim string) (*Verifier, error) {
+	if issuer == "" {
+		return nil, errors.New("oidc issuer required")
+	}
+	// Without a client ID the audience would go unchecked and tokens issued to any
+	// other application of the provider would be accepted
+	if clientID == "" {
+		return nil, errors.New("oidc client id required")
+	}
+	if groupsClaim == "" {
+		groupsClaim = "groups"
+	}
+	return &Verifier{
+		issuer:      strings.TrimSuffix(issuer, "/"),
+		clientID:    clientID,
+		groupsClaim: groupsClaim,
+		httpClient:  &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Issuer returns the issuer the verifier accepts
+func (v *Verifier) Issuer() string {
+	return v.issuer
+}
+
+// Verify checks the ID token signature, issuer, audience, expiry and nonce and returns its claims.
+// The nonce is required: it binds the token to the sign-in that requested it, so a token
+// captured elsewhere cannot be replayed.
+func (v *Verifier) Verify(rawIDToken, nonce string) (*Claims, error) {
+	if nonce == "" {
+		return nil, errors.New("invalid id token: nonce required")
+	}
+
+	mapClaims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(rawIDToken, mapClaims, v.keyFunc,
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(v.issuer),
+		jwt.WithAudience(v.clientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id token: %w", err)
+	}
+
+	if tokenNonce, _ := mapClaims["nonce"].(string); subtle.ConstantTimeCompare([]byte(tokenNonce), []byte(nonce)) != 1 {
+		return nil, errors.New("invalid id token: nonce mismatch")
+	}
+
+	claims := &Claims{Issuer: v.issuer}
+	claims.Subject, _ = mapClaims["sub"].(string)
+	claims.Email, _ = mapClaims["email"].(string)
+	claims.EmailVerified = boolClaim(mapClaims["email_verified"])
+	claims.PreferredUsername, _ = mapClaims["preferred_username"].(string)
+	claims.Name, _ = mapClaims["name"].(string)
+	claims.Groups = stringsClaim(mapClaims[v.groupsClaim])
+
+	if claims.Subject == "" {
+		return nil, errors.New("invalid id token: missing subject")
+	}
+	return claims, nil
+}
+
+func (v *Verifier) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if key, ok := v.lookupKey(kid); ok {
+		return key, nil
+	}
+
+	// Unknown key: the provider may have rotated its keys
+	if time.Since(v.fetchedAt) < jwksRefreshInterval && v.keys != nil {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if err := v.refreshKeys(); err != nil {
+		return nil, err
+	}
+	if key, ok := v.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (v *Verifier) lookupKey(kid string) (interface{}, bool) {
+	if kid != "" {
+		key, ok := v.keys[kid]
+		return key, ok
+	}
+	// Tokens without a key ID are accepted only if the provider has a single key
+	if len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// refreshKeys downloads the provider's JWKS, discovering its location first if needed
+func (v *Verifier) refreshKeys() error {
+	v.fetchedAt = time.Now()
+
+	if v.jwksURI == "" {
+		var discovery struct {
+			Issuer  string `json:"issuer"`
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := v.getJSON(v.issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+			return fmt.Errorf("oidc discovery: %w", err)
+		}
+		if strings.TrimSuffix(discovery.Issuer, "/") != v.issuer {
+			return fmt.Errorf("oidc discovery: issuer mismatch %q", discovery.Issuer)
+		}
+		v.jwksURI = discovery.JWKSURI
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := v.getJSON(v.jwksURI, &set); err != nil {
+		return fmt.Errorf("oidc jwks: %w", err)
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	v.keys = keys
+	return nil
+}
+
+func (v *Verifier) getJSON(url string, out interface{}) error {
+	resp, err := v.httpClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func boolClaim(v interface{}) bool {
+	switch value := v.(type) {
+	case bool:
+		return value
+	case string:
+		// Some providers send booleans as strings
+		return value == "true"
+	default:
+		return false
+	}
+}
+
+func stringsClaim(v interface{}) []string {
+	switch value := v.(type) {
+	case []interface{}:
+		var result []string
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	case string:
+		return []string{value}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,150 @@
+package oidc_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/meetohin/web-chat/auth-service/internal/oidc"
+	"github.com/meetohin/web-chat/auth-service/internal/oidc/oidctest"
+)
+
+const clientID = "chat"
+
+func TestNewVerifierRequiresClientID(t *testing.T) {
+	if _, err := oidc.NewVerifier("https://idp.example.com", "", ""); err == nil {
+		t.Fatal("verifier without client id was created")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	issuer := oidctest.NewIssuer(t)
+	verifier, err := oidc.NewVerifier(issuer.URL, clientID, "groups")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := jwt.NewWithClaims(jwt.SigningMethodRS256, issuer.Claims(clientID, "alice", "n1"))
+	forged.Header["kid"] = oidctest.KeyID
+	forgedToken, err := forged.SignedString(otherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		nonce   string
+		wantErr string
+	}{
+		{
+			name:  "valid",
+			token: issuer.Sign(t, issuer.Claims(clientID, "alice", "n1")),
+			nonce: "n1",
+		},
+		{
+			name:    "nonce mismatch",
+			token:   issuer.Sign(t, issuer.Claims(clientID, "alice", "n1")),
+			nonce:   "n2",
+			wantErr: "nonce",
+		},
+		{
+			name: "token without nonce",
+			token: issuer.Sign(t, func() jwt.MapClaims {
+				claims := issuer.Claims(clientID, "alice", "")
+				delete(claims, "nonce")
+				return claims
+			}()),
+			nonce:   "n1",
+			wantErr: "nonce",
+		},
+		{
+			name:    "no expected nonce",
+			token:   issuer.Sign(t, issuer.Claims(clientID, "alice", "")),
+			nonce:   "",
+			wantErr: "nonce",
+		},
+		{
+			name:    "other audience",
+			token:   issuer.Sign(t, issuer.Claims("other-app", "alice", "n1")),
+			nonce:   "n1",
+			wantErr: "audience",
+		},
+		{
+			name: "other issuer",
+			token: issuer.Sign(t, func() jwt.MapClaims {
+				claims := issuer.Claims(clientID, "alice", "n1")
+				claims["iss"] = "https://evil.example.com"
+				return claims
+			}()),
+			nonce:   "n1",
+			wantErr: "issuer",
+		},
+		{
+			name: "expired",
+			token: issuer.Sign(t, func() jwt.MapClaims {
+				claims := issuer.Claims(clientID, "alice", "n1")
+				claims["exp"] = time.Now().Add(-time.Minute).Unix()
+				return claims
+			}()),
+			nonce:   "n1",
+			wantErr: "expired",
+		},
+		{
+			name:    "signed with another key",
+			token:   forgedToken,
+			nonce:   "n1",
+			wantErr: "signature",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := verifier.Verify(tt.token, tt.nonce)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Verify() error = %v", err)
+				}
+				if claims.Subject != "alice" || claims.Issuer != issuer.URL {
+					t.Fatalf("Verify() claims = %+v", claims)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Verify() error = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyClaims(t *testing.T) {
+	issuer := oidctest.NewIssuer(t)
+	verifier, err := oidc.NewVerifier(issuer.URL+"/", clientID, "roles")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := issuer.Claims(clientID, "alice", "n1")
+	claims["email"] = "alice@example.com"
+	claims["email_verified"] = "true"
+	claims["preferred_username"] = "alice"
+	claims["roles"] = []string{"chat-admins", "staff"}
+
+	got, err := verifier.Verify(issuer.Sign(t, claims), "n1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Email != "alice@example.com" || !got.EmailVerified || got.PreferredUsername != "alice" {
+		t.Errorf("Verify() claims = %+v", got)
+	}
+	if len(got.Groups) != 2 || got.Groups[0] != "chat-admins" {
+		t.Errorf("Verify() groups = %v", got.Groups)
+	}
+}
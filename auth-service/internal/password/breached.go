@@ -0,0 +1,89 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BreachedList checks passwords against a local copy of a breached password
+// list in the k-anonymity format used by Have I Been Pwned: SHA-1 hashes are
+// split into a 5 character prefix and the remaining suffix.
+//
+// The list is either a directory of range files named "<PREFIX>.txt", each
+// holding "<SUFFIX>:<COUNT>" lines (as written by the official downloader),
+// or a single file of "<HASH>[:<COUNT>]" lines, which is loaded into memory.
+type BreachedList struct {
+	dir    string
+	hashes map[string]map[string]struct{} // prefix -> suffixes, for single file lists
+}
+
+// LoadBreachedList opens the list at path
+func LoadBreachedList(path string) (*BreachedList, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &BreachedList{dir: path}, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	list := &BreachedList{hashes: make(map[string]map[string]struct{})}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		hash, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if len(hash) != sha1.Size*2 {
+			continue
+		}
+		hash = strings.ToUpper(hash)
+		prefix, suffix := hash[:5], hash[5:]
+		if list.hashes[prefix] == nil {
+			list.hashes[prefix] = make(map[string]struct{})
+		}
+		list.hashes[prefix][suffix] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read breached password list: %w", err)
+	}
+	return list, nil
+}
+
+// Contains reports whether the password is in the list
+func (l *BreachedList) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	if l.hashes != nil {
+		_, ok := l.hashes[prefix][suffix]
+		return ok, nil
+	}
+
+	f, err := os.Open(filepath.Join(l.dir, prefix+".txt"))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		candidate, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(candidate, suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
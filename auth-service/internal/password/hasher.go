@@ -0,0 +1,174 @@
+// Package password hashes passwords and enforces the password policy
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Supported hashing algorithms
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+)
+
+// BcryptMaxLength is the longest password in bytes bcrypt can hash; it ignores the rest
+const BcryptMaxLength = 72
+
+// ErrTooLong is returned by Hash for passwords bcrypt would silently truncate
+var ErrTooLong = fmt.Errorf("password must be at most %d bytes", BcryptMaxLength)
+
+// HasherConfig selects the algorithm and cost used for new hashes
+type HasherConfig struct {
+	Algorithm     string
+	BcryptCost    int
+	Argon2Memory  uint32 // KiB
+	Argon2Time    uint32
+	Argon2Threads uint8
+	// MaxConcurrent limits how many hashes are computed at once, each argon2id one takes
+	// Argon2Memory; further logins wait. Zero means the number of CPUs.
+	MaxConcurrent int
+}
+
+// DefaultHasherConfig returns argon2id with the parameters recommended by RFC 9106
+func DefaultHasherConfig() HasherConfig {
+	return HasherConfig{
+		Algorithm:     AlgorithmArgon2id,
+		BcryptCost:    bcrypt.DefaultCost,
+		Argon2Memory:  64 * 1024,
+		Argon2Time:    3,
+		Argon2Threads: 2,
+	}
+}
+
+// Hasher creates and verifies password hashes. It verifies every supported
+// format, so hashes made with an older algorithm or cost keep working and
+// can be upgraded on the next successful login.
+type Hasher struct {
+	cfg   HasherConfig
+	slots chan struct{}
+}
+
+// NewHasher creates a new hasher
+func NewHasher(cfg HasherConfig) (*Hasher, error) {
+	switch cfg.Algorithm {
+	case AlgorithmBcrypt:
+		if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("invalid bcrypt cost %d", cfg.BcryptCost)
+		}
+	case AlgorithmArgon2id:
+		if cfg.Argon2Memory == 0 || cfg.Argon2Time == 0 || cfg.Argon2Threads == 0 {
+			return nil, errors.New("invalid argon2id parameters")
+		}
+	default:
+		return nil, fmt.Errorf("unknown password hashing algorithm %q", cfg.Algorithm)
+	}
+	if cfg.MaxConcurrent <= 0 {
+		cfg.MaxConcurrent = runtime.NumCPU()
+	}
+	return &Hasher{cfg: cfg, slots: make(chan struct{}, cfg.MaxConcurrent)}, nil
+}
+
+// acquire waits for one of the MaxConcurrent hashing slots; the returned function frees it
+func (h *Hasher) acquire() func() {
+	h.slots <- struct{}{}
+	return func() { <-h.slots }
+}
+
+// Hash returns a new hash of the password using the configured algorithm
+func (h *Hasher) Hash(password string) (string, error) {
+	if h.cfg.Algorithm == AlgorithmBcrypt {
+		if len(password) > BcryptMaxLength {
+			return "", ErrTooLong
+		}
+		defer h.acquire()()
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cfg.BcryptCost)
+		return string(hash), err
+	}
+	defer h.acquire()()
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.cfg.Argon2Time, h.cfg.Argon2Memory, h.cfg.Argon2Threads, 32)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.cfg.Argon2Memory, h.cfg.Argon2Time, h.cfg.Argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify checks the password against the hash. needsRehash is true when the
+// password is correct but the hash does not use the configured algorithm and cost.
+func (h *Hasher) Verify(hash, password string) (ok bool, needsRehash bool) {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		params, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false, false
+		}
+		release := h.acquire()
+		actual := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, uint32(len(key)))
+		release()
+		if subtle.ConstantTimeCompare(actual, key) != 1 {
+			return false, false
+		}
+		return true, h.cfg.Algorithm != AlgorithmArgon2id ||
+			params.memory != h.cfg.Argon2Memory || params.time != h.cfg.Argon2Time || params.threads != h.cfg.Argon2Threads
+	}
+
+	// bcrypt compares only the first 72 bytes, longer passwords would match by their prefix
+	if len(password) > BcryptMaxLength {
+		return false, false
+	}
+	release := h.acquire()
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	release()
+	if err != nil {
+		return false, false
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return true, h.cfg.Algorithm != AlgorithmBcrypt || err != nil || cost != h.cfg.BcryptCost
+}
+
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+}
+
+// decodeArgon2id parses a hash in the PHC string format produced by Hash
+func decodeArgon2id(hash string) (argon2Params, []byte, []byte, error) {
+	var params argon2Params
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, errors.New("malformed argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errors.New("unsupported argon2 version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return params, nil, nil, errors.New("malformed argon2id parameters")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, errors.New("malformed argon2id key")
+	}
+
+	return params, salt, key, nil
+}
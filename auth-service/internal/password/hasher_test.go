@@ -0,0 +1,44 @@
+package password
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestBcryptRejectsTruncatedPasswords(t *testing.T) {
+	h, err := NewHasher(HasherConfig{Algorithm: AlgorithmBcrypt, BcryptCost: bcrypt.MinCost})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := h.Hash(strings.Repeat("a", BcryptMaxLength+1)); !errors.Is(err, ErrTooLong) {
+		t.Fatalf("Hash of a %d byte password: got %v, want ErrTooLong", BcryptMaxLength+1, err)
+	}
+
+	password := strings.Repeat("a", BcryptMaxLength)
+	hash, err := h.Hash(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := h.Verify(hash, password); !ok {
+		t.Fatal("Verify rejected the hashed password")
+	}
+	if ok, _ := h.Verify(hash, password+"extra"); ok {
+		t.Fatal("Verify accepted a longer password sharing the first 72 bytes")
+	}
+}
+
+func TestHasherDefaultsConcurrency(t *testing.T) {
+	cfg := DefaultHasherConfig()
+	cfg.MaxConcurrent = 0
+	h, err := NewHasher(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cap(h.slots) < 1 {
+		t.Fatalf("got %d hashing slots, want at least 1", cap(h.slots))
+	}
+}
@@ -0,0 +1,141 @@
+package password
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Policy describes which passwords are acceptable
+type Policy struct {
+	MinLength      int
+	MaxLength      int // 0 means no limit
+	RequireUpper   bool
+	RequireLower   bool
+	RequireDigit   bool
+	RequireSymbol  bool
+	MinCharClasses int // minimum number of distinct character classes, 0 disables the check
+	// RejectSimilarToUsername rejects passwords that contain the username
+	// or differ from it by only a few characters
+	RejectSimilarToUsername bool
+	Breached                *BreachedList // nil disables the breached password check
+}
+
+// DefaultPolicy returns the policy used when nothing is configured
+func DefaultPolicy() Policy {
+	return Policy{
+		MinLength:               6,
+		MaxLength:               128,
+		RejectSimilarToUsername: true,
+	}
+}
+
+// Validate returns an error describing why the password is not acceptable for the user
+func (p Policy) Validate(username, password string) error {
+	length := len([]rune(password))
+	if length < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters", p.MinLength)
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		return fmt.Errorf("password must be at most %d characters", p.MaxLength)
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		default:
+			hasSymbol = true
+		}
+	}
+
+	if p.RequireUpper && !hasUpper {
+		return errors.New("password must contain an uppercase letter")
+	}
+	if p.RequireLower && !hasLower {
+		return errors.New("password must contain a lowercase letter")
+	}
+	if p.RequireDigit && !hasDigit {
+		return errors.New("password must contain a digit")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		return errors.New("password must contain a symbol")
+	}
+	if p.MinCharClasses > 0 && countTrue(hasUpper, hasLower, hasDigit, hasSymbol) < p.MinCharClasses {
+		return fmt.Errorf("password must contain at least %d of: uppercase letters, lowercase letters, digits, symbols", p.MinCharClasses)
+	}
+
+	if p.RejectSimilarToUsername && username != "" && similar(username, password) {
+		return errors.New("password is too similar to the username")
+	}
+
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			return fmt.Errorf("breached password check failed: %w", err)
+		}
+		if breached {
+			return errors.New("password appears in a list of breached passwords, choose another one")
+		}
+	}
+
+	return nil
+}
+
+// similar reports whether the password contains the username (forwards or
+// backwards) or is within a small edit distance of it
+func similar(username, password string) bool {
+	u := strings.ToLower(username)
+	p := strings.ToLower(password)
+
+	if len(u) >= 3 && (strings.Contains(p, u) || strings.Contains(p, reverse(u))) {
+		return true
+	}
+	return levenshtein(u, p) <= len([]rune(p))/3
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+func countTrue(values ...bool) int {
+	n := 0
+	for _, v := range values {
+		if v {
+			n++
+		}
+	}
+	return n
+}
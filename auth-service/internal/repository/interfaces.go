@@ -1,14 +1,82 @@
 package repository
 
+import "time"
+
 // User represents a user in the system
 type User struct {
-	Username string
-	Password string // hashed
+	Username          string
+	Password          string // hashed
+	Email             string // empty if the user registered without one
+	EmailVerified     bool
+	PasswordChangedAt time.Time // zero if the password was never changed
+	TokenVersion      int       // incremented with every password change; tokens carry the version they were issued for
+	TOTPSecret        string    // set once enrollment has started
+	TOTPEnabled       bool
+	Role              string
+	IsBot             bool
+}
+
+// Session is a login of a user on one device, identified by the token's sid claim
+type Session struct {
+	ID         string
+	Username   string
+	UserAgent  string
+	IPAddress  string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+	RevokedAt  time.Time // zero while the session is active
+}
+
+// APIKey is a long-lived credential of a bot user. Only a hash of the key is stored.
+type APIKey struct {
+	ID         int64
+	Username   string
+	Name       string
+	Prefix     string // first characters of the key, shown so users can tell keys apart
+	KeyHash    string
+	Scopes     []string
+	CreatedBy  string
+	CreatedAt  time.Time
+	LastUsedAt time.Time // zero if the key was never used
+	RevokedAt  time.Time // zero while the key is active
 }
 
 // UserRepository defines the interface for user data access
 type UserRepository interface {
-	CreateUser(username, password string) error
+	CreateUser(username, email, password string) error
 	GetUser(username string) (*User, error)
+	GetUserByEmail(email string) (*User, error)
+	GetUserByIdentity(issuer, subject string) (*User, error)
+	CreateExternalUser(username, email string, emailVerified bool) error
+	LinkIdentity(issuer, subject, username string) error
+	SetRole(username, role string) error
 	ValidatePassword(username, password string) bool
+	UpdatePassword(username, password string) error
+
+	CreatePasswordReset(username, tokenHash string, expiresAt time.Time) error
+	GetPasswordReset(tokenHash string) (string, error)
+	ConsumePasswordReset(tokenHash string) (string, error)
+
+	CreateEmailVerification(username, email, tokenHash string, expiresAt time.Time) error
+	ConsumeEmailVerification(tokenHash string) (string, error)
+
+	SetTOTP(username, secret string, enabled bool) error
+	UseTOTPStep(username string, step uint64) (bool, error)
+	ReplaceRecoveryCodes(username string, codeHashes []string) error
+	ConsumeRecoveryCode(username, codeHash string) (bool, error)
+
+	CreateSession(session *Session) error
+	GetSession(id string) (*Session, error)
+	TouchSession(id string) error
+	ListSessions(username string) ([]Session, error)
+	RevokeSession(username, id string) (bool, error)
+	RevokeUserSessions(username string) error
+
+	CreateBotUser(username string) error
+	CreateAPIKey(key *APIKey) (int64, error)
+	GetAPIKeyByHash(keyHash string) (*APIKey, error)
+	ListAPIKeys(username string) ([]APIKey, error)
+	RevokeAPIKey(id int64) (bool, error)
+	TouchAPIKey(id int64) error
 }
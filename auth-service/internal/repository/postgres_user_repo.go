@@ -3,23 +3,27 @@ package repository
 import (
 	"database/sql"
 	"errors"
+	"log"
+	"strings"
+	"time"
 
 	_ "github.com/lib/pq"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/meetohin/web-chat/auth-service/internal/password"
 )
 
 // PostgreSQLUserRepository implements UserRepository interface
 type PostgreSQLUserRepository struct {
-	db *sql.DB
+	db     *sql.DB
+	hasher *password.Hasher
 }
 
 // NewPostgreSQLUserRepository creates a new PostgreSQL user repository
-func NewPostgreSQLUserRepository(db *sql.DB) UserRepository {
-	return &PostgreSQLUserRepository{db: db}
+func NewPostgreSQLUserRepository(db *sql.DB, hasher *password.Hasher) UserRepository {
+	return &PostgreSQLUserRepository{db: db, hasher: hasher}
 }
 
-// CreateUser creates a new user in the repository
-func (r *PostgreSQLUserRepository) CreateUser(username, password string) error {
+// CreateUser creates a new user in the repository. The email is optional.
+func (r *PostgreSQLUserRepository) CreateUser(username, email, password string) error {
 	// Check if user already exists
 	var exists bool
 	err := r.db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE username = $1)", username).Scan(&exists)
@@ -30,27 +34,79 @@ func (r *PostgreSQLUserRepository) CreateUser(username, password string) error {
 		return errors.New("user already exists")
 	}
 
+	if email != "" {
+		err = r.db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE LOWER(email) = LOWER($1))", email).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return errors.New("email already in use")
+		}
+	}
+
 	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := r.hasher.Hash(password)
 	if err != nil {
 		return err
 	}
 
 	// Insert user
 	_, err = r.db.Exec(
-		"INSERT INTO users (username, password, created_at) VALUES ($1, $2, NOW())",
-		username, string(hashedPassword),
+		"INSERT INTO users (username, email, password, created_at) VALUES ($1, $2, $3, NOW())",
+		username, sql.NullString{String: email, Valid: email != ""}, hashedPassword,
+	)
+	return err
+}
+
+// CreateExternalUser creates a user that signs in through an identity provider.
+// The stored password is not a valid hash, so password logins are impossible.
+func (r *PostgreSQLUserRepository) CreateExternalUser(username, email string, emailVerified bool) error {
+	_, err := r.db.Exec(
+		"INSERT INTO users (username, email, email_verified, password, created_at) VALUES ($1, $2, $3, '!', NOW())",
+		username, sql.NullString{String: email, Valid: email != ""}, emailVerified,
+	)
+	return err
+}
+
+// LinkIdentity binds an external identity provider account to a user
+func (r *PostgreSQLUserRepository) LinkIdentity(issuer, subject, username string) error {
+	_, err := r.db.Exec(
+		"INSERT INTO user_identities (issuer, subject, username, created_at) VALUES ($1, $2, $3, NOW())",
+		issuer, subject, username,
 	)
 	return err
 }
 
+// SetRole changes the user's role
+func (r *PostgreSQLUserRepository) SetRole(username, role string) error {
+	_, err := r.db.Exec("UPDATE users SET role = $1 WHERE username = $2", role, username)
+	return err
+}
+
 // GetUser retrieves a user by username
 func (r *PostgreSQLUserRepository) GetUser(username string) (*User, error) {
+	return r.getUser("username = $1", username)
+}
+
+// GetUserByIdentity retrieves the user linked to an external identity provider account
+func (r *PostgreSQLUserRepository) GetUserByIdentity(issuer, subject string) (*User, error) {
+	return r.getUser("username = (SELECT username FROM user_identities WHERE issuer = $1 AND subject = $2)", issuer, subject)
+}
+
+// GetUserByEmail retrieves a user by email address, ignoring case
+func (r *PostgreSQLUserRepository) GetUserByEmail(email string) (*User, error) {
+	return r.getUser("LOWER(email) = LOWER($1)", email)
+}
+
+func (r *PostgreSQLUserRepository) getUser(condition string, args ...interface{}) (*User, error) {
 	user := &User{}
+	var email, totpSecret sql.NullString
+	var passwordChangedAt sql.NullTime
 	err := r.db.QueryRow(
-		"SELECT username, password FROM users WHERE username = $1",
-		username,
-	).Scan(&user.Username, &user.Password)
+		`SELECT username, password, email, email_verified, password_changed_at, token_version, totp_secret, totp_enabled, role, is_bot
+         FROM users WHERE `+condition,
+		args...,
+	).Scan(&user.Username, &user.Password, &email, &user.EmailVerified, &passwordChangedAt, &user.TokenVersion, &totpSecret, &user.TOTPEnabled, &user.Role, &user.IsBot)
 
 	if err == sql.ErrNoRows {
 		return nil, errors.New("user not found")
@@ -58,19 +114,428 @@ func (r *PostgreSQLUserRepository) GetUser(username string) (*User, error) {
 	if err != nil {
 		return nil, err
 	}
+	user.Email = email.String
+	user.PasswordChangedAt = passwordChangedAt.Time
+	user.TOTPSecret = totpSecret.String
 
 	return user, nil
 }
 
-// ValidatePassword validates a user's password
+// ValidatePassword validates a user's password. Hashes made with an outdated
+// algorithm or cost are transparently replaced after a successful check.
 func (r *PostgreSQLUserRepository) ValidatePassword(username, password string) bool {
 	user, err := r.GetUser(username)
 	if err != nil {
 		return false
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
-	return err == nil
+	ok, needsRehash := r.hasher.Verify(user.Password, password)
+	if ok && needsRehash {
+		if err := r.rehashPassword(username, user.Password, password); err != nil {
+			log.Printf("Failed to upgrade password hash for %s: %v", username, err)
+		}
+	}
+	return ok
+}
+
+// rehashPassword stores a new hash of an unchanged password. Unlike UpdatePassword
+// it keeps the token version, so existing tokens stay valid.
+func (r *PostgreSQLUserRepository) rehashPassword(username, oldHash, password string) error {
+	hashedPassword, err := r.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	// Guard against overwriting a password changed concurrently
+	_, err = r.db.Exec(
+		"UPDATE users SET password = $1 WHERE username = $2 AND password = $3",
+		hashedPassword, username, oldHash,
+	)
+	return err
+}
+
+// UpdatePassword replaces a user's password, records when it was changed and bumps the
+// token version, which revokes all tokens issued before
+func (r *PostgreSQLUserRepository) UpdatePassword(username, password string) error {
+	hashedPassword, err := r.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.db.Exec(
+		"UPDATE users SET password = $1, password_changed_at = NOW(), token_version = token_version + 1 WHERE username = $2",
+		hashedPassword, username,
+	)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return errors.New("user not found")
+	}
+	return nil
+}
+
+// CreatePasswordReset stores a hashed password reset token
+func (r *PostgreSQLUserRepository) CreatePasswordReset(username, tokenHash string, expiresAt time.Time) error {
+	_, err := r.db.Exec(
+		"INSERT INTO password_resets (token_hash, username, expires_at, created_at) VALUES ($1, $2, $3, NOW())",
+		tokenHash, username, expiresAt,
+	)
+	return err
+}
+
+// GetPasswordReset returns the owner of an unused, unexpired reset token without consuming it
+func (r *PostgreSQLUserRepository) GetPasswordReset(tokenHash string) (string, error) {
+	var username string
+	err := r.db.QueryRow(
+		"SELECT username FROM password_resets WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()",
+		tokenHash,
+	).Scan(&username)
+
+	if err == sql.ErrNoRows {
+		return "", errors.New("invalid or expired reset token")
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return username, nil
+}
+
+// ConsumePasswordReset marks an unexpired reset token as used and returns its owner.
+// A token can be consumed only once.
+func (r *PostgreSQLUserRepository) ConsumePasswordReset(tokenHash string) (string, error) {
+	var username string
+	err := r.db.QueryRow(
+		`UPDATE password_resets SET used_at = NOW()
+         WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+         RETURNING username`,
+		tokenHash,
+	).Scan(&username)
+
+	if err == sql.ErrNoRows {
+		return "", errors.New("invalid or expired reset token")
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return username, nil
+}
+
+// CreateEmailVerification stores a hashed email verification token
+func (r *PostgreSQLUserRepository) CreateEmailVerification(username, email, tokenHash string, expiresAt time.Time) error {
+	_, err := r.db.Exec(
+		"INSERT INTO email_verifications (token_hash, username, email, expires_at, created_at) VALUES ($1, $2, $3, $4, NOW())",
+		tokenHash, username, email, expiresAt,
+	)
+	return err
+}
+
+// ConsumeEmailVerification marks the user's email as verified if the token is valid
+// and still matches the address on file. It returns the user's username.
+func (r *PostgreSQLUserRepository) ConsumeEmailVerification(tokenHash string) (string, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var username, email string
+	err = tx.QueryRow(
+		`UPDATE email_verifications SET used_at = NOW()
+         WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+         RETURNING username, email`,
+		tokenHash,
+	).Scan(&username, &email)
+
+	if err == sql.ErrNoRows {
+		return "", errors.New("invalid or expired verification token")
+	}
+	if err != nil {
+		return "", err
+	}
+
+	result, err := tx.Exec(
+		"UPDATE users SET email_verified = TRUE WHERE username = $1 AND LOWER(email) = LOWER($2)",
+		username, email,
+	)
+	if err != nil {
+		return "", err
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return "", errors.New("invalid or expired verification token")
+	}
+
+	return username, tx.Commit()
+}
+
+// SetTOTP stores the user's TOTP secret. An empty secret removes two-factor authentication.
+func (r *PostgreSQLUserRepository) SetTOTP(username, secret string, enabled bool) error {
+	_, err := r.db.Exec(
+		"UPDATE users SET totp_secret = $1, totp_enabled = $2 WHERE username = $3",
+		sql.NullString{String: secret, Valid: secret != ""}, enabled, username,
+	)
+	return err
+}
+
+// UseTOTPStep records that a code of the given time step was accepted. It returns false
+// if a code of that step or a later one was accepted before, so every code works once.
+func (r *PostgreSQLUserRepository) UseTOTPStep(username string, step uint64) (bool, error) {
+	result, err := r.db.Exec(
+		"UPDATE users SET totp_last_step = $1 WHERE username = $2 AND (totp_last_step IS NULL OR totp_last_step < $1)",
+		int64(step), username,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// ReplaceRecoveryCodes discards the user's recovery codes and stores new hashed ones
+func (r *PostgreSQLUserRepository) ReplaceRecoveryCodes(username string, codeHashes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE username = $1", username); err != nil {
+		return err
+	}
+	for _, hash := range codeHashes {
+		_, err := tx.Exec(
+			"INSERT INTO recovery_codes (username, code_hash, created_at) VALUES ($1, $2, NOW())",
+			username, hash,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ConsumeRecoveryCode marks an unused recovery code as used and reports whether it was valid
+func (r *PostgreSQLUserRepository) ConsumeRecoveryCode(username, codeHash string) (bool, error) {
+	result, err := r.db.Exec(
+		"UPDATE recovery_codes SET used_at = NOW() WHERE username = $1 AND code_hash = $2 AND used_at IS NULL",
+		username, codeHash,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// CreateSession stores a new login session
+func (r *PostgreSQLUserRepository) CreateSession(session *Session) error {
+	_, err := r.db.Exec(
+		`INSERT INTO sessions (id, username, user_agent, ip_address, created_at, last_seen_at, expires_at)
+         VALUES ($1, $2, $3, $4, NOW(), NOW(), $5)`,
+		session.ID, session.Username, session.UserAgent, session.IPAddress, session.ExpiresAt,
+	)
+	return err
+}
+
+// GetSession retrieves a session by ID, including revoked and expired ones
+func (r *PostgreSQLUserRepository) GetSession(id string) (*Session, error) {
+	var session Session
+	var revokedAt sql.NullTime
+	err := r.db.QueryRow(
+		`SELECT id, username, user_agent, ip_address, created_at, last_seen_at, expires_at, revoked_at
+         FROM sessions WHERE id = $1`,
+		id,
+	).Scan(&session.ID, &session.Username, &session.UserAgent, &session.IPAddress,
+		&session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt, &revokedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, errors.New("session not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	session.RevokedAt = revokedAt.Time
+	return &session, nil
+}
+
+// TouchSession records that the session was just used. Updates are limited
+// to one per minute so frequent token checks do not turn into writes.
+func (r *PostgreSQLUserRepository) TouchSession(id string) error {
+	_, err := r.db.Exec(
+		"UPDATE sessions SET last_seen_at = NOW() WHERE id = $1 AND last_seen_at < NOW() - INTERVAL '1 minute'",
+		id,
+	)
+	return err
+}
+
+// ListSessions returns the active sessions of a user, most recently used first
+func (r *PostgreSQLUserRepository) ListSessions(username string) ([]Session, error) {
+	rows, err := r.db.Query(
+		`SELECT id, username, user_agent, ip_address, created_at, last_seen_at, expires_at
+         FROM sessions
+         WHERE username = $1 AND revoked_at IS NULL AND expires_at > NOW()
+         ORDER BY last_seen_at DESC`,
+		username,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		var session Session
+		if err := rows.Scan(&session.ID, &session.Username, &session.UserAgent, &session.IPAddress,
+			&session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// RevokeSession revokes an active session of the user and reports whether it existed
+func (r *PostgreSQLUserRepository) RevokeSession(username, id string) (bool, error) {
+	result, err := r.db.Exec(
+		"UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND username = $2 AND revoked_at IS NULL",
+		id, username,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// RevokeUserSessions revokes all active sessions of the user
+func (r *PostgreSQLUserRepository) RevokeUserSessions(username string) error {
+	_, err := r.db.Exec(
+		"UPDATE sessions SET revoked_at = NOW() WHERE username = $1 AND revoked_at IS NULL",
+		username,
+	)
+	return err
+}
+
+// CreateBotUser creates a bot account. Bots cannot log in with a password and authenticate with API keys only.
+func (r *PostgreSQLUserRepository) CreateBotUser(username string) error {
+	_, err := r.GetUser(username)
+	if err == nil {
+		return errors.New("user already exists")
+	}
+
+	_, err = r.db.Exec(
+		"INSERT INTO users (username, password, is_bot, created_at) VALUES ($1, '!', TRUE, NOW())",
+		username,
+	)
+	return err
+}
+
+// CreateAPIKey stores a new API key and returns its ID
+func (r *PostgreSQLUserRepository) CreateAPIKey(key *APIKey) (int64, error) {
+	var id int64
+	err := r.db.QueryRow(
+		`INSERT INTO api_keys (username, name, prefix, key_hash, scopes, created_by, created_at)
+         VALUES ($1, $2, $3, $4, $5, $6, NOW())
+         RETURNING id`,
+		key.Username, key.Name, key.Prefix, key.KeyHash, strings.Join(key.Scopes, ","), key.CreatedBy,
+	).Scan(&id)
+	return id, err
+}
+
+// GetAPIKeyByHash retrieves an API key by the hash of its value, including revoked keys
+func (r *PostgreSQLUserRepository) GetAPIKeyByHash(keyHash string) (*APIKey, error) {
+	rows, err := r.db.Query(
+		`SELECT id, username, name, prefix, key_hash, scopes, created_by, created_at, last_used_at, revoked_at
+         FROM api_keys WHERE key_hash = $1`,
+		keyHash,
+	)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := scanAPIKeys(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("api key not found")
+	}
+	return &keys[0], nil
+}
+
+// ListAPIKeys returns all API keys of a user, newest first
+func (r *PostgreSQLUserRepository) ListAPIKeys(username string) ([]APIKey, error) {
+	rows, err := r.db.Query(
+		`SELECT id, username, name, prefix, key_hash, scopes, created_by, created_at, last_used_at, revoked_at
+         FROM api_keys WHERE username = $1 ORDER BY created_at DESC`,
+		username,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanAPIKeys(rows)
+}
+
+func scanAPIKeys(rows *sql.Rows) ([]APIKey, error) {
+	defer rows.Close()
+
+	var keys []APIKey
+	for rows.Next() {
+		var key APIKey
+		var scopes string
+		var lastUsedAt, revokedAt sql.NullTime
+		if err := rows.Scan(&key.ID, &key.Username, &key.Name, &key.Prefix, &key.KeyHash, &scopes,
+			&key.CreatedBy, &key.CreatedAt, &lastUsedAt, &revokedAt); err != nil {
+			return nil, err
+		}
+		if scopes != "" {
+			key.Scopes = strings.Split(scopes, ",")
+		}
+		key.LastUsedAt = lastUsedAt.Time
+		key.RevokedAt = revokedAt.Time
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey revokes an active API key and reports whether it existed
+func (r *PostgreSQLUserRepository) RevokeAPIKey(id int64) (bool, error) {
+	result, err := r.db.Exec("UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL", id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// TouchAPIKey records that the key was just used, at most once per minute
+func (r *PostgreSQLUserRepository) TouchAPIKey(id int64) error {
+	_, err := r.db.Exec(
+		"UPDATE api_keys SET last_used_at = NOW() WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')",
+		id,
+	)
+	return err
 }
 
 // CreateTables initializes the repository schema
@@ -83,6 +548,83 @@ func (r *PostgreSQLUserRepository) CreateTables() error {
         created_at TIMESTAMP DEFAULT NOW()
     );
     CREATE INDEX IF NOT EXISTS idx_users_username ON users(username);
+    ALTER TABLE users ADD COLUMN IF NOT EXISTS password_changed_at TIMESTAMP;
+    ALTER TABLE users ADD COLUMN IF NOT EXISTS email VARCHAR(255);
+    ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+    CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_unique ON users(LOWER(email));
+    ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret VARCHAR(64);
+    ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+    ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_step BIGINT;
+    ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'user';
+    ALTER TABLE users ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT FALSE;
+    -- Tokens without a version predate it; revoke them for users who have changed their password since
+    DO $$ BEGIN
+        IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'users' AND column_name = 'token_version') THEN
+            ALTER TABLE users ADD COLUMN token_version INTEGER NOT NULL DEFAULT 0;
+            UPDATE users SET token_version = 1 WHERE password_changed_at IS NOT NULL;
+        END IF;
+    END $$;
+
+    CREATE TABLE IF NOT EXISTS password_resets (
+        token_hash VARCHAR(64) PRIMARY KEY,
+        username VARCHAR(50) NOT NULL,
+        expires_at TIMESTAMP NOT NULL,
+        used_at TIMESTAMP,
+        created_at TIMESTAMP DEFAULT NOW()
+    );
+    CREATE INDEX IF NOT EXISTS idx_password_resets_username ON password_resets(username);
+
+    CREATE TABLE IF NOT EXISTS email_verifications (
+        token_hash VARCHAR(64) PRIMARY KEY,
+        username VARCHAR(50) NOT NULL,
+        email VARCHAR(255) NOT NULL,
+        expires_at TIMESTAMP NOT NULL,
+        used_at TIMESTAMP,
+        created_at TIMESTAMP DEFAULT NOW()
+    );
+
+    CREATE TABLE IF NOT EXISTS recovery_codes (
+        id SERIAL PRIMARY KEY,
+        username VARCHAR(50) NOT NULL,
+        code_hash VARCHAR(64) NOT NULL,
+        used_at TIMESTAMP,
+        created_at TIMESTAMP DEFAULT NOW()
+    );
+    CREATE INDEX IF NOT EXISTS idx_recovery_codes_username ON recovery_codes(username);
+
+    CREATE TABLE IF NOT EXISTS user_identities (
+        issuer VARCHAR(255) NOT NULL,
+        subject VARCHAR(255) NOT NULL,
+        username VARCHAR(50) NOT NULL,
+        created_at TIMESTAMP DEFAULT NOW(),
+        PRIMARY KEY (issuer, subject)
+    );
+
+    CREATE TABLE IF NOT EXISTS sessions (
+        id VARCHAR(64) PRIMARY KEY,
+        username VARCHAR(50) NOT NULL,
+        user_agent VARCHAR(512) NOT NULL DEFAULT '',
+        ip_address VARCHAR(64) NOT NULL DEFAULT '',
+        created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+        last_seen_at TIMESTAMP NOT NULL DEFAULT NOW(),
+        expires_at TIMESTAMP NOT NULL,
+        revoked_at TIMESTAMP
+    );
+    CREATE INDEX IF NOT EXISTS idx_sessions_username ON sessions(username);
+
+    CREATE TABLE IF NOT EXISTS api_keys (
+        id SERIAL PRIMARY KEY,
+        username VARCHAR(50) NOT NULL,
+        name VARCHAR(100) NOT NULL,
+        prefix VARCHAR(16) NOT NULL,
+        key_hash VARCHAR(64) UNIQUE NOT NULL,
+        scopes TEXT NOT NULL DEFAULT '',
+        created_by VARCHAR(50) NOT NULL,
+        created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+        last_used_at TIMESTAMP,
+        revoked_at TIMESTAMP
+    );
+    CREATE INDEX IF NOT EXISTS idx_api_keys_username ON api_keys(username);
     `
 	_, err := r.db.Exec(query)
 	return err
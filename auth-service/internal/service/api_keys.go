@@ -0,0 +1,168 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/meetohin/web-chat/auth-service/internal/repository"
+)
+
+// API key scopes
+const (
+	ScopeMessagesRead  = "messages:read"
+	ScopeMessagesWrite = "messages:write"
+)
+
+var validScopes = map[string]bool{
+	ScopeMessagesRead:  true,
+	ScopeMessagesWrite: true,
+}
+
+const (
+	// apiKeyPrefix marks API keys, so they are never mistaken for JWT tokens
+	apiKeyPrefix       = "wck_"
+	apiKeyDisplayChars = 12
+)
+
+// IsAPIKey reports whether the token looks like an API key rather than a JWT
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyPrefix)
+}
+
+// CreateBot creates a bot account. Only admins may call it.
+func (s *AuthService) CreateBot(adminToken, username string) error {
+	admin, err := s.requireAdmin(adminToken)
+	if err != nil {
+		return err
+	}
+	if err := validateUsername(username); err != nil {
+		return err
+	}
+
+	if err := s.userRepo.CreateBotUser(username); err != nil {
+		return err
+	}
+
+	log.Printf("Bot %s created by %s", username, admin.Username)
+	return nil
+}
+
+// CreateAPIKey issues a new key for a bot. The returned key is not stored and cannot be shown again.
+func (s *AuthService) CreateAPIKey(adminToken, botUsername, name string, scopes []string) (string, *repository.APIKey, error) {
+	admin, err := s.requireAdmin(adminToken)
+	if err != nil {
+		return "", nil, err
+	}
+
+	bot, err := s.userRepo.GetUser(botUsername)
+	if err != nil {
+		return "", nil, err
+	}
+	if !bot.IsBot {
+		return "", nil, errors.New("api keys can only be issued to bots")
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		return "", nil, errors.New("key name must be between 1 and 100 characters")
+	}
+	if len(scopes) == 0 {
+		return "", nil, errors.New("at least one scope required")
+	}
+	for _, scope := range scopes {
+		if !validScopes[scope] {
+			return "", nil, fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+	key := apiKeyPrefix + hex.EncodeToString(secret)
+
+	apiKey := &repository.APIKey{
+		Username:  bot.Username,
+		Name:      name,
+		Prefix:    key[:apiKeyDisplayChars],
+		KeyHash:   hashToken(key),
+		Scopes:    scopes,
+		CreatedBy: admin.Username,
+		CreatedAt: time.Now(),
+	}
+	if apiKey.ID, err = s.userRepo.CreateAPIKey(apiKey); err != nil {
+		return "", nil, err
+	}
+
+	log.Printf("API key %d for %s created by %s", apiKey.ID, bot.Username, admin.Username)
+	return key, apiKey, nil
+}
+
+// ListAPIKeys returns all keys of a bot, including revoked ones. Only admins may call it.
+func (s *AuthService) ListAPIKeys(adminToken, botUsername string) ([]repository.APIKey, error) {
+	if _, err := s.requireAdmin(adminToken); err != nil {
+		return nil, err
+	}
+	return s.userRepo.ListAPIKeys(botUsername)
+}
+
+// RevokeAPIKey revokes a key immediately. Only admins may call it.
+func (s *AuthService) RevokeAPIKey(adminToken string, id int64) error {
+	admin, err := s.requireAdmin(adminToken)
+	if err != nil {
+		return err
+	}
+
+	revoked, err := s.userRepo.RevokeAPIKey(id)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return errors.New("api key not found")
+	}
+
+	log.Printf("API key %d revoked by %s", id, admin.Username)
+	return nil
+}
+
+// validateAPIKey checks an API key and returns the identity of its bot
+func (s *AuthService) validateAPIKey(key string) (*Identity, error) {
+	apiKey, err := s.userRepo.GetAPIKeyByHash(hashToken(key))
+	if err != nil || !apiKey.RevokedAt.IsZero() {
+		return nil, errors.New("invalid api key")
+	}
+
+	user, err := s.userRepo.GetUser(apiKey.Username)
+	if err != nil || !user.IsBot {
+		return nil, errors.New("invalid api key")
+	}
+
+	if err := s.userRepo.TouchAPIKey(apiKey.ID); err != nil {
+		log.Printf("Failed to update last use of api key %d: %v", apiKey.ID, err)
+	}
+
+	return &Identity{
+		Username: user.Username,
+		Role:     user.Role,
+		Bot:      true,
+		Scopes:   apiKey.Scopes,
+		APIKeyID: apiKey.ID,
+	}, nil
+}
+
+// requireAdmin authenticates a user token and checks that its owner is an admin
+func (s *AuthService) requireAdmin(token string) (*Identity, error) {
+	identity, err := s.authenticate(token)
+	if err != nil {
+		return nil, err
+	}
+	if !s.IsAdmin(identity) {
+		return nil, errors.New("permission denied")
+	}
+	return identity, nil
+}
@@ -2,45 +2,215 @@ package service
 
 import (
 	"errors"
+	"log"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/meetohin/web-chat/auth-service/internal/mailer"
+	"github.com/meetohin/web-chat/auth-service/internal/password"
 	"github.com/meetohin/web-chat/auth-service/internal/repository"
 )
 
 var jwtSecret = []byte(getJWTSecret())
 
+// Config holds tunable settings of the auth service
+type Config struct {
+	PasswordPolicy   password.Policy
+	LoginThrottle    LoginThrottleConfig
+	AdminUsers       []string
+	Mailer           mailer.Mailer
+	PasswordResetTTL time.Duration
+	PasswordResetURL string // link sent to users, the reset token is appended as ?token=
+	EmailVerifyTTL   time.Duration
+	EmailVerifyURL   string      // link sent to users, the verification token is appended as ?token=
+	TOTPIssuer       string      // shown in authenticator apps
+	OIDC             *OIDCConfig // nil disables single sign-on
+}
+
+// Roles a user can have
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Identity describes the owner of a valid token
+type Identity struct {
+	Username      string
+	Email         string
+	EmailVerified bool
+	Role          string
+	SessionID     string   // empty for tokens issued before sessions were tracked
+	Bot           bool     // authenticated with an API key
+	Scopes        []string // what an API key may do; empty for user tokens, which are not restricted
+	APIKeyID      int64
+}
+
 // AuthService handles authentication business logic
 type AuthService struct {
-	userRepo repository.UserRepository
+	userRepo         repository.UserRepository
+	passwordPolicy   password.Policy
+	throttle         *LoginThrottle
+	touches          *sessionTouches
+	admins           map[string]bool
+	mailer           mailer.Mailer
+	passwordResetTTL time.Duration
+	passwordResetURL string
+	emailVerifyTTL   time.Duration
+	emailVerifyURL   string
+	totpIssuer       string
+	oidc             *OIDCConfig
 }
 
 // NewAuthService creates a new auth service
-func NewAuthService(userRepo repository.UserRepository) *AuthService {
+func NewAuthService(userRepo repository.UserRepository, cfg Config) *AuthService {
+	admins := make(map[string]bool, len(cfg.AdminUsers))
+	for _, username := range cfg.AdminUsers {
+		admins[username] = true
+	}
+
+	if cfg.Mailer == nil {
+		cfg.Mailer = mailer.NewLogMailer()
+	}
+	if cfg.PasswordResetTTL <= 0 {
+		cfg.PasswordResetTTL = time.Hour
+	}
+	if cfg.EmailVerifyTTL <= 0 {
+		cfg.EmailVerifyTTL = 48 * time.Hour
+	}
+	if cfg.TOTPIssuer == "" {
+		cfg.TOTPIssuer = "Web Chat"
+	}
+
 	return &AuthService{
-		userRepo: userRepo,
+		userRepo:         userRepo,
+		passwordPolicy:   cfg.PasswordPolicy,
+		throttle:         NewLoginThrottle(cfg.LoginThrottle),
+		touches:          newSessionTouches(),
+		admins:           admins,
+		mailer:           cfg.Mailer,
+		passwordResetTTL: cfg.PasswordResetTTL,
+		passwordResetURL: cfg.PasswordResetURL,
+		emailVerifyTTL:   cfg.EmailVerifyTTL,
+		emailVerifyURL:   cfg.EmailVerifyURL,
+		totpIssuer:       cfg.TOTPIssuer,
+		oidc:             cfg.OIDC,
 	}
 }
 
-// Register creates a new user account
-func (s *AuthService) Register(username, password string) error {
-	if len(username) < 3 || len(password) < 6 {
-		return errors.New("username must be at least 3 characters and password at least 6 characters")
+// Register creates a new user account. If an email is given, a verification link is sent to it.
+func (s *AuthService) Register(username, email, password string) error {
+	if err := validateUsername(username); err != nil {
+		return err
+	}
+	if err := s.passwordPolicy.Validate(username, password); err != nil {
+		return err
+	}
+
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return err
+	}
+
+	if err := s.userRepo.CreateUser(username, email, password); err != nil {
+		return err
 	}
 
-	return s.userRepo.CreateUser(username, password)
+	if email != "" {
+		if err := s.sendVerification(username, email); err != nil {
+			// The account exists already; the user can ask for another link later
+			log.Printf("Failed to send verification email to %s: %v", username, err)
+		}
+	}
+	return nil
 }
 
-// Login authenticates a user and returns a JWT token
-func (s *AuthService) Login(username, password string) (string, error) {
+// validateUsername checks the rules shared by all account names
+func validateUsername(username string) error {
+	if len(username) < 3 {
+		return errors.New("username must be at least 3 characters")
+	}
+	if strings.Contains(username, "@") {
+		return errors.New("username must not contain '@'")
+	}
+	return nil
+}
+
+// LoginResult is the outcome of a successful password check
+type LoginResult struct {
+	Token          string // set when the login is complete
+	ChallengeToken string // set when a second factor is still required, see CompleteLogin
+}
+
+// Login authenticates a user by username or email. Users with two-factor
+// authentication get a challenge token instead of a JWT token.
+// Repeated failures for the same username or client IP are throttled.
+func (s *AuthService) Login(login, password string, client ClientInfo) (*LoginResult, error) {
+	username := s.resolveUsername(login)
+
+	if err := s.throttle.Attempt(username, client.IP); err != nil {
+		return nil, err
+	}
+
 	if !s.userRepo.ValidatePassword(username, password) {
-		return "", errors.New("invalid credentials")
+		return nil, errors.New("invalid credentials")
+	}
+
+	user, err := s.userRepo.GetUser(username)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TOTPEnabled {
+		// Failures are only cleared once the second factor is passed too
+		s.throttle.Release(username, client.IP)
+		challenge, err := s.issueChallenge(user.Username)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{ChallengeToken: challenge}, nil
+	}
+
+	s.throttle.RecordSuccess(username, client.IP)
+
+	token, err := s.issueToken(user.Username, client)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{Token: token}, nil
+}
+
+// resolveUsername maps an email address to its owner's username. Anything else is returned as is.
+func (s *AuthService) resolveUsername(login string) string {
+	if !strings.Contains(login, "@") {
+		return login
+	}
+	user, err := s.userRepo.GetUserByEmail(login)
+	if err != nil {
+		return login
 	}
+	return user.Username
+}
 
+// issueToken starts a new session and creates a signed JWT for it
+func (s *AuthService) issueToken(username string, client ClientInfo) (string, error) {
+	user, err := s.userRepo.GetUser(username)
+	if err != nil {
+		return "", err
+	}
+	sessionID, err := s.createSession(username, client)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"username": username,
-		"exp":      time.Now().Add(time.Hour * 24).Unix(),
+		"sid":      sessionID,
+		"ver":      user.TokenVersion,
+		"iat":      now.Unix(),
+		"exp":      now.Add(tokenTTL).Unix(),
 	})
 
 	tokenString, err := token.SignedString(jwtSecret)
@@ -51,25 +221,89 @@ func (s *AuthService) Login(username, password string) (string, error) {
 	return tokenString, nil
 }
 
-// ValidateToken validates a JWT token and returns the username
-func (s *AuthService) ValidateToken(tokenString string) (string, error) {
+// ValidateToken validates a JWT token or a bot's API key and returns the identity of its owner
+func (s *AuthService) ValidateToken(tokenString string) (*Identity, error) {
+	if IsAPIKey(tokenString) {
+		return s.validateAPIKey(tokenString)
+	}
+	return s.authenticate(tokenString)
+}
+
+// authenticate validates a user's JWT token. API keys are rejected, so bots
+// cannot manage accounts, sessions or other users.
+func (s *AuthService) authenticate(tokenString string) (*Identity, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		return jwtSecret, nil
 	})
 
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
 		username, ok := claims["username"].(string)
 		if !ok {
-			return "", errors.New("invalid token claims")
+			return nil, errors.New("invalid token claims")
+		}
+		if _, ok := claims["purpose"]; ok {
+			// Challenge tokens do not grant access
+			return nil, errors.New("invalid token")
+		}
+
+		// Tokens issued before the last password change carry an older version and are revoked
+		user, err := s.userRepo.GetUser(username)
+		if err != nil {
+			return nil, err
+		}
+		version, _ := claims["ver"].(float64) // tokens from before versions count as 0
+		if int(version) != user.TokenVersion {
+			return nil, errors.New("token revoked")
 		}
-		return username, nil
+
+		sessionID, _ := claims["sid"].(string)
+		if sessionID != "" {
+			if err := s.checkSession(sessionID, user.Username); err != nil {
+				return nil, err
+			}
+		}
+
+		return &Identity{
+			Username:      user.Username,
+			Email:         user.Email,
+			EmailVerified: user.EmailVerified,
+			Role:          user.Role,
+			SessionID:     sessionID,
+		}, nil
+	}
+
+	return nil, errors.New("invalid token")
+}
+
+// UnlockAccount clears login lockouts for a username and/or client IP. Only admins may call it.
+func (s *AuthService) UnlockAccount(adminToken, username, clientIP string) error {
+	if _, err := s.requireAdmin(adminToken); err != nil {
+		return err
 	}
 
-	return "", errors.New("invalid token")
+	if username == "" && clientIP == "" {
+		return errors.New("username or ip address required")
+	}
+	if username != "" {
+		s.throttle.Unlock(username)
+	}
+	if clientIP != "" {
+		s.throttle.UnlockIP(clientIP)
+	}
+	return nil
+}
+
+// IsAdmin reports whether the user has administrative rights, either through
+// the admin role or by being listed in the configured admin users. Bots are never admins.
+func (s *AuthService) IsAdmin(identity *Identity) bool {
+	if identity.Bot {
+		return false
+	}
+	return identity.Role == RoleAdmin || s.admins[identity.Username]
 }
 
 // getJWTSecret retrieves JWT secret from environment
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/meetohin/web-chat/auth-service/internal/mailer"
+)
+
+// VerifyEmail marks the email address bound to the verification token as verified
+func (s *AuthService) VerifyEmail(verificationToken string) error {
+	if verificationToken == "" {
+		return errors.New("verification token required")
+	}
+
+	_, err := s.userRepo.ConsumeEmailVerification(hashToken(verificationToken))
+	return err
+}
+
+// ResendVerification sends a new verification link to the email of the token's owner
+func (s *AuthService) ResendVerification(tokenString string) error {
+	identity, err := s.authenticate(tokenString)
+	if err != nil {
+		return err
+	}
+
+	if identity.Email == "" {
+		return errors.New("no email address on file")
+	}
+	if identity.EmailVerified {
+		return errors.New("email already verified")
+	}
+
+	return s.sendVerification(identity.Username, identity.Email)
+}
+
+// sendVerification creates a verification token for the address and mails the link to it
+func (s *AuthService) sendVerification(username, email string) error {
+	token, err := generateToken()
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().Add(s.emailVerifyTTL)
+	if err := s.userRepo.CreateEmailVerification(username, email, hashToken(token), expiresAt); err != nil {
+		return err
+	}
+
+	return s.mailer.Send(mailer.Message{
+		To:      email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Welcome, %s!\n\n"+
+			"Please confirm your email address by opening the following link (valid until %s):\n%s",
+			username, expiresAt.Format(time.RFC1123), tokenLink(s.emailVerifyURL, token)),
+	})
+}
+
+// normalizeEmail validates an optional email address and returns it lower-cased
+func normalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return "", nil
+	}
+
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", errors.New("invalid email address")
+	}
+	return strings.ToLower(email), nil
+}
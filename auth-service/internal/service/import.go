@@ -0,0 +1,50 @@
+package service
+
+import (
+	"log"
+	"strings"
+)
+
+// ImportUser maps a user of another chat system to a local account for a history import.
+// Users are only matched by a verified email; a matching username or an unverified address
+// could belong to someone else, so neither attributes imported messages to a local account. Unmatched users get a
+// placeholder account without a password, which the owner can claim through a password
+// reset if an email address is known. Only admins may call it.
+func (s *AuthService) ImportUser(adminToken, username, email string) (string, bool, error) {
+	admin, err := s.requireAdmin(adminToken)
+	if err != nil {
+		return "", false, err
+	}
+
+	// Import sources are not always strict about addresses, an invalid one is ignored
+	email, err = normalizeEmail(email)
+	if err != nil {
+		email = ""
+	}
+
+	base := username
+	if base == "" {
+		base, _, _ = strings.Cut(email, "@")
+	}
+
+	if email != "" {
+		if existing, err := s.userRepo.GetUserByEmail(email); err == nil {
+			if existing.EmailVerified {
+				return existing.Username, false, nil
+			}
+			// Anyone can register with an address they do not own, so an unverified one
+			// neither gets the history nor can be given to the placeholder
+			email = ""
+		}
+	}
+	local, err := s.availableUsername(base)
+	if err != nil {
+		return "", false, err
+	}
+
+	if err := s.userRepo.CreateExternalUser(local, email, false); err != nil {
+		return "", false, err
+	}
+	log.Printf("Placeholder user %s created for import by %s", local, admin.Username)
+	return local, true, nil
+}
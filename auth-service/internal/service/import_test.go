@@ -0,0 +1,69 @@
+package service
+
+import (
+	"testing"
+)
+
+func newImportService(t *testing.T, users *memoryUsers) (*AuthService, string) {
+	t.Helper()
+
+	s := NewAuthService(users, Config{LoginThrottle: DefaultLoginThrottleConfig(), AdminUsers: []string{"admin"}})
+	if err := users.CreateUser("admin", "", "password"); err != nil {
+		t.Fatal(err)
+	}
+	token, err := s.issueToken("admin", ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, token
+}
+
+func TestImportUserMatchesVerifiedEmail(t *testing.T) {
+	users := newMemoryUsers()
+	s, token := newImportService(t, users)
+	users.CreateExternalUser("alice", "alice@example.com", true)
+
+	local, created, err := s.ImportUser(token, "alice.slack", "Alice@Example.com")
+	if err != nil {
+		t.Fatalf("ImportUser() error = %v", err)
+	}
+	if local != "alice" || created {
+		t.Errorf("ImportUser() = %q, created %v; want the existing alice", local, created)
+	}
+}
+
+func TestImportUserIgnoresUnverifiedEmail(t *testing.T) {
+	users := newMemoryUsers()
+	s, token := newImportService(t, users)
+	// Registered with the victim's address before the import, never verified
+	users.CreateExternalUser("mallory", "victim@example.com", false)
+
+	local, created, err := s.ImportUser(token, "victim", "victim@example.com")
+	if err != nil {
+		t.Fatalf("ImportUser() error = %v", err)
+	}
+	if local == "mallory" || !created {
+		t.Fatalf("ImportUser() = %q, created %v; want a new placeholder", local, created)
+	}
+	placeholder, err := users.GetUser(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if placeholder.Email != "" {
+		t.Errorf("placeholder got the unverified address %q", placeholder.Email)
+	}
+}
+
+func TestImportUserIgnoresUsername(t *testing.T) {
+	users := newMemoryUsers()
+	s, token := newImportService(t, users)
+	users.CreateExternalUser("bob", "", false)
+
+	local, created, err := s.ImportUser(token, "bob", "")
+	if err != nil {
+		t.Fatalf("ImportUser() error = %v", err)
+	}
+	if local == "bob" || !created {
+		t.Errorf("ImportUser() = %q, created %v; want a placeholder other than bob", local, created)
+	}
+}
@@ -0,0 +1,230 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// LoginThrottleConfig controls how failed login attempts are throttled
+type LoginThrottleConfig struct {
+	MaxUserAttempts int           // failures per username before lockout
+	MaxIPAttempts   int           // failures per client IP before lockout
+	BaseDelay       time.Duration // backoff after the first failure, doubled on each next one
+	MaxDelay        time.Duration // upper bound for the backoff
+	LockoutDuration time.Duration // how long a key stays locked after too many failures
+	AttemptWindow   time.Duration // failures older than this are forgotten
+}
+
+// DefaultLoginThrottleConfig returns the throttle settings used when nothing is configured
+func DefaultLoginThrottleConfig() LoginThrottleConfig {
+	return LoginThrottleConfig{
+		MaxUserAttempts: 5,
+		MaxIPAttempts:   20,
+		BaseDelay:       time.Second,
+		MaxDelay:        30 * time.Second,
+		LockoutDuration: 15 * time.Minute,
+		AttemptWindow:   15 * time.Minute,
+	}
+}
+
+// LoginThrottledError is returned when a login attempt is rejected without checking the password
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+func (e *LoginThrottledError) Error() string {
+	seconds := int(e.RetryAfter.Round(time.Second) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	if e.Locked {
+		return fmt.Sprintf("account temporarily locked due to too many failed login attempts, try again in %ds", seconds)
+	}
+	return fmt.Sprintf("too many failed login attempts, try again in %ds", seconds)
+}
+
+type attemptState struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// LoginThrottle tracks failed login attempts per username and per client IP
+type LoginThrottle struct {
+	cfg     LoginThrottleConfig
+	mu      sync.Mutex
+	entries map[string]*attemptState
+	now     func() time.Time
+}
+
+// NewLoginThrottle creates a new login throttle
+func NewLoginThrottle(cfg LoginThrottleConfig) *LoginThrottle {
+	return &LoginThrottle{
+		cfg:     cfg,
+		entries: make(map[string]*attemptState),
+		now:     time.Now,
+	}
+}
+
+// Attempt starts a login attempt for the username and IP. It returns a LoginThrottledError
+// if they may not attempt a login right now, and otherwise counts the attempt as a failure
+// in the same step, so parallel requests cannot all pass before the first failure is
+// recorded. Successful attempts are taken back with RecordSuccess or Release.
+func (t *LoginThrottle) Attempt(username, ip string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	var worst *LoginThrottledError
+	for _, key := range t.keys(username, ip) {
+		if err := t.check(key, now); err != nil && (worst == nil || err.RetryAfter > worst.RetryAfter) {
+			worst = err
+		}
+	}
+	if worst != nil {
+		return worst
+	}
+
+	t.prune(now)
+	userKey := userThrottleKey(username)
+	for _, key := range t.keys(username, ip) {
+		state := t.entries[key]
+		if state == nil || now.Sub(state.lastFailure) > t.cfg.AttemptWindow {
+			state = &attemptState{}
+			t.entries[key] = state
+		}
+		state.failures++
+		state.lastFailure = now
+
+		if limit := t.limit(key, userKey); limit > 0 && state.failures >= limit {
+			state.lockedUntil = now.Add(t.cfg.LockoutDuration)
+		}
+	}
+	return nil
+}
+
+// Release takes back an attempt that did not fail, keeping the earlier failures. It is used
+// when a correct password still has to be followed by a second factor.
+func (t *LoginThrottle) Release(username, ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	userKey := userThrottleKey(username)
+	for _, key := range t.keys(username, ip) {
+		t.release(key, userKey)
+	}
+}
+
+// RecordSuccess takes back the attempt and clears the failure history of the username
+func (t *LoginThrottle) RecordSuccess(username, ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.entries, userThrottleKey(username))
+	if ip != "" {
+		t.release(ipThrottleKey(ip), "")
+	}
+}
+
+func (t *LoginThrottle) release(key, userKey string) {
+	state := t.entries[key]
+	if state == nil {
+		return
+	}
+	state.failures--
+	if state.failures <= 0 {
+		delete(t.entries, key)
+		return
+	}
+	// The attempt may have been the one that reached the limit
+	if limit := t.limit(key, userKey); limit > 0 && state.failures < limit {
+		state.lockedUntil = time.Time{}
+	}
+}
+
+func (t *LoginThrottle) limit(key, userKey string) int {
+	if key == userKey {
+		return t.cfg.MaxUserAttempts
+	}
+	return t.cfg.MaxIPAttempts
+}
+
+// Unlock clears any lockout for the username
+func (t *LoginThrottle) Unlock(username string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.entries, userThrottleKey(username))
+}
+
+// UnlockIP clears any lockout for the client IP
+func (t *LoginThrottle) UnlockIP(ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.entries, ipThrottleKey(ip))
+}
+
+func (t *LoginThrottle) check(key string, now time.Time) *LoginThrottledError {
+	state, ok := t.entries[key]
+	if !ok {
+		return nil
+	}
+
+	if now.Before(state.lockedUntil) {
+		return &LoginThrottledError{RetryAfter: state.lockedUntil.Sub(now), Locked: true}
+	}
+	if !state.lockedUntil.IsZero() {
+		// Lockout expired, start over
+		delete(t.entries, key)
+		return nil
+	}
+
+	if nextAttempt := state.lastFailure.Add(t.backoff(state.failures)); now.Before(nextAttempt) {
+		return &LoginThrottledError{RetryAfter: nextAttempt.Sub(now)}
+	}
+	return nil
+}
+
+// backoff returns the delay required after the given number of consecutive failures
+func (t *LoginThrottle) backoff(failures int) time.Duration {
+	if failures <= 0 || t.cfg.BaseDelay <= 0 {
+		return 0
+	}
+
+	delay := t.cfg.BaseDelay
+	for i := 1; i < failures; i++ {
+		delay *= 2
+		if t.cfg.MaxDelay > 0 && delay >= t.cfg.MaxDelay {
+			return t.cfg.MaxDelay
+		}
+	}
+	return delay
+}
+
+// prune drops entries that are neither locked nor within the attempt window
+func (t *LoginThrottle) prune(now time.Time) {
+	for key, state := range t.entries {
+		if now.After(state.lockedUntil) && now.Sub(state.lastFailure) > t.cfg.AttemptWindow {
+			delete(t.entries, key)
+		}
+	}
+}
+
+func (t *LoginThrottle) keys(username, ip string) []string {
+	keys := []string{userThrottleKey(username)}
+	if ip != "" {
+		keys = append(keys, ipThrottleKey(ip))
+	}
+	return keys
+}
+
+func userThrottleKey(username string) string {
+	return "user:" + username
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
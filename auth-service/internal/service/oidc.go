@@ -0,0 +1,161 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/meetohin/web-chat/auth-service/internal/oidc"
+)
+
+// OIDCConfig configures single sign-on through an OpenID Connect provider
+type OIDCConfig struct {
+	Verifier *oidc.Verifier
+	// RoleMapping maps provider groups to roles. When set, the role of
+	// SSO users is updated from their groups on every login.
+	RoleMapping map[string]string
+	// AutoProvision creates accounts for unknown provider users
+	AutoProvision bool
+}
+
+// OIDCLogin signs in with an ID token from the identity provider. The provider account is
+// linked to an existing user with the same verified email, or a new user is provisioned
+// if allowed. Users with two-factor authentication get a challenge token, as with Login.
+func (s *AuthService) OIDCLogin(rawIDToken, nonce string, client ClientInfo) (*LoginResult, error) {
+	if s.oidc == nil {
+		return nil, errors.New("single sign-on is not configured")
+	}
+
+	claims, err := s.oidc.Verifier.Verify(rawIDToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetUserByIdentity(claims.Issuer, claims.Subject)
+	if err != nil {
+		username, err := s.linkOIDCAccount(claims)
+		if err != nil {
+			return nil, err
+		}
+		if user, err = s.userRepo.GetUser(username); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(s.oidc.RoleMapping) > 0 {
+		role := mapRole(claims.Groups, s.oidc.RoleMapping)
+		if role != user.Role {
+			if err := s.userRepo.SetRole(user.Username, role); err != nil {
+				return nil, err
+			}
+			log.Printf("Role of %s changed from %s to %s by SSO groups", user.Username, user.Role, role)
+		}
+	}
+
+	if user.TOTPEnabled {
+		challenge, err := s.issueChallenge(user.Username)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{ChallengeToken: challenge}, nil
+	}
+
+	token, err := s.issueToken(user.Username, client)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{Token: token}, nil
+}
+
+// linkOIDCAccount links the provider account to a local user, creating one if needed.
+// It returns the local username.
+func (s *AuthService) linkOIDCAccount(claims *oidc.Claims) (string, error) {
+	email, _ := normalizeEmail(claims.Email)
+
+	// Only link to local accounts whose email both sides have verified,
+	// otherwise anyone could take over an account by registering its address
+	if email != "" && claims.EmailVerified {
+		if existing, err := s.userRepo.GetUserByEmail(email); err == nil && existing.EmailVerified {
+			if err := s.userRepo.LinkIdentity(claims.Issuer, claims.Subject, existing.Username); err != nil {
+				return "", err
+			}
+			log.Printf("Linked SSO account %s to existing user %s", claims.Subject, existing.Username)
+			return existing.Username, nil
+		}
+	}
+
+	if !s.oidc.AutoProvision {
+		return "", errors.New("no account is linked to this identity")
+	}
+
+	base := claims.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(claims.Email, "@")
+	}
+	username, err := s.availableUsername(base)
+	if err != nil {
+		return "", err
+	}
+
+	// The address may already belong to an unverified local account
+	if email != "" {
+		if _, err := s.userRepo.GetUserByEmail(email); err == nil {
+			email = ""
+		}
+	}
+
+	if err := s.userRepo.CreateExternalUser(username, email, email != "" && claims.EmailVerified); err != nil {
+		return "", err
+	}
+	if err := s.userRepo.LinkIdentity(claims.Issuer, claims.Subject, username); err != nil {
+		return "", err
+	}
+	log.Printf("Provisioned user %s for SSO account %s", username, claims.Subject)
+	return username, nil
+}
+
+// availableUsername derives an unused username from base
+func (s *AuthService) availableUsername(base string) (string, error) {
+	base = sanitizeUsername(base)
+	if len(base) < 3 {
+		base = "user"
+	}
+
+	for i := 1; i <= 100; i++ {
+		candidate := base
+		if i > 1 {
+			candidate = fmt.Sprintf("%s%d", base, i)
+		}
+		if _, err := s.userRepo.GetUser(candidate); err != nil {
+			return candidate, nil
+		}
+	}
+	return "", errors.New("could not find a free username")
+}
+
+// mapRole returns the most privileged role granted by any of the groups
+func mapRole(groups []string, mapping map[string]string) string {
+	for _, group := range groups {
+		if mapping[group] == RoleAdmin {
+			return RoleAdmin
+		}
+	}
+	return RoleUser
+}
+
+// sanitizeUsername keeps the characters allowed in local usernames
+func sanitizeUsername(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		default:
+			return -1
+		}
+	}, name)
+	if len(name) > 45 {
+		name = name[:45]
+	}
+	return name
+}
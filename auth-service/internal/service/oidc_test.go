@@ -0,0 +1,101 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/meetohin/web-chat/auth-service/internal/oidc"
+	"github.com/meetohin/web-chat/auth-service/internal/oidc/oidctest"
+	"github.com/meetohin/web-chat/auth-service/internal/totp"
+)
+
+func newOIDCService(t *testing.T, issuer *oidctest.Issuer, users *memoryUsers) *AuthService {
+	t.Helper()
+
+	verifier, err := oidc.NewVerifier(issuer.URL, "chat", "groups")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewAuthService(users, Config{
+		LoginThrottle: DefaultLoginThrottleConfig(),
+		OIDC: &OIDCConfig{
+			Verifier:      verifier,
+			RoleMapping:   map[string]string{"chat-admins": RoleAdmin},
+			AutoProvision: true,
+		},
+	})
+}
+
+func TestOIDCLoginProvisionsUser(t *testing.T) {
+	issuer := oidctest.NewIssuer(t)
+	users := newMemoryUsers()
+	s := newOIDCService(t, issuer, users)
+
+	claims := issuer.Claims("chat", "sub-1", "nonce-1")
+	claims["preferred_username"] = "alice"
+	claims["email"] = "alice@example.com"
+	claims["email_verified"] = true
+	claims["groups"] = []string{"chat-admins"}
+
+	result, err := s.OIDCLogin(issuer.Sign(t, claims), "nonce-1", ClientInfo{})
+	if err != nil {
+		t.Fatalf("OIDCLogin() error = %v", err)
+	}
+	if result.Token == "" {
+		t.Fatalf("OIDCLogin() = %+v, want a token", result)
+	}
+
+	identity, err := s.ValidateToken(result.Token)
+	if err != nil {
+		t.Fatalf("ValidateToken() error = %v", err)
+	}
+	if identity.Username != "alice" || identity.Role != RoleAdmin {
+		t.Errorf("identity = %+v, want admin alice", identity)
+	}
+}
+
+func TestOIDCLoginRejectsReplayedToken(t *testing.T) {
+	issuer := oidctest.NewIssuer(t)
+	s := newOIDCService(t, issuer, newMemoryUsers())
+
+	token := issuer.Sign(t, issuer.Claims("chat", "sub-1", "nonce-1"))
+	for _, nonce := range []string{"", "nonce-2"} {
+		if _, err := s.OIDCLogin(token, nonce, ClientInfo{}); err == nil {
+			t.Errorf("OIDCLogin() with nonce %q accepted a token issued for another sign-in", nonce)
+		}
+	}
+}
+
+func TestOIDCLoginRequiresSecondFactor(t *testing.T) {
+	issuer := oidctest.NewIssuer(t)
+	users := newMemoryUsers()
+	s := newOIDCService(t, issuer, users)
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	users.CreateExternalUser("bob", "", false)
+	users.LinkIdentity(issuer.URL, "sub-2", "bob")
+	users.SetTOTP("bob", secret, true)
+
+	result, err := s.OIDCLogin(issuer.Sign(t, issuer.Claims("chat", "sub-2", "n")), "n", ClientInfo{})
+	if err != nil {
+		t.Fatalf("OIDCLogin() error = %v", err)
+	}
+	if result.Token != "" || result.ChallengeToken == "" {
+		t.Fatalf("OIDCLogin() = %+v, want only a challenge", result)
+	}
+
+	code, err := totp.Code(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := s.CompleteLogin(result.ChallengeToken, code, ClientInfo{})
+	if err != nil {
+		t.Fatalf("CompleteLogin() error = %v", err)
+	}
+	if _, err := s.ValidateToken(token); err != nil {
+		t.Fatalf("ValidateToken() error = %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/meetohin/web-chat/auth-service/internal/mailer"
+)
+
+// ChangePassword replaces the password of the token's owner after checking the old one,
+// which is throttled like logins. All previously issued tokens and sessions are revoked;
+// a fresh token is returned.
+func (s *AuthService) ChangePassword(tokenString, oldPassword, newPassword string, client ClientInfo) (string, error) {
+	identity, err := s.authenticate(tokenString)
+	if err != nil {
+		return "", err
+	}
+	username := identity.Username
+
+	if err := s.throttle.Attempt(username, client.IP); err != nil {
+		return "", err
+	}
+	if !s.userRepo.ValidatePassword(username, oldPassword) {
+		return "", errors.New("invalid credentials")
+	}
+	s.throttle.RecordSuccess(username, client.IP)
+
+	if err := s.passwordPolicy.Validate(username, newPassword); err != nil {
+		return "", err
+	}
+
+	if err := s.userRepo.UpdatePassword(username, newPassword); err != nil {
+		return "", err
+	}
+	if err := s.userRepo.RevokeUserSessions(username); err != nil {
+		return "", err
+	}
+
+	return s.issueToken(username, client)
+}
+
+// RequestPasswordReset generates a single-use reset token and mails it to the user's
+// email address. The user may be given by username or email. Unknown users and users
+// without an email are ignored so callers cannot probe which accounts exist.
+func (s *AuthService) RequestPasswordReset(login string) error {
+	user, err := s.userRepo.GetUser(s.resolveUsername(login))
+	if err != nil {
+		log.Printf("Password reset requested for unknown user %q", login)
+		return nil
+	}
+	if user.Email == "" {
+		log.Printf("Password reset requested for %q who has no email address", user.Username)
+		return nil
+	}
+	username := user.Username
+
+	token, err := generateToken()
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().Add(s.passwordResetTTL)
+	if err := s.userRepo.CreatePasswordReset(username, hashToken(token), expiresAt); err != nil {
+		return err
+	}
+
+	return s.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Password reset",
+		Body: fmt.Sprintf("Someone requested a password reset for your account %q.\n\n"+
+			"Use the following link to choose a new password (valid until %s):\n%s\n\n"+
+			"If you did not request this, ignore this message.",
+			username, expiresAt.Format(time.RFC1123), s.passwordResetLink(token)),
+	})
+}
+
+// ResetPassword sets a new password using a token from RequestPasswordReset
+func (s *AuthService) ResetPassword(resetToken, newPassword string) error {
+	tokenHash := hashToken(resetToken)
+
+	// Check the policy before consuming, so a rejected password does not burn the token
+	username, err := s.userRepo.GetPasswordReset(tokenHash)
+	if err != nil {
+		return err
+	}
+	if err := s.passwordPolicy.Validate(username, newPassword); err != nil {
+		return err
+	}
+
+	if _, err := s.userRepo.ConsumePasswordReset(tokenHash); err != nil {
+		return err
+	}
+
+	if err := s.userRepo.UpdatePassword(username, newPassword); err != nil {
+		return err
+	}
+	return s.userRepo.RevokeUserSessions(username)
+}
+
+func (s *AuthService) passwordResetLink(token string) string {
+	return tokenLink(s.passwordResetURL, token)
+}
+
+// tokenLink appends a token to a link base URL. Without a base URL the bare token is used.
+func tokenLink(baseURL, token string) string {
+	if baseURL == "" {
+		return token
+	}
+	return baseURL + "?token=" + url.QueryEscape(token)
+}
+
+// generateToken returns a random hex-encoded token
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashToken returns the value stored in the database for a token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/meetohin/web-chat/auth-service/internal/repository"
+)
+
+// memoryUsers is an in-memory UserRepository with the methods the tests need;
+// the others panic through the nil embedded interface
+type memoryUsers struct {
+	repository.UserRepository
+
+	mu         sync.Mutex
+	users      map[string]*repository.User
+	passwords  map[string]string
+	identities map[string]string // issuer + " " + subject → username
+	sessions   map[string]*repository.Session
+	totpSteps  map[string]uint64
+}
+
+func newMemoryUsers() *memoryUsers {
+	return &memoryUsers{
+		users:      make(map[string]*repository.User),
+		passwords:  make(map[string]string),
+		identities: make(map[string]string),
+		sessions:   make(map[string]*repository.Session),
+		totpSteps:  make(map[string]uint64),
+	}
+}
+
+func (m *memoryUsers) CreateUser(username, email, password string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[username]; ok {
+		return errors.New("user already exists")
+	}
+	m.users[username] = &repository.User{Username: username, Email: email, Role: RoleUser}
+	m.passwords[username] = password
+	return nil
+}
+
+func (m *memoryUsers) CreateExternalUser(username, email string, emailVerified bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.users[username] = &repository.User{Username: username, Email: email, EmailVerified: emailVerified, Role: RoleUser}
+	return nil
+}
+
+func (m *memoryUsers) GetUser(username string) (*repository.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[username]
+	if !ok {
+		return nil, errors.New("user not found")
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (m *memoryUsers) GetUserByEmail(email string) (*repository.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, user := range m.users {
+		if email != "" && strings.EqualFold(user.Email, email) {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, errors.New("user not found")
+}
+
+func (m *memoryUsers) GetUserByIdentity(issuer, subject string) (*repository.User, error) {
+	m.mu.Lock()
+	username, ok := m.identities[issuer+" "+subject]
+	m.mu.Unlock()
+	if !ok {
+		return nil, errors.New("user not found")
+	}
+	return m.GetUser(username)
+}
+
+func (m *memoryUsers) LinkIdentity(issuer, subject, username string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.identities[issuer+" "+subject] = username
+	return nil
+}
+
+func (m *memoryUsers) SetRole(username, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.users[username].Role = role
+	return nil
+}
+
+func (m *memoryUsers) ValidatePassword(username, password string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.passwords[username]
+	return ok && stored == password
+}
+
+func (m *memoryUsers) SetTOTP(username, secret string, enabled bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.users[username].TOTPSecret = secret
+	m.users[username].TOTPEnabled = enabled
+	return nil
+}
+
+func (m *memoryUsers) UseTOTPStep(username string, step uint64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if last, ok := m.totpSteps[username]; ok && step <= last {
+		return false, nil
+	}
+	m.totpSteps[username] = step
+	return true, nil
+}
+
+func (m *memoryUsers) ConsumeRecoveryCode(username, codeHash string) (bool, error) {
+	return false, nil
+}
+
+func (m *memoryUsers) ReplaceRecoveryCodes(username string, codeHashes []string) error {
+	return nil
+}
+
+func (m *memoryUsers) CreateSession(session *repository.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	copied := *session
+	m.sessions[session.ID] = &copied
+	return nil
+}
+
+func (m *memoryUsers) GetSession(id string) (*repository.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[id]
+	if !ok {
+		return nil, errors.New("session not found")
+	}
+	copied := *session
+	return &copied, nil
+}
+
+func (m *memoryUsers) TouchSession(id string) error {
+	return nil
+}
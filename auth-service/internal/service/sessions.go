@@ -0,0 +1,134 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/meetohin/web-chat/auth-service/internal/repository"
+)
+
+const (
+	tokenTTL           = 24 * time.Hour
+	maxUserAgentLength = 512
+	// sessionTouchInterval is how long the last use of a session may lag behind
+	sessionTouchInterval = time.Minute
+)
+
+// ClientInfo describes the device a login comes from
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+// ListSessions returns the active sessions of the token's owner and the ID of the session the token belongs to
+func (s *AuthService) ListSessions(tokenString string) ([]repository.Session, string, error) {
+	identity, err := s.authenticate(tokenString)
+	if err != nil {
+		return nil, "", err
+	}
+
+	sessions, err := s.userRepo.ListSessions(identity.Username)
+	if err != nil {
+		return nil, "", err
+	}
+	return sessions, identity.SessionID, nil
+}
+
+// RevokeSession ends one of the token owner's sessions. Tokens of the session stop validating immediately.
+func (s *AuthService) RevokeSession(tokenString, sessionID string) error {
+	identity, err := s.authenticate(tokenString)
+	if err != nil {
+		return err
+	}
+	if sessionID == "" {
+		return errors.New("session id required")
+	}
+
+	revoked, err := s.userRepo.RevokeSession(identity.Username, sessionID)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return errors.New("session not found")
+	}
+
+	log.Printf("Session %s of %s revoked", sessionID, identity.Username)
+	return nil
+}
+
+// createSession records a new session for the user and returns its ID
+func (s *AuthService) createSession(username string, client ClientInfo) (string, error) {
+	id, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+
+	userAgent := client.UserAgent
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	err = s.userRepo.CreateSession(&repository.Session{
+		ID:        id,
+		Username:  username,
+		UserAgent: userAgent,
+		IPAddress: client.IP,
+		ExpiresAt: time.Now().Add(tokenTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// checkSession verifies that the session is still active and records its use
+func (s *AuthService) checkSession(id, username string) error {
+	session, err := s.userRepo.GetSession(id)
+	if err != nil {
+		return errors.New("token revoked")
+	}
+	if session.Username != username || !session.RevokedAt.IsZero() || time.Now().After(session.ExpiresAt) {
+		return errors.New("token revoked")
+	}
+
+	if s.touches.due(id, time.Now()) {
+		if err := s.userRepo.TouchSession(id); err != nil {
+			log.Printf("Failed to update last use of session %s: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// sessionTouches remembers when sessions were last written as used, so token
+// checks within sessionTouchInterval do not reach the database
+type sessionTouches struct {
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+func newSessionTouches() *sessionTouches {
+	return &sessionTouches{last: make(map[string]time.Time)}
+}
+
+// due reports whether the session should be touched now and records it if so
+func (t *sessionTouches) due(id string, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if last, ok := t.last[id]; ok && now.Sub(last) < sessionTouchInterval {
+		return false
+	}
+	t.last[id] = now
+
+	// Forget sessions that have not been used for a while so the map stays small
+	if len(t.last) > 10000 {
+		for sid, last := range t.last {
+			if now.Sub(last) >= sessionTouchInterval {
+				delete(t.last, sid)
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,236 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/meetohin/web-chat/auth-service/internal/repository"
+	"github.com/meetohin/web-chat/auth-service/internal/totp"
+)
+
+const (
+	challengePurpose  = "2fa"
+	challengeTTL      = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+// CompleteLogin finishes a two-factor login with a TOTP or recovery code and returns a JWT token
+func (s *AuthService) CompleteLogin(challengeToken, code string, client ClientInfo) (string, error) {
+	username, err := s.parseChallenge(challengeToken)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.throttle.Attempt(username, client.IP); err != nil {
+		return "", err
+	}
+
+	user, err := s.userRepo.GetUser(username)
+	if err != nil {
+		return "", err
+	}
+	if !user.TOTPEnabled {
+		return "", errors.New("two-factor authentication is not enabled")
+	}
+
+	ok, err := s.checkSecondFactor(user, code)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", errors.New("invalid authentication code")
+	}
+	s.throttle.RecordSuccess(username, client.IP)
+
+	return s.issueToken(username, client)
+}
+
+// EnrollTOTP starts two-factor enrollment and returns the new secret and its provisioning URI.
+// Two-factor authentication is only enabled after ConfirmTOTP.
+func (s *AuthService) EnrollTOTP(tokenString string) (string, string, error) {
+	identity, err := s.authenticate(tokenString)
+	if err != nil {
+		return "", "", err
+	}
+
+	user, err := s.userRepo.GetUser(identity.Username)
+	if err != nil {
+		return "", "", err
+	}
+	if user.TOTPEnabled {
+		return "", "", errors.New("two-factor authentication is already enabled")
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if err := s.userRepo.SetTOTP(user.Username, secret, false); err != nil {
+		return "", "", err
+	}
+
+	account := user.Username
+	if user.Email != "" {
+		account = user.Email
+	}
+	return secret, totp.ProvisioningURI(s.totpIssuer, account, secret), nil
+}
+
+// ConfirmTOTP enables two-factor authentication once the user proves the secret works.
+// It returns recovery codes, which are shown to the user only this once.
+func (s *AuthService) ConfirmTOTP(tokenString, code string) ([]string, error) {
+	identity, err := s.authenticate(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetUser(identity.Username)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, errors.New("two-factor authentication is already enabled")
+	}
+	if user.TOTPSecret == "" {
+		return nil, errors.New("two-factor enrollment has not been started")
+	}
+
+	ok, err := s.checkTOTP(user, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("invalid authentication code")
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.ReplaceRecoveryCodes(user.Username, hashes); err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.SetTOTP(user.Username, user.TOTPSecret, true); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// DisableTOTP turns two-factor authentication off after re-checking the password and,
+// while it is enabled, a current TOTP or recovery code. Failures are throttled like logins.
+func (s *AuthService) DisableTOTP(tokenString, password, code string, client ClientInfo) error {
+	identity, err := s.authenticate(tokenString)
+	if err != nil {
+		return err
+	}
+	username := identity.Username
+
+	if err := s.throttle.Attempt(username, client.IP); err != nil {
+		return err
+	}
+	if !s.userRepo.ValidatePassword(username, password) {
+		return errors.New("invalid credentials")
+	}
+
+	user, err := s.userRepo.GetUser(username)
+	if err != nil {
+		return err
+	}
+	if user.TOTPEnabled {
+		ok, err := s.checkSecondFactor(user, code)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("invalid authentication code")
+		}
+	}
+	s.throttle.RecordSuccess(username, client.IP)
+
+	if err := s.userRepo.SetTOTP(username, "", false); err != nil {
+		return err
+	}
+	return s.userRepo.ReplaceRecoveryCodes(username, nil)
+}
+
+// checkSecondFactor accepts a TOTP code or consumes a recovery code of the user
+func (s *AuthService) checkSecondFactor(user *repository.User, code string) (bool, error) {
+	ok, err := s.checkTOTP(user, code)
+	if err != nil || ok {
+		return ok, err
+	}
+	return s.userRepo.ConsumeRecoveryCode(user.Username, hashToken(normalizeRecoveryCode(code)))
+}
+
+// checkTOTP validates a code of the user's authenticator app. Each code is accepted once.
+func (s *AuthService) checkTOTP(user *repository.User, code string) (bool, error) {
+	step, ok := totp.Match(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	return s.userRepo.UseTOTPStep(user.Username, step)
+}
+
+// issueChallenge creates a short-lived token proving the password step of a login succeeded
+func (s *AuthService) issueChallenge(username string) (string, error) {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"username": username,
+		"purpose":  challengePurpose,
+		"iat":      now.Unix(),
+		"exp":      now.Add(challengeTTL).Unix(),
+	})
+
+	return token.SignedString(jwtSecret)
+}
+
+// parseChallenge validates a challenge token and returns its username
+func (s *AuthService) parseChallenge(challengeToken string) (string, error) {
+	token, err := jwt.Parse(challengeToken, func(token *jwt.Token) (interface{}, error) {
+		return jwtSecret, nil
+	})
+	if err != nil {
+		return "", errors.New("invalid or expired challenge")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || claims["purpose"] != challengePurpose {
+		return "", errors.New("invalid or expired challenge")
+	}
+
+	username, ok := claims["username"].(string)
+	if !ok {
+		return "", errors.New("invalid or expired challenge")
+	}
+	return username, nil
+}
+
+// generateRecoveryCodes returns new recovery codes and their hashes
+func generateRecoveryCodes() ([]string, []string, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(encoding.EncodeToString(b))[:10]
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		hashes = append(hashes, hashToken(raw))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode strips formatting so "ABCDE-FGHIJ" and "abcdefghij" match
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
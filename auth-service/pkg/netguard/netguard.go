@@ -0,0 +1,33 @@
+// Package netguard keeps requests to user-supplied URLs, such as webhooks, away from
+// the services on the internal network
+package netguard
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598), which cloud providers
+// also use for internal services
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// Allowed reports whether ip is a public address that user-supplied URLs may reach
+func Allowed(ip net.IP) bool {
+	return ip != nil && !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() && !ip.IsMulticast() &&
+		!sharedAddressSpace.Contains(ip)
+}
+
+// Control refuses connections to addresses that are not Allowed. Set as the Control of a
+// net.Dialer it checks the resolved address of every connection, so DNS cannot point around it.
+func Control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if !Allowed(net.ParseIP(host)) {
+		return fmt.Errorf("address %s is not allowed", host)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package netguard
+
+import (
+	"net"
+	"testing"
+)
+
+func TestAllowed(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"100.63.255.255", true},
+		{"100.128.0.0", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"fd00::1", false},
+		{"169.254.169.254", false}, // cloud metadata
+		{"fe80::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"224.0.0.1", false},
+		{"100.64.0.1", false}, // carrier-grade NAT
+		{"100.127.255.254", false},
+		{"::ffff:10.0.0.1", false}, // IPv4-mapped
+		{"::ffff:100.100.100.200", false},
+	}
+	for _, tt := range tests {
+		if got := Allowed(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("Allowed(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+	if Allowed(nil) {
+		t.Error("Allowed(nil) = true")
+	}
+}
+
+func TestControl(t *testing.T) {
+	if err := Control("tcp", "93.184.216.34:443", nil); err != nil {
+		t.Errorf("Control of a public address: %v", err)
+	}
+	for _, address := range []string{"127.0.0.1:80", "[::1]:443", "100.64.0.1:80", "localhost:80", "no-port"} {
+		if err := Control("tcp", address, nil); err == nil {
+			t.Errorf("Control(%s) allowed the connection", address)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+// Command chat-import loads chat history from a Slack workspace export ZIP or from a
+// JSON Lines file (the format of the JSON Lines chat export) into the chat database.
+// Authors are mapped to existing accounts by verified email address; placeholder
+// accounts are created for the others. Imports can be re-run: messages and users imported
+// before are recognised by their ID in the source and skipped.
+//
+//	CHAT_TOKEN=<admin token> chat-import [-source slack] [-channels general,random] [-dry-run] export.zip
+//
+// The database and auth service are configured with the same environment variables
+// as chat-service. Message retention applies to imported messages as well, so old
+// history may be purged on the next retention run.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/meetohin/web-chat/chat-service/internal/client"
+	"github.com/meetohin/web-chat/chat-service/internal/importer"
+	"github.com/meetohin/web-chat/chat-service/internal/repository"
+)
+
+const progressEvery = 1000
+
+func main() {
+	format := flag.String("format", "", "export format: slack or jsonl (default: slack for .zip files, jsonl otherwise)")
+	source := flag.String("source", "", "name that keys imported rows, use a different one per workspace (default: the format)")
+	channels := flag.String("channels", "", "comma-separated Slack channels to import (default: all)")
+	token := flag.String("token", os.Getenv("CHAT_TOKEN"), "admin token, used to map and create users")
+	dryRun := flag.Bool("dry-run", false, "read the export and count messages without importing them")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: chat-import [flags] <export.zip | messages.jsonl>\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	file := flag.Arg(0)
+
+	if *format == "" {
+		*format = "jsonl"
+		if strings.EqualFold(filepath.Ext(file), ".zip") {
+			*format = "slack"
+		}
+	}
+	if *format != "slack" && *format != "jsonl" {
+		log.Fatalf("Unknown format %q", *format)
+	}
+	if *source == "" {
+		*source = *format
+	}
+
+	var im *importer.Importer
+	if *dryRun {
+		im = importer.New(nil, nil, "", *source, true)
+	} else {
+		if *token == "" {
+			log.Fatal("An admin token is required, set CHAT_TOKEN or use -token")
+		}
+
+		authClient, err := client.NewAuthClient(getEnv("AUTH_SERVICE_URL", "localhost:50051"))
+		if err != nil {
+			log.Fatalf("Failed to connect to auth service: %v", err)
+		}
+		defer authClient.Close()
+
+		db, err := openDatabase()
+		if err != nil {
+			log.Fatalf("Failed to connect to database: %v", err)
+		}
+		defer db.Close()
+
+		messageRepo := repository.NewPostgreSQLMessageRepository(db)
+		importRepo := repository.NewPostgreSQLImportRepository(db)
+		for _, repo := range []interface{}{messageRepo, importRepo} {
+			if err := repo.(interface{ CreateTables() error }).CreateTables(); err != nil {
+				log.Fatalf("Failed to create tables: %v", err)
+			}
+		}
+
+		im = importer.New(authClient, importRepo, *token, *source, false)
+	}
+
+	ctx := context.Background()
+	started := time.Now()
+	importRecord := func(rec *importer.Record) error {
+		if err := im.Import(ctx, rec); err != nil {
+			return err
+		}
+		if im.Stats.Read%progressEvery == 0 {
+			log.Printf("%d messages read, up to %s", im.Stats.Read, rec.Time.Format("2006-01-02"))
+		}
+		return nil
+	}
+
+	var err error
+	if *format == "slack" {
+		var list []string
+		for _, c := range strings.Split(*channels, ",") {
+			if c = strings.TrimSpace(c); c != "" {
+				list = append(list, c)
+			}
+		}
+		err = importer.ReadSlack(file, list, importRecord)
+	} else {
+		var f *os.File
+		if f, err = os.Open(file); err == nil {
+			err = importer.ReadJSONL(f, importRecord)
+			f.Close()
+		}
+	}
+
+	s := im.Stats
+	if *dryRun {
+		log.Printf("Dry run: %d messages would be imported from %s", s.Read, file)
+	} else {
+		log.Printf("Imported %d messages (%d already present) in %s; %d users mapped to existing accounts, %d placeholders created",
+			s.Imported, s.Duplicates, time.Since(started).Round(time.Second), s.UsersMapped, s.UsersCreated)
+	}
+	if err != nil {
+		log.Fatalf("Import stopped: %v", err)
+	}
+}
+
+func openDatabase() (*sql.DB, error) {
+	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		getEnv("DB_HOST", "localhost"), getEnv("DB_PORT", "5432"), getEnv("DB_USER", "postgres_user"),
+		getEnv("DB_PASSWORD", "postgres"), getEnv("DB_NAME", "webchat"))
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
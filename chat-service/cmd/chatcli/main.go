@@ -0,0 +1,381 @@
+// Command chatcli is a terminal client for chat-service.
+//
+//	chatcli register -u alice -e alice@example.com
+//	chatcli login -u alice
+//	chatcli                      # interactive chat
+//	chatcli send "deploy finished"
+//	echo "multi-line report" | chatcli send
+//	chatcli tail -n 20 -f
+//
+// The server defaults to CHAT_URL or http://localhost:8080. Scripts can pass a token or
+// an API key in CHAT_TOKEN (or -token) instead of logging in.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/meetohin/web-chat/chat-service/pkg/chatclient"
+	"github.com/meetohin/web-chat/chat-service/pkg/protocol"
+	"golang.org/x/term"
+)
+
+const usage = `Usage: chatcli <command> [flags]
+
+Commands:
+  chat       interactive chat (default)
+  register   create an account
+  login      log in and remember the token
+  logout     forget the remembered token
+  send       post a message from the arguments or stdin
+  tail       print recent messages, -f to keep following
+
+Common flags:
+  -server URL    chat-service address (env CHAT_URL)
+  -token TOKEN   token or API key to use instead of the remembered login (env CHAT_TOKEN)
+`
+
+// storedLogin is kept in the user's config directory between runs
+type storedLogin struct {
+	Server   string `json:"server"`
+	Username string `json:"username"`
+	Token    string `json:"token"`
+}
+
+type globalFlags struct {
+	server string
+	token  string
+}
+
+func main() {
+	args := os.Args[1:]
+	command := "chat"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	switch command {
+	case "chat":
+		err = runChat(ctx, args)
+	case "register":
+		err = runRegister(ctx, args)
+	case "login":
+		err = runLogin(ctx, args)
+	case "logout":
+		err = runLogout(args)
+	case "send":
+		err = runSend(ctx, args)
+	case "tail":
+		err = runTail(ctx, args)
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+
+	if err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Fprintln(os.Stderr, "chatcli:", err)
+		os.Exit(1)
+	}
+}
+
+func newFlagSet(name string) (*flag.FlagSet, *globalFlags) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	g := &globalFlags{}
+	fs.StringVar(&g.server, "server", os.Getenv("CHAT_URL"), "chat-service address")
+	fs.StringVar(&g.token, "token", os.Getenv("CHAT_TOKEN"), "token or API key")
+	return fs, g
+}
+
+// client builds a chat client from the flags, falling back to the remembered login
+func (g *globalFlags) client() (*chatclient.Client, *storedLogin, error) {
+	stored, _ := loadLogin()
+
+	server := g.server
+	if server == "" && stored != nil {
+		server = stored.Server
+	}
+	if server == "" {
+		server = "http://localhost:8080"
+	}
+
+	cfg := chatclient.Config{BaseURL: server}
+	switch {
+	case strings.HasPrefix(g.token, "wck_"):
+		cfg.APIKey = g.token
+	case g.token != "":
+		cfg.Token = g.token
+	case stored != nil && stored.Token != "" && sameServer(stored.Server, server):
+		cfg.Token = stored.Token
+	default:
+		return nil, nil, errors.New("not logged in; run \"chatcli login\" or set CHAT_TOKEN")
+	}
+
+	return chatclient.New(cfg), stored, nil
+}
+
+func newAnonymousClient(g *globalFlags) *chatclient.Client {
+	server := g.server
+	if server == "" {
+		server = "http://localhost:8080"
+	}
+	return chatclient.New(chatclient.Config{BaseURL: server})
+}
+
+func runRegister(ctx context.Context, args []string) error {
+	fs, g := newFlagSet("register")
+	username := fs.String("u", "", "username")
+	email := fs.String("e", "", "email address (optional)")
+	fs.Parse(args)
+
+	if *username == "" {
+		return errors.New("-u username is required")
+	}
+	password, err := readPassword("Password: ")
+	if err != nil {
+		return err
+	}
+	confirm, err := readPassword("Repeat password: ")
+	if err != nil {
+		return err
+	}
+	if password != confirm {
+		return errors.New("passwords do not match")
+	}
+
+	if err := newAnonymousClient(g).Register(ctx, *username, *email, password); err != nil {
+		return err
+	}
+	fmt.Println("Registered. Log in with: chatcli login -u", *username)
+	return nil
+}
+
+func runLogin(ctx context.Context, args []string) error {
+	fs, g := newFlagSet("login")
+	username := fs.String("u", "", "username or email")
+	fs.Parse(args)
+
+	if *username == "" {
+		return errors.New("-u username is required")
+	}
+	password, err := readPassword("Password: ")
+	if err != nil {
+		return err
+	}
+
+	server := g.server
+	if server == "" {
+		server = "http://localhost:8080"
+	}
+	c := chatclient.New(chatclient.Config{BaseURL: server, Username: *username, Password: password})
+
+	err = c.Login(ctx)
+	if errors.Is(err, chatclient.ErrTwoFactorRequired) {
+		code, readErr := readLine("Authentication code: ")
+		if readErr != nil {
+			return readErr
+		}
+		err = c.CompleteLogin(ctx, code)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := saveLogin(&storedLogin{Server: server, Username: *username, Token: c.Token()}); err != nil {
+		return err
+	}
+	fmt.Println("Logged in as", *username)
+	return nil
+}
+
+func runLogout(args []string) error {
+	fs, _ := newFlagSet("logout")
+	fs.Parse(args)
+
+	path, err := loginPath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	fmt.Println("Logged out")
+	return nil
+}
+
+func runSend(ctx context.Context, args []string) error {
+	fs, g := newFlagSet("send")
+	fs.Parse(args)
+
+	text := strings.Join(fs.Args(), " ")
+	if text == "" {
+		data, err := io.ReadAll(io.LimitReader(os.Stdin, 64<<10))
+		if err != nil {
+			return err
+		}
+		text = strings.TrimSpace(string(data))
+	}
+	if text == "" {
+		return errors.New("nothing to send")
+	}
+
+	c, _, err := g.client()
+	if err != nil {
+		return err
+	}
+	_, err = c.PostMessage(ctx, text)
+	return err
+}
+
+func runTail(ctx context.Context, args []string) error {
+	fs, g := newFlagSet("tail")
+	limit := fs.Int("n", 20, "number of recent messages to print")
+	follow := fs.Bool("f", false, "keep printing new messages")
+	fs.Parse(args)
+
+	if *limit < 0 || *limit > 500 {
+		return errors.New("-n must be between 0 and 500")
+	}
+
+	c, _, err := g.client()
+	if err != nil {
+		return err
+	}
+
+	if !*follow {
+		if *limit == 0 {
+			return nil
+		}
+		messages, err := c.RecentMessages(ctx, *limit)
+		if err != nil {
+			return err
+		}
+		for _, m := range messages {
+			fmt.Println(formatMessage(m))
+		}
+		return nil
+	}
+
+	// The server replays its history on connect; print only the last n of it the first time.
+	// After a reconnect the client skips what was already printed.
+	var history []protocol.Message
+	connected := false
+	c.OnMessage(func(m chatclient.Message) {
+		if m.Replayed && !connected {
+			history = append(history, m.Message)
+			return
+		}
+		fmt.Println(formatMessage(m.Message))
+	})
+	c.OnConnect(func() {
+		if connected {
+			return
+		}
+		connected = true
+		if len(history) > *limit {
+			history = history[len(history)-*limit:]
+		}
+		for _, m := range history {
+			fmt.Println(formatMessage(m))
+		}
+		history = nil
+	})
+	c.OnNotification(func(n chatclient.Notification) {
+		fmt.Println(formatNotification(n))
+	})
+	return c.Run(ctx)
+}
+
+func formatMessage(m protocol.Message) string {
+	ts := m.Timestamp.Local().Format("15:04")
+	if m.IsAction() {
+		return fmt.Sprintf("%s * %s %s", ts, m.Name(), m.Text[4:])
+	}
+	return fmt.Sprintf("%s %s: %s", ts, m.Name(), m.Text)
+}
+
+func formatNotification(n chatclient.Notification) string {
+	return fmt.Sprintf("%s [!] %s: %s", time.Now().Format("15:04"), n.Title, n.Message)
+}
+
+func readPassword(prompt string) (string, error) {
+	if value := os.Getenv("CHAT_PASSWORD"); value != "" {
+		return value, nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return readLine(prompt)
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	password, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	return string(password), err
+}
+
+func readLine(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+func loginPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "chatcli", "login.json"), nil
+}
+
+func loadLogin() (*storedLogin, error) {
+	path, err := loginPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	login := &storedLogin{}
+	if err := json.Unmarshal(data, login); err != nil {
+		return nil, err
+	}
+	return login, nil
+}
+
+func saveLogin(login *storedLogin) error {
+	path, err := loginPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	data, _ := json.MarshalIndent(login, "", "  ")
+	return os.WriteFile(path, data, 0o600)
+}
+
+func sameServer(a, b string) bool {
+	return strings.TrimSuffix(a, "/") == strings.TrimSuffix(b, "/")
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/meetohin/web-chat/chat-service/pkg/chatclient"
+	"golang.org/x/term"
+)
+
+// ANSI styles used by the interactive view
+const (
+	styleReset        = "\x1b[0m"
+	styleHeader       = "\x1b[7m"
+	styleDim          = "\x1b[2m"
+	styleBold         = "\x1b[1m"
+	styleAction       = "\x1b[35m"
+	styleEphemeral    = "\x1b[36m"
+	styleNotification = "\x1b[33m"
+)
+
+// entry is one logical line of the chat history
+type entry struct {
+	text  string
+	style string
+}
+
+// tui is the interactive view: a header, the scrollable history and an input line.
+// All fields are owned by the goroutine running loop.
+type tui struct {
+	client   *chatclient.Client
+	username string
+	out      *bufio.Writer
+
+	width, height int
+	entries       []entry
+	scroll        int // rows scrolled up from the bottom
+	input         []rune
+	sent          []string
+	sentIndex     int
+	status        string
+	topic         string
+}
+
+func runChat(ctx context.Context, args []string) error {
+	fs, g := newFlagSet("chat")
+	fs.Parse(args)
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return errors.New("interactive chat needs a terminal; use send or tail in scripts")
+	}
+
+	c, stored, err := g.client()
+	if err != nil {
+		return err
+	}
+
+	t := &tui{client: c, out: bufio.NewWriter(os.Stdout), status: "connecting"}
+	if stored != nil && g.token == "" {
+		t.username = stored.Username
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	fmt.Print("\x1b[?1049h") // alternate screen
+	defer func() {
+		fmt.Print("\x1b[?1049l")
+		term.Restore(fd, state)
+	}()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Client callbacks run on the connection's goroutine; hand them to the UI loop
+	events := make(chan func(), 256)
+	post := func(fn func()) {
+		select {
+		case events <- fn:
+		case <-ctx.Done():
+		}
+	}
+
+	c.OnMessage(func(m chatclient.Message) {
+		post(func() { t.addMessage(m) })
+	})
+	c.OnNotification(func(n chatclient.Notification) {
+		post(func() {
+			t.add(formatNotification(n), styleNotification)
+			fmt.Fprint(t.out, "\a")
+		})
+	})
+	c.OnSystem(func(e chatclient.SystemEvent) {
+		style := styleDim
+		if e.Ephemeral {
+			style = styleEphemeral
+		}
+		post(func() { t.add(e.Text, style) })
+	})
+	c.OnTopic(func(topic chatclient.Topic) {
+		post(func() { t.topic = topic.Text })
+	})
+	c.OnConnect(func() {
+		post(func() { t.status = "connected" })
+	})
+	c.OnDisconnect(func(err error) {
+		post(func() { t.status = "reconnecting" })
+	})
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- c.Run(ctx) }()
+
+	keys := make(chan []byte)
+	go readKeys(keys)
+
+	return t.loop(ctx, keys, events, runErr)
+}
+
+func (t *tui) loop(ctx context.Context, keys <-chan []byte, events <-chan func(), runErr <-chan error) error {
+	resize := time.NewTicker(500 * time.Millisecond)
+	defer resize.Stop()
+
+	t.render()
+	for {
+		select {
+		case data, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			if quit := t.handleKeys(data); quit {
+				return nil
+			}
+		case fn := <-events:
+			fn()
+		case err := <-runErr:
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		case <-resize.C:
+			if w, h, err := term.GetSize(int(os.Stdout.Fd())); err != nil || (w == t.width && h == t.height) {
+				continue
+			}
+		case <-ctx.Done():
+			return nil
+		}
+		t.render()
+	}
+}
+
+func readKeys(keys chan<- []byte) {
+	defer close(keys)
+
+	buf := make([]byte, 256)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return
+		}
+		data := make([]byte, n)
+		copy(data, buf[:n])
+		keys <- data
+	}
+}
+
+// handleKeys applies a chunk of terminal input and reports whether the user asked to quit
+func (t *tui) handleKeys(data []byte) bool {
+	for len(data) > 0 {
+		b := data[0]
+		switch {
+		case b == 0x03: // Ctrl-C
+			return true
+		case b == 0x04: // Ctrl-D quits on an empty line
+			if len(t.input) == 0 {
+				return true
+			}
+		case b == '\r' || b == '\n':
+			if t.submit() {
+				return true
+			}
+		case b == 0x7f || b == 0x08:
+			if len(t.input) > 0 {
+				t.input = t.input[:len(t.input)-1]
+			}
+		case b == 0x15: // Ctrl-U clears the line
+			t.input = t.input[:0]
+		case b == 0x17: // Ctrl-W deletes the last word
+			line := strings.TrimRightFunc(string(t.input), unicode.IsSpace)
+			if i := strings.LastIndexFunc(line, unicode.IsSpace); i >= 0 {
+				t.input = []rune(line[:i+1])
+			} else {
+				t.input = t.input[:0]
+			}
+		case b == 0x1b:
+			data = t.handleEscape(data)
+			continue
+		case b >= 0x20:
+			r, size := utf8.DecodeRune(data)
+			if r != utf8.RuneError && unicode.IsPrint(r) {
+				t.input = append(t.input, r)
+			}
+			data = data[size:]
+			continue
+		}
+		data = data[1:]
+	}
+	return false
+}
+
+// handleEscape handles an escape sequence at the start of data and returns the rest
+func (t *tui) handleEscape(data []byte) []byte {
+	if len(data) < 2 || data[1] != '[' {
+		return data[1:]
+	}
+
+	end := 2
+	for end < len(data) && (data[end] < 0x40 || data[end] > 0x7e) {
+		end++
+	}
+	if end == len(data) {
+		return nil
+	}
+
+	page := t.viewHeight() - 1
+	switch string(data[2 : end+1]) {
+	case "A": // Up recalls earlier input
+		if t.sentIndex > 0 {
+			t.sentIndex--
+			t.input = []rune(t.sent[t.sentIndex])
+		}
+	case "B":
+		if t.sentIndex < len(t.sent)-1 {
+			t.sentIndex++
+			t.input = []rune(t.sent[t.sentIndex])
+		} else {
+			t.sentIndex = len(t.sent)
+			t.input = t.input[:0]
+		}
+	case "5~": // Page Up
+		t.scroll += page
+	case "6~": // Page Down
+		t.scroll -= page
+	case "H", "1~": // Home
+		t.scroll = len(t.rows())
+	case "F", "4~": // End
+		t.scroll = 0
+	}
+	return data[end+1:]
+}
+
+// submit sends the input line and reports whether it was /quit
+func (t *tui) submit() bool {
+	line := strings.TrimSpace(string(t.input))
+	t.input = t.input[:0]
+	if line == "" {
+		return false
+	}
+	if line == "/quit" || line == "/exit" {
+		return true
+	}
+
+	t.sent = append(t.sent, line)
+	t.sentIndex = len(t.sent)
+	t.scroll = 0
+
+	if err := t.client.Send(line); err != nil {
+		if errors.Is(err, chatclient.ErrNotConnected) {
+			t.add("Not connected, message not sent", styleEphemeral)
+		} else {
+			t.add("Send failed: "+err.Error(), styleEphemeral)
+		}
+	}
+	return false
+}
+
+func (t *tui) addMessage(m chatclient.Message) {
+	ts := m.Timestamp.Local().Format("15:04")
+	if m.IsAction() {
+		t.add(fmt.Sprintf("%s * %s %s", ts, m.Name(), m.Text[4:]), styleAction)
+		return
+	}
+
+	style := ""
+	if m.Username == t.username {
+		style = styleBold
+	}
+	t.add(fmt.Sprintf("%s %s: %s", ts, m.Name(), m.Text), style)
+}
+
+func (t *tui) add(text, style string) {
+	t.entries = append(t.entries, entry{text: text, style: style})
+
+	// Keep the view in place while the user reads older messages
+	if t.scroll > 0 {
+		t.scroll += len(wrap(text, t.width))
+	}
+	if len(t.entries) > 5000 {
+		t.entries = t.entries[len(t.entries)-5000:]
+	}
+}
+
+func (t *tui) viewHeight() int {
+	return t.height - 3 // header, status line and input line
+}
+
+// rows returns the history wrapped to the terminal width
+func (t *tui) rows() []entry {
+	var rows []entry
+	for _, e := range t.entries {
+		for _, line := range wrap(e.text, t.width) {
+			rows = append(rows, entry{text: line, style: e.style})
+		}
+	}
+	return rows
+}
+
+func (t *tui) render() {
+	if w, h, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+		t.width, t.height = w, h
+	}
+	if t.width < 10 || t.height < 5 {
+		return
+	}
+
+	rows := t.rows()
+	view := t.viewHeight()
+	maxScroll := len(rows) - view
+	if maxScroll < 0 {
+		maxScroll = 0
+	}
+	if t.scroll > maxScroll {
+		t.scroll = maxScroll
+	}
+	if t.scroll < 0 {
+		t.scroll = 0
+	}
+
+	out := t.out
+	out.WriteString("\x1b[?25l") // hide the cursor while drawing
+
+	header := " chat"
+	if t.username != "" {
+		header += " — " + t.username
+	}
+	header += " [" + t.status + "]"
+	if t.topic != "" {
+		header += "  " + t.topic
+	}
+	t.drawRow(1, styleHeader, pad(header, t.width))
+
+	end := len(rows) - t.scroll
+	start := end - view
+	for i := 0; i < view; i++ {
+		idx := start + i
+		if idx < 0 || idx >= end {
+			t.drawRow(2+i, "", "")
+			continue
+		}
+		t.drawRow(2+i, rows[idx].style, rows[idx].text)
+	}
+
+	status := ""
+	if t.scroll > 0 {
+		status = fmt.Sprintf("-- %d more lines below, PgDn or End to return --", t.scroll)
+	}
+	t.drawRow(t.height-1, styleDim, status)
+
+	input := string(t.input)
+	visible := []rune("> " + input)
+	if len(visible) > t.width-1 {
+		visible = visible[len(visible)-(t.width-1):]
+	}
+	t.drawRow(t.height, "", string(visible))
+
+	fmt.Fprintf(out, "\x1b[%d;%dH\x1b[?25h", t.height, len(visible)+1)
+	out.Flush()
+}
+
+func (t *tui) drawRow(row int, style, text string) {
+	fmt.Fprintf(t.out, "\x1b[%d;1H\x1b[2K", row)
+	if text == "" {
+		return
+	}
+	if style != "" {
+		t.out.WriteString(style)
+	}
+	t.out.WriteString(text)
+	if style != "" {
+		t.out.WriteString(styleReset)
+	}
+}
+
+// wrap splits text into rows of at most width runes
+func wrap(text string, width int) []string {
+	if width < 1 {
+		width = 1
+	}
+
+	var rows []string
+	for _, line := range strings.Split(text, "\n") {
+		runes := []rune(line)
+		for len(runes) > width {
+			rows = append(rows, string(runes[:width]))
+			runes = runes[width:]
+		}
+		rows = append(rows, string(runes))
+	}
+	return rows
+}
+
+func pad(text string, width int) string {
+	runes := []rune(text)
+	if len(runes) > width {
+		return string(runes[:width])
+	}
+	return text + strings.Repeat(" ", width-len(runes))
+}
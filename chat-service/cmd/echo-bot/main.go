@@ -0,0 +1,73 @@
+// Command echo-bot is an example bot built on pkg/chatclient. It answers
+// "!echo <text>" with the text and "!ping" with "pong". It signs in with
+// BOT_API_KEY, or with BOT_USERNAME and BOT_PASSWORD.
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/meetohin/web-chat/chat-service/pkg/chatclient"
+)
+
+func main() {
+	c := chatclient.New(chatclient.Config{
+		BaseURL:  getEnv("CHAT_URL", "http://localhost:8080"),
+		APIKey:   os.Getenv("BOT_API_KEY"),
+		Username: getEnv("BOT_USERNAME", "echo-bot"),
+		Password: os.Getenv("BOT_PASSWORD"),
+		Logger:   log.Default(),
+	})
+
+	c.OnConnect(func() {
+		log.Println("Echo bot connected")
+	})
+
+	c.OnMessage(func(m chatclient.Message) {
+		// Skip history so restarts do not answer old messages twice, and our own
+		// replies so "!echo !echo x" cannot make the bot talk to itself
+		if m.Replayed || m.Own {
+			return
+		}
+
+		var reply string
+		switch {
+		case m.Text == "!ping":
+			reply = "pong"
+		case strings.HasPrefix(m.Text, "!echo "):
+			reply = strings.TrimSpace(strings.TrimPrefix(m.Text, "!echo "))
+		}
+		if reply == "" {
+			return
+		}
+
+		if err := c.SendText(reply); err != nil {
+			log.Printf("Failed to reply to %s: %v", m.Username, err)
+		}
+	})
+
+	c.OnSystem(func(e chatclient.SystemEvent) {
+		if e.Ephemeral {
+			log.Printf("Server: %s", e.Text)
+		}
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := c.Run(ctx); err != nil && ctx.Err() == nil {
+		log.Fatalf("Echo bot stopped: %v", err)
+	}
+	log.Println("Echo bot stopped")
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
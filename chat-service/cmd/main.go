@@ -1,19 +1,30 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/go-redis/redis/v8"
 	_ "github.com/lib/pq"
 	"github.com/meetohin/web-chat/chat-service/internal/client"
+	"github.com/meetohin/web-chat/chat-service/internal/export"
 	"github.com/meetohin/web-chat/chat-service/internal/handler"
+	"github.com/meetohin/web-chat/chat-service/internal/oidc"
+	"github.com/meetohin/web-chat/chat-service/internal/ratelimit"
 	"github.com/meetohin/web-chat/chat-service/internal/repository"
+	"github.com/meetohin/web-chat/chat-service/internal/retention"
 	"github.com/meetohin/web-chat/chat-service/internal/service"
+	"github.com/meetohin/web-chat/chat-service/internal/webhook"
 )
 
 func main() {
@@ -54,50 +65,184 @@ func main() {
 	// Init PostgreSQL message repository
 	messageRepo := repository.NewPostgreSQLMessageRepository(db)
 
+	webhookRepo := repository.NewPostgreSQLWebhookRepository(db)
+	incomingRepo := repository.NewPostgreSQLIncomingWebhookRepository(db)
+	scheduledRepo := repository.NewPostgreSQLScheduledMessageRepository(db)
+	retentionRepo := repository.NewPostgreSQLRetentionRepository(db)
+	exportRepo := repository.NewPostgreSQLExportRepository(db)
+
 	// Create tables if not exist
-	if postgresRepo, ok := messageRepo.(*repository.PostgreSQLMessageRepository); ok {
-		// Type assertion to access CreateTables method
-		type tableCreator interface {
-			CreateTables() error
-		}
-		if creator, ok := interface{}(postgresRepo).(tableCreator); ok {
+	type tableCreator interface {
+		CreateTables() error
+	}
+	for _, repo := range []interface{}{messageRepo, webhookRepo, incomingRepo, scheduledRepo, retentionRepo, exportRepo} {
+		if creator, ok := repo.(tableCreator); ok {
 			if err := creator.CreateTables(); err != nil {
 				log.Fatalf("Failed to create tables: %v", err)
 			}
-			log.Println("Database tables initialized")
 		}
 	}
+	log.Println("Database tables initialized")
 
-	// Chat service with notification
+	// Chat service with notification; one Redis client is shared for sessions, commands, presence and notifications
 	redisURL := getEnv("REDIS_URL", "redis://localhost:6379/1")
-	chatService, err := service.NewChatService(authClient, messageRepo, redisURL)
+	redisOpts, err := redis.ParseURL(redisURL)
 	if err != nil {
-		log.Fatalf("Failed to create chat service: %v", err)
+		log.Fatalf("Invalid Redis URL: %v", err)
+	}
+	rdb := redis.NewClient(redisOpts)
+	defer rdb.Close()
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		log.Fatalf("Failed to connect to Redis: %v", err)
+	}
+
+	// Outgoing webhooks
+	webhookConfig := webhook.DefaultConfig()
+	webhookConfig.Workers = getIntEnv("WEBHOOK_WORKERS", webhookConfig.Workers)
+	webhookConfig.MaxAttempts = getIntEnv("WEBHOOK_MAX_ATTEMPTS", webhookConfig.MaxAttempts)
+	webhookConfig.BaseDelay = getDurationEnv("WEBHOOK_RETRY_BASE", webhookConfig.BaseDelay)
+	webhookConfig.MaxDelay = getDurationEnv("WEBHOOK_RETRY_MAX", webhookConfig.MaxDelay)
+	webhookConfig.Timeout = getDurationEnv("WEBHOOK_TIMEOUT", webhookConfig.Timeout)
+	webhookConfig.AllowPrivate = getEnv("WEBHOOK_ALLOW_PRIVATE", "false") == "true"
+
+	dispatcher := webhook.NewDispatcher(rdb, webhookRepo, webhookConfig)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dispatcher.Start(ctx)
+
+	chatService := service.NewChatService(authClient, messageRepo, scheduledRepo, dispatcher, rdb)
+
+	// Slash commands answered by external services, e.g. SLASH_COMMANDS="weather=http://localhost:9100/weather"
+	commandSecret := getEnv("SLASH_COMMAND_SECRET", "")
+	for _, entry := range strings.Split(getEnv("SLASH_COMMANDS", ""), ",") {
+		name, endpoint, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			continue
+		}
+		err := chatService.RegisterExternalCommand(service.ExternalCommand{Name: name, URL: endpoint, Secret: commandSecret})
+		if err != nil {
+			log.Fatalf("Failed to register slash command: %v", err)
+		}
+		log.Printf("Slash command /%s handled by %s", name, endpoint)
+	}
+
+	// Single sign-on
+	oidcIssuer := getEnv("OIDC_ISSUER_URL", "")
+	ssoEnabled := oidcIssuer != ""
+
+	// Client IPs are taken from proxy headers only when set by these proxies, e.g. TRUSTED_PROXIES="10.0.0.0/8"
+	if err := handler.TrustProxies(strings.Split(getEnv("TRUSTED_PROXIES", ""), ",")); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
 	}
-	defer chatService.Close()
 
 	// Handlers
-	chatHandler := handler.NewChatHandler(authClient, chatService)
+	chatHandler := handler.NewChatHandler(authClient, chatService, ssoEnabled)
+	webhookHandler := handler.NewWebhookHandler(authClient, webhookRepo, dispatcher)
+	legalHoldHandler := handler.NewLegalHoldHandler(authClient, retentionRepo, rdb)
+	if err := retention.PublishLegalHolds(ctx, rdb, retentionRepo); err != nil {
+		log.Printf("Failed to publish legal holds: %v", err)
+	}
+
+	// History exports are written to local disk and downloaded from the instance that ran them
+	exporter, err := export.NewExporter(messageRepo, exportRepo,
+		getEnv("EXPORT_DIR", filepath.Join(os.TempDir(), "chat-exports")), getDurationEnv("EXPORT_TTL", 72*time.Hour))
+	if err != nil {
+		log.Fatalf("Failed to create exporter: %v", err)
+	}
+	go exporter.Start(ctx)
+	exportHandler := handler.NewExportHandler(authClient, exportRepo, exporter)
+	incomingHandler := handler.NewIncomingWebhookHandler(authClient, chatService, incomingRepo,
+		ratelimit.New(rdb, "ratelimit:incoming"), getEnv("PUBLIC_URL", "http://localhost:8080"))
 
 	// Start chat service
-	go chatService.Run()
-
-	// Routes
-	http.HandleFunc("/", chatHandler.LoginPage)
-	http.HandleFunc("/login", chatHandler.LoginPage)
-	http.HandleFunc("/register", chatHandler.RegisterPage)
-	http.HandleFunc("/chat", chatHandler.ChatPage)
-	http.HandleFunc("/api/login", chatHandler.Login)
-	http.HandleFunc("/api/register", chatHandler.Register)
-	http.HandleFunc("/api/stats", chatHandler.Stats)
-	http.HandleFunc("/ws", chatHandler.WebSocket)
+	go chatService.Run(ctx)
+	go chatService.RunScheduler(ctx, getDurationEnv("SCHEDULER_INTERVAL", 5*time.Second))
+
+	// Message retention; purge metrics are published at /debug/vars on METRICS_ADDR
+	retentionConfig := retention.DefaultConfig()
+	retentionConfig.MaxAge = time.Duration(getIntEnv("MESSAGE_RETENTION_DAYS", 0)) * 24 * time.Hour
+	retentionConfig.MaxMessages = getIntEnv("MESSAGE_RETENTION_MAX_COUNT", 0)
+	retentionConfig.Interval = getDurationEnv("RETENTION_INTERVAL", retentionConfig.Interval)
+	retentionConfig.BatchSize = getIntEnv("RETENTION_BATCH_SIZE", retentionConfig.BatchSize)
+	if retentionConfig.Enabled() {
+		go retention.NewPurger(retentionRepo, retentionConfig).Start(ctx)
+		log.Printf("Message retention enabled: max age %s, max count %d", retentionConfig.MaxAge, retentionConfig.MaxMessages)
+	}
+
+	// Routes. The public mux leaves out /debug/vars, which expvar adds to the default mux.
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", chatHandler.LoginPage)
+	mux.HandleFunc("/login", chatHandler.LoginPage)
+	mux.HandleFunc("/register", chatHandler.RegisterPage)
+	mux.HandleFunc("/reset-password", chatHandler.ResetPasswordPage)
+	mux.HandleFunc("/verify-email", chatHandler.VerifyEmailPage)
+	mux.HandleFunc("/chat", chatHandler.ChatPage)
+	mux.HandleFunc("/sessions", chatHandler.SessionsPage)
+	mux.HandleFunc("/api/login", chatHandler.Login)
+	mux.HandleFunc("/api/register", chatHandler.Register)
+	mux.HandleFunc("/api/password/change", chatHandler.ChangePassword)
+	mux.HandleFunc("/api/password/forgot", chatHandler.ForgotPassword)
+	mux.HandleFunc("/api/password/reset", chatHandler.ResetPassword)
+	mux.HandleFunc("/api/email/verify", chatHandler.VerifyEmail)
+	mux.HandleFunc("/api/email/resend", chatHandler.ResendVerification)
+	mux.HandleFunc("/api/2fa/enroll", chatHandler.EnrollTOTP)
+	mux.HandleFunc("/api/2fa/confirm", chatHandler.ConfirmTOTP)
+	mux.HandleFunc("/api/2fa/disable", chatHandler.DisableTOTP)
+	mux.HandleFunc("/api/sessions", chatHandler.Sessions)
+	mux.HandleFunc("/api/sessions/revoke", chatHandler.RevokeSession)
+	mux.HandleFunc("/api/messages", chatHandler.Messages)
+	mux.HandleFunc("/api/scheduled", chatHandler.ScheduledMessages)
+	mux.HandleFunc("/api/scheduled/cancel", chatHandler.CancelScheduledMessage)
+	mux.HandleFunc("/api/stats", chatHandler.Stats)
+	mux.HandleFunc("/api/admin/unlock", chatHandler.UnlockAccount)
+	mux.HandleFunc("/api/admin/bots", chatHandler.CreateBot)
+	mux.HandleFunc("/api/admin/api-keys", chatHandler.APIKeys)
+	mux.HandleFunc("/api/admin/api-keys/revoke", chatHandler.RevokeAPIKey)
+	mux.HandleFunc("/api/admin/webhooks", webhookHandler.Webhooks)
+	mux.HandleFunc("/api/admin/webhooks/delete", webhookHandler.DeleteWebhook)
+	mux.HandleFunc("/api/admin/webhooks/ping", webhookHandler.PingWebhook)
+	mux.HandleFunc("/api/admin/webhooks/deliveries", webhookHandler.Deliveries)
+	mux.HandleFunc("/api/admin/incoming-webhooks", incomingHandler.IncomingWebhooks)
+	mux.HandleFunc("/api/admin/incoming-webhooks/delete", incomingHandler.DeleteIncomingWebhook)
+	mux.HandleFunc(handler.IncomingWebhookPath, incomingHandler.Receive)
+	mux.HandleFunc("/api/admin/legal-holds", legalHoldHandler.LegalHolds)
+	mux.HandleFunc("/api/admin/legal-holds/release", legalHoldHandler.ReleaseLegalHold)
+	mux.HandleFunc("/api/admin/exports", exportHandler.Exports)
+	mux.HandleFunc("/api/admin/exports/status", exportHandler.ExportStatus)
+	mux.HandleFunc("/api/admin/exports/download", exportHandler.DownloadExport)
+	mux.HandleFunc("/ws", chatHandler.WebSocket)
+
+	if ssoEnabled {
+		if getEnv("OIDC_CLIENT_ID", "") == "" {
+			log.Fatal("OIDC_CLIENT_ID is required when OIDC_ISSUER_URL is set")
+		}
+		oidcHandler := handler.NewOIDCHandler(authClient, oidc.NewClient(oidc.Config{
+			IssuerURL:    oidcIssuer,
+			ClientID:     getEnv("OIDC_CLIENT_ID", ""),
+			ClientSecret: getEnv("OIDC_CLIENT_SECRET", ""),
+			RedirectURL:  getEnv("OIDC_REDIRECT_URL", "http://localhost:8080/auth/oidc/callback"),
+			Scopes:       strings.Fields(getEnv("OIDC_SCOPES", "openid profile email groups")),
+		}))
+		mux.HandleFunc("/auth/oidc/login", oidcHandler.Login)
+		mux.HandleFunc("/auth/oidc/callback", oidcHandler.Callback)
+		log.Printf("Single sign-on enabled with issuer %s", oidcIssuer)
+	}
 
 	// Static files
-	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("web/static/"))))
+	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("web/static/"))))
 
 	// Graceful shutdown
 	serverPort := getEnv("PORT", "8080")
-	server := &http.Server{Addr: ":" + serverPort}
+	server := &http.Server{Addr: ":" + serverPort, Handler: mux}
+
+	// Metrics (expvar) at /debug/vars, on an admin listener that is kept off the public port
+	metricsAddr := getEnv("METRICS_ADDR", ":9101")
+	go func() {
+		if err := http.ListenAndServe(metricsAddr, nil); err != nil {
+			log.Printf("Metrics server stopped: %v", err)
+		}
+	}()
 
 	go func() {
 		log.Printf("Chat service is running on port %s", serverPort)
@@ -111,6 +256,7 @@ func main() {
 	<-quit
 
 	log.Println("Shutting down chat service...")
+	cancel()
 
 	// Graceful shutdown with timeout
 	if err := server.Close(); err != nil {
@@ -126,3 +272,21 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getIntEnv(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
@@ -0,0 +1,105 @@
+// Command webhook-receiver is a local HTTP endpoint for checking outgoing webhooks.
+// It verifies the signature of every delivery and prints the event. Setting
+// WEBHOOK_RECEIVER_FAIL=N answers the first N attempts of each event with 500,
+// which exercises the retry path.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/meetohin/web-chat/chat-service/internal/webhook"
+)
+
+// maxClockSkew is how old a delivery's timestamp may be before it is treated as a replay
+const maxClockSkew = 5 * time.Minute
+
+type receiver struct {
+	secret   string
+	failures int
+
+	mu       sync.Mutex
+	attempts map[string]int
+}
+
+func main() {
+	port := getEnv("WEBHOOK_RECEIVER_PORT", "9100")
+	failures, _ := strconv.Atoi(getEnv("WEBHOOK_RECEIVER_FAIL", "0"))
+
+	r := &receiver{
+		secret:   os.Getenv("WEBHOOK_SECRET"),
+		failures: failures,
+		attempts: make(map[string]int),
+	}
+	if r.secret == "" {
+		log.Println("WEBHOOK_SECRET is not set, signatures will not be verified")
+	}
+
+	http.HandleFunc("/", r.handle)
+
+	log.Printf("Webhook receiver listening on http://localhost:%s/", port)
+	log.Fatal(http.ListenAndServe(":"+port, nil))
+}
+
+func (rc *receiver) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "Failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	eventID := r.Header.Get(webhook.HeaderEventID)
+	event := r.Header.Get(webhook.HeaderEvent)
+
+	if rc.secret != "" {
+		timestamp, err := strconv.ParseInt(r.Header.Get(webhook.HeaderTimestamp), 10, 64)
+		if err != nil || time.Since(time.Unix(timestamp, 0)).Abs() > maxClockSkew {
+			log.Printf("REJECTED %s %s: missing or stale timestamp", event, eventID)
+			http.Error(w, "Invalid timestamp", http.StatusUnauthorized)
+			return
+		}
+		if !webhook.Verify(rc.secret, timestamp, body, r.Header.Get(webhook.HeaderSignature)) {
+			log.Printf("REJECTED %s %s: bad signature", event, eventID)
+			http.Error(w, "Invalid signature", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	rc.mu.Lock()
+	rc.attempts[eventID]++
+	attempt := rc.attempts[eventID]
+	rc.mu.Unlock()
+
+	if attempt <= rc.failures {
+		log.Printf("FAILING %s %s (attempt %d of %d simulated failures)", event, eventID, attempt, rc.failures)
+		http.Error(w, "Simulated failure", http.StatusInternalServerError)
+		return
+	}
+
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, body, "", "  "); err != nil {
+		pretty.Write(body)
+	}
+	log.Printf("RECEIVED %s %s (attempt %d)\n%s", event, eventID, attempt, pretty.String())
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -7,6 +7,7 @@ require (
 	github.com/gorilla/websocket v1.5.3
 	github.com/lib/pq v1.10.9
 	github.com/meetohin/web-chat/auth-service v0.0.0-20250613165258-63b21c662387
+	golang.org/x/term v0.32.0
 	google.golang.org/grpc v1.73.0
 )
 
@@ -19,3 +20,6 @@ require (
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20250324211829-b45e905df463 // indirect
 	google.golang.org/protobuf v1.36.6 // indirect
 )
+
+// auth-service is developed in this repository; builds use its current source
+replace github.com/meetohin/web-chat/auth-service => ../auth-service
@@ -2,11 +2,84 @@ package client
 
 import (
 	"context"
+	"errors"
+	"time"
+
 	pb "github.com/meetohin/web-chat/auth-service/proto"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+// Metadata keys describing the end user's device to auth-service
+const (
+	clientIPMetadataKey  = "x-client-ip"
+	userAgentMetadataKey = "x-user-agent"
 )
 
+// LoginError is returned when auth-service rejects a login
+type LoginError struct {
+	Message    string
+	RetryAfter time.Duration // non-zero when the login was throttled
+}
+
+func (e *LoginError) Error() string {
+	return e.Message
+}
+
+// WithClientIP attaches the end user's IP address to outgoing auth-service calls
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	if ip == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, clientIPMetadataKey, ip)
+}
+
+// WithUserAgent attaches the end user's user agent to outgoing auth-service calls.
+// It is stored with new sessions so users can recognise their devices.
+func WithUserAgent(ctx context.Context, userAgent string) context.Context {
+	if userAgent == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, userAgentMetadataKey, userAgent)
+}
+
+// Identity describes the owner of a valid token
+type Identity struct {
+	Username      string
+	Email         string
+	EmailVerified bool
+	Role          string
+	SessionID     string
+	Bot           bool     // authenticated with an API key
+	Scopes        []string // API key scopes
+}
+
+// API key scopes
+const (
+	ScopeMessagesRead  = "messages:read"
+	ScopeMessagesWrite = "messages:write"
+)
+
+// IsAdmin reports whether the identity is an admin user. API keys never grant admin rights.
+func (i *Identity) IsAdmin() bool {
+	return i.Role == "admin" && !i.Bot
+}
+
+// HasScope reports whether the identity may perform actions of the scope.
+// User tokens are not restricted; API keys only have the scopes they were issued with.
+func (i *Identity) HasScope(scope string) bool {
+	if !i.Bot {
+		return true
+	}
+	for _, s := range i.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
 type AuthClient struct {
 	client pb.AuthServiceClient
 	conn   *grpc.ClientConn
@@ -32,52 +105,520 @@ func (ac *AuthClient) Close() {
 	}
 }
 
-func (ac *AuthClient) ValidateToken(ctx context.Context, token string) (string, error) {
+func (ac *AuthClient) ValidateToken(ctx context.Context, token string) (*Identity, error) {
 	if ctx.Err() != nil {
-		return "", ctx.Err()
+		return nil, ctx.Err()
 	}
 
 	resp, err := ac.client.ValidateToken(ctx, &pb.ValidateTokenRequest{
 		Token: token,
 	})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	if !resp.Valid {
-		return "", err
+		return nil, errors.New("invalid token")
 	}
 
-	return resp.Username, nil
+	return &Identity{
+		Username:      resp.Username,
+		Email:         resp.Email,
+		EmailVerified: resp.EmailVerified,
+		Role:          resp.Role,
+		SessionID:     resp.SessionId,
+		Bot:           resp.Bot,
+		Scopes:        resp.Scopes,
+	}, nil
 }
 
-func (ac *AuthClient) Register(ctx context.Context, username, password string) error {
+func (ac *AuthClient) Register(ctx context.Context, username, email, password string) error {
 	if ctx.Err() != nil {
 		return ctx.Err()
 	}
 
-	_, err := ac.client.Register(ctx, &pb.RegisterRequest{
+	resp, err := ac.client.Register(ctx, &pb.RegisterRequest{
 		Username: username,
 		Password: password,
+		Email:    email,
 	})
-	return err
+	if err != nil {
+		return err
+	}
+
+	if !resp.Success {
+		return errors.New(resp.Message)
+	}
+
+	return nil
 }
 
-func (ac *AuthClient) Login(ctx context.Context, username, password string) (string, error) {
+// LoginResult holds either a session token or, for two-factor users, a challenge token
+type LoginResult struct {
+	Token          string
+	ChallengeToken string
+}
+
+func (ac *AuthClient) Login(ctx context.Context, username, password string) (*LoginResult, error) {
 	if ctx.Err() != nil {
-		return "", ctx.Err()
+		return nil, ctx.Err()
 	}
 	resp, err := ac.client.Login(ctx, &pb.LoginRequest{
 		Username: username,
 		Password: password,
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.TwoFactorRequired {
+		return &LoginResult{ChallengeToken: resp.ChallengeToken}, nil
+	}
+
+	if !resp.Success {
+		return nil, loginError(resp)
+	}
+
+	return &LoginResult{Token: resp.Token}, nil
+}
+
+// CompleteLogin finishes a two-factor login with a TOTP or recovery code
+func (ac *AuthClient) CompleteLogin(ctx context.Context, challengeToken, code string) (string, error) {
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	resp, err := ac.client.CompleteLogin(ctx, &pb.CompleteLoginRequest{
+		ChallengeToken: challengeToken,
+		Code:           code,
+	})
 	if err != nil {
 		return "", err
 	}
 
 	if !resp.Success {
+		return "", loginError(resp)
+	}
+
+	return resp.Token, nil
+}
+
+// OIDCLogin exchanges an ID token from the identity provider for a session token
+func (ac *AuthClient) OIDCLogin(ctx context.Context, idToken, nonce string) (*LoginResult, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	resp, err := ac.client.OIDCLogin(ctx, &pb.OIDCLoginRequest{
+		IdToken: idToken,
+		Nonce:   nonce,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.TwoFactorRequired {
+		return &LoginResult{ChallengeToken: resp.ChallengeToken}, nil
+	}
+
+	if !resp.Success {
+		return nil, loginError(resp)
+	}
+
+	return &LoginResult{Token: resp.Token}, nil
+}
+
+func loginError(resp *pb.LoginResponse) *LoginError {
+	return &LoginError{
+		Message:    resp.Message,
+		RetryAfter: time.Duration(resp.RetryAfterSeconds) * time.Second,
+	}
+}
+
+func (ac *AuthClient) UnlockAccount(ctx context.Context, adminToken, username, ip string) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	resp, err := ac.client.UnlockAccount(ctx, &pb.UnlockAccountRequest{
+		Token:     adminToken,
+		Username:  username,
+		IpAddress: ip,
+	})
+	if err != nil {
+		return err
+	}
+
+	if !resp.Success {
+		return errors.New(resp.Message)
+	}
+
+	return nil
+}
+
+func (ac *AuthClient) ChangePassword(ctx context.Context, token, oldPassword, newPassword string) (string, error) {
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+
+	resp, err := ac.client.ChangePassword(ctx, &pb.ChangePasswordRequest{
+		Token:       token,
+		OldPassword: oldPassword,
+		NewPassword: newPassword,
+	})
+	if err != nil {
 		return "", err
 	}
 
+	if !resp.Success {
+		return "", errors.New(resp.Message)
+	}
+
 	return resp.Token, nil
 }
+
+func (ac *AuthClient) RequestPasswordReset(ctx context.Context, username string) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	resp, err := ac.client.RequestPasswordReset(ctx, &pb.RequestPasswordResetRequest{
+		Username: username,
+	})
+	if err != nil {
+		return err
+	}
+
+	if !resp.Success {
+		return errors.New(resp.Message)
+	}
+
+	return nil
+}
+
+func (ac *AuthClient) ResetPassword(ctx context.Context, resetToken, newPassword string) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	resp, err := ac.client.ResetPassword(ctx, &pb.ResetPasswordRequest{
+		ResetToken:  resetToken,
+		NewPassword: newPassword,
+	})
+	if err != nil {
+		return err
+	}
+
+	if !resp.Success {
+		return errors.New(resp.Message)
+	}
+
+	return nil
+}
+
+func (ac *AuthClient) VerifyEmail(ctx context.Context, verificationToken string) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	resp, err := ac.client.VerifyEmail(ctx, &pb.VerifyEmailRequest{
+		VerificationToken: verificationToken,
+	})
+	if err != nil {
+		return err
+	}
+
+	if !resp.Success {
+		return errors.New(resp.Message)
+	}
+
+	return nil
+}
+
+func (ac *AuthClient) ResendVerification(ctx context.Context, token string) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	resp, err := ac.client.ResendVerification(ctx, &pb.ResendVerificationRequest{
+		Token: token,
+	})
+	if err != nil {
+		return err
+	}
+
+	if !resp.Success {
+		return errors.New(resp.Message)
+	}
+
+	return nil
+}
+
+// TOTPEnrollment holds the secret of a two-factor enrollment in progress
+type TOTPEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+func (ac *AuthClient) EnrollTOTP(ctx context.Context, token string) (*TOTPEnrollment, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	resp, err := ac.client.EnrollTOTP(ctx, &pb.EnrollTOTPRequest{
+		Token: token,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !resp.Success {
+		return nil, errors.New(resp.Message)
+	}
+
+	return &TOTPEnrollment{
+		Secret:          resp.Secret,
+		ProvisioningURI: resp.ProvisioningUri,
+	}, nil
+}
+
+func (ac *AuthClient) ConfirmTOTP(ctx context.Context, token, code string) ([]string, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	resp, err := ac.client.ConfirmTOTP(ctx, &pb.ConfirmTOTPRequest{
+		Token: token,
+		Code:  code,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !resp.Success {
+		return nil, errors.New(resp.Message)
+	}
+
+	return resp.RecoveryCodes, nil
+}
+
+func (ac *AuthClient) DisableTOTP(ctx context.Context, token, password, code string) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	resp, err := ac.client.DisableTOTP(ctx, &pb.DisableTOTPRequest{
+		Token:    token,
+		Password: password,
+		Code:     code,
+	})
+	if err != nil {
+		return err
+	}
+
+	if !resp.Success {
+		return errors.New(resp.Message)
+	}
+
+	return nil
+}
+
+// Session is a login of the user on one device
+type Session struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Current    bool      `json:"current"`
+}
+
+func (ac *AuthClient) ListSessions(ctx context.Context, token string) ([]Session, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	resp, err := ac.client.ListSessions(ctx, &pb.ListSessionsRequest{
+		Token: token,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !resp.Success {
+		return nil, errors.New(resp.Message)
+	}
+
+	sessions := make([]Session, 0, len(resp.Sessions))
+	for _, s := range resp.Sessions {
+		sessions = append(sessions, Session{
+			ID:         s.Id,
+			UserAgent:  s.UserAgent,
+			IPAddress:  s.IpAddress,
+			CreatedAt:  time.Unix(s.CreatedAt, 0),
+			LastSeenAt: time.Unix(s.LastSeenAt, 0),
+			Current:    s.Current,
+		})
+	}
+	return sessions, nil
+}
+
+func (ac *AuthClient) RevokeSession(ctx context.Context, token, sessionID string) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	resp, err := ac.client.RevokeSession(ctx, &pb.RevokeSessionRequest{
+		Token:     token,
+		SessionId: sessionID,
+	})
+	if err != nil {
+		return err
+	}
+
+	if !resp.Success {
+		return errors.New(resp.Message)
+	}
+
+	return nil
+}
+
+// APIKey describes a bot's API key without its secret value
+type APIKey struct {
+	ID          int64      `json:"id"`
+	BotUsername string     `json:"bot_username"`
+	Name        string     `json:"name"`
+	Prefix      string     `json:"prefix"`
+	Scopes      []string   `json:"scopes"`
+	CreatedBy   string     `json:"created_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	Revoked     bool       `json:"revoked"`
+}
+
+func apiKeyFromProto(k *pb.APIKey) APIKey {
+	key := APIKey{
+		ID:          k.Id,
+		BotUsername: k.BotUsername,
+		Name:        k.Name,
+		Prefix:      k.Prefix,
+		Scopes:      k.Scopes,
+		CreatedBy:   k.CreatedBy,
+		CreatedAt:   time.Unix(k.CreatedAt, 0),
+		Revoked:     k.Revoked,
+	}
+	if k.LastUsedAt != 0 {
+		lastUsedAt := time.Unix(k.LastUsedAt, 0)
+		key.LastUsedAt = &lastUsedAt
+	}
+	return key
+}
+
+func (ac *AuthClient) CreateBot(ctx context.Context, adminToken, username string) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	resp, err := ac.client.CreateBot(ctx, &pb.CreateBotRequest{
+		Token:    adminToken,
+		Username: username,
+	})
+	if err != nil {
+		return err
+	}
+
+	if !resp.Success {
+		return errors.New(resp.Message)
+	}
+
+	return nil
+}
+
+// CreateAPIKey issues a key for a bot and returns its secret value, which cannot be retrieved again
+func (ac *AuthClient) CreateAPIKey(ctx context.Context, adminToken, botUsername, name string, scopes []string) (string, *APIKey, error) {
+	if ctx.Err() != nil {
+		return "", nil, ctx.Err()
+	}
+
+	resp, err := ac.client.CreateAPIKey(ctx, &pb.CreateAPIKeyRequest{
+		Token:       adminToken,
+		BotUsername: botUsername,
+		Name:        name,
+		Scopes:      scopes,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	if !resp.Success {
+		return "", nil, errors.New(resp.Message)
+	}
+
+	key := apiKeyFromProto(resp.ApiKey)
+	return resp.Key, &key, nil
+}
+
+func (ac *AuthClient) ListAPIKeys(ctx context.Context, adminToken, botUsername string) ([]APIKey, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	resp, err := ac.client.ListAPIKeys(ctx, &pb.ListAPIKeysRequest{
+		Token:       adminToken,
+		BotUsername: botUsername,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !resp.Success {
+		return nil, errors.New(resp.Message)
+	}
+
+	keys := make([]APIKey, 0, len(resp.ApiKeys))
+	for _, k := range resp.ApiKeys {
+		keys = append(keys, apiKeyFromProto(k))
+	}
+	return keys, nil
+}
+
+func (ac *AuthClient) RevokeAPIKey(ctx context.Context, adminToken string, keyID int64) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	resp, err := ac.client.RevokeAPIKey(ctx, &pb.RevokeAPIKeyRequest{
+		Token: adminToken,
+		KeyId: keyID,
+	})
+	if err != nil {
+		return err
+	}
+
+	if !resp.Success {
+		return errors.New(resp.Message)
+	}
+
+	return nil
+}
+
+// ImportUser maps a user of another chat system to a local account, creating a
+// placeholder if there is none. It returns the local username and whether it was created.
+func (ac *AuthClient) ImportUser(ctx context.Context, adminToken, username, email string) (string, bool, error) {
+	if ctx.Err() != nil {
+		return "", false, ctx.Err()
+	}
+
+	resp, err := ac.client.ImportUser(ctx, &pb.ImportUserRequest{
+		Token:    adminToken,
+		Username: username,
+		Email:    email,
+	})
+	if err != nil {
+		return "", false, err
+	}
+
+	if !resp.Success {
+		return "", false, errors.New(resp.Message)
+	}
+
+	return resp.Username, resp.Created, nil
+}
@@ -0,0 +1,229 @@
+// Package export writes chat history to downloadable files in the background
+package export
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/meetohin/web-chat/chat-service/internal/repository"
+)
+
+const (
+	batchSize        = 500
+	progressInterval = time.Second
+	maxConcurrent    = 2
+)
+
+// ErrNotAvailable is returned for exports that are not finished or whose file is kept by another instance
+var ErrNotAvailable = errors.New("export is not available for download")
+
+// Exporter runs export jobs and keeps their files until they expire
+type Exporter struct {
+	messageRepo repository.MessageRepository
+	exportRepo  repository.ExportRepository
+	dir         string
+	ttl         time.Duration
+	worker      string
+	slots       chan struct{}
+}
+
+// NewExporter creates an exporter that stores files in dir for ttl. Jobs this host
+// was running before a restart are marked as failed.
+func NewExporter(messageRepo repository.MessageRepository, exportRepo repository.ExportRepository, dir string, ttl time.Duration) (*Exporter, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create export directory: %w", err)
+	}
+
+	worker, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+
+	if failed, err := exportRepo.FailInterruptedExports(worker); err != nil {
+		return nil, err
+	} else if failed > 0 {
+		log.Printf("Marked %d interrupted exports as failed", failed)
+	}
+
+	return &Exporter{
+		messageRepo: messageRepo,
+		exportRepo:  exportRepo,
+		dir:         dir,
+		ttl:         ttl,
+		worker:      worker,
+		slots:       make(chan struct{}, maxConcurrent),
+	}, nil
+}
+
+// Create queues an export job and starts it in the background
+func (e *Exporter) Create(job *repository.ExportJob) error {
+	if !IsFormat(job.Format) {
+		return fmt.Errorf("unsupported format %q", job.Format)
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	job.ID = hex.EncodeToString(id)
+	job.Worker = e.worker
+
+	if err := e.exportRepo.CreateExportJob(job); err != nil {
+		return err
+	}
+
+	go e.run(job)
+	return nil
+}
+
+// Open returns the file of a finished export
+func (e *Exporter) Open(job *repository.ExportJob) (*os.File, error) {
+	if job.Status != repository.ExportDone || job.Worker != e.worker {
+		return nil, ErrNotAvailable
+	}
+	return os.Open(e.path(job))
+}
+
+// Start removes expired export files every hour until ctx is cancelled
+func (e *Exporter) Start(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		e.removeExpired()
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (e *Exporter) removeExpired() {
+	jobs, err := e.exportRepo.ExpireExports(e.worker, time.Now().Add(-e.ttl))
+	if err != nil {
+		log.Printf("Failed to expire exports: %v", err)
+		return
+	}
+
+	for i := range jobs {
+		if err := os.Remove(e.path(&jobs[i])); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove export %s: %v", jobs[i].ID, err)
+		}
+	}
+}
+
+func (e *Exporter) path(job *repository.ExportJob) string {
+	return filepath.Join(e.dir, job.ID+"."+job.Format)
+}
+
+func (e *Exporter) run(job *repository.ExportJob) {
+	e.slots <- struct{}{}
+	defer func() { <-e.slots }()
+
+	started := time.Now()
+	size, err := e.write(job)
+	if err != nil {
+		log.Printf("Export %s failed: %v", job.ID, err)
+		if err := e.exportRepo.FinishExportJob(job.ID, repository.ExportFailed, err.Error(), 0); err != nil {
+			log.Printf("Failed to record failure of export %s: %v", job.ID, err)
+		}
+		return
+	}
+
+	if err := e.exportRepo.FinishExportJob(job.ID, repository.ExportDone, "", size); err != nil {
+		log.Printf("Failed to record completion of export %s: %v", job.ID, err)
+		return
+	}
+	log.Printf("Export %s finished: %d messages, %d bytes in %s", job.ID, job.Processed, size, time.Since(started).Round(time.Millisecond))
+}
+
+// write streams the matching messages into the export file and returns its size
+func (e *Exporter) write(job *repository.ExportJob) (int64, error) {
+	filter := repository.MessageFilter{Username: job.Username}
+	if job.From != nil {
+		filter.From = *job.From
+	}
+	if job.To != nil {
+		filter.To = *job.To
+	}
+
+	total, err := e.messageRepo.CountMessages(filter)
+	if err != nil {
+		return 0, err
+	}
+	if err := e.exportRepo.StartExportJob(job.ID, total); err != nil {
+		return 0, err
+	}
+
+	// Write to a temporary name so a partial file is never offered for download
+	partial := e.path(job) + ".part"
+	file, err := os.OpenFile(partial, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(partial)
+	defer file.Close()
+
+	w := newRecordWriter(job.Format, file)
+	if err := w.begin(job); err != nil {
+		return 0, err
+	}
+
+	var after *repository.Message
+	lastProgress := time.Now()
+	for {
+		messages, err := e.messageRepo.ListMessages(filter, after, batchSize)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, msg := range messages {
+			if err := w.write(msg); err != nil {
+				return 0, err
+			}
+		}
+		if len(messages) > 0 {
+			after = &messages[len(messages)-1]
+		}
+		job.Processed += len(messages)
+
+		if time.Since(lastProgress) >= progressInterval {
+			if err := e.exportRepo.UpdateExportProgress(job.ID, job.Processed); err != nil {
+				log.Printf("Failed to update progress of export %s: %v", job.ID, err)
+			}
+			lastProgress = time.Now()
+		}
+
+		if len(messages) < batchSize {
+			break
+		}
+	}
+
+	if err := w.end(job.Processed); err != nil {
+		return 0, err
+	}
+	if err := e.exportRepo.UpdateExportProgress(job.ID, job.Processed); err != nil {
+		return 0, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if err := file.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(partial, e.path(job)); err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
@@ -0,0 +1,170 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/meetohin/web-chat/chat-service/internal/repository"
+)
+
+// Export formats
+const (
+	FormatJSONL = "jsonl"
+	FormatCSV   = "csv"
+	FormatHTML  = "html"
+)
+
+// IsFormat reports whether format is supported
+func IsFormat(format string) bool {
+	return format == FormatJSONL || format == FormatCSV || format == FormatHTML
+}
+
+// ContentType returns the MIME type of an export file
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatHTML:
+		return "text/html; charset=utf-8"
+	default:
+		return "application/x-ndjson"
+	}
+}
+
+// recordWriter writes messages in one of the export formats
+type recordWriter interface {
+	begin(job *repository.ExportJob) error
+	write(msg repository.Message) error
+	end(count int) error
+}
+
+func newRecordWriter(format string, w io.Writer) recordWriter {
+	switch format {
+	case FormatCSV:
+		return &csvWriter{w: csv.NewWriter(w)}
+	case FormatHTML:
+		return &htmlWriter{w: bufio.NewWriter(w)}
+	default:
+		return &jsonlWriter{w: bufio.NewWriter(w)}
+	}
+}
+
+// jsonlWriter writes one JSON object per line
+type jsonlWriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (j *jsonlWriter) begin(job *repository.ExportJob) error {
+	j.enc = json.NewEncoder(j.w)
+	j.enc.SetEscapeHTML(false)
+	return nil
+}
+
+func (j *jsonlWriter) write(msg repository.Message) error {
+	return j.enc.Encode(msg)
+}
+
+func (j *jsonlWriter) end(count int) error { return j.w.Flush() }
+
+// csvWriter writes a header row and one row per message
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvWriter) begin(job *repository.ExportJob) error {
+	return c.w.Write([]string{"id", "timestamp", "username", "text"})
+}
+
+func (c *csvWriter) write(msg repository.Message) error {
+	return c.w.Write([]string{strconv.Itoa(msg.ID), msg.Timestamp.UTC().Format(time.RFC3339), csvCell(msg.Username), csvCell(msg.Text)})
+}
+
+// csvCell keeps spreadsheets from evaluating user text as a formula by prefixing
+// values that start with a formula character with an apostrophe
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func (c *csvWriter) end(count int) error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// htmlWriter writes a single HTML page with inline styles that opens without a server
+type htmlWriter struct {
+	w *bufio.Writer
+}
+
+const htmlHeader = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="UTF-8">
+<title>Chat export %s</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif; margin: 0; background: #f5f6fa; color: #222; }
+header { padding: 24px 32px; background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%); color: #fff; }
+header h1 { margin: 0 0 8px; font-size: 22px; }
+header p { margin: 2px 0; font-size: 13px; opacity: 0.9; }
+main { padding: 16px 32px; }
+.message { margin: 0 0 10px; padding: 10px 14px; background: #fff; border-radius: 8px; box-shadow: 0 1px 3px rgba(0, 0, 0, 0.08); }
+.meta { font-size: 12px; color: #666; margin-bottom: 4px; }
+.username { font-weight: bold; color: #5a4fcf; margin-right: 8px; }
+.text { white-space: pre-wrap; word-wrap: break-word; }
+footer { padding: 16px 32px; font-size: 12px; color: #666; }
+</style>
+</head>
+<body>
+<header>
+<h1>Chat export</h1>
+`
+
+func (h *htmlWriter) begin(job *repository.ExportJob) error {
+	fmt.Fprintf(h.w, htmlHeader, html.EscapeString(job.ID))
+
+	var filters []string
+	if job.From != nil {
+		filters = append(filters, "from "+job.From.UTC().Format(time.RFC3339))
+	}
+	if job.To != nil {
+		filters = append(filters, "until "+job.To.UTC().Format(time.RFC3339))
+	}
+	if job.Username != "" {
+		filters = append(filters, "by "+job.Username)
+	}
+	if len(filters) == 0 {
+		filters = append(filters, "all messages")
+	}
+
+	fmt.Fprintf(h.w, "<p>Messages: %s</p>\n", html.EscapeString(strings.Join(filters, ", ")))
+	fmt.Fprintf(h.w, "<p>Exported by %s on %s</p>\n</header>\n<main>\n",
+		html.EscapeString(job.CreatedBy), time.Now().UTC().Format(time.RFC3339))
+	return nil
+}
+
+func (h *htmlWriter) write(msg repository.Message) error {
+	_, err := fmt.Fprintf(h.w,
+		"<div class=\"message\" id=\"m%d\"><div class=\"meta\"><span class=\"username\">%s</span><time datetime=\"%s\">%s</time></div><div class=\"text\">%s</div></div>\n",
+		msg.ID,
+		html.EscapeString(msg.Username),
+		msg.Timestamp.UTC().Format(time.RFC3339),
+		msg.Timestamp.UTC().Format("2006-01-02 15:04:05 UTC"),
+		html.EscapeString(msg.Text),
+	)
+	return err
+}
+
+func (h *htmlWriter) end(count int) error {
+	fmt.Fprintf(h.w, "</main>\n<footer>%d messages</footer>\n</body>\n</html>\n", count)
+	return h.w.Flush()
+}
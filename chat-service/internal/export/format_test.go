@@ -0,0 +1,56 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+	"time"
+
+	"github.com/meetohin/web-chat/chat-service/internal/repository"
+)
+
+func TestCSVCell(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", ""},
+		{"hello", "hello"},
+		{"1+1", "1+1"},
+		{"=HYPERLINK(\"http://evil\")", "'=HYPERLINK(\"http://evil\")"},
+		{"+1", "'+1"},
+		{"-1", "'-1"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\t=1", "'\t=1"},
+		{"\r=1", "'\r=1"},
+	}
+	for _, tt := range tests {
+		if got := csvCell(tt.value); got != tt.want {
+			t.Errorf("csvCell(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestCSVWriterEscapesFormulas(t *testing.T) {
+	var buf bytes.Buffer
+	w := &csvWriter{w: csv.NewWriter(&buf)}
+	if err := w.begin(&repository.ExportJob{}); err != nil {
+		t.Fatal(err)
+	}
+	err := w.write(repository.Message{ID: 7, Username: "=alice", Text: "=cmd|' /C calc'!A0", Timestamp: time.Unix(0, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.end(1); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := records[1]
+	if row[2] != "'=alice" || row[3] != "'=cmd|' /C calc'!A0" {
+		t.Errorf("got row %q, want the username and text prefixed with an apostrophe", row)
+	}
+}
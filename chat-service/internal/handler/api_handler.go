@@ -0,0 +1,219 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/meetohin/web-chat/chat-service/internal/client"
+	"github.com/meetohin/web-chat/chat-service/internal/service"
+)
+
+// Messages lets scripts and bots read and post chat messages over plain HTTP.
+// Authenticate with "Authorization: Bearer <token or API key>". API keys need the
+// messages:read scope for GET and messages:write for POST.
+func (h *ChatHandler) Messages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := bearerToken(r)
+	if token == "" {
+		http.Error(w, "Token required", http.StatusUnauthorized)
+		return
+	}
+
+	identity, err := h.authClient.ValidateToken(context.Background(), token)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		h.listMessages(w, r, identity)
+		return
+	}
+	h.postMessage(w, r, identity)
+}
+
+func (h *ChatHandler) listMessages(w http.ResponseWriter, r *http.Request, identity *client.Identity) {
+	if !identity.HasScope(client.ScopeMessagesRead) {
+		http.Error(w, "API key lacks the messages:read scope", http.StatusForbidden)
+		return
+	}
+
+	limit := 50
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 500 {
+			http.Error(w, "limit must be between 1 and 500", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	messages, err := h.chatService.RecentMessages(limit)
+	if err != nil {
+		log.Printf("Error getting recent messages: %v", err)
+		http.Error(w, "Failed to load messages", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"messages": messages})
+}
+
+func (h *ChatHandler) postMessage(w http.ResponseWriter, r *http.Request, identity *client.Identity) {
+	if !identity.HasScope(client.ScopeMessagesWrite) {
+		http.Error(w, "API key lacks the messages:write scope", http.StatusForbidden)
+		return
+	}
+
+	// Accept both JSON bodies and form posts, whichever is easier for the script
+	var text string
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var body struct {
+			Text string `json:"text"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&body); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		text = body.Text
+	} else {
+		text = r.FormValue("text")
+	}
+
+	if strings.TrimSpace(text) == "" {
+		http.Error(w, "Text required", http.StatusBadRequest)
+		return
+	}
+
+	message, err := h.chatService.PostMessage(identity.Username, text)
+	if errors.Is(err, service.ErrMuted) {
+		http.Error(w, "User is muted", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		log.Printf("Error saving message: %v", err)
+		http.Error(w, "Failed to save message", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(message)
+}
+
+// CreateBot lets an admin create a bot account
+func (h *ChatHandler) CreateBot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := bearerToken(r)
+	if token == "" {
+		http.Error(w, "Token required", http.StatusUnauthorized)
+		return
+	}
+
+	username := r.FormValue("username")
+	if username == "" {
+		http.Error(w, "Username required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authClient.CreateBot(context.Background(), token, username); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Bot created"})
+}
+
+// APIKeys lets an admin list (GET ?bot=) or create (POST bot, name, scopes) API keys of a bot.
+// Scopes are given comma-separated, e.g. "messages:write".
+func (h *ChatHandler) APIKeys(w http.ResponseWriter, r *http.Request) {
+	token := bearerToken(r)
+	if token == "" {
+		http.Error(w, "Token required", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		bot := r.URL.Query().Get("bot")
+		if bot == "" {
+			http.Error(w, "Bot required", http.StatusBadRequest)
+			return
+		}
+
+		keys, err := h.authClient.ListAPIKeys(context.Background(), token, bot)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string][]client.APIKey{"api_keys": keys})
+
+	case http.MethodPost:
+		var scopes []string
+		for _, scope := range strings.Split(r.FormValue("scopes"), ",") {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				scopes = append(scopes, scope)
+			}
+		}
+
+		key, apiKey, err := h.authClient.CreateAPIKey(context.Background(), token, r.FormValue("bot"), r.FormValue("name"), scopes)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"key":     key,
+			"api_key": apiKey,
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// RevokeAPIKey lets an admin revoke an API key by ID
+func (h *ChatHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := bearerToken(r)
+	if token == "" {
+		http.Error(w, "Token required", http.StatusUnauthorized)
+		return
+	}
+
+	keyID, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Key ID required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authClient.RevokeAPIKey(context.Background(), token, keyID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "API key revoked"})
+}
@@ -3,46 +3,88 @@ package handler
 import (
 	"context"
 	"encoding/json"
-	"github.com/meetohin/web-chat/chat-service/internal/client"
-	"github.com/meetohin/web-chat/chat-service/internal/service"
+	"errors"
 	"html/template"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/meetohin/web-chat/chat-service/internal/client"
+	"github.com/meetohin/web-chat/chat-service/internal/service"
 )
 
 type ChatHandler struct {
 	authClient  *client.AuthClient
 	chatService *service.ChatService
 	templates   *template.Template
+	ssoEnabled  bool
 }
 
-func NewChatHandler(authClient *client.AuthClient, chatService *service.ChatService) *ChatHandler {
+func NewChatHandler(authClient *client.AuthClient, chatService *service.ChatService, ssoEnabled bool) *ChatHandler {
 	tmpl := template.Must(template.ParseGlob("web/templates/*.html"))
 
 	return &ChatHandler{
 		authClient:  authClient,
 		chatService: chatService,
 		templates:   tmpl,
+		ssoEnabled:  ssoEnabled,
 	}
 }
 
 func (h *ChatHandler) LoginPage(w http.ResponseWriter, r *http.Request) {
-	h.templates.ExecuteTemplate(w, "login.html", nil)
+	h.templates.ExecuteTemplate(w, "login.html", map[string]bool{"SSOEnabled": h.ssoEnabled})
 }
 
 func (h *ChatHandler) RegisterPage(w http.ResponseWriter, r *http.Request) {
 	h.templates.ExecuteTemplate(w, "register.html", nil)
 }
 
+func (h *ChatHandler) ResetPasswordPage(w http.ResponseWriter, r *http.Request) {
+	h.templates.ExecuteTemplate(w, "reset-password.html", nil)
+}
+
+func (h *ChatHandler) VerifyEmailPage(w http.ResponseWriter, r *http.Request) {
+	h.templates.ExecuteTemplate(w, "verify-email.html", nil)
+}
+
+func (h *ChatHandler) SessionsPage(w http.ResponseWriter, r *http.Request) {
+	h.templates.ExecuteTemplate(w, "sessions.html", nil)
+}
+
 func (h *ChatHandler) ChatPage(w http.ResponseWriter, r *http.Request) {
 	h.templates.ExecuteTemplate(w, "chat.html", nil)
 }
 
+// Login authenticates with username/email and password. For users with two-factor
+// authentication it answers with a challenge token; posting that token back together
+// with a code completes the login.
 func (h *ChatHandler) Login(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	ctx := client.WithUserAgent(client.WithClientIP(context.Background(), clientIP(r)), r.UserAgent())
+
+	if challengeToken := r.FormValue("challenge_token"); challengeToken != "" {
+		code := r.FormValue("code")
+		if code == "" {
+			http.Error(w, "Authentication code required", http.StatusBadRequest)
+			return
+		}
+
+		token, err := h.authClient.CompleteLogin(ctx, challengeToken, code)
+		if err != nil {
+			writeLoginError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"token": token})
+		return
+	}
+
 	username := r.FormValue("username")
 	password := r.FormValue("password")
 
@@ -51,14 +93,31 @@ func (h *ChatHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := h.authClient.Login(context.Background(), username, password)
+	result, err := h.authClient.Login(ctx, username, password)
 	if err != nil {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		writeLoginError(w, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"token": token})
+	if result.ChallengeToken != "" {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"two_factor_required": true,
+			"challenge_token":     result.ChallengeToken,
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"token": result.Token})
+}
+
+func writeLoginError(w http.ResponseWriter, err error) {
+	var loginErr *client.LoginError
+	if errors.As(err, &loginErr) && loginErr.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(loginErr.RetryAfter.Seconds())))
+		http.Error(w, loginErr.Message, http.StatusTooManyRequests)
+		return
+	}
+	http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 }
 
 func (h *ChatHandler) Register(w http.ResponseWriter, r *http.Request) {
@@ -75,14 +134,21 @@ func (h *ChatHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.authClient.Register(context.Background(), username, password)
+	email := r.FormValue("email")
+
+	err := h.authClient.Register(context.Background(), username, email, password)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	message := "Registration successful"
+	if email != "" {
+		message = "Registration successful. Check your email to verify your address"
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"message": "Registration successful"})
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
 }
 
 func (h *ChatHandler) WebSocket(w http.ResponseWriter, r *http.Request) {
@@ -94,3 +160,320 @@ func (h *ChatHandler) Stats(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(stats)
 }
+
+// ChangePassword changes the password of the authenticated user and returns a fresh token
+func (h *ChatHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := bearerToken(r)
+	if token == "" {
+		http.Error(w, "Token required", http.StatusUnauthorized)
+		return
+	}
+
+	oldPassword := r.FormValue("old_password")
+	newPassword := r.FormValue("new_password")
+
+	if oldPassword == "" || newPassword == "" {
+		http.Error(w, "Old and new password required", http.StatusBadRequest)
+		return
+	}
+
+	ctx := client.WithUserAgent(client.WithClientIP(context.Background(), clientIP(r)), r.UserAgent())
+	newToken, err := h.authClient.ChangePassword(ctx, token, oldPassword, newPassword)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"token": newToken})
+}
+
+// ForgotPassword starts the password reset flow for a username
+func (h *ChatHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	username := r.FormValue("username")
+	if username == "" {
+		http.Error(w, "Username or email required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authClient.RequestPasswordReset(context.Background(), username); err != nil {
+		http.Error(w, "Failed to request password reset", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "If the account exists, reset instructions have been sent"})
+}
+
+// ResetPassword completes the password reset flow with a token from the reset email
+func (h *ChatHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	resetToken := r.FormValue("token")
+	password := r.FormValue("password")
+
+	if resetToken == "" || password == "" {
+		http.Error(w, "Token and password required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authClient.ResetPassword(context.Background(), resetToken, password); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password reset successful"})
+}
+
+// VerifyEmail confirms an email address with a token from the verification email
+func (h *ChatHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	verificationToken := r.FormValue("token")
+	if verificationToken == "" {
+		http.Error(w, "Token required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authClient.VerifyEmail(context.Background(), verificationToken); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Email verified"})
+}
+
+// ResendVerification sends a new verification email to the authenticated user
+func (h *ChatHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := bearerToken(r)
+	if token == "" {
+		http.Error(w, "Token required", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.authClient.ResendVerification(context.Background(), token); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Verification email sent"})
+}
+
+// EnrollTOTP starts two-factor enrollment for the authenticated user
+func (h *ChatHandler) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := bearerToken(r)
+	if token == "" {
+		http.Error(w, "Token required", http.StatusUnauthorized)
+		return
+	}
+
+	enrollment, err := h.authClient.EnrollTOTP(context.Background(), token)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(enrollment)
+}
+
+// ConfirmTOTP enables two-factor authentication and returns the recovery codes
+func (h *ChatHandler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := bearerToken(r)
+	if token == "" {
+		http.Error(w, "Token required", http.StatusUnauthorized)
+		return
+	}
+
+	codes, err := h.authClient.ConfirmTOTP(context.Background(), token, r.FormValue("code"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+}
+
+// DisableTOTP turns two-factor authentication off; it takes the password and a current code
+func (h *ChatHandler) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := bearerToken(r)
+	if token == "" {
+		http.Error(w, "Token required", http.StatusUnauthorized)
+		return
+	}
+
+	ctx := client.WithUserAgent(client.WithClientIP(context.Background(), clientIP(r)), r.UserAgent())
+	if err := h.authClient.DisableTOTP(ctx, token, r.FormValue("password"), r.FormValue("code")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Two-factor authentication disabled"})
+}
+
+// sessionInfo is a session as shown to its owner
+type sessionInfo struct {
+	client.Session
+	Connected bool `json:"connected"` // has a live WebSocket connection
+}
+
+// Sessions lists the active sessions of the authenticated user
+func (h *ChatHandler) Sessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := bearerToken(r)
+	if token == "" {
+		http.Error(w, "Token required", http.StatusUnauthorized)
+		return
+	}
+
+	identity, err := h.authClient.ValidateToken(context.Background(), token)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	sessions, err := h.authClient.ListSessions(context.Background(), token)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	connected := h.chatService.ConnectedSessions(identity.Username)
+	result := make([]sessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		result = append(result, sessionInfo{Session: session, Connected: connected[session.ID]})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]sessionInfo{"sessions": result})
+}
+
+// RevokeSession signs one of the user's sessions out and closes its WebSocket connections
+func (h *ChatHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := bearerToken(r)
+	if token == "" {
+		http.Error(w, "Token required", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID := r.FormValue("session_id")
+	if sessionID == "" {
+		http.Error(w, "Session ID required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authClient.RevokeSession(context.Background(), token, sessionID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.chatService.RevokeSession(context.Background(), sessionID); err != nil {
+		log.Printf("Failed to publish revocation of session %s: %v", sessionID, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Session revoked"})
+}
+
+// UnlockAccount lets an admin clear a login lockout for a username or IP address
+func (h *ChatHandler) UnlockAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := bearerToken(r)
+	if token == "" {
+		http.Error(w, "Token required", http.StatusUnauthorized)
+		return
+	}
+
+	err := h.authClient.UnlockAccount(context.Background(), token, r.FormValue("username"), r.FormValue("ip"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Account unlocked"})
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer" header
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if token, ok := strings.CutPrefix(header, "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// requireScope validates the bearer token and checks that it grants scope.
+// It writes the error response and returns false when it does not.
+func requireScope(w http.ResponseWriter, r *http.Request, authClient *client.AuthClient, scope string) (*client.Identity, bool) {
+	token := bearerToken(r)
+	if token == "" {
+		http.Error(w, "Token required", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	identity, err := authClient.ValidateToken(context.Background(), token)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return nil, false
+	}
+	if !identity.HasScope(scope) {
+		http.Error(w, "API key lacks the "+scope+" scope", http.StatusForbidden)
+		return nil, false
+	}
+	return identity, true
+}
@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/meetohin/web-chat/chat-service/internal/client"
+	"github.com/meetohin/web-chat/chat-service/internal/export"
+	"github.com/meetohin/web-chat/chat-service/internal/repository"
+)
+
+// ExportHandler lets admins export chat history for compliance
+type ExportHandler struct {
+	authClient *client.AuthClient
+	exportRepo repository.ExportRepository
+	exporter   *export.Exporter
+}
+
+func NewExportHandler(authClient *client.AuthClient, exportRepo repository.ExportRepository, exporter *export.Exporter) *ExportHandler {
+	return &ExportHandler{
+		authClient: authClient,
+		exportRepo: exportRepo,
+		exporter:   exporter,
+	}
+}
+
+// Exports lists (GET) or starts (POST format, from, to, username) export jobs
+func (h *ExportHandler) Exports(w http.ResponseWriter, r *http.Request) {
+	admin, ok := requireAdmin(w, r, h.authClient)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		jobs, err := h.exportRepo.ListExportJobs(50)
+		if err != nil {
+			log.Printf("Error listing exports: %v", err)
+			http.Error(w, "Failed to list exports", http.StatusInternalServerError)
+			return
+		}
+		if jobs == nil {
+			jobs = []repository.ExportJob{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"exports": jobs})
+
+	case http.MethodPost:
+		format := strings.ToLower(strings.TrimSpace(r.FormValue("format")))
+		if format == "" {
+			format = export.FormatJSONL
+		}
+		if !export.IsFormat(format) {
+			http.Error(w, "Format must be jsonl, csv or html", http.StatusBadRequest)
+			return
+		}
+
+		from, err := parseExportDate(r.FormValue("from"), false)
+		if err != nil {
+			http.Error(w, "Invalid from date: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		to, err := parseExportDate(r.FormValue("to"), true)
+		if err != nil {
+			http.Error(w, "Invalid to date: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if from != nil && to != nil && !from.Before(*to) {
+			http.Error(w, "The from date must be before the to date", http.StatusBadRequest)
+			return
+		}
+
+		job := &repository.ExportJob{
+			Format:    format,
+			From:      from,
+			To:        to,
+			Username:  strings.TrimSpace(r.FormValue("username")),
+			CreatedBy: admin.Username,
+		}
+		if err := h.exporter.Create(job); err != nil {
+			log.Printf("Error creating export: %v", err)
+			http.Error(w, "Failed to create export", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Export %s (%s) started by %s", job.ID, job.Format, admin.Username)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(job)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// ExportStatus reports the progress of an export job
+func (h *ExportHandler) ExportStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := requireAdmin(w, r, h.authClient); !ok {
+		return
+	}
+
+	job, err := h.exportRepo.GetExportJob(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Export not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// DownloadExport sends the file of a finished export
+func (h *ExportHandler) DownloadExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	admin, ok := requireAdmin(w, r, h.authClient)
+	if !ok {
+		return
+	}
+
+	job, err := h.exportRepo.GetExportJob(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Export not found", http.StatusNotFound)
+		return
+	}
+
+	file, err := h.exporter.Open(job)
+	if err != nil {
+		if errors.Is(err, export.ErrNotAvailable) {
+			http.Error(w, fmt.Sprintf("Export is %s and cannot be downloaded from this server", job.Status), http.StatusConflict)
+			return
+		}
+		log.Printf("Error opening export %s: %v", job.ID, err)
+		http.Error(w, "Export file is missing", http.StatusGone)
+		return
+	}
+	defer file.Close()
+	log.Printf("Export %s downloaded by %s", job.ID, admin.Username)
+
+	w.Header().Set("Content-Type", export.ContentType(job.Format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"chat-export-%s.%s\"", job.ID, job.Format))
+	w.Header().Set("Content-Length", fmt.Sprint(job.FileSize))
+	io.Copy(w, file)
+}
+
+// parseExportDate accepts RFC 3339 timestamps or plain dates. A plain end date
+// includes the whole day.
+func parseExportDate(value string, endOfDay bool) (*time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, errors.New("use YYYY-MM-DD or RFC 3339")
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
@@ -0,0 +1,244 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/meetohin/web-chat/chat-service/internal/client"
+	"github.com/meetohin/web-chat/chat-service/internal/incoming"
+	"github.com/meetohin/web-chat/chat-service/internal/ratelimit"
+	"github.com/meetohin/web-chat/chat-service/internal/repository"
+	"github.com/meetohin/web-chat/chat-service/internal/service"
+)
+
+// IncomingWebhookPath is where incoming webhooks are served; the secret token follows it
+const IncomingWebhookPath = "/hooks/incoming/"
+
+const defaultIncomingRateLimit = 30 // messages per minute
+
+// IncomingWebhookHandler accepts messages from external systems and lets admins manage the integrations
+type IncomingWebhookHandler struct {
+	authClient  *client.AuthClient
+	chatService *service.ChatService
+	hookRepo    repository.IncomingWebhookRepository
+	limiter     *ratelimit.Limiter
+	publicURL   string
+}
+
+func NewIncomingWebhookHandler(authClient *client.AuthClient, chatService *service.ChatService, hookRepo repository.IncomingWebhookRepository, limiter *ratelimit.Limiter, publicURL string) *IncomingWebhookHandler {
+	return &IncomingWebhookHandler{
+		authClient:  authClient,
+		chatService: chatService,
+		hookRepo:    hookRepo,
+		limiter:     limiter,
+		publicURL:   strings.TrimSuffix(publicURL, "/"),
+	}
+}
+
+// Receive posts the payload sent to /hooks/incoming/<token> as a chat message under the hook's display name,
+// with the author marked by service.IncomingWebhookSuffix
+func (h *IncomingWebhookHandler) Receive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := strings.TrimPrefix(r.URL.Path, IncomingWebhookPath)
+	if token == "" || strings.Contains(token, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	hook, err := h.hookRepo.GetIncomingWebhookByToken(hashIncomingToken(token))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	allowed, retryAfter, err := h.limiter.Allow(r.Context(), strconv.Itoa(hook.ID), hook.RateLimit, time.Minute)
+	if err != nil {
+		// Without the limiter a leaked URL could flood the chat, so refuse until it is back
+		log.Printf("Rate limiter failed for incoming webhook %d: %v", hook.ID, err)
+		w.Header().Set("Retry-After", "10")
+		http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if !allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+		http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 64<<10))
+	if err != nil {
+		http.Error(w, "Payload too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// Slack clients may also send the JSON in a "payload" form field
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			http.Error(w, "invalid_payload", http.StatusBadRequest)
+			return
+		}
+		body = []byte(form.Get("payload"))
+	}
+
+	payload, err := incoming.Parse(body)
+	if err != nil {
+		http.Error(w, "invalid_payload", http.StatusBadRequest)
+		return
+	}
+
+	text := payload.MessageText()
+	if text == "" {
+		http.Error(w, "no_text", http.StatusBadRequest)
+		return
+	}
+
+	_, err = h.chatService.PostMessage(hook.Name+service.IncomingWebhookSuffix, text)
+	if errors.Is(err, service.ErrMuted) {
+		http.Error(w, "muted", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		log.Printf("Error saving incoming webhook message: %v", err)
+		http.Error(w, "Failed to save message", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.hookRepo.TouchIncomingWebhook(hook.ID); err != nil {
+		log.Printf("Failed to update last use of incoming webhook %d: %v", hook.ID, err)
+	}
+
+	// Same answer as Slack, so existing integrations treat it as success
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("ok"))
+}
+
+// IncomingWebhooks lists (GET) or creates (POST name, rate_limit) incoming webhooks.
+// The URL containing the secret token is only returned when the webhook is created.
+func (h *IncomingWebhookHandler) IncomingWebhooks(w http.ResponseWriter, r *http.Request) {
+	admin, ok := requireAdmin(w, r, h.authClient)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		hooks, err := h.hookRepo.ListIncomingWebhooks()
+		if err != nil {
+			log.Printf("Error listing incoming webhooks: %v", err)
+			http.Error(w, "Failed to list incoming webhooks", http.StatusInternalServerError)
+			return
+		}
+		if hooks == nil {
+			hooks = []repository.IncomingWebhook{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"incoming_webhooks": hooks})
+
+	case http.MethodPost:
+		name := strings.TrimSpace(r.FormValue("name"))
+		// Posted as name@hook, which must fit the 50 characters of a message author
+		if len(name) < 3 || len(name) > 45 || strings.Contains(name, "@") {
+			http.Error(w, "Name must be between 3 and 45 characters and must not contain '@'", http.StatusBadRequest)
+			return
+		}
+
+		rateLimit := defaultIncomingRateLimit
+		if value := r.FormValue("rate_limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 || parsed > 6000 {
+				http.Error(w, "rate_limit must be between 1 and 6000 messages per minute", http.StatusBadRequest)
+				return
+			}
+			rateLimit = parsed
+		}
+
+		token, err := newIncomingToken()
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		hook := &repository.IncomingWebhook{
+			Name:      name,
+			TokenHash: hashIncomingToken(token),
+			RateLimit: rateLimit,
+			CreatedBy: admin.Username,
+		}
+		if err := h.hookRepo.CreateIncomingWebhook(hook); err != nil {
+			log.Printf("Error creating incoming webhook: %v", err)
+			http.Error(w, "Failed to create incoming webhook", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Incoming webhook %d (%s) created by %s", hook.ID, hook.Name, admin.Username)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"incoming_webhook": hook,
+			"url":              h.publicURL + IncomingWebhookPath + token,
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// DeleteIncomingWebhook removes an incoming webhook; its URL stops working immediately
+func (h *IncomingWebhookHandler) DeleteIncomingWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := requireAdmin(w, r, h.authClient); !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Incoming webhook ID required", http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := h.hookRepo.DeleteIncomingWebhook(id)
+	if err != nil {
+		log.Printf("Error deleting incoming webhook: %v", err)
+		http.Error(w, "Failed to delete incoming webhook", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, "Incoming webhook not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Incoming webhook deleted"})
+}
+
+func newIncomingToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashIncomingToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
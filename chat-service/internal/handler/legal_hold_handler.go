@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/meetohin/web-chat/chat-service/internal/client"
+	"github.com/meetohin/web-chat/chat-service/internal/repository"
+	"github.com/meetohin/web-chat/chat-service/internal/retention"
+)
+
+// LegalHoldHandler lets admins exempt users' messages and notifications from retention purges
+type LegalHoldHandler struct {
+	authClient    *client.AuthClient
+	retentionRepo repository.RetentionRepository
+	redis         *redis.Client // holds are published here for notification-service
+}
+
+func NewLegalHoldHandler(authClient *client.AuthClient, retentionRepo repository.RetentionRepository, rdb *redis.Client) *LegalHoldHandler {
+	return &LegalHoldHandler{
+		authClient:    authClient,
+		retentionRepo: retentionRepo,
+		redis:         rdb,
+	}
+}
+
+// publish passes the changed holds on to notification-service. Until that succeeds it
+// keeps the previous holds, so a released hold may keep notifications a little longer.
+func (h *LegalHoldHandler) publish(r *http.Request) {
+	if err := retention.PublishLegalHolds(r.Context(), h.redis, h.retentionRepo); err != nil {
+		log.Printf("Failed to publish legal holds: %v", err)
+	}
+}
+
+// LegalHolds lists (GET) or places (POST username, reason) legal holds
+func (h *LegalHoldHandler) LegalHolds(w http.ResponseWriter, r *http.Request) {
+	admin, ok := requireAdmin(w, r, h.authClient)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		holds, err := h.retentionRepo.ListLegalHolds()
+		if err != nil {
+			log.Printf("Error listing legal holds: %v", err)
+			http.Error(w, "Failed to list legal holds", http.StatusInternalServerError)
+			return
+		}
+		if holds == nil {
+			holds = []repository.LegalHold{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"legal_holds": holds})
+
+	case http.MethodPost:
+		username := strings.TrimSpace(r.FormValue("username"))
+		reason := strings.TrimSpace(r.FormValue("reason"))
+		if username == "" || reason == "" {
+			http.Error(w, "Username and reason required", http.StatusBadRequest)
+			return
+		}
+
+		hold := &repository.LegalHold{Username: username, Reason: reason, CreatedBy: admin.Username}
+		if err := h.retentionRepo.CreateLegalHold(hold); err != nil {
+			log.Printf("Error creating legal hold: %v", err)
+			http.Error(w, "Failed to create legal hold", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Legal hold on %s placed by %s", username, admin.Username)
+		h.publish(r)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(hold)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// ReleaseLegalHold removes a user's legal hold; their messages are purged normally again
+func (h *LegalHoldHandler) ReleaseLegalHold(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	admin, ok := requireAdmin(w, r, h.authClient)
+	if !ok {
+		return
+	}
+
+	username := strings.TrimSpace(r.FormValue("username"))
+	if username == "" {
+		http.Error(w, "Username required", http.StatusBadRequest)
+		return
+	}
+
+	released, err := h.retentionRepo.DeleteLegalHold(username)
+	if err != nil {
+		log.Printf("Error releasing legal hold: %v", err)
+		http.Error(w, "Failed to release legal hold", http.StatusInternalServerError)
+		return
+	}
+	if !released {
+		http.Error(w, "No legal hold for this user", http.StatusNotFound)
+		return
+	}
+	log.Printf("Legal hold on %s released by %s", username, admin.Username)
+	h.publish(r)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Legal hold released"})
+}
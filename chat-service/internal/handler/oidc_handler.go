@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/meetohin/web-chat/chat-service/internal/client"
+	"github.com/meetohin/web-chat/chat-service/internal/oidc"
+)
+
+const oidcFlowCookie = "oidc_flow"
+
+// oidcFlow is kept in a short-lived cookie between the redirect to the provider and the callback
+type oidcFlow struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+// OIDCHandler implements single sign-on through an OpenID Connect provider
+type OIDCHandler struct {
+	authClient *client.AuthClient
+	oidcClient *oidc.Client
+	templates  *template.Template
+}
+
+func NewOIDCHandler(authClient *client.AuthClient, oidcClient *oidc.Client) *OIDCHandler {
+	tmpl := template.Must(template.ParseGlob("web/templates/*.html"))
+
+	return &OIDCHandler{
+		authClient: authClient,
+		oidcClient: oidcClient,
+		templates:  tmpl,
+	}
+}
+
+// Login redirects the browser to the identity provider
+func (h *OIDCHandler) Login(w http.ResponseWriter, r *http.Request) {
+	state, err := oidc.RandomString()
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	authURL, err := h.oidcClient.AuthCodeURL(r.Context(), state, nonce, challenge)
+	if err != nil {
+		log.Printf("OIDC login error: %v", err)
+		http.Error(w, "Identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+
+	flow, _ := json.Marshal(oidcFlow{State: state, Nonce: nonce, Verifier: verifier})
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcFlowCookie,
+		Value:    base64.RawURLEncoding.EncodeToString(flow),
+		Path:     "/auth/oidc",
+		MaxAge:   int((10 * time.Minute).Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// Callback completes the sign-in after the provider redirects back
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	flow, ok := readOIDCFlow(r)
+	http.SetCookie(w, &http.Cookie{Name: oidcFlowCookie, Path: "/auth/oidc", MaxAge: -1})
+
+	if errCode := r.URL.Query().Get("error"); errCode != "" {
+		h.renderCallback(w, "", "Sign-in was cancelled or denied: "+errCode)
+		return
+	}
+	if !ok || flow.State == "" || r.URL.Query().Get("state") != flow.State {
+		h.renderCallback(w, "", "Sign-in session expired, please try again")
+		return
+	}
+
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		h.renderCallback(w, "", "Missing authorization code")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+
+	idToken, err := h.oidcClient.Exchange(ctx, code, flow.Verifier)
+	if err != nil {
+		log.Printf("OIDC code exchange error: %v", err)
+		h.renderCallback(w, "", "Could not complete sign-in with the identity provider")
+		return
+	}
+
+	loginCtx := client.WithUserAgent(client.WithClientIP(ctx, clientIP(r)), r.UserAgent())
+	result, err := h.authClient.OIDCLogin(loginCtx, idToken, flow.Nonce)
+	if err != nil {
+		// The reason stays in the log, it may tell an attacker which accounts exist
+		log.Printf("OIDC login rejected: %v", err)
+		h.renderCallback(w, "", "Sign-in failed. Please try again or contact your administrator.")
+		return
+	}
+
+	if result.ChallengeToken != "" {
+		h.templates.ExecuteTemplate(w, "oidc-callback.html", map[string]string{"ChallengeToken": result.ChallengeToken})
+		return
+	}
+	h.renderCallback(w, result.Token, "")
+}
+
+func (h *OIDCHandler) renderCallback(w http.ResponseWriter, token, errorMessage string) {
+	if errorMessage != "" {
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+	h.templates.ExecuteTemplate(w, "oidc-callback.html", map[string]string{
+		"Token": token,
+		"Error": errorMessage,
+	})
+}
+
+func readOIDCFlow(r *http.Request) (*oidcFlow, bool) {
+	cookie, err := r.Cookie(oidcFlowCookie)
+	if err != nil {
+		return nil, false
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return nil, false
+	}
+
+	flow := &oidcFlow{}
+	if err := json.Unmarshal(data, flow); err != nil {
+		return nil, false
+	}
+	return flow, true
+}
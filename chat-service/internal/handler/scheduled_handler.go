@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/meetohin/web-chat/chat-service/internal/client"
+	"github.com/meetohin/web-chat/chat-service/internal/repository"
+	"github.com/meetohin/web-chat/chat-service/internal/service"
+)
+
+// ScheduledMessages lists (GET) or creates (POST text and send_at) the caller's scheduled messages.
+// send_at is either an RFC 3339 time or a delay such as "90m".
+func (h *ChatHandler) ScheduledMessages(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		identity, ok := requireScope(w, r, h.authClient, client.ScopeMessagesRead)
+		if !ok {
+			return
+		}
+
+		messages, err := h.chatService.ScheduledMessages(identity.Username)
+		if err != nil {
+			log.Printf("Error listing scheduled messages: %v", err)
+			http.Error(w, "Failed to list scheduled messages", http.StatusInternalServerError)
+			return
+		}
+		if messages == nil {
+			messages = []repository.ScheduledMessage{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"scheduled_messages": messages})
+
+	case http.MethodPost:
+		identity, ok := requireScope(w, r, h.authClient, client.ScopeMessagesWrite)
+		if !ok {
+			return
+		}
+
+		text, sendAtValue := r.FormValue("text"), r.FormValue("send_at")
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			var body struct {
+				Text   string `json:"text"`
+				SendAt string `json:"send_at"`
+			}
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&body); err != nil {
+				http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+				return
+			}
+			text, sendAtValue = body.Text, body.SendAt
+		}
+
+		sendAt, err := service.ParseSendTime(sendAtValue, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		scheduled, err := h.chatService.ScheduleMessage(identity.Username, text, sendAt)
+		if errors.Is(err, service.ErrInvalidSchedule) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Printf("Error scheduling message: %v", err)
+			http.Error(w, "Failed to schedule message", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(scheduled)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// CancelScheduledMessage cancels one of the caller's pending scheduled messages
+func (h *ChatHandler) CancelScheduledMessage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	identity, ok := requireScope(w, r, h.authClient, client.ScopeMessagesWrite)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Scheduled message ID required", http.StatusBadRequest)
+		return
+	}
+
+	cancelled, err := h.chatService.CancelScheduledMessage(id, identity.Username)
+	if err != nil {
+		log.Printf("Error cancelling scheduled message: %v", err)
+		http.Error(w, "Failed to cancel scheduled message", http.StatusInternalServerError)
+		return
+	}
+	if !cancelled {
+		http.Error(w, "No pending scheduled message with this ID", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Scheduled message cancelled"})
+}
@@ -0,0 +1,249 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/meetohin/web-chat/chat-service/internal/client"
+	"github.com/meetohin/web-chat/chat-service/internal/repository"
+	"github.com/meetohin/web-chat/chat-service/internal/webhook"
+)
+
+// WebhookHandler lets admins manage outgoing webhooks
+type WebhookHandler struct {
+	authClient  *client.AuthClient
+	webhookRepo repository.WebhookRepository
+	dispatcher  *webhook.Dispatcher
+}
+
+func NewWebhookHandler(authClient *client.AuthClient, webhookRepo repository.WebhookRepository, dispatcher *webhook.Dispatcher) *WebhookHandler {
+	return &WebhookHandler{
+		authClient:  authClient,
+		webhookRepo: webhookRepo,
+		dispatcher:  dispatcher,
+	}
+}
+
+// Webhooks lists (GET) or registers (POST url, events) webhooks. Events are given
+// comma-separated; the signing secret is only returned when the webhook is created.
+func (h *WebhookHandler) Webhooks(w http.ResponseWriter, r *http.Request) {
+	admin, ok := requireAdmin(w, r, h.authClient)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		webhooks, err := h.webhookRepo.ListWebhooks()
+		if err != nil {
+			log.Printf("Error listing webhooks: %v", err)
+			http.Error(w, "Failed to list webhooks", http.StatusInternalServerError)
+			return
+		}
+		if webhooks == nil {
+			webhooks = []repository.Webhook{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"webhooks": webhooks})
+
+	case http.MethodPost:
+		hook, err := newWebhook(r.FormValue("url"), r.FormValue("events"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		hook.CreatedBy = admin.Username
+
+		if err := h.webhookRepo.CreateWebhook(hook); err != nil {
+			log.Printf("Error creating webhook: %v", err)
+			http.Error(w, "Failed to create webhook", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Webhook %d for %s created by %s", hook.ID, hook.URL, admin.Username)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"webhook": hook,
+			"secret":  hook.Secret,
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// DeleteWebhook removes a webhook together with its delivery log
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := requireAdmin(w, r, h.authClient); !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Webhook ID required", http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := h.webhookRepo.DeleteWebhook(id)
+	if err != nil {
+		log.Printf("Error deleting webhook: %v", err)
+		http.Error(w, "Failed to delete webhook", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Webhook deleted"})
+}
+
+// PingWebhook queues a ping event so admins can check that a receiver works
+func (h *WebhookHandler) PingWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := requireAdmin(w, r, h.authClient); !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Webhook ID required", http.StatusBadRequest)
+		return
+	}
+	_, err = h.webhookRepo.GetWebhook(id)
+	if errors.Is(err, repository.ErrWebhookNotFound) {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading webhook %d: %v", id, err)
+		http.Error(w, "Failed to load webhook", http.StatusInternalServerError)
+		return
+	}
+
+	eventID, err := h.dispatcher.Ping(context.Background(), id)
+	if err != nil {
+		log.Printf("Error queueing webhook ping: %v", err)
+		http.Error(w, "Failed to queue ping", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"event_id": eventID})
+}
+
+// Deliveries returns the delivery log of a webhook (GET ?id=&limit=)
+func (h *WebhookHandler) Deliveries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := requireAdmin(w, r, h.authClient); !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Webhook ID required", http.StatusBadRequest)
+		return
+	}
+
+	limit := 50
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 500 {
+			http.Error(w, "limit must be between 1 and 500", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	deliveries, err := h.webhookRepo.ListDeliveries(id, limit)
+	if err != nil {
+		log.Printf("Error listing webhook deliveries: %v", err)
+		http.Error(w, "Failed to list deliveries", http.StatusInternalServerError)
+		return
+	}
+	if deliveries == nil {
+		deliveries = []repository.WebhookDelivery{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"deliveries": deliveries})
+}
+
+// newWebhook validates the form values and creates a webhook with a fresh secret
+func newWebhook(rawURL, rawEvents string) (*repository.Webhook, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("url must be an absolute http or https URL")
+	}
+
+	var events []string
+	for _, event := range strings.Split(rawEvents, ",") {
+		event = strings.TrimSpace(event)
+		if event == "" {
+			continue
+		}
+		if !webhook.IsEvent(event) {
+			return nil, fmt.Errorf("unknown event %q, expected one of %s", event, strings.Join(webhook.Events, ", "))
+		}
+		events = append(events, event)
+	}
+	if len(events) == 0 {
+		return nil, fmt.Errorf("at least one event required: %s", strings.Join(webhook.Events, ", "))
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	return &repository.Webhook{
+		URL:    u.String(),
+		Secret: hex.EncodeToString(secret),
+		Events: events,
+		Active: true,
+	}, nil
+}
+
+// requireAdmin authenticates the bearer token and checks for the admin role.
+// It writes the error response and returns false if the request may not proceed.
+func requireAdmin(w http.ResponseWriter, r *http.Request, authClient *client.AuthClient) (*client.Identity, bool) {
+	token := bearerToken(r)
+	if token == "" {
+		http.Error(w, "Token required", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	identity, err := authClient.ValidateToken(context.Background(), token)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return nil, false
+	}
+	if !identity.IsAdmin() {
+		http.Error(w, "Permission denied", http.StatusForbidden)
+		return nil, false
+	}
+	return identity, true
+}
@@ -0,0 +1,111 @@
+// Package importer loads chat history exported from other chat systems
+package importer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/meetohin/web-chat/chat-service/internal/client"
+	"github.com/meetohin/web-chat/chat-service/internal/repository"
+)
+
+// Record is a message read from an export
+type Record struct {
+	ID       string // unique within the source
+	UserID   string // author's ID in the source system
+	Username string // author's name in the source system
+	Email    string // author's email address, if the export has it
+	Text     string
+	Time     time.Time
+}
+
+// Stats counts what an import did
+type Stats struct {
+	Read         int // messages read from the export
+	Imported     int // messages stored
+	Duplicates   int // messages skipped because an earlier run stored them
+	UsersMapped  int // source users mapped to existing accounts
+	UsersCreated int // source users that got a placeholder account
+}
+
+// Importer stores records as chat messages. Authors are mapped to local accounts once
+// per source and the mapping is remembered, so re-running an import changes nothing.
+type Importer struct {
+	authClient *client.AuthClient
+	importRepo repository.ImportRepository
+	adminToken string
+	source     string
+	dryRun     bool
+	users      map[string]string
+	Stats      Stats
+}
+
+// New creates an importer for records from source, a name like "slack" that keys the
+// imported rows. With dryRun records are only counted.
+func New(authClient *client.AuthClient, importRepo repository.ImportRepository, adminToken, source string, dryRun bool) *Importer {
+	return &Importer{
+		authClient: authClient,
+		importRepo: importRepo,
+		adminToken: adminToken,
+		source:     source,
+		dryRun:     dryRun,
+		users:      make(map[string]string),
+	}
+}
+
+// Import stores one record
+func (im *Importer) Import(ctx context.Context, rec *Record) error {
+	im.Stats.Read++
+	if im.dryRun {
+		return nil
+	}
+
+	username, err := im.localUser(ctx, rec)
+	if err != nil {
+		return fmt.Errorf("failed to map user %s: %w", rec.Username, err)
+	}
+
+	inserted, err := im.importRepo.ImportMessage(im.source, rec.ID, username, rec.Text, rec.Time)
+	if err != nil {
+		return fmt.Errorf("failed to store message %s: %w", rec.ID, err)
+	}
+	if inserted {
+		im.Stats.Imported++
+	} else {
+		im.Stats.Duplicates++
+	}
+	return nil
+}
+
+// localUser returns the local account of the record's author
+func (im *Importer) localUser(ctx context.Context, rec *Record) (string, error) {
+	if username, ok := im.users[rec.UserID]; ok {
+		return username, nil
+	}
+
+	username, err := im.importRepo.ImportedUser(im.source, rec.UserID)
+	if err != nil {
+		return "", err
+	}
+
+	if username == "" {
+		var created bool
+		username, created, err = im.authClient.ImportUser(ctx, im.adminToken, rec.Username, rec.Email)
+		if err != nil {
+			return "", err
+		}
+		if err := im.importRepo.SaveImportedUser(im.source, rec.UserID, username); err != nil {
+			return "", err
+		}
+
+		if created {
+			im.Stats.UsersCreated++
+		} else {
+			im.Stats.UsersMapped++
+		}
+	}
+
+	im.users[rec.UserID] = username
+	return username, nil
+}
@@ -0,0 +1,66 @@
+package importer
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// jsonlMessage is a line of the generic format. It matches the JSON Lines chat export,
+// so exported history can be imported into another installation.
+type jsonlMessage struct {
+	ID        json.RawMessage `json:"id"` // number or string, optional
+	Username  string          `json:"username"`
+	Email     string          `json:"email"`
+	Text      string          `json:"text"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// ReadJSONL reads one JSON message per line and calls fn for each of them. Lines
+// without an ID are identified by a hash of their timestamp, author and text.
+func ReadJSONL(r io.Reader, fn func(*Record) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := strings.TrimSpace(scanner.Text())
+		if data == "" {
+			continue
+		}
+
+		var msg jsonlMessage
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if msg.Username == "" || msg.Text == "" || msg.Timestamp.IsZero() {
+			return fmt.Errorf("line %d: username, text and timestamp required", line)
+		}
+
+		id := strings.Trim(string(msg.ID), `"`)
+		if id == "" || id == "null" {
+			sum := sha256.Sum256([]byte(msg.Timestamp.UTC().Format(time.RFC3339Nano) + "\x00" + msg.Username + "\x00" + msg.Text))
+			id = hex.EncodeToString(sum[:16])
+		}
+
+		err := fn(&Record{
+			ID:       id,
+			UserID:   msg.Username,
+			Username: msg.Username,
+			Email:    msg.Email,
+			Text:     msg.Text,
+			Time:     msg.Timestamp,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
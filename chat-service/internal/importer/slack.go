@@ -0,0 +1,242 @@
+package importer
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/meetohin/web-chat/chat-service/internal/incoming"
+)
+
+type slackUser struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Profile struct {
+		Email       string `json:"email"`
+		DisplayName string `json:"display_name"`
+	} `json:"profile"`
+}
+
+type slackChannel struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type slackMessage struct {
+	Type        string `json:"type"`
+	Subtype     string `json:"subtype"`
+	User        string `json:"user"`
+	BotID       string `json:"bot_id"`
+	Username    string `json:"username"`
+	Text        string `json:"text"`
+	TS          string `json:"ts"`
+	UserProfile *struct {
+		Name string `json:"name"`
+	} `json:"user_profile"`
+	Files []struct {
+		Name  string `json:"name"`
+		Title string `json:"title"`
+	} `json:"files"`
+
+	channel string
+	time    time.Time
+}
+
+// importedSubtypes are the Slack message subtypes that carry conversation; joins,
+// topic changes and the like are skipped
+var importedSubtypes = map[string]bool{
+	"":                 true,
+	"me_message":       true,
+	"bot_message":      true,
+	"file_share":       true,
+	"thread_broadcast": true,
+}
+
+// ReadSlack reads a Slack workspace export ZIP and calls fn for every message in time
+// order. With channels set only those channels are read, otherwise all of them. The
+// chat has a single room, so messages of all read channels end up together.
+func ReadSlack(file string, channels []string, fn func(*Record) error) error {
+	archive, err := zip.OpenReader(file)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	files := make(map[string]*zip.File)
+	for _, f := range archive.File {
+		files[f.Name] = f
+	}
+
+	var users []slackUser
+	if err := readZipJSON(files["users.json"], &users); err != nil {
+		return fmt.Errorf("users.json: %w", err)
+	}
+	byID := make(map[string]slackUser)
+	userNames := make(map[string]string)
+	for _, u := range users {
+		byID[u.ID] = u
+		userNames[u.ID] = u.Name
+	}
+
+	// Public channels are in channels.json, private ones in groups.json; the
+	// directory of a channel is named after it
+	channelNames := make(map[string]string)
+	channelIDs := make(map[string]string)
+	for _, name := range []string{"channels.json", "groups.json"} {
+		var list []slackChannel
+		if err := readZipJSON(files[name], &list); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		for _, c := range list {
+			channelNames[c.ID] = c.Name
+			channelIDs[c.Name] = c.ID
+		}
+	}
+
+	wanted := make(map[string]bool)
+	for _, c := range channels {
+		wanted[strings.TrimPrefix(c, "#")] = true
+	}
+
+	// Channel directories hold one file per day, e.g. general/2024-01-31.json
+	days := make(map[string][]*zip.File)
+	for _, f := range archive.File {
+		dir, name := path.Split(f.Name)
+		dir = strings.TrimSuffix(dir, "/")
+		if dir == "" || strings.Contains(dir, "/") || (len(wanted) > 0 && !wanted[dir]) {
+			continue
+		}
+		day := strings.TrimSuffix(name, ".json")
+		if _, err := time.Parse("2006-01-02", day); err != nil {
+			continue
+		}
+		days[day] = append(days[day], f)
+	}
+
+	var order []string
+	for day := range days {
+		order = append(order, day)
+	}
+	sort.Strings(order)
+
+	for _, day := range order {
+		var messages []slackMessage
+		for _, f := range days[day] {
+			channel := path.Dir(f.Name)
+			if id := channelIDs[channel]; id != "" {
+				channel = id
+			}
+
+			var dayMessages []slackMessage
+			if err := readZipJSON(f, &dayMessages); err != nil {
+				return fmt.Errorf("%s: %w", f.Name, err)
+			}
+			for _, msg := range dayMessages {
+				if msg.Type != "message" || !importedSubtypes[msg.Subtype] {
+					continue
+				}
+				msg.channel = channel
+				if msg.time, err = parseSlackTS(msg.TS); err != nil {
+					return fmt.Errorf("%s: %w", f.Name, err)
+				}
+				messages = append(messages, msg)
+			}
+		}
+		sort.SliceStable(messages, func(i, j int) bool { return messages[i].time.Before(messages[j].time) })
+
+		for i := range messages {
+			rec := slackRecord(&messages[i], byID, userNames, channelNames)
+			if rec == nil {
+				continue
+			}
+			if err := fn(rec); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func slackRecord(msg *slackMessage, users map[string]slackUser, userNames, channelNames map[string]string) *Record {
+	text := strings.TrimSpace(incoming.SlackText(msg.Text, userNames, channelNames))
+	for _, f := range msg.Files {
+		name := f.Title
+		if name == "" {
+			name = f.Name
+		}
+		text = strings.TrimSpace(text + "\n[file: " + name + "]")
+	}
+	if text == "" {
+		return nil
+	}
+	if msg.Subtype == "me_message" {
+		text = "/me " + text
+	}
+
+	rec := &Record{
+		ID:   msg.channel + "/" + msg.TS,
+		Text: text,
+		Time: msg.time,
+	}
+
+	switch {
+	case msg.User != "":
+		rec.UserID = msg.User
+		if u, ok := users[msg.User]; ok {
+			rec.Username = u.Name
+			rec.Email = u.Profile.Email
+		} else if msg.UserProfile != nil {
+			rec.Username = msg.UserProfile.Name
+		} else {
+			rec.Username = msg.User
+		}
+	case msg.Username != "":
+		rec.UserID = "bot:" + msg.Username
+		rec.Username = msg.Username
+	case msg.BotID != "":
+		rec.UserID = "bot:" + msg.BotID
+		rec.Username = msg.BotID
+	default:
+		return nil
+	}
+
+	return rec
+}
+
+// parseSlackTS parses message timestamps like "1355517523.000005"
+func parseSlackTS(ts string) (time.Time, error) {
+	secPart, microPart, _ := strings.Cut(ts, ".")
+	sec, err := strconv.ParseInt(secPart, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q", ts)
+	}
+
+	var micro int64
+	if microPart != "" {
+		if micro, err = strconv.ParseInt(microPart, 10, 64); err != nil {
+			return time.Time{}, fmt.Errorf("invalid timestamp %q", ts)
+		}
+	}
+	return time.Unix(sec, micro*1000), nil
+}
+
+// readZipJSON decodes a JSON file of the archive; a missing file leaves v unchanged
+func readZipJSON(f *zip.File, v interface{}) error {
+	if f == nil {
+		return nil
+	}
+
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return json.NewDecoder(r).Decode(v)
+}
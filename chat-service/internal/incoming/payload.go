@@ -0,0 +1,142 @@
+// Package incoming turns payloads posted to incoming webhooks into chat messages
+package incoming
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Payload is the accepted JSON body. Besides a plain {"text": "..."} it understands
+// the parts of Slack's incoming webhook format that carry text.
+type Payload struct {
+	Text        string       `json:"text"`
+	Attachments []Attachment `json:"attachments"`
+	Blocks      []Block      `json:"blocks"`
+}
+
+// Attachment is a Slack message attachment
+type Attachment struct {
+	Fallback string `json:"fallback"`
+	Pretext  string `json:"pretext"`
+	Title    string `json:"title"`
+	Text     string `json:"text"`
+}
+
+// Block is a Slack Block Kit block. Only text-bearing fields are read.
+type Block struct {
+	Type     string       `json:"type"`
+	Text     *TextObject  `json:"text"`
+	Fields   []TextObject `json:"fields"`
+	Elements []TextObject `json:"elements"`
+}
+
+// TextObject is a Slack text object
+type TextObject struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// Parse decodes a payload
+func Parse(data []byte) (*Payload, error) {
+	var payload Payload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, err
+	}
+	return &payload, nil
+}
+
+// MessageText flattens the payload into the text of a single chat message.
+// Slack markup is converted to plain text, see SlackText.
+func (p *Payload) MessageText() string {
+	var parts []string
+	add := func(s string) {
+		if s = strings.TrimSpace(s); s != "" {
+			parts = append(parts, s)
+		}
+	}
+
+	add(p.Text)
+	for _, block := range p.Blocks {
+		if block.Text != nil {
+			add(block.Text.Text)
+		}
+		for _, field := range block.Fields {
+			add(field.Text)
+		}
+		if block.Type == "context" {
+			for _, element := range block.Elements {
+				add(element.Text)
+			}
+		}
+	}
+	for _, attachment := range p.Attachments {
+		before := len(parts)
+		add(attachment.Pretext)
+		add(attachment.Title)
+		add(attachment.Text)
+		if len(parts) == before {
+			add(attachment.Fallback)
+		}
+	}
+
+	return SlackText(strings.Join(parts, "\n"), nil, nil)
+}
+
+// SlackText converts Slack message markup to plain text. Mentions like <@U123> are
+// shown with the names in users and channels, which map Slack IDs to names and may be nil.
+func SlackText(text string, users, channels map[string]string) string {
+	return unescape(convertMarkup(text, users, channels))
+}
+
+// unescape reverses the HTML entities Slack payloads use for control characters
+var unescape = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&").Replace
+
+// convertMarkup rewrites Slack's <url|label>, <url>, <@user>, <#channel> and <!special> markup as plain text
+func convertMarkup(text string, users, channels map[string]string) string {
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(text, '<')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(text[start:], '>')
+		if end < 0 {
+			break
+		}
+		end += start
+
+		b.WriteString(text[:start])
+		inner := text[start+1 : end]
+		target, label, hasLabel := strings.Cut(inner, "|")
+		switch {
+		case strings.HasPrefix(target, "@"):
+			b.WriteString("@" + mentionName(target[1:], label, users))
+		case strings.HasPrefix(target, "#"):
+			b.WriteString("#" + mentionName(target[1:], label, channels))
+		case strings.HasPrefix(target, "!"):
+			// <!here>, <!channel> and <!everyone>; dates and user groups carry a fallback label
+			if special := target[1:]; hasLabel && special != "here" && special != "channel" && special != "everyone" {
+				b.WriteString(label)
+			} else {
+				b.WriteString("@" + special)
+			}
+		case hasLabel:
+			b.WriteString(label + " (" + target + ")")
+		default:
+			b.WriteString(inner)
+		}
+		text = text[end+1:]
+	}
+	b.WriteString(text)
+	return b.String()
+}
+
+func mentionName(id, label string, names map[string]string) string {
+	if name := names[id]; name != "" {
+		return name
+	}
+	if label != "" {
+		return strings.TrimPrefix(label, "@")
+	}
+	return id
+}
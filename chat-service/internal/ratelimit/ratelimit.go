@@ -0,0 +1,45 @@
+// Package ratelimit limits how often something may happen across all chat-service instances
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Limiter counts events per key in fixed windows stored in Redis
+type Limiter struct {
+	redis  *redis.Client
+	prefix string
+}
+
+// New creates a limiter whose Redis keys start with prefix
+func New(rdb *redis.Client, prefix string) *Limiter {
+	return &Limiter{redis: rdb, prefix: prefix}
+}
+
+// Allow records an event for key and reports whether it is within limit events per window.
+// When it is not, the returned duration tells how long until the window resets.
+func (l *Limiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, time.Duration, error) {
+	if limit <= 0 {
+		return true, 0, nil
+	}
+
+	now := time.Now()
+	windowStart := now.Truncate(window)
+	redisKey := fmt.Sprintf("%s:%s:%d", l.prefix, key, windowStart.Unix())
+
+	pipe := l.redis.TxPipeline()
+	count := pipe.Incr(ctx, redisKey)
+	pipe.Expire(ctx, redisKey, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, 0, err
+	}
+
+	if count.Val() > int64(limit) {
+		return false, windowStart.Add(window).Sub(now), nil
+	}
+	return true, 0, nil
+}
@@ -1,13 +1,20 @@
 package repository
 
-import "time"
+import (
+	"errors"
+	"time"
+
+	"github.com/meetohin/web-chat/chat-service/pkg/protocol"
+)
 
 // Message represents a chat message
-type Message struct {
-	ID        int       `json:"id"`
-	Username  string    `json:"username"`
-	Text      string    `json:"text"`
-	Timestamp time.Time `json:"timestamp"`
+type Message = protocol.Message
+
+// MessageFilter selects messages by time range and author. Zero fields match everything.
+type MessageFilter struct {
+	From     time.Time // inclusive
+	To       time.Time // exclusive
+	Username string
 }
 
 // MessageRepository defines the interface for message data access
@@ -15,4 +22,171 @@ type MessageRepository interface {
 	SaveMessage(username, text string) (*Message, error)
 	GetRecentMessages(limit int) ([]Message, error)
 	GetMessageCount() (int, error)
+	// ListMessages returns up to limit messages matching filter that come after the given
+	// message, oldest first by creation time and then ID. A nil after starts at the oldest.
+	ListMessages(filter MessageFilter, after *Message, limit int) ([]Message, error)
+	CountMessages(filter MessageFilter) (int, error)
+}
+
+// Webhook is an admin-registered URL that receives chat events
+type Webhook struct {
+	ID        int       `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"-"` // HMAC key for signing deliveries
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ErrWebhookNotFound is returned for webhooks that do not exist or were deleted
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// WebhookDelivery is one attempt to deliver an event to a webhook
+type WebhookDelivery struct {
+	ID         int       `json:"id"`
+	WebhookID  int       `json:"webhook_id"`
+	EventID    string    `json:"event_id"`
+	Event      string    `json:"event"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	Success    bool      `json:"success"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// WebhookRepository defines the interface for webhook data access
+type WebhookRepository interface {
+	CreateWebhook(webhook *Webhook) error
+	GetWebhook(id int) (*Webhook, error)
+	ListWebhooks() ([]Webhook, error)
+	ListWebhooksForEvent(event string) ([]Webhook, error)
+	DeleteWebhook(id int) (bool, error)
+	SaveDelivery(delivery *WebhookDelivery) error
+	ListDeliveries(webhookID, limit int) ([]WebhookDelivery, error)
+}
+
+// IncomingWebhook lets an external system post messages under a display name.
+// Only a hash of its secret token is stored.
+type IncomingWebhook struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"` // display name of posted messages
+	TokenHash  string     `json:"-"`
+	RateLimit  int        `json:"rate_limit"` // messages per minute
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// IncomingWebhookRepository defines the interface for incoming webhook data access
+type IncomingWebhookRepository interface {
+	CreateIncomingWebhook(hook *IncomingWebhook) error
+	GetIncomingWebhookByToken(tokenHash string) (*IncomingWebhook, error)
+	ListIncomingWebhooks() ([]IncomingWebhook, error)
+	DeleteIncomingWebhook(id int) (bool, error)
+	TouchIncomingWebhook(id int) error
+}
+
+// Scheduled message states
+const (
+	ScheduledPending   = "pending"
+	ScheduledSending   = "sending" // claimed by a scheduler that is posting it
+	ScheduledSent      = "sent"
+	ScheduledCancelled = "cancelled"
+	ScheduledFailed    = "failed"
+)
+
+// ScheduledMessage is a message a user asked to post at a later time
+type ScheduledMessage struct {
+	ID        int        `json:"id"`
+	Username  string     `json:"username"`
+	Text      string     `json:"text"`
+	SendAt    time.Time  `json:"send_at"`
+	Status    string     `json:"status"`
+	Error     string     `json:"error,omitempty"`
+	MessageID int        `json:"message_id,omitempty"` // the posted message once sent
+	CreatedAt time.Time  `json:"created_at"`
+	SentAt    *time.Time `json:"sent_at,omitempty"`
+}
+
+// ScheduledMessageRepository defines the interface for scheduled message data access
+type ScheduledMessageRepository interface {
+	// CreateScheduledMessage saves the message unless the user already has maxPending
+	// messages waiting, and reports whether it was saved
+	CreateScheduledMessage(msg *ScheduledMessage, maxPending int) (bool, error)
+	ListScheduledMessages(username string) ([]ScheduledMessage, error)
+	CancelScheduledMessage(id int, username string) (bool, error)
+	// DeliverDueScheduledMessages claims up to limit due messages, so no other instance
+	// takes them, and records the outcome of deliver for each of them
+	DeliverDueScheduledMessages(limit int, deliver func(msg *ScheduledMessage) (*Message, error)) (int, error)
+}
+
+// LegalHold exempts a user's messages from retention purges
+type LegalHold struct {
+	Username  string    `json:"username"`
+	Reason    string    `json:"reason"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RetentionRepository defines the interface for purging old messages and managing legal holds.
+// The purge methods delete at most batchSize rows per call so no lock is held for long.
+type RetentionRepository interface {
+	PurgeMessagesBefore(cutoff time.Time, batchSize int) (int64, error)
+	PurgeMessagesBeyondCount(keep, batchSize int) (int64, error)
+	CreateLegalHold(hold *LegalHold) error
+	ListLegalHolds() ([]LegalHold, error)
+	DeleteLegalHold(username string) (bool, error)
+}
+
+// Export job states
+const (
+	ExportQueued  = "queued"
+	ExportRunning = "running"
+	ExportDone    = "done"
+	ExportFailed  = "failed"
+	ExportExpired = "expired"
+)
+
+// ExportJob is an admin-requested export of chat history to a file
+type ExportJob struct {
+	ID         string     `json:"id"`
+	Format     string     `json:"format"`
+	From       *time.Time `json:"from,omitempty"`
+	To         *time.Time `json:"to,omitempty"`
+	Username   string     `json:"username,omitempty"` // only messages by this author
+	Status     string     `json:"status"`
+	Total      int        `json:"total"`
+	Processed  int        `json:"processed"`
+	Error      string     `json:"error,omitempty"`
+	FileSize   int64      `json:"file_size,omitempty"`
+	Worker     string     `json:"-"` // host that runs the job and keeps the file
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// ExportRepository defines the interface for export job data access
+type ExportRepository interface {
+	CreateExportJob(job *ExportJob) error
+	GetExportJob(id string) (*ExportJob, error)
+	ListExportJobs(limit int) ([]ExportJob, error)
+	StartExportJob(id string, total int) error
+	UpdateExportProgress(id string, processed int) error
+	FinishExportJob(id, status, errorText string, fileSize int64) error
+	// FailInterruptedExports marks jobs the worker was running when it stopped as failed
+	FailInterruptedExports(worker string) (int64, error)
+	// ExpireExports marks the worker's finished jobs older than before as expired and returns them
+	ExpireExports(worker string, before time.Time) ([]ExportJob, error)
+}
+
+// ImportRepository defines the interface for importing history from other chat systems.
+// Imported rows are keyed by their source and ID there, so an import can be re-run.
+type ImportRepository interface {
+	// ImportMessage stores a message with its original time and reports whether it was new
+	ImportMessage(source, externalID, username, text string, createdAt time.Time) (bool, error)
+	// ImportedUser returns the local username a source user was mapped to, or "" if none
+	ImportedUser(source, externalID string) (string, error)
+	SaveImportedUser(source, externalID, username string) error
 }
@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// PostgreSQLExportRepository implements ExportRepository interface
+type PostgreSQLExportRepository struct {
+	db *sql.DB
+}
+
+// NewPostgreSQLExportRepository creates a new PostgreSQL export repository
+func NewPostgreSQLExportRepository(db *sql.DB) ExportRepository {
+	return &PostgreSQLExportRepository{db: db}
+}
+
+const exportColumns = `id, format, from_time, to_time, username, status, total, processed, error,
+    file_size, worker, created_by, created_at, finished_at`
+
+// CreateExportJob saves a new queued export job
+func (r *PostgreSQLExportRepository) CreateExportJob(job *ExportJob) error {
+	job.Status = ExportQueued
+	job.CreatedAt = time.Now()
+	_, err := r.db.Exec(
+		`INSERT INTO export_jobs (id, format, from_time, to_time, username, status, worker, created_by, created_at)
+         VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		job.ID, job.Format, job.From, job.To, job.Username, job.Status, job.Worker, job.CreatedBy, job.CreatedAt,
+	)
+	return err
+}
+
+// GetExportJob retrieves an export job by ID
+func (r *PostgreSQLExportRepository) GetExportJob(id string) (*ExportJob, error) {
+	jobs, err := r.query("WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return nil, errors.New("export job not found")
+	}
+	return &jobs[0], nil
+}
+
+// ListExportJobs returns the latest export jobs, newest first
+func (r *PostgreSQLExportRepository) ListExportJobs(limit int) ([]ExportJob, error) {
+	return r.query("ORDER BY created_at DESC LIMIT $1", limit)
+}
+
+// StartExportJob marks a job as running with the number of messages it will export
+func (r *PostgreSQLExportRepository) StartExportJob(id string, total int) error {
+	_, err := r.db.Exec("UPDATE export_jobs SET status = $1, total = $2 WHERE id = $3", ExportRunning, total, id)
+	return err
+}
+
+// UpdateExportProgress records how many messages have been written
+func (r *PostgreSQLExportRepository) UpdateExportProgress(id string, processed int) error {
+	_, err := r.db.Exec("UPDATE export_jobs SET processed = $1 WHERE id = $2", processed, id)
+	return err
+}
+
+// FinishExportJob records the outcome of a job
+func (r *PostgreSQLExportRepository) FinishExportJob(id, status, errorText string, fileSize int64) error {
+	_, err := r.db.Exec(
+		"UPDATE export_jobs SET status = $1, error = $2, file_size = $3, finished_at = NOW() WHERE id = $4",
+		status, errorText, fileSize, id,
+	)
+	return err
+}
+
+// FailInterruptedExports marks jobs the worker was running when it stopped as failed
+func (r *PostgreSQLExportRepository) FailInterruptedExports(worker string) (int64, error) {
+	result, err := r.db.Exec(
+		"UPDATE export_jobs SET status = $1, error = $2, finished_at = NOW() WHERE worker = $3 AND status IN ($4, $5)",
+		ExportFailed, "interrupted by a restart", worker, ExportQueued, ExportRunning,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ExpireExports marks the worker's finished jobs older than before as expired and returns them
+func (r *PostgreSQLExportRepository) ExpireExports(worker string, before time.Time) ([]ExportJob, error) {
+	rows, err := r.db.Query(
+		"UPDATE export_jobs SET status = $1 WHERE worker = $2 AND status = $3 AND finished_at < $4 RETURNING "+exportColumns,
+		ExportExpired, worker, ExportDone, before,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanExportJobs(rows)
+}
+
+func (r *PostgreSQLExportRepository) query(clause string, args ...interface{}) ([]ExportJob, error) {
+	rows, err := r.db.Query("SELECT "+exportColumns+" FROM export_jobs "+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanExportJobs(rows)
+}
+
+func scanExportJobs(rows *sql.Rows) ([]ExportJob, error) {
+	var jobs []ExportJob
+	for rows.Next() {
+		var job ExportJob
+		var from, to, finishedAt sql.NullTime
+		var errorText sql.NullString
+		if err := rows.Scan(&job.ID, &job.Format, &from, &to, &job.Username, &job.Status, &job.Total,
+			&job.Processed, &errorText, &job.FileSize, &job.Worker, &job.CreatedBy, &job.CreatedAt, &finishedAt); err != nil {
+			return nil, err
+		}
+		if from.Valid {
+			job.From = &from.Time
+		}
+		if to.Valid {
+			job.To = &to.Time
+		}
+		if finishedAt.Valid {
+			job.FinishedAt = &finishedAt.Time
+		}
+		job.Error = errorText.String
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// CreateTables initializes the database schema
+func (r *PostgreSQLExportRepository) CreateTables() error {
+	query := `
+    CREATE TABLE IF NOT EXISTS export_jobs (
+        id VARCHAR(32) PRIMARY KEY,
+        format VARCHAR(10) NOT NULL,
+        from_time TIMESTAMP,
+        to_time TIMESTAMP,
+        username VARCHAR(50) NOT NULL DEFAULT '',
+        status VARCHAR(10) NOT NULL,
+        total INTEGER NOT NULL DEFAULT 0,
+        processed INTEGER NOT NULL DEFAULT 0,
+        error TEXT,
+        file_size BIGINT NOT NULL DEFAULT 0,
+        worker VARCHAR(255) NOT NULL,
+        created_by VARCHAR(50) NOT NULL,
+        created_at TIMESTAMP DEFAULT NOW(),
+        finished_at TIMESTAMP
+    );
+    `
+	_, err := r.db.Exec(query)
+	return err
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+)
+
+// PostgreSQLImportRepository implements ImportRepository interface
+type PostgreSQLImportRepository struct {
+	db *sql.DB
+}
+
+// NewPostgreSQLImportRepository creates a new PostgreSQL import repository
+func NewPostgreSQLImportRepository(db *sql.DB) ImportRepository {
+	return &PostgreSQLImportRepository{db: db}
+}
+
+// ImportMessage stores a message unless one with the same source and external ID exists
+func (r *PostgreSQLImportRepository) ImportMessage(source, externalID, username, text string, createdAt time.Time) (bool, error) {
+	// created_at has no time zone, live messages are stored in local time as well
+	result, err := r.db.Exec(
+		`INSERT INTO messages (username, text, created_at, import_source, import_id)
+         VALUES ($1, $2, $3, $4, $5)
+         ON CONFLICT (import_source, import_id) DO NOTHING`,
+		username, text, createdAt.Local(), source, externalID,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	inserted, err := result.RowsAffected()
+	return inserted > 0, err
+}
+
+// ImportedUser returns the local username a source user was mapped to
+func (r *PostgreSQLImportRepository) ImportedUser(source, externalID string) (string, error) {
+	var username string
+	err := r.db.QueryRow(
+		"SELECT username FROM import_users WHERE source = $1 AND external_id = $2",
+		source, externalID,
+	).Scan(&username)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return username, err
+}
+
+// SaveImportedUser records the local username a source user maps to
+func (r *PostgreSQLImportRepository) SaveImportedUser(source, externalID, username string) error {
+	_, err := r.db.Exec(
+		`INSERT INTO import_users (source, external_id, username, created_at) VALUES ($1, $2, $3, NOW())
+         ON CONFLICT (source, external_id) DO UPDATE SET username = EXCLUDED.username`,
+		source, externalID, username,
+	)
+	return err
+}
+
+// CreateTables initializes the database schema
+func (r *PostgreSQLImportRepository) CreateTables() error {
+	query := `
+    CREATE TABLE IF NOT EXISTS import_users (
+        source VARCHAR(50) NOT NULL,
+        external_id VARCHAR(255) NOT NULL,
+        username VARCHAR(50) NOT NULL,
+        created_at TIMESTAMP DEFAULT NOW(),
+        PRIMARY KEY (source, external_id)
+    );
+    `
+	_, err := r.db.Exec(query)
+	return err
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// PostgreSQLIncomingWebhookRepository implements IncomingWebhookRepository interface
+type PostgreSQLIncomingWebhookRepository struct {
+	db *sql.DB
+}
+
+// NewPostgreSQLIncomingWebhookRepository creates a new PostgreSQL incoming webhook repository
+func NewPostgreSQLIncomingWebhookRepository(db *sql.DB) IncomingWebhookRepository {
+	return &PostgreSQLIncomingWebhookRepository{db: db}
+}
+
+// CreateIncomingWebhook saves a new incoming webhook and sets its ID
+func (r *PostgreSQLIncomingWebhookRepository) CreateIncomingWebhook(hook *IncomingWebhook) error {
+	hook.CreatedAt = time.Now()
+	return r.db.QueryRow(
+		`INSERT INTO incoming_webhooks (name, token_hash, rate_limit, created_by, created_at)
+         VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		hook.Name, hook.TokenHash, hook.RateLimit, hook.CreatedBy, hook.CreatedAt,
+	).Scan(&hook.ID)
+}
+
+// GetIncomingWebhookByToken retrieves an incoming webhook by the hash of its token
+func (r *PostgreSQLIncomingWebhookRepository) GetIncomingWebhookByToken(tokenHash string) (*IncomingWebhook, error) {
+	hooks, err := r.query("WHERE token_hash = $1", tokenHash)
+	if err != nil {
+		return nil, err
+	}
+	if len(hooks) == 0 {
+		return nil, errors.New("incoming webhook not found")
+	}
+	return &hooks[0], nil
+}
+
+// ListIncomingWebhooks returns all incoming webhooks
+func (r *PostgreSQLIncomingWebhookRepository) ListIncomingWebhooks() ([]IncomingWebhook, error) {
+	return r.query("")
+}
+
+func (r *PostgreSQLIncomingWebhookRepository) query(condition string, args ...interface{}) ([]IncomingWebhook, error) {
+	rows, err := r.db.Query(
+		"SELECT id, name, token_hash, rate_limit, created_by, created_at, last_used_at FROM incoming_webhooks "+condition+" ORDER BY id",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hooks []IncomingWebhook
+	for rows.Next() {
+		var hook IncomingWebhook
+		var lastUsedAt sql.NullTime
+		if err := rows.Scan(&hook.ID, &hook.Name, &hook.TokenHash, &hook.RateLimit,
+			&hook.CreatedBy, &hook.CreatedAt, &lastUsedAt); err != nil {
+			return nil, err
+		}
+		if lastUsedAt.Valid {
+			hook.LastUsedAt = &lastUsedAt.Time
+		}
+		hooks = append(hooks, hook)
+	}
+
+	return hooks, rows.Err()
+}
+
+// DeleteIncomingWebhook removes an incoming webhook and reports whether it existed
+func (r *PostgreSQLIncomingWebhookRepository) DeleteIncomingWebhook(id int) (bool, error) {
+	result, err := r.db.Exec("DELETE FROM incoming_webhooks WHERE id = $1", id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// TouchIncomingWebhook records that the webhook was just used
+func (r *PostgreSQLIncomingWebhookRepository) TouchIncomingWebhook(id int) error {
+	_, err := r.db.Exec("UPDATE incoming_webhooks SET last_used_at = NOW() WHERE id = $1", id)
+	return err
+}
+
+// CreateTables initializes the database schema
+func (r *PostgreSQLIncomingWebhookRepository) CreateTables() error {
+	query := `
+    CREATE TABLE IF NOT EXISTS incoming_webhooks (
+        id SERIAL PRIMARY KEY,
+        name VARCHAR(50) NOT NULL,
+        token_hash VARCHAR(64) UNIQUE NOT NULL,
+        rate_limit INTEGER NOT NULL,
+        created_by VARCHAR(50) NOT NULL,
+        created_at TIMESTAMP DEFAULT NOW(),
+        last_used_at TIMESTAMP
+    );
+    `
+	_, err := r.db.Exec(query)
+	return err
+}
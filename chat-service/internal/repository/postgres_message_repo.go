@@ -2,6 +2,8 @@ package repository
 
 import (
 	"database/sql"
+	"fmt"
+	"strings"
 	"time"
 
 	_ "github.com/lib/pq"
@@ -74,6 +76,66 @@ func (r *PostgreSQLMessageRepository) GetMessageCount() (int, error) {
 	return count, err
 }
 
+// ListMessages returns up to limit messages matching filter that come after the given message,
+// in creation order. Imported messages can have IDs above newer ones, so IDs only break ties.
+func (r *PostgreSQLMessageRepository) ListMessages(filter MessageFilter, after *Message, limit int) ([]Message, error) {
+	condition, args := filterCondition(filter, after)
+	args = append(args, limit)
+
+	rows, err := r.db.Query(
+		fmt.Sprintf("SELECT id, username, text, created_at FROM messages WHERE %s ORDER BY created_at, id LIMIT $%d", condition, len(args)),
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		var msg Message
+		if err := rows.Scan(&msg.ID, &msg.Username, &msg.Text, &msg.Timestamp); err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, rows.Err()
+}
+
+// CountMessages returns the number of messages matching filter
+func (r *PostgreSQLMessageRepository) CountMessages(filter MessageFilter) (int, error) {
+	condition, args := filterCondition(filter, nil)
+
+	var count int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM messages WHERE "+condition, args...).Scan(&count)
+	return count, err
+}
+
+func filterCondition(filter MessageFilter, after *Message) (string, []interface{}) {
+	conditions := []string{"TRUE"}
+	var args []interface{}
+
+	if after != nil {
+		args = append(args, after.Timestamp, after.ID)
+		conditions = append(conditions, fmt.Sprintf("(created_at, id) > ($%d, $%d)", len(args)-1, len(args)))
+	}
+	if !filter.From.IsZero() {
+		args = append(args, filter.From)
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+	if !filter.To.IsZero() {
+		args = append(args, filter.To)
+		conditions = append(conditions, fmt.Sprintf("created_at < $%d", len(args)))
+	}
+	if filter.Username != "" {
+		args = append(args, filter.Username)
+		conditions = append(conditions, fmt.Sprintf("username = $%d", len(args)))
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
 // CreateTables initializes the database schema
 func (r *PostgreSQLMessageRepository) CreateTables() error {
 	query := `
@@ -84,7 +146,12 @@ func (r *PostgreSQLMessageRepository) CreateTables() error {
         created_at TIMESTAMP DEFAULT NOW()
     );
     CREATE INDEX IF NOT EXISTS idx_messages_created_at ON messages(created_at DESC);
+    CREATE INDEX IF NOT EXISTS idx_messages_created_id ON messages(created_at, id);
     CREATE INDEX IF NOT EXISTS idx_messages_username ON messages(username);
+
+    ALTER TABLE messages ADD COLUMN IF NOT EXISTS import_source VARCHAR(50);
+    ALTER TABLE messages ADD COLUMN IF NOT EXISTS import_id VARCHAR(255);
+    CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_import ON messages(import_source, import_id);
     `
 	_, err := r.db.Exec(query)
 	return err
@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+)
+
+// PostgreSQLRetentionRepository implements RetentionRepository interface
+type PostgreSQLRetentionRepository struct {
+	db *sql.DB
+}
+
+// NewPostgreSQLRetentionRepository creates a new PostgreSQL retention repository
+func NewPostgreSQLRetentionRepository(db *sql.DB) RetentionRepository {
+	return &PostgreSQLRetentionRepository{db: db}
+}
+
+// PurgeMessagesBefore deletes up to batchSize messages older than cutoff, skipping users on legal hold
+func (r *PostgreSQLRetentionRepository) PurgeMessagesBefore(cutoff time.Time, batchSize int) (int64, error) {
+	return r.purge(
+		`DELETE FROM messages WHERE id IN (
+             SELECT id FROM messages
+             WHERE created_at < $1
+               AND username NOT IN (SELECT username FROM legal_holds)
+             ORDER BY created_at, id
+             LIMIT $2
+         )`,
+		cutoff, batchSize,
+	)
+}
+
+// PurgeMessagesBeyondCount deletes up to batchSize of the oldest messages beyond the newest keep,
+// skipping users on legal hold. Held messages still count towards keep. Age is taken from the
+// creation time, since imported messages can have IDs above newer ones.
+func (r *PostgreSQLRetentionRepository) PurgeMessagesBeyondCount(keep, batchSize int) (int64, error) {
+	var cutoffTime time.Time
+	var cutoffID int
+	err := r.db.QueryRow(
+		"SELECT created_at, id FROM messages ORDER BY created_at DESC, id DESC OFFSET $1 LIMIT 1", keep,
+	).Scan(&cutoffTime, &cutoffID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return r.purge(
+		`DELETE FROM messages WHERE id IN (
+             SELECT id FROM messages
+             WHERE (created_at, id) <= ($1, $2)
+               AND username NOT IN (SELECT username FROM legal_holds)
+             ORDER BY created_at, id
+             LIMIT $3
+         )`,
+		cutoffTime, cutoffID, batchSize,
+	)
+}
+
+func (r *PostgreSQLRetentionRepository) purge(query string, args ...interface{}) (int64, error) {
+	result, err := r.db.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// CreateLegalHold places a user's messages on legal hold, replacing the reason of an existing hold
+func (r *PostgreSQLRetentionRepository) CreateLegalHold(hold *LegalHold) error {
+	hold.CreatedAt = time.Now()
+	_, err := r.db.Exec(
+		`INSERT INTO legal_holds (username, reason, created_by, created_at) VALUES ($1, $2, $3, $4)
+         ON CONFLICT (username) DO UPDATE SET reason = EXCLUDED.reason`,
+		hold.Username, hold.Reason, hold.CreatedBy, hold.CreatedAt,
+	)
+	return err
+}
+
+// ListLegalHolds returns all legal holds
+func (r *PostgreSQLRetentionRepository) ListLegalHolds() ([]LegalHold, error) {
+	rows, err := r.db.Query("SELECT username, reason, created_by, created_at FROM legal_holds ORDER BY username")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var holds []LegalHold
+	for rows.Next() {
+		var hold LegalHold
+		if err := rows.Scan(&hold.Username, &hold.Reason, &hold.CreatedBy, &hold.CreatedAt); err != nil {
+			return nil, err
+		}
+		holds = append(holds, hold)
+	}
+
+	return holds, rows.Err()
+}
+
+// DeleteLegalHold releases a legal hold and reports whether it existed
+func (r *PostgreSQLRetentionRepository) DeleteLegalHold(username string) (bool, error) {
+	result, err := r.db.Exec("DELETE FROM legal_holds WHERE username = $1", username)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// CreateTables initializes the database schema
+func (r *PostgreSQLRetentionRepository) CreateTables() error {
+	query := `
+    CREATE TABLE IF NOT EXISTS legal_holds (
+        username VARCHAR(50) PRIMARY KEY,
+        reason TEXT NOT NULL,
+        created_by VARCHAR(50) NOT NULL,
+        created_at TIMESTAMP DEFAULT NOW()
+    );
+    `
+	_, err := r.db.Exec(query)
+	return err
+}
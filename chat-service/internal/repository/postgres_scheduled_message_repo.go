@@ -0,0 +1,212 @@
+package repository
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+)
+
+// PostgreSQLScheduledMessageRepository implements ScheduledMessageRepository interface
+type PostgreSQLScheduledMessageRepository struct {
+	db *sql.DB
+}
+
+// NewPostgreSQLScheduledMessageRepository creates a new PostgreSQL scheduled message repository
+func NewPostgreSQLScheduledMessageRepository(db *sql.DB) ScheduledMessageRepository {
+	return &PostgreSQLScheduledMessageRepository{db: db}
+}
+
+// CreateScheduledMessage saves a new pending scheduled message and sets its ID. The user's
+// messages are counted under a per-user lock, so concurrent requests cannot exceed maxPending.
+func (r *PostgreSQLScheduledMessageRepository) CreateScheduledMessage(msg *ScheduledMessage, maxPending int) (bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('scheduled_messages:' || $1))", msg.Username); err != nil {
+		return false, err
+	}
+
+	var pending int
+	err = tx.QueryRow(
+		"SELECT COUNT(*) FROM scheduled_messages WHERE username = $1 AND status = $2",
+		msg.Username, ScheduledPending,
+	).Scan(&pending)
+	if err != nil {
+		return false, err
+	}
+	if pending >= maxPending {
+		return false, nil
+	}
+
+	msg.Status = ScheduledPending
+	msg.CreatedAt = time.Now()
+	err = tx.QueryRow(
+		`INSERT INTO scheduled_messages (username, text, send_at, status, created_at)
+         VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		msg.Username, msg.Text, msg.SendAt, msg.Status, msg.CreatedAt,
+	).Scan(&msg.ID)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// ListScheduledMessages returns the user's pending messages and the ones handled in the last day, soonest first
+func (r *PostgreSQLScheduledMessageRepository) ListScheduledMessages(username string) ([]ScheduledMessage, error) {
+	rows, err := r.db.Query(
+		`SELECT id, username, text, send_at, status, error, message_id, created_at, sent_at
+         FROM scheduled_messages
+         WHERE username = $1 AND (status = $2 OR send_at > NOW() - INTERVAL '1 day')
+         ORDER BY send_at, id`,
+		username, ScheduledPending,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []ScheduledMessage
+	for rows.Next() {
+		msg, err := scanScheduledMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, *msg)
+	}
+
+	return messages, rows.Err()
+}
+
+// CancelScheduledMessage cancels one of the user's pending messages and reports whether it was pending
+func (r *PostgreSQLScheduledMessageRepository) CancelScheduledMessage(id int, username string) (bool, error) {
+	result, err := r.db.Exec(
+		"UPDATE scheduled_messages SET status = $1 WHERE id = $2 AND username = $3 AND status = $4",
+		ScheduledCancelled, id, username, ScheduledPending,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// DeliverDueScheduledMessages marks due messages as sending and commits that before
+// posting them, so no row lock is held while messages are posted and several chat-service
+// instances can run the scheduler without sending a message twice. Messages whose
+// scheduler died while posting are marked failed rather than risking a duplicate.
+func (r *PostgreSQLScheduledMessageRepository) DeliverDueScheduledMessages(limit int, deliver func(msg *ScheduledMessage) (*Message, error)) (int, error) {
+	_, err := r.db.Exec(
+		"UPDATE scheduled_messages SET status = $1, error = $2, sent_at = NOW() WHERE status = $3 AND claimed_at < NOW() - INTERVAL '10 minutes'",
+		ScheduledFailed, "interrupted while sending", ScheduledSending,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := r.db.Query(
+		`UPDATE scheduled_messages SET status = $1, claimed_at = NOW()
+         WHERE id IN (
+             SELECT id FROM scheduled_messages
+             WHERE status = $2 AND send_at <= NOW()
+             ORDER BY send_at, id
+             LIMIT $3
+             FOR UPDATE SKIP LOCKED
+         )
+         RETURNING id, username, text, send_at, status, error, message_id, created_at, sent_at`,
+		ScheduledSending, ScheduledPending, limit,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	var due []*ScheduledMessage
+	for rows.Next() {
+		msg, err := scanScheduledMessage(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due = append(due, msg)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].SendAt.Equal(due[j].SendAt) {
+			return due[i].SendAt.Before(due[j].SendAt)
+		}
+		return due[i].ID < due[j].ID
+	})
+
+	// The outcome of every claimed message is recorded even if one update fails
+	var firstErr error
+	for _, msg := range due {
+		message, err := deliver(msg)
+		if err != nil {
+			_, err = r.db.Exec(
+				"UPDATE scheduled_messages SET status = $1, error = $2, sent_at = NOW() WHERE id = $3",
+				ScheduledFailed, err.Error(), msg.ID,
+			)
+		} else {
+			_, err = r.db.Exec(
+				"UPDATE scheduled_messages SET status = $1, message_id = $2, sent_at = NOW() WHERE id = $3",
+				ScheduledSent, message.ID, msg.ID,
+			)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return len(due), firstErr
+}
+
+func scanScheduledMessage(rows *sql.Rows) (*ScheduledMessage, error) {
+	var msg ScheduledMessage
+	var errorText sql.NullString
+	var messageID sql.NullInt64
+	var sentAt sql.NullTime
+	if err := rows.Scan(&msg.ID, &msg.Username, &msg.Text, &msg.SendAt, &msg.Status,
+		&errorText, &messageID, &msg.CreatedAt, &sentAt); err != nil {
+		return nil, err
+	}
+
+	msg.Error = errorText.String
+	msg.MessageID = int(messageID.Int64)
+	if sentAt.Valid {
+		msg.SentAt = &sentAt.Time
+	}
+	return &msg, nil
+}
+
+// CreateTables initializes the database schema
+func (r *PostgreSQLScheduledMessageRepository) CreateTables() error {
+	query := `
+    CREATE TABLE IF NOT EXISTS scheduled_messages (
+        id SERIAL PRIMARY KEY,
+        username VARCHAR(50) NOT NULL,
+        text TEXT NOT NULL,
+        send_at TIMESTAMPTZ NOT NULL,
+        status VARCHAR(10) NOT NULL,
+        error TEXT,
+        message_id INTEGER,
+        created_at TIMESTAMPTZ DEFAULT NOW(),
+        sent_at TIMESTAMPTZ
+    );
+
+    CREATE INDEX IF NOT EXISTS idx_scheduled_messages_due ON scheduled_messages(send_at) WHERE status = 'pending';
+    CREATE INDEX IF NOT EXISTS idx_scheduled_messages_username ON scheduled_messages(username, send_at);
+
+    ALTER TABLE scheduled_messages ADD COLUMN IF NOT EXISTS claimed_at TIMESTAMPTZ;
+    `
+	_, err := r.db.Exec(query)
+	return err
+}
@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// PostgreSQLWebhookRepository implements WebhookRepository interface
+type PostgreSQLWebhookRepository struct {
+	db *sql.DB
+}
+
+// NewPostgreSQLWebhookRepository creates a new PostgreSQL webhook repository
+func NewPostgreSQLWebhookRepository(db *sql.DB) WebhookRepository {
+	return &PostgreSQLWebhookRepository{db: db}
+}
+
+// CreateWebhook saves a new webhook and sets its ID
+func (r *PostgreSQLWebhookRepository) CreateWebhook(webhook *Webhook) error {
+	webhook.CreatedAt = time.Now()
+	return r.db.QueryRow(
+		`INSERT INTO webhooks (url, secret, events, active, created_by, created_at)
+         VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		webhook.URL, webhook.Secret, strings.Join(webhook.Events, ","), webhook.Active, webhook.CreatedBy, webhook.CreatedAt,
+	).Scan(&webhook.ID)
+}
+
+// GetWebhook retrieves a webhook by ID
+func (r *PostgreSQLWebhookRepository) GetWebhook(id int) (*Webhook, error) {
+	webhooks, err := r.queryWebhooks("WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(webhooks) == 0 {
+		return nil, ErrWebhookNotFound
+	}
+	return &webhooks[0], nil
+}
+
+// ListWebhooks returns all webhooks
+func (r *PostgreSQLWebhookRepository) ListWebhooks() ([]Webhook, error) {
+	return r.queryWebhooks("")
+}
+
+// ListWebhooksForEvent returns the active webhooks subscribed to an event
+func (r *PostgreSQLWebhookRepository) ListWebhooksForEvent(event string) ([]Webhook, error) {
+	return r.queryWebhooks("WHERE active AND $1 = ANY(string_to_array(events, ','))", event)
+}
+
+func (r *PostgreSQLWebhookRepository) queryWebhooks(condition string, args ...interface{}) ([]Webhook, error) {
+	rows, err := r.db.Query(
+		"SELECT id, url, secret, events, active, created_by, created_at FROM webhooks "+condition+" ORDER BY id",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []Webhook
+	for rows.Next() {
+		var webhook Webhook
+		var events string
+		if err := rows.Scan(&webhook.ID, &webhook.URL, &webhook.Secret, &events,
+			&webhook.Active, &webhook.CreatedBy, &webhook.CreatedAt); err != nil {
+			return nil, err
+		}
+		if events != "" {
+			webhook.Events = strings.Split(events, ",")
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+// DeleteWebhook removes a webhook and its delivery log and reports whether it existed
+func (r *PostgreSQLWebhookRepository) DeleteWebhook(id int) (bool, error) {
+	result, err := r.db.Exec("DELETE FROM webhooks WHERE id = $1", id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// SaveDelivery records a delivery attempt
+func (r *PostgreSQLWebhookRepository) SaveDelivery(delivery *WebhookDelivery) error {
+	delivery.CreatedAt = time.Now()
+	return r.db.QueryRow(
+		`INSERT INTO webhook_deliveries (webhook_id, event_id, event, attempt, status_code, error, duration_ms, success, created_at)
+         VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`,
+		delivery.WebhookID, delivery.EventID, delivery.Event, delivery.Attempt, delivery.StatusCode,
+		delivery.Error, delivery.DurationMs, delivery.Success, delivery.CreatedAt,
+	).Scan(&delivery.ID)
+}
+
+// ListDeliveries returns the latest delivery attempts of a webhook, newest first
+func (r *PostgreSQLWebhookRepository) ListDeliveries(webhookID, limit int) ([]WebhookDelivery, error) {
+	rows, err := r.db.Query(
+		`SELECT id, webhook_id, event_id, event, attempt, status_code, error, duration_ms, success, created_at
+         FROM webhook_deliveries WHERE webhook_id = $1 ORDER BY id DESC LIMIT $2`,
+		webhookID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []WebhookDelivery
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.Event, &d.Attempt, &d.StatusCode,
+			&d.Error, &d.DurationMs, &d.Success, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// CreateTables initializes the database schema
+func (r *PostgreSQLWebhookRepository) CreateTables() error {
+	query := `
+    CREATE TABLE IF NOT EXISTS webhooks (
+        id SERIAL PRIMARY KEY,
+        url TEXT NOT NULL,
+        secret VARCHAR(128) NOT NULL,
+        events TEXT NOT NULL,
+        active BOOLEAN NOT NULL DEFAULT TRUE,
+        created_by VARCHAR(50) NOT NULL,
+        created_at TIMESTAMP DEFAULT NOW()
+    );
+
+    CREATE TABLE IF NOT EXISTS webhook_deliveries (
+        id SERIAL PRIMARY KEY,
+        webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+        event_id VARCHAR(64) NOT NULL,
+        event VARCHAR(50) NOT NULL,
+        attempt INTEGER NOT NULL,
+        status_code INTEGER NOT NULL DEFAULT 0,
+        error TEXT NOT NULL DEFAULT '',
+        duration_ms BIGINT NOT NULL DEFAULT 0,
+        success BOOLEAN NOT NULL,
+        created_at TIMESTAMP DEFAULT NOW()
+    );
+    CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, id DESC);
+    `
+	_, err := r.db.Exec(query)
+	return err
+}
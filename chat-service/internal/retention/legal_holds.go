@@ -0,0 +1,40 @@
+package retention
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/meetohin/web-chat/chat-service/internal/repository"
+)
+
+// Redis keys through which notification-service learns about legal holds, so it keeps
+// the notifications of held users too. The published key tells an empty set of holds
+// apart from holds that were never published.
+const (
+	LegalHoldsKey          = "retention:legal_holds"
+	LegalHoldsPublishedKey = "retention:legal_holds:published"
+)
+
+// PublishLegalHolds replaces the Redis set of held usernames with the holds in the database
+func PublishLegalHolds(ctx context.Context, rdb *redis.Client, repo repository.RetentionRepository) error {
+	holds, err := repo.ListLegalHolds()
+	if err != nil {
+		return err
+	}
+
+	usernames := make([]interface{}, len(holds))
+	for i, hold := range holds {
+		usernames[i] = hold.Username
+	}
+
+	_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, LegalHoldsKey)
+		if len(usernames) > 0 {
+			pipe.SAdd(ctx, LegalHoldsKey, usernames...)
+		}
+		pipe.Set(ctx, LegalHoldsPublishedKey, time.Now().Unix(), 0)
+		return nil
+	})
+	return err
+}
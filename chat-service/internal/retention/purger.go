@@ -0,0 +1,125 @@
+// Package retention deletes chat messages that are past their retention period
+package retention
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"time"
+
+	"github.com/meetohin/web-chat/chat-service/internal/repository"
+)
+
+// Config controls what is purged and how. A zero MaxAge or MaxMessages disables that rule.
+type Config struct {
+	MaxAge      time.Duration
+	MaxMessages int
+	Interval    time.Duration
+	BatchSize   int
+	BatchPause  time.Duration // pause between batches so other queries get the table
+}
+
+// DefaultConfig returns the configuration used when nothing is set: retention is off
+func DefaultConfig() Config {
+	return Config{
+		Interval:   time.Hour,
+		BatchSize:  1000,
+		BatchPause: 100 * time.Millisecond,
+	}
+}
+
+// Enabled reports whether any retention rule is configured
+func (c Config) Enabled() bool {
+	return c.MaxAge > 0 || c.MaxMessages > 0
+}
+
+// Metrics are published at /debug/vars under "retention"
+var metrics = expvar.NewMap("retention")
+
+// Purger periodically deletes messages that fall outside the retention rules
+type Purger struct {
+	repo repository.RetentionRepository
+	cfg  Config
+}
+
+// NewPurger creates a purger
+func NewPurger(repo repository.RetentionRepository, cfg Config) *Purger {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultConfig().BatchSize
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultConfig().Interval
+	}
+	return &Purger{repo: repo, cfg: cfg}
+}
+
+// Start purges right away and then every interval until ctx is cancelled
+func (p *Purger) Start(ctx context.Context) {
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		p.RunOnce(ctx)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// RunOnce applies every configured rule once
+func (p *Purger) RunOnce(ctx context.Context) {
+	started := time.Now()
+	metrics.Add("runs", 1)
+
+	if p.cfg.MaxAge > 0 {
+		cutoff := time.Now().Add(-p.cfg.MaxAge)
+		p.purge(ctx, "messages_purged_age", func() (int64, error) {
+			return p.repo.PurgeMessagesBefore(cutoff, p.cfg.BatchSize)
+		})
+	}
+	if p.cfg.MaxMessages > 0 {
+		p.purge(ctx, "messages_purged_count", func() (int64, error) {
+			return p.repo.PurgeMessagesBeyondCount(p.cfg.MaxMessages, p.cfg.BatchSize)
+		})
+	}
+
+	metrics.Set("last_run_unix", intVar(started.Unix()))
+	metrics.Set("last_run_duration_ms", intVar(time.Since(started).Milliseconds()))
+}
+
+// purge runs batches until one deletes fewer rows than the batch size
+func (p *Purger) purge(ctx context.Context, metric string, batch func() (int64, error)) {
+	var total int64
+	for ctx.Err() == nil {
+		deleted, err := batch()
+		if err != nil {
+			metrics.Add("errors", 1)
+			log.Printf("Retention purge failed: %v", err)
+			break
+		}
+
+		total += deleted
+		metrics.Add(metric, deleted)
+		if deleted < int64(p.cfg.BatchSize) {
+			break
+		}
+
+		select {
+		case <-time.After(p.cfg.BatchPause):
+		case <-ctx.Done():
+		}
+	}
+
+	if total > 0 {
+		log.Printf("Retention purged %d messages (%s)", total, metric)
+	}
+}
+
+func intVar(v int64) *expvar.Int {
+	i := new(expvar.Int)
+	i.Set(v)
+	return i
+}
@@ -3,17 +3,29 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/go-redis/redis/v8"
 	"github.com/gorilla/websocket"
 	"github.com/meetohin/web-chat/chat-service/internal/client"
 	"github.com/meetohin/web-chat/chat-service/internal/repository"
+	"github.com/meetohin/web-chat/chat-service/internal/webhook"
+	"github.com/meetohin/web-chat/chat-service/pkg/protocol"
 )
 
+// MaxMessageLength is the longest message text kept, longer texts are truncated
+const MaxMessageLength = 1000
+
+// IncomingWebhookSuffix marks the authors of messages posted by incoming webhooks.
+// Usernames cannot contain '@', so these authors never clash with real accounts.
+const IncomingWebhookSuffix = "@hook"
+
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		return true // TODO: Configure proper CORS for production
@@ -24,6 +36,10 @@ type Client struct {
 	conn               *websocket.Conn
 	username           string
 	userID             string
+	sessionID          string // auth session of the token used to connect
+	admin              bool
+	away               bool  // idle or not looking at the chat, guarded by ChatService.mu
+	commandRunning     int32 // 1 while an async command of the client runs, accessed atomically
 	send               chan []byte
 	notificationCancel context.CancelFunc // for canceling notification subscription
 }
@@ -31,7 +47,11 @@ type Client struct {
 type ChatService struct {
 	authClient         *client.AuthClient
 	messageRepo        repository.MessageRepository
+	scheduledRepo      repository.ScheduledMessageRepository
 	notificationClient *NotificationClient
+	redis              *redis.Client // sessions, commands and presence state shared by all instances
+	webhooks           *webhook.Dispatcher
+	commands           *CommandRegistry
 	clients            map[*Client]bool
 	broadcast          chan []byte
 	register           chan *Client
@@ -39,37 +59,49 @@ type ChatService struct {
 	mu                 sync.RWMutex
 }
 
-func NewChatService(authClient *client.AuthClient, messageRepo repository.MessageRepository, redisURL string) (*ChatService, error) {
-	notificationClient, err := NewNotificationClient(redisURL)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create notification client: %w", err)
-	}
-
-	return &ChatService{
+func NewChatService(authClient *client.AuthClient, messageRepo repository.MessageRepository, scheduledRepo repository.ScheduledMessageRepository, webhooks *webhook.Dispatcher, rdb *redis.Client) *ChatService {
+	cs := &ChatService{
 		authClient:         authClient,
 		messageRepo:        messageRepo,
-		notificationClient: notificationClient,
+		scheduledRepo:      scheduledRepo,
+		notificationClient: NewNotificationClient(rdb),
+		redis:              rdb,
+		webhooks:           webhooks,
+		commands:           newCommandRegistry(),
 		clients:            make(map[*Client]bool),
 		broadcast:          make(chan []byte),
 		register:           make(chan *Client),
 		unregister:         make(chan *Client),
-	}, nil
+	}
+	cs.registerBuiltinCommands()
+	return cs
 }
 
-func (cs *ChatService) Run() {
+// Run serves client registrations and broadcasts. Cancelling ctx stops listening
+// for session revocations and tracking presence.
+func (cs *ChatService) Run(ctx context.Context) {
+	go cs.listenSessionRevocations(ctx)
+	go cs.trackPresence(ctx)
+
 	for {
 		select {
 		case client := <-cs.register:
 			cs.mu.Lock()
+			firstConnection := !cs.isConnected(client.username)
 			cs.clients[client] = true
 			cs.mu.Unlock()
 
-			cs.startNotificationSubscription(client)
+			if firstConnection {
+				cs.publishEvent(webhook.EventUserJoined, map[string]string{"username": client.username})
+			}
+			go cs.touchPresence(context.Background(), client.username)
+			go cs.updateActive(client.username, true)
 
 			log.Printf("Client %s connected. Total clients: %d", client.username, len(cs.clients))
 
 		case client := <-cs.unregister:
 			cs.mu.Lock()
+			lastConnection := false
 			if _, ok := cs.clients[client]; ok {
 				delete(cs.clients, client)
 				close(client.send)
@@ -77,8 +109,17 @@ func (cs *ChatService) Run() {
 				if client.notificationCancel != nil {
 					client.notificationCancel()
 				}
+				lastConnection = !cs.isConnected(client.username)
+				if !client.away && !cs.isActive(client.username) {
+					go cs.updateActive(client.username, false)
+				}
 			}
 			cs.mu.Unlock()
+
+			if lastConnection {
+				cs.publishEvent(webhook.EventUserLeft, map[string]string{"username": client.username})
+				go cs.touchPresence(context.Background(), client.username)
+			}
 			log.Printf("Client %s disconnected. Total clients: %d", client.username, len(cs.clients))
 
 		case message := <-cs.broadcast:
@@ -99,17 +140,47 @@ func (cs *ChatService) Run() {
 	}
 }
 
-func (cs *ChatService) startNotificationSubscription(client *Client) {
+// startNotificationSubscription forwards the user's notifications to the client. It returns
+// once the subscription is active, so no notification published afterwards is missed.
+func (cs *ChatService) startNotificationSubscription(client *Client) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	client.notificationCancel = cancel
 
-	go cs.notificationClient.SubscribeToNotifications(ctx, client.userID, func(data []byte) {
+	err := cs.notificationClient.SubscribeToNotifications(ctx, client.userID, func(data []byte) {
 		select {
 		case client.send <- data:
 		default:
 			cs.unregister <- client
 		}
 	})
+	if err != nil {
+		cancel()
+	}
+	return err
+}
+
+// sendPendingNotifications sends the client the notifications that arrived while its user
+// had no connection, in one burst
+func (cs *ChatService) sendPendingNotifications(client *Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	frames, err := cs.notificationClient.TakePendingNotifications(ctx, client.userID)
+	if err != nil {
+		log.Printf("Error getting pending notifications of %s: %v", client.username, err)
+		return
+	}
+	for i, frame := range frames {
+		select {
+		case client.send <- frame:
+		default:
+			// The rest waits for the next connection rather than being lost
+			if err := cs.notificationClient.RestorePendingNotifications(ctx, client.userID, frames[i:]); err != nil {
+				log.Printf("Dropped %d pending notifications of %s: %v", len(frames)-i, client.username, err)
+			}
+			return
+		}
+	}
 }
 
 func (cs *ChatService) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
@@ -119,11 +190,15 @@ func (cs *ChatService) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	username, err := cs.authClient.ValidateToken(context.Background(), token)
+	identity, err := cs.authClient.ValidateToken(context.Background(), token)
 	if err != nil {
 		http.Error(w, "Invalid token", http.StatusUnauthorized)
 		return
 	}
+	if !identity.HasScope(client.ScopeMessagesRead) {
+		http.Error(w, "API key lacks the messages:read scope", http.StatusForbidden)
+		return
+	}
 
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -132,16 +207,30 @@ func (cs *ChatService) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	}
 
 	client := &Client{
-		conn:     conn,
-		username: username,
-		userID:   username,
-		send:     make(chan []byte, 256),
+		conn:      conn,
+		username:  identity.Username,
+		userID:    identity.Username,
+		sessionID: identity.SessionID,
+		admin:     identity.IsAdmin(),
+		send:      make(chan []byte, 256),
+	}
+
+	// Subscribe before taking the held notifications, so none falls in between
+	if err := cs.startNotificationSubscription(client); err != nil {
+		log.Printf("Failed to subscribe %s to notifications: %v", client.username, err)
 	}
 
 	cs.register <- client
 
-	// Send recent messages to newly connected client
-	recentMessages, err := cs.messageRepo.GetRecentMessages(50)
+	// Send the topic and recent messages to newly connected client
+	if topic, err := cs.CurrentTopic(context.Background()); err != nil {
+		log.Printf("Error getting topic: %v", err)
+	} else if topic != nil {
+		frame, _ := json.Marshal(protocol.SystemFrame{Type: protocol.FrameTopic, Topic: topic, Timestamp: topic.SetAt})
+		client.send <- frame
+	}
+
+	recentMessages, err := cs.RecentMessages(50)
 	if err != nil {
 		log.Printf("Error getting recent messages: %v", err)
 	} else {
@@ -156,6 +245,12 @@ func (cs *ChatService) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	cs.sendPendingNotifications(client)
+
+	// Tells clients that the history is complete and live messages follow
+	ready, _ := json.Marshal(protocol.SystemFrame{Type: protocol.FrameReady, Username: client.username, Timestamp: time.Now()})
+	client.send <- ready
+
 	go cs.writePump(client)
 	go cs.readPump(client)
 }
@@ -167,8 +262,7 @@ func (cs *ChatService) readPump(client *Client) {
 	}()
 
 	for {
-		var msg map[string]interface{}
-		err := client.conn.ReadJSON(&msg)
+		_, data, err := client.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("WebSocket error: %v", err)
@@ -176,62 +270,141 @@ func (cs *ChatService) readPump(client *Client) {
 			break
 		}
 
-		text, ok := msg["text"].(string)
-		if !ok || text == "" {
+		var msg protocol.ClientMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+		if msg.Type == protocol.ClientPresence {
+			cs.setPresence(client, msg.State)
+			continue
+		}
+		if msg.Text == "" {
 			continue
 		}
+		text := msg.Text
 
-		if len(text) > 1000 {
-			text = text[:1000]
+		if IsCommand(text) {
+			cs.handleCommand(client, text)
+			continue
+		}
+		// A doubled slash sends a message that starts with a slash
+		if strings.HasPrefix(text, "//") {
+			text = text[1:]
 		}
 
-		message, err := cs.messageRepo.SaveMessage(client.username, text)
-		if err != nil {
+		if _, err := cs.PostMessage(client.username, text); err != nil {
+			if errors.Is(err, ErrMuted) {
+				cs.sendSystem(client, "You are muted and cannot post messages right now")
+				continue
+			}
 			log.Printf("Error saving message: %v", err)
-			continue
 		}
+	}
+}
+
+// PostMessage saves a message, broadcasts it to all connected clients and notifies them
+func (cs *ChatService) PostMessage(username, text string) (*repository.Message, error) {
+	if len(text) > MaxMessageLength {
+		text = text[:MaxMessageLength]
+	}
 
-		messageJSON, _ := json.Marshal(message)
-		cs.broadcast <- messageJSON
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if cs.isMuted(ctx, username) {
+		return nil, ErrMuted
+	}
 
-		go cs.sendNotificationToOthers(client.username, text)
+	message, err := cs.messageRepo.SaveMessage(username, text)
+	if err != nil {
+		return nil, err
+	}
+	if nickname, err := cs.redis.HGet(ctx, nicknamesKey, username).Result(); err == nil {
+		message.DisplayName = nickname
 	}
+
+	messageJSON, _ := json.Marshal(message)
+	cs.broadcast <- messageJSON
+
+	go cs.sendNotificationToOthers(message)
+	cs.publishEvent(webhook.EventMessageCreated, message)
+	return message, nil
 }
 
-func (cs *ChatService) sendNotificationToOthers(senderUsername, messageText string) {
-	cs.mu.RLock()
-	var recipients []string
+// isConnected reports whether the user has any connected client. The caller must hold cs.mu.
+func (cs *ChatService) isConnected(username string) bool {
 	for client := range cs.clients {
-		if client.username != senderUsername {
-			recipients = append(recipients, client.userID)
+		if client.username == username {
+			return true
 		}
 	}
-	cs.mu.RUnlock()
+	return false
+}
 
-	for _, userID := range recipients {
-		notification := NotificationRequest{
-			UserID:  userID,
-			Title:   fmt.Sprintf("New message from %s", senderUsername),
-			Message: cs.truncateMessage(messageText, 100),
-			Type:    "message",
+// publishEvent queues a webhook event without blocking the caller
+func (cs *ChatService) publishEvent(event string, data interface{}) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := cs.webhooks.Publish(ctx, event, data); err != nil {
+			log.Printf("Failed to publish %s webhook event: %v", event, err)
 		}
+	}()
+}
 
-		go func(notif NotificationRequest) {
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			defer cancel()
+// RecentMessages returns the latest messages, oldest first, with the authors' current display names
+func (cs *ChatService) RecentMessages(limit int) ([]repository.Message, error) {
+	messages, err := cs.messageRepo.GetRecentMessages(limit)
+	if err != nil {
+		return nil, err
+	}
 
-			if err := cs.notificationClient.SendNotification(ctx, notif); err != nil {
-				log.Printf("Failed to send notification: %v", err)
-			}
-		}(notification)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	names := cs.nicknames(ctx)
+	for i := range messages {
+		messages[i].DisplayName = names[messages[i].Username]
 	}
+	return messages, nil
 }
 
-func (cs *ChatService) truncateMessage(text string, maxLength int) string {
-	if len(text) <= maxLength {
-		return text
+// sendNotificationToOthers notifies the users who will not see the message live: those
+// who are idle, have the chat in a background tab or left recently, and those mentioned
+func (cs *ChatService) sendNotificationToOthers(message *repository.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	recipients, mentioned, err := cs.notificationRecipients(ctx, message.Username, message.Text)
+	if err != nil {
+		log.Printf("Failed to find notification recipients: %v", err)
+		return
+	}
+
+	notifications := make([]NotificationRequest, 0, len(mentioned)+len(recipients))
+	add := func(userID, notificationType string) {
+		// notification-service renders the texts in each recipient's language
+		notifications = append(notifications, NotificationRequest{
+			UserID: userID,
+			Type:   notificationType,
+			Sender: message.Username,
+			Variables: map[string]string{
+				"sender": message.Username,
+				"text":   message.Text,
+			},
+
+			IdempotencyKey: fmt.Sprintf("message:%d", message.ID),
+		})
+	}
+	for _, userID := range mentioned {
+		add(userID, "mention")
+	}
+	for _, userID := range recipients {
+		add(userID, "message")
+	}
+
+	if err := cs.notificationClient.SendNotifications(ctx, notifications); err != nil {
+		log.Printf("Failed to send notifications: %v", err)
 	}
-	return text[:maxLength-3] + "..."
 }
 
 func (cs *ChatService) writePump(client *Client) {
@@ -268,7 +441,3 @@ func (cs *ChatService) GetStats() map[string]interface{} {
 		"total_messages":    messageCount,
 	}
 }
-
-func (cs *ChatService) Close() error {
-	return cs.notificationClient.Close()
-}
@@ -0,0 +1,388 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/meetohin/web-chat/chat-service/pkg/protocol"
+)
+
+const (
+	nicknamesKey   = "chat:nicknames"
+	topicKey       = "chat:topic"
+	mutedKeyPrefix = "chat:muted:"
+
+	defaultMuteDuration = 10 * time.Minute
+	maxMuteDuration     = 7 * 24 * time.Hour
+	maxTopicLength      = 200
+)
+
+// ErrMuted is returned when a muted user tries to post a message
+var ErrMuted = errors.New("you are muted")
+
+var nicknamePattern = regexp.MustCompile(`^[\p{L}\p{N}_.\- ]{1,32}$`)
+
+// CommandHandler runs a slash command for the client that typed it
+type CommandHandler func(ctx context.Context, cmd *CommandContext) (*CommandResponse, error)
+
+// Command is a slash command such as /help
+type Command struct {
+	Name        string // without the leading slash
+	Usage       string
+	Description string
+	AdminOnly   bool
+	// ReadOnly commands change nothing other users see and stay available to muted users
+	ReadOnly bool
+	Handler  CommandHandler
+
+	async bool // runs outside the client's read loop, e.g. because it waits for a remote endpoint
+}
+
+// CommandContext is what a command handler gets to work with
+type CommandContext struct {
+	Chat     *ChatService
+	Username string
+	IsAdmin  bool
+	Args     string
+}
+
+// CommandResponse is shown to the sender only, or to everyone when Broadcast is set
+type CommandResponse struct {
+	Text      string
+	Broadcast bool
+}
+
+// Topic is the chat room's topic
+type Topic = protocol.Topic
+
+// CommandRegistry holds the available slash commands
+type CommandRegistry struct {
+	mu       sync.RWMutex
+	commands map[string]Command
+}
+
+func newCommandRegistry() *CommandRegistry {
+	return &CommandRegistry{commands: make(map[string]Command)}
+}
+
+// Register adds a command. Names are case-insensitive and must be unique.
+func (r *CommandRegistry) Register(cmd Command) error {
+	name := strings.ToLower(strings.TrimPrefix(cmd.Name, "/"))
+	if name == "" || strings.ContainsAny(name, " \t/") {
+		return fmt.Errorf("invalid command name %q", cmd.Name)
+	}
+	if cmd.Handler == nil {
+		return fmt.Errorf("command /%s has no handler", name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.commands[name]; exists {
+		return fmt.Errorf("command /%s is already registered", name)
+	}
+	cmd.Name = name
+	r.commands[name] = cmd
+	return nil
+}
+
+// Lookup finds a command by name
+func (r *CommandRegistry) Lookup(name string) (Command, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	cmd, ok := r.commands[strings.ToLower(name)]
+	return cmd, ok
+}
+
+// List returns the commands sorted by name
+func (r *CommandRegistry) List() []Command {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	commands := make([]Command, 0, len(r.commands))
+	for _, cmd := range r.commands {
+		commands = append(commands, cmd)
+	}
+	sort.Slice(commands, func(i, j int) bool { return commands[i].Name < commands[j].Name })
+	return commands
+}
+
+// RegisterCommand adds a slash command to the chat
+func (cs *ChatService) RegisterCommand(cmd Command) error {
+	return cs.commands.Register(cmd)
+}
+
+// IsCommand reports whether a message text is a slash command rather than a chat message
+func IsCommand(text string) bool {
+	return strings.HasPrefix(text, "/") && !strings.HasPrefix(text, "//") && len(text) > 1
+}
+
+// handleCommand runs a slash command typed by a connected client and delivers its response
+func (cs *ChatService) handleCommand(client *Client, text string) {
+	name, args, _ := strings.Cut(strings.TrimPrefix(text, "/"), " ")
+
+	cmd, ok := cs.commands.Lookup(name)
+	if !ok {
+		cs.sendSystem(client, fmt.Sprintf("Unknown command /%s. Type /help for a list of commands.", name))
+		return
+	}
+	if cmd.AdminOnly && !client.admin {
+		cs.sendSystem(client, fmt.Sprintf("/%s is only available to admins", cmd.Name))
+		return
+	}
+
+	if !cmd.async {
+		cs.runCommand(client, cmd, args)
+		return
+	}
+	// One slow command at a time per client, so a client cannot pile up requests to an endpoint
+	if !atomic.CompareAndSwapInt32(&client.commandRunning, 0, 1) {
+		cs.sendSystem(client, "Please wait until your previous command has finished")
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&client.commandRunning, 0)
+		cs.runCommand(client, cmd, args)
+	}()
+}
+
+// runCommand runs a looked up command and delivers its response to the client
+func (cs *ChatService) runCommand(client *Client, cmd Command, args string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if !cmd.ReadOnly && cs.isMuted(ctx, client.username) {
+		cs.sendSystem(client, fmt.Sprintf("You are muted and cannot use /%s right now", cmd.Name))
+		return
+	}
+
+	response, err := cmd.Handler(ctx, &CommandContext{
+		Chat:     cs,
+		Username: client.username,
+		IsAdmin:  client.admin,
+		Args:     strings.TrimSpace(args),
+	})
+	if err != nil {
+		log.Printf("Command /%s by %s failed: %v", cmd.Name, client.username, err)
+		cs.sendSystem(client, err.Error())
+		return
+	}
+	if response == nil || response.Text == "" {
+		return
+	}
+
+	if response.Broadcast {
+		cs.BroadcastSystem(response.Text)
+	} else {
+		cs.sendSystem(client, response.Text)
+	}
+}
+
+// BroadcastSystem shows a system line to every connected client
+func (cs *ChatService) BroadcastSystem(text string) {
+	frame, _ := json.Marshal(protocol.SystemFrame{Type: protocol.FrameSystem, Text: text, Timestamp: time.Now()})
+	cs.broadcast <- frame
+}
+
+// sendSystem shows a system line to one client only
+func (cs *ChatService) sendSystem(client *Client, text string) {
+	frame, _ := json.Marshal(protocol.SystemFrame{Type: protocol.FrameSystem, Text: text, Ephemeral: true, Timestamp: time.Now()})
+	cs.sendTo(client, frame)
+}
+
+func (cs *ChatService) sendTo(client *Client, data []byte) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	if _, ok := cs.clients[client]; !ok {
+		return
+	}
+	select {
+	case client.send <- data:
+	default:
+	}
+}
+
+// registerBuiltinCommands adds /help, /me, /nick, /topic, /mute, /unmute and /schedule
+func (cs *ChatService) registerBuiltinCommands() {
+	builtins := []Command{
+		{Name: "help", Usage: "/help", Description: "List available commands", ReadOnly: true, Handler: helpCommand},
+		{Name: "me", Usage: "/me <action>", Description: "Describe what you are doing", Handler: meCommand},
+		{Name: "nick", Usage: "/nick [name]", Description: "Set your display name, or clear it", Handler: nickCommand},
+		{Name: "topic", Usage: "/topic [text]", Description: "Show or set the room topic", Handler: topicCommand},
+		{Name: "mute", Usage: "/mute <user> [duration]", Description: "Stop a user from posting (default 10m)", AdminOnly: true, Handler: muteCommand},
+		{Name: "unmute", Usage: "/unmute <user>", Description: "Let a muted user post again", AdminOnly: true, Handler: unmuteCommand},
+		{Name: "schedule", Usage: "/schedule <delay|time> <text> | list | cancel <id>", Description: "Post a message later", Handler: scheduleCommand},
+	}
+
+	for _, cmd := range builtins {
+		if err := cs.commands.Register(cmd); err != nil {
+			log.Fatalf("Failed to register command: %v", err)
+		}
+	}
+}
+
+func helpCommand(ctx context.Context, cmd *CommandContext) (*CommandResponse, error) {
+	var lines []string
+	for _, c := range cmd.Chat.commands.List() {
+		if c.AdminOnly && !cmd.IsAdmin {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s — %s", c.Usage, c.Description))
+	}
+	return &CommandResponse{Text: "Available commands:\n" + strings.Join(lines, "\n")}, nil
+}
+
+func meCommand(ctx context.Context, cmd *CommandContext) (*CommandResponse, error) {
+	if cmd.Args == "" {
+		return nil, errors.New("usage: /me <action>")
+	}
+
+	// Action messages are stored with their /me prefix so every client can render them
+	if _, err := cmd.Chat.PostMessage(cmd.Username, "/me "+cmd.Args); err != nil {
+		if errors.Is(err, ErrMuted) {
+			return nil, err
+		}
+		return nil, errors.New("failed to send message")
+	}
+	return nil, nil
+}
+
+func nickCommand(ctx context.Context, cmd *CommandContext) (*CommandResponse, error) {
+	rdb := cmd.Chat.redis
+
+	if cmd.Args == "" {
+		if err := rdb.HDel(ctx, nicknamesKey, cmd.Username).Err(); err != nil {
+			return nil, errors.New("failed to clear display name")
+		}
+		return &CommandResponse{Text: fmt.Sprintf("%s cleared their display name", cmd.Username), Broadcast: true}, nil
+	}
+
+	if !nicknamePattern.MatchString(cmd.Args) {
+		return nil, errors.New("display names are 1-32 letters, digits, spaces, dots, dashes or underscores")
+	}
+	if err := rdb.HSet(ctx, nicknamesKey, cmd.Username, cmd.Args).Err(); err != nil {
+		return nil, errors.New("failed to set display name")
+	}
+	return &CommandResponse{Text: fmt.Sprintf("%s is now known as %s", cmd.Username, cmd.Args), Broadcast: true}, nil
+}
+
+func topicCommand(ctx context.Context, cmd *CommandContext) (*CommandResponse, error) {
+	if cmd.Args == "" {
+		topic, err := cmd.Chat.CurrentTopic(ctx)
+		if err != nil {
+			return nil, errors.New("failed to load topic")
+		}
+		if topic == nil {
+			return &CommandResponse{Text: "No topic is set"}, nil
+		}
+		return &CommandResponse{Text: fmt.Sprintf("Topic: %s (set by %s)", topic.Text, topic.SetBy)}, nil
+	}
+
+	if len(cmd.Args) > maxTopicLength {
+		return nil, fmt.Errorf("topics are at most %d characters", maxTopicLength)
+	}
+
+	topic := &Topic{Text: cmd.Args, SetBy: cmd.Username, SetAt: time.Now()}
+	data, _ := json.Marshal(topic)
+	if err := cmd.Chat.redis.Set(ctx, topicKey, data, 0).Err(); err != nil {
+		return nil, errors.New("failed to set topic")
+	}
+
+	frame, _ := json.Marshal(protocol.SystemFrame{Type: protocol.FrameTopic, Topic: topic, Timestamp: topic.SetAt})
+	cmd.Chat.broadcast <- frame
+	return &CommandResponse{Text: fmt.Sprintf("%s changed the topic to: %s", cmd.Username, cmd.Args), Broadcast: true}, nil
+}
+
+func muteCommand(ctx context.Context, cmd *CommandContext) (*CommandResponse, error) {
+	fields := strings.Fields(cmd.Args)
+	if len(fields) == 0 || len(fields) > 2 {
+		return nil, errors.New("usage: /mute <user> [duration]")
+	}
+
+	duration := defaultMuteDuration
+	if len(fields) == 2 {
+		parsed, err := time.ParseDuration(fields[1])
+		if err != nil || parsed <= 0 || parsed > maxMuteDuration {
+			return nil, errors.New("duration must be like 30m or 2h and at most 168h")
+		}
+		duration = parsed
+	}
+
+	username := fields[0]
+	if username == cmd.Username {
+		return nil, errors.New("you cannot mute yourself")
+	}
+	if err := cmd.Chat.redis.Set(ctx, mutedKeyPrefix+username, cmd.Username, duration).Err(); err != nil {
+		return nil, errors.New("failed to mute user")
+	}
+
+	log.Printf("%s muted %s for %s", cmd.Username, username, duration)
+	return &CommandResponse{Text: fmt.Sprintf("%s was muted for %s by %s", username, duration, cmd.Username), Broadcast: true}, nil
+}
+
+func unmuteCommand(ctx context.Context, cmd *CommandContext) (*CommandResponse, error) {
+	username := strings.TrimSpace(cmd.Args)
+	if username == "" || strings.Contains(username, " ") {
+		return nil, errors.New("usage: /unmute <user>")
+	}
+
+	removed, err := cmd.Chat.redis.Del(ctx, mutedKeyPrefix+username).Result()
+	if err != nil {
+		return nil, errors.New("failed to unmute user")
+	}
+	if removed == 0 {
+		return &CommandResponse{Text: fmt.Sprintf("%s is not muted", username)}, nil
+	}
+
+	log.Printf("%s unmuted %s", cmd.Username, username)
+	return &CommandResponse{Text: fmt.Sprintf("%s was unmuted by %s", username, cmd.Username), Broadcast: true}, nil
+}
+
+// CurrentTopic returns the room topic, or nil when none is set
+func (cs *ChatService) CurrentTopic(ctx context.Context) (*Topic, error) {
+	data, err := cs.redis.Get(ctx, topicKey).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	topic := &Topic{}
+	if err := json.Unmarshal(data, topic); err != nil {
+		return nil, err
+	}
+	return topic, nil
+}
+
+// isMuted reports whether the user is currently muted. Failures to check do not block posting.
+func (cs *ChatService) isMuted(ctx context.Context, username string) bool {
+	n, err := cs.redis.Exists(ctx, mutedKeyPrefix+username).Result()
+	if err != nil {
+		log.Printf("Failed to check mute of %s: %v", username, err)
+		return false
+	}
+	return n > 0
+}
+
+// nicknames returns the display names users have chosen with /nick
+func (cs *ChatService) nicknames(ctx context.Context) map[string]string {
+	names, err := cs.redis.HGetAll(ctx, nicknamesKey).Result()
+	if err != nil {
+		log.Printf("Failed to load display names: %v", err)
+		return nil
+	}
+	return names
+}
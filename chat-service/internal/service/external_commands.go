@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/meetohin/web-chat/chat-service/internal/incoming"
+	"github.com/meetohin/web-chat/chat-service/internal/webhook"
+)
+
+const externalCommandTimeout = 3 * time.Second
+
+// ExternalCommand is a slash command answered by an HTTP endpoint.
+// The endpoint receives a signed form POST with the fields command, text, user_name and timestamp,
+// and answers like a Slack slash command: {"response_type": "in_channel" | "ephemeral", "text": "..."}
+// or a plain text body, which is shown to the sender only.
+type ExternalCommand struct {
+	Name        string
+	URL         string
+	Secret      string // signs requests the same way as outgoing webhooks; optional
+	Description string
+}
+
+// externalResponse is the JSON an endpoint answers with; text may also come in blocks or attachments
+type externalResponse struct {
+	ResponseType string `json:"response_type"`
+}
+
+var externalHTTPClient = &http.Client{Timeout: externalCommandTimeout}
+
+// RegisterExternalCommand adds a slash command handled by an HTTP endpoint
+func (cs *ChatService) RegisterExternalCommand(ext ExternalCommand) error {
+	u, err := url.Parse(ext.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("command /%s: invalid URL %q", ext.Name, ext.URL)
+	}
+
+	description := ext.Description
+	if description == "" {
+		description = "Handled by " + u.Host
+	}
+
+	return cs.commands.Register(Command{
+		Name:        ext.Name,
+		Usage:       "/" + ext.Name + " [text]",
+		Description: description,
+		async:       true,
+		Handler: func(ctx context.Context, cmd *CommandContext) (*CommandResponse, error) {
+			return callExternalCommand(ctx, ext, cmd)
+		},
+	})
+}
+
+func callExternalCommand(ctx context.Context, ext ExternalCommand, cmd *CommandContext) (*CommandResponse, error) {
+	now := time.Now().Unix()
+	form := url.Values{
+		"command":   {"/" + ext.Name},
+		"text":      {cmd.Args},
+		"user_name": {cmd.Username},
+		"timestamp": {strconv.FormatInt(now, 10)},
+	}
+	body := []byte(form.Encode())
+
+	ctx, cancel := context.WithTimeout(ctx, externalCommandTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ext.URL, strings.NewReader(string(body)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", "web-chat-commands/1.0")
+	if ext.Secret != "" {
+		req.Header.Set(webhook.HeaderTimestamp, strconv.FormatInt(now, 10))
+		req.Header.Set(webhook.HeaderSignature, webhook.Sign(ext.Secret, now, body))
+	}
+
+	resp, err := externalHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("/%s did not respond", ext.Name)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return nil, fmt.Errorf("/%s did not respond", ext.Name)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("/%s failed with status %d", ext.Name, resp.StatusCode)
+	}
+
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		return &CommandResponse{Text: strings.TrimSpace(string(data))}, nil
+	}
+
+	var meta externalResponse
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, errors.New("/" + ext.Name + " returned an invalid response")
+	}
+	payload, err := incoming.Parse(data)
+	if err != nil {
+		return nil, errors.New("/" + ext.Name + " returned an invalid response")
+	}
+
+	text := payload.MessageText()
+	if len(text) > MaxMessageLength {
+		text = text[:MaxMessageLength]
+	}
+	return &CommandResponse{Text: text, Broadcast: meta.ResponseType == "in_channel"}, nil
+}
@@ -6,42 +6,42 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/meetohin/web-chat/chat-service/pkg/protocol"
 )
 
 type NotificationRequest struct {
-	UserID  string `json:"user_id"`
-	Title   string `json:"title"`
-	Message string `json:"message"`
-	Type    string `json:"type,omitempty"`
+	UserID string `json:"user_id"`
+	// Title and Message may be left empty when Variables are set; notification-service then
+	// renders them from the templates of Type in the recipient's language
+	Title     string            `json:"title,omitempty"`
+	Message   string            `json:"message,omitempty"`
+	Variables map[string]string `json:"variables,omitempty"`
+	Type      string            `json:"type,omitempty"`
+	Sender    string            `json:"sender,omitempty"` // lets recipients mute the sender
+	// IdempotencyKey identifies the event the notification is about, e.g. "message:42".
+	// notification-service stores one notification per user and key, so requests can be retried.
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
 }
 
+// sendAttempts is how often queueing notifications is tried; retries are safe with idempotency keys
+const sendAttempts = 3
+
+// pendingTTL is how long notification-service holds notifications for a user without a connection
+const pendingTTL = 7 * 24 * time.Hour
+
 type NotificationClient struct {
 	redis  *redis.Client
 	logger *log.Logger
 }
 
-func NewNotificationClient(redisURL string) (*NotificationClient, error) {
-	opt, err := redis.ParseURL(redisURL)
-	if err != nil {
-		return nil, err
-	}
-
-	rdb := redis.NewClient(opt)
-
-	if err := rdb.Ping(context.Background()).Err(); err != nil {
-		return nil, err
-	}
-
+func NewNotificationClient(rdb *redis.Client) *NotificationClient {
 	return &NotificationClient{
 		redis:  rdb,
 		logger: log.New(os.Stdout, "NotificationClient: ", log.LstdFlags),
-	}, nil
-}
-
-func (nc *NotificationClient) Close() error {
-	return nc.redis.Close()
+	}
 }
 
 func (nc *NotificationClient) SendNotification(ctx context.Context, req NotificationRequest) error {
@@ -58,7 +58,9 @@ func (nc *NotificationClient) SendNotification(ctx context.Context, req Notifica
 		return err
 	}
 
-	err = nc.redis.LPush(ctx, "notifications", data).Err()
+	err = nc.retry(ctx, func() error {
+		return nc.redis.LPush(ctx, "notifications", data).Err()
+	})
 	if err != nil {
 		nc.logger.Printf("Failed to send notification: %v", err)
 		return err
@@ -68,28 +70,141 @@ func (nc *NotificationClient) SendNotification(ctx context.Context, req Notifica
 	return nil
 }
 
-func (nc *NotificationClient) SubscribeToNotifications(ctx context.Context, userID string, handler func([]byte)) {
+// SendNotifications queues several notifications in one round trip
+func (nc *NotificationClient) SendNotifications(ctx context.Context, reqs []NotificationRequest) error {
+	if len(reqs) == 0 {
+		return nil
+	}
+
+	entries := make([]interface{}, 0, len(reqs))
+	for _, req := range reqs {
+		if req.Type == "" {
+			req.Type = "message"
+		}
+		data, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, data)
+	}
+
+	err := nc.retry(ctx, func() error {
+		return nc.redis.LPush(ctx, "notifications", entries...).Err()
+	})
+	if err != nil {
+		nc.logger.Printf("Failed to send notifications: %v", err)
+		return err
+	}
+
+	nc.logger.Printf("%d notifications sent", len(reqs))
+	return nil
+}
+
+// retry calls send until it succeeds, sendAttempts times at most
+func (nc *NotificationClient) retry(ctx context.Context, send func() error) error {
+	delay := 100 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		err := send()
+		if err == nil || attempt == sendAttempts {
+			return err
+		}
+
+		select {
+		case <-time.After(delay):
+			delay *= 2
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// SubscribeToNotifications calls handler with every notification published for the user
+// until ctx is cancelled. It returns once the subscription is active.
+func (nc *NotificationClient) SubscribeToNotifications(ctx context.Context, userID string, handler func([]byte)) error {
 	if ctx.Err() != nil {
-		return
+		return ctx.Err()
 	}
 
 	channel := fmt.Sprintf("user:%s:notifications", userID)
 
 	pubsub := nc.redis.Subscribe(ctx, channel)
-	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return err
+	}
 
 	nc.logger.Printf("Subscribed to notifications for user %s", userID)
 
-	ch := pubsub.Channel()
-	for {
-		select {
-		case msg := <-ch:
-			if msg != nil {
-				handler([]byte(msg.Payload))
+	go func() {
+		defer pubsub.Close()
+
+		ch := pubsub.Channel()
+		for {
+			select {
+			case msg := <-ch:
+				if msg != nil {
+					handler([]byte(msg.Payload))
+				}
+			case <-ctx.Done():
+				nc.logger.Printf("Unsubscribed from notifications for user %s", userID)
+				return
 			}
-		case <-ctx.Done():
-			nc.logger.Printf("Unsubscribed from notifications for user %s", userID)
-			return
 		}
+	}()
+	return nil
+}
+
+// TakePendingNotifications removes and returns the notifications notification-service held
+// because the user had no connection, oldest first. A notification that was updated while
+// held is returned once, in its latest version.
+func (nc *NotificationClient) TakePendingNotifications(ctx context.Context, userID string) ([][]byte, error) {
+	key := fmt.Sprintf("user:%s:notifications:pending", userID)
+
+	var entries *redis.StringSliceCmd
+	_, err := nc.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		entries = pipe.LRange(ctx, key, 0, -1)
+		pipe.Del(ctx, key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The list is newest first
+	seen := make(map[string]bool)
+	var frames [][]byte
+	for _, entry := range entries.Val() {
+		var frame protocol.NotificationFrame
+		if err := json.Unmarshal([]byte(entry), &frame); err != nil || seen[frame.Data.ID] {
+			continue
+		}
+		seen[frame.Data.ID] = true
+		frames = append(frames, []byte(entry))
+	}
+
+	for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+		frames[i], frames[j] = frames[j], frames[i]
+	}
+	return frames, nil
+}
+
+// RestorePendingNotifications holds notifications taken with TakePendingNotifications
+// (oldest first) again, so the user gets them on their next connection
+func (nc *NotificationClient) RestorePendingNotifications(ctx context.Context, userID string, frames [][]byte) error {
+	if len(frames) == 0 {
+		return nil
+	}
+	key := fmt.Sprintf("user:%s:notifications:pending", userID)
+
+	// The list is newest first, restored notifications go behind the ones held since
+	values := make([]interface{}, 0, len(frames))
+	for i := len(frames) - 1; i >= 0; i-- {
+		values = append(values, frames[i])
 	}
+	_, err := nc.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, key, values...)
+		pipe.Expire(ctx, key, pendingTTL)
+		return nil
+	})
+	return err
 }
@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/meetohin/web-chat/chat-service/pkg/protocol"
+)
+
+const (
+	// presenceKey is a sorted set of usernames scored by the Unix time they were last
+	// connected. notification-service reads it to find users who have been away.
+	presenceKey = "presence:last_seen"
+
+	// activeKey is a sorted set of users with a connection they are looking at, scored
+	// by the Unix time an instance last confirmed it
+	activeKey = "presence:active"
+
+	// presenceInterval is how often connected users are marked as seen; a user whose
+	// score is older than this is not connected to any instance
+	presenceInterval = time.Minute
+
+	// notifyWithin limits notifications for every new message to users seen this recently:
+	// those idle or with a hidden tab and those who just left. Users away for longer are
+	// only notified of mentions, not of every message.
+	notifyWithin = time.Hour
+
+	// mentionNotifyWithin limits notifications for mentions to users seen this recently
+	mentionNotifyWithin = 30 * 24 * time.Hour
+
+	// maxMentions is how many mentioned users one message notifies at most
+	maxMentions = 20
+)
+
+// mentionPattern matches "@username" at the start of a word, so email addresses are no
+// mentions; usernames cannot contain '@' and punctuation ends them
+var mentionPattern = regexp.MustCompile(`(?:^|[\s(\[{"'])@([^\s@,.:;!?()\[\]{}"']+)`)
+
+// touchPresence marks users as seen now
+func (cs *ChatService) touchPresence(ctx context.Context, usernames ...string) {
+	cs.zaddNow(ctx, presenceKey, usernames)
+}
+
+// setPresence records the state a client reported and updates whether its user is active
+func (cs *ChatService) setPresence(client *Client, state string) {
+	switch state {
+	case protocol.PresenceActive, protocol.PresenceIdle, protocol.PresenceHidden:
+	default:
+		return
+	}
+
+	cs.mu.Lock()
+	client.away = state != protocol.PresenceActive
+	active := cs.isActive(client.username)
+	cs.mu.Unlock()
+
+	cs.updateActive(client.username, active)
+}
+
+// updateActive adds the user to or removes them from the users who are looking at the chat
+func (cs *ChatService) updateActive(username string, active bool) {
+	ctx := context.Background()
+	if active {
+		cs.zaddNow(ctx, activeKey, []string{username})
+		return
+	}
+
+	// Another instance with an active connection of the user adds them back on its next refresh
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	if err := cs.redis.ZRem(ctx, activeKey, username).Err(); err != nil {
+		log.Printf("Failed to update presence: %v", err)
+	}
+}
+
+// isActive reports whether the user has a connected client they are looking at. The caller must hold cs.mu.
+func (cs *ChatService) isActive(username string) bool {
+	for client := range cs.clients {
+		if client.username == username && !client.away {
+			return true
+		}
+	}
+	return false
+}
+
+// notificationRecipients returns the users who are not looking at the chat and should be
+// notified of a message: those seen recently, and those mentioned in it, separately
+func (cs *ChatService) notificationRecipients(ctx context.Context, sender, text string) ([]string, []string, error) {
+	rdb := cs.redis
+	now := time.Now()
+
+	recent, err := rdb.ZRangeByScore(ctx, presenceKey, &redis.ZRangeBy{
+		Min: strconv.FormatInt(now.Add(-notifyWithin).Unix(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, nil, err
+	}
+	active, err := rdb.ZRangeByScore(ctx, activeKey, &redis.ZRangeBy{
+		Min: strconv.FormatInt(now.Add(-2*presenceInterval).Unix(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	skip := map[string]bool{sender: true}
+	for _, username := range active {
+		skip[username] = true
+	}
+
+	// Unknown names have no score and users long gone are skipped
+	var mentioned []string
+	if names := mentions(text); len(names) > 0 {
+		seen, err := rdb.ZMScore(ctx, presenceKey, names...).Result()
+		if err != nil {
+			return nil, nil, err
+		}
+		cutoff := float64(now.Add(-mentionNotifyWithin).Unix())
+		for i, username := range names {
+			if seen[i] >= cutoff && !skip[username] {
+				mentioned = append(mentioned, username)
+				skip[username] = true
+			}
+		}
+	}
+
+	var recipients []string
+	for _, username := range recent {
+		if !skip[username] {
+			recipients = append(recipients, username)
+		}
+	}
+	return recipients, mentioned, nil
+}
+
+// mentions returns the distinct usernames mentioned in text, at most maxMentions
+func mentions(text string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		name := match[1]
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+		if len(names) == maxMentions {
+			break
+		}
+	}
+	return names
+}
+
+// trackPresence keeps the users connected to this instance marked as seen, and those
+// looking at the chat as active, and forgets users nobody confirmed for a while
+func (cs *ChatService) trackPresence(ctx context.Context) {
+	ticker := time.NewTicker(presenceInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			cs.mu.RLock()
+			seen := make(map[string]bool)
+			active := make(map[string]bool)
+			for client := range cs.clients {
+				seen[client.username] = true
+				if !client.away {
+					active[client.username] = true
+				}
+			}
+			cs.mu.RUnlock()
+
+			cs.touchPresence(ctx, usernames(seen)...)
+			cs.zaddNow(ctx, activeKey, usernames(active))
+
+			expired := strconv.FormatInt(time.Now().Add(-2*presenceInterval).Unix(), 10)
+			if err := cs.redis.ZRemRangeByScore(ctx, activeKey, "-inf", "("+expired).Err(); err != nil {
+				log.Printf("Failed to expire presence: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// zaddNow scores members of a sorted set with the current Unix time
+func (cs *ChatService) zaddNow(ctx context.Context, key string, members []string) {
+	if len(members) == 0 {
+		return
+	}
+
+	now := float64(time.Now().Unix())
+	z := make([]*redis.Z, 0, len(members))
+	for _, member := range members {
+		z = append(z, &redis.Z{Score: now, Member: member})
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	if err := cs.redis.ZAdd(ctx, key, z...).Err(); err != nil {
+		log.Printf("Failed to update presence: %v", err)
+	}
+}
+
+func usernames(set map[string]bool) []string {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMentions(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"no mentions here", nil},
+		{"@alice hi", []string{"alice"}},
+		{"thanks @bob.", []string{"bob"}},
+		{"@alice, @bob and @alice again", []string{"alice", "bob"}},
+		{"(@carol) @dave! @erin?", []string{"carol", "dave", "erin"}},
+		{"mail me at someone@example.com", nil},
+		{"a lone @ sign", nil},
+		{"@Jürgen_1 joined", []string{"Jürgen_1"}},
+	}
+	for _, tt := range tests {
+		if got := mentions(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("mentions(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestMentionsLimit(t *testing.T) {
+	var text strings.Builder
+	for i := 0; i < maxMentions+5; i++ {
+		text.WriteString("@user" + strconv.Itoa(i) + " ")
+	}
+	if got := mentions(text.String()); len(got) != maxMentions {
+		t.Errorf("got %d mentions, want at most %d", len(got), maxMentions)
+	}
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/meetohin/web-chat/chat-service/internal/repository"
+)
+
+const (
+	// MaxPendingScheduled is how many scheduled messages a user may have waiting
+	MaxPendingScheduled = 50
+
+	maxScheduleAhead = 365 * 24 * time.Hour
+	schedulerBatch   = 50
+)
+
+// ErrInvalidSchedule is wrapped by errors about the requested message or send time
+var ErrInvalidSchedule = errors.New("invalid schedule")
+
+// ScheduleMessage stores a message to be posted as the user at sendAt
+func (cs *ChatService) ScheduleMessage(username, text string, sendAt time.Time) (*repository.ScheduledMessage, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, fmt.Errorf("%w: message text required", ErrInvalidSchedule)
+	}
+	if len(text) > MaxMessageLength {
+		return nil, fmt.Errorf("%w: message is longer than %d characters", ErrInvalidSchedule, MaxMessageLength)
+	}
+	if !sendAt.After(time.Now()) {
+		return nil, fmt.Errorf("%w: send time must be in the future", ErrInvalidSchedule)
+	}
+	if sendAt.After(time.Now().Add(maxScheduleAhead)) {
+		return nil, fmt.Errorf("%w: send time must be within a year", ErrInvalidSchedule)
+	}
+
+	msg := &repository.ScheduledMessage{Username: username, Text: text, SendAt: sendAt}
+	created, err := cs.scheduledRepo.CreateScheduledMessage(msg, MaxPendingScheduled)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		return nil, fmt.Errorf("%w: at most %d messages can be scheduled", ErrInvalidSchedule, MaxPendingScheduled)
+	}
+	return msg, nil
+}
+
+// ScheduledMessages returns the user's pending and recently handled scheduled messages
+func (cs *ChatService) ScheduledMessages(username string) ([]repository.ScheduledMessage, error) {
+	return cs.scheduledRepo.ListScheduledMessages(username)
+}
+
+// CancelScheduledMessage cancels one of the user's pending messages and reports whether there was one to cancel
+func (cs *ChatService) CancelScheduledMessage(id int, username string) (bool, error) {
+	return cs.scheduledRepo.CancelScheduledMessage(id, username)
+}
+
+// RunScheduler posts due scheduled messages until ctx is cancelled. It is safe to run on every instance.
+func (cs *ChatService) RunScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			cs.deliverScheduled(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (cs *ChatService) deliverScheduled(ctx context.Context) {
+	for ctx.Err() == nil {
+		delivered, err := cs.scheduledRepo.DeliverDueScheduledMessages(schedulerBatch, func(msg *repository.ScheduledMessage) (*repository.Message, error) {
+			message, err := cs.PostMessage(msg.Username, msg.Text)
+			if err != nil {
+				log.Printf("Scheduled message %d of %s failed: %v", msg.ID, msg.Username, err)
+				return nil, err
+			}
+			return message, nil
+		})
+		if err != nil {
+			log.Printf("Scheduler error: %v", err)
+			return
+		}
+		if delivered > 0 {
+			log.Printf("Delivered %d scheduled messages", delivered)
+		}
+		if delivered < schedulerBatch {
+			return
+		}
+	}
+}
+
+// ParseSendTime reads a send time given either as a delay such as "90m" or as an RFC 3339 time
+func ParseSendTime(value string, now time.Time) (time.Time, error) {
+	if delay, err := time.ParseDuration(value); err == nil {
+		return now.Add(delay), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%w: use a delay like 90m or a time like 2026-01-02T15:04:05Z", ErrInvalidSchedule)
+}
+
+// scheduleCommand implements /schedule <delay|time> <text>, /schedule list and /schedule cancel <id>
+func scheduleCommand(ctx context.Context, cmd *CommandContext) (*CommandResponse, error) {
+	first, rest, _ := strings.Cut(cmd.Args, " ")
+	rest = strings.TrimSpace(rest)
+
+	switch first {
+	case "", "list":
+		messages, err := cmd.Chat.ScheduledMessages(cmd.Username)
+		if err != nil {
+			return nil, errors.New("failed to load scheduled messages")
+		}
+
+		var lines []string
+		for _, msg := range messages {
+			if msg.Status != repository.ScheduledPending {
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("#%d at %s: %s", msg.ID, msg.SendAt.UTC().Format("2006-01-02 15:04 MST"), msg.Text))
+		}
+		if len(lines) == 0 {
+			return &CommandResponse{Text: "You have no scheduled messages"}, nil
+		}
+		return &CommandResponse{Text: "Scheduled messages:\n" + strings.Join(lines, "\n")}, nil
+
+	case "cancel":
+		id, err := strconv.Atoi(strings.TrimPrefix(rest, "#"))
+		if err != nil {
+			return nil, errors.New("usage: /schedule cancel <id>")
+		}
+		cancelled, err := cmd.Chat.CancelScheduledMessage(id, cmd.Username)
+		if err != nil {
+			return nil, errors.New("failed to cancel scheduled message")
+		}
+		if !cancelled {
+			return nil, fmt.Errorf("no pending scheduled message #%d", id)
+		}
+		return &CommandResponse{Text: fmt.Sprintf("Scheduled message #%d cancelled", id)}, nil
+	}
+
+	sendAt, err := ParseSendTime(first, time.Now())
+	if err != nil {
+		return nil, errors.New("usage: /schedule <delay|time> <text>, e.g. /schedule 30m Stand-up starts")
+	}
+	msg, err := cmd.Chat.ScheduleMessage(cmd.Username, rest, sendAt)
+	if errors.Is(err, ErrInvalidSchedule) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, errors.New("failed to schedule message")
+	}
+	return &CommandResponse{Text: fmt.Sprintf("Message #%d scheduled for %s", msg.ID, msg.SendAt.UTC().Format("2006-01-02 15:04 MST"))}, nil
+}
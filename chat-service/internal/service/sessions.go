@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// sessionRevocationsChannel carries IDs of revoked sessions to every chat-service instance
+	sessionRevocationsChannel = "sessions:revoked"
+
+	// CloseSessionRevoked is the WebSocket close code sent to clients of a revoked session
+	CloseSessionRevoked = 4001
+)
+
+// ConnectedSessions returns the IDs of the user's sessions with a live WebSocket connection on this instance
+func (cs *ChatService) ConnectedSessions(username string) map[string]bool {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	sessions := make(map[string]bool)
+	for client := range cs.clients {
+		if client.username == username && client.sessionID != "" {
+			sessions[client.sessionID] = true
+		}
+	}
+	return sessions
+}
+
+// RevokeSession disconnects the WebSocket clients of a revoked session on every instance
+func (cs *ChatService) RevokeSession(ctx context.Context, sessionID string) error {
+	if err := cs.redis.Publish(ctx, sessionRevocationsChannel, sessionID).Err(); err != nil {
+		// Other instances will drop the clients once they validate the token again
+		cs.disconnectSession(sessionID)
+		return err
+	}
+	return nil
+}
+
+// listenSessionRevocations disconnects local clients of sessions revoked through any instance
+func (cs *ChatService) listenSessionRevocations(ctx context.Context) {
+	pubsub := cs.redis.Subscribe(ctx, sessionRevocationsChannel)
+	defer pubsub.Close()
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			cs.disconnectSession(msg.Payload)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (cs *ChatService) disconnectSession(sessionID string) {
+	if sessionID == "" {
+		return
+	}
+
+	cs.mu.RLock()
+	var clients []*Client
+	for client := range cs.clients {
+		if client.sessionID == sessionID {
+			clients = append(clients, client)
+		}
+	}
+	cs.mu.RUnlock()
+
+	for _, client := range clients {
+		// Closing the connection ends readPump, which unregisters the client
+		message := websocket.FormatCloseMessage(CloseSessionRevoked, "session revoked")
+		client.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+		client.conn.Close()
+		log.Printf("Client %s disconnected: session revoked", client.username)
+	}
+}
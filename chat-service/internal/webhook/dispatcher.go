@@ -0,0 +1,435 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/meetohin/web-chat/auth-service/pkg/netguard"
+	"github.com/meetohin/web-chat/chat-service/internal/repository"
+)
+
+const (
+	queueName        = "webhooks"
+	retryQueueName   = "webhooks:retry"       // sorted set scored by the time of the next attempt
+	processingPrefix = "webhooks:processing:" // one list per consumer
+	heartbeatPrefix  = "webhooks:consumer:"
+	maxErrorLength   = 500
+
+	heartbeatTTL    = time.Minute
+	recoverInterval = time.Minute
+)
+
+// Config controls delivery concurrency and retries
+type Config struct {
+	Workers     int
+	MaxAttempts int           // attempts per event before giving up
+	BaseDelay   time.Duration // delay before the first retry, doubled on each next one
+	MaxDelay    time.Duration
+	Timeout     time.Duration // per request
+	// AllowPrivate permits webhook URLs resolving to loopback, private, link-local or CGNAT
+	// addresses, which are refused by default so webhooks cannot reach internal services
+	AllowPrivate bool
+}
+
+// DefaultConfig returns the settings used when nothing is configured
+func DefaultConfig() Config {
+	return Config{
+		Workers:     2,
+		MaxAttempts: 6,
+		BaseDelay:   10 * time.Second,
+		MaxDelay:    time.Hour,
+		Timeout:     10 * time.Second,
+	}
+}
+
+// job is a pending delivery of one event to one webhook
+type job struct {
+	WebhookID int             `json:"webhook_id"`
+	EventID   string          `json:"event_id"`
+	Event     string          `json:"event"`
+	Body      json.RawMessage `json:"body"`
+	Attempt   int             `json:"attempt"`
+}
+
+// Dispatcher queues chat events in Redis and delivers them to webhooks.
+// Failed deliveries are retried with exponential backoff; every attempt is logged.
+// Workers move each job to a processing list of their own and remove it once handled,
+// jobs of dispatchers that died are put back on the queue.
+type Dispatcher struct {
+	redis      *redis.Client
+	repo       repository.WebhookRepository
+	httpClient *http.Client
+	cfg        Config
+	logger     *log.Logger
+	consumer   string
+}
+
+// NewDispatcher creates a new dispatcher
+func NewDispatcher(rdb *redis.Client, repo repository.WebhookRepository, cfg Config) *Dispatcher {
+	hostname, _ := os.Hostname()
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+
+	return &Dispatcher{
+		redis:      rdb,
+		repo:       repo,
+		httpClient: newHTTPClient(cfg.Timeout, cfg.AllowPrivate),
+		cfg:        cfg,
+		logger:     log.New(os.Stdout, "Webhooks: ", log.LstdFlags),
+		// Random, so a restarted process never takes the processing lists of its previous run for its own
+		consumer: fmt.Sprintf("%s:%d:%s", hostname, os.Getpid(), hex.EncodeToString(suffix)),
+	}
+}
+
+// newHTTPClient returns a client for webhook URLs
+func newHTTPClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if !allowPrivate {
+		dialer.Control = netguard.Control
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+			MaxIdleConnsPerHost: 2,
+		},
+	}
+}
+
+// Publish queues an event for every active webhook subscribed to it
+func (d *Dispatcher) Publish(ctx context.Context, event string, data interface{}) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	webhooks, err := d.repo.ListWebhooksForEvent(event)
+	if err != nil {
+		return err
+	}
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	eventID, body, err := newEnvelope(event, data)
+	if err != nil {
+		return err
+	}
+
+	for _, webhook := range webhooks {
+		if err := d.enqueue(ctx, job{WebhookID: webhook.ID, EventID: eventID, Event: event, Body: body, Attempt: 1}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Ping queues a ping event for one webhook, regardless of its subscriptions
+func (d *Dispatcher) Ping(ctx context.Context, webhookID int) (string, error) {
+	eventID, body, err := newEnvelope(EventPing, map[string]int{"webhook_id": webhookID})
+	if err != nil {
+		return "", err
+	}
+	return eventID, d.enqueue(ctx, job{WebhookID: webhookID, EventID: eventID, Event: EventPing, Body: body, Attempt: 1})
+}
+
+// Start runs the delivery workers and the retry scheduler until ctx is cancelled
+func (d *Dispatcher) Start(ctx context.Context) {
+	d.logger.Printf("Starting %d webhook workers", d.cfg.Workers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < d.cfg.Workers; i++ {
+		wg.Add(1)
+		go func(workerID int) {
+			defer wg.Done()
+			d.worker(ctx, workerID)
+		}(i)
+	}
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		d.retryScheduler(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		d.recoverer(ctx)
+	}()
+
+	wg.Wait()
+	d.logger.Println("Webhook workers stopped")
+}
+
+func (d *Dispatcher) worker(ctx context.Context, workerID int) {
+	consumer := fmt.Sprintf("%s:%d", d.consumer, workerID)
+	processing := processingPrefix + consumer
+	heartbeat := heartbeatPrefix + consumer
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			if err := d.redis.Set(ctx, heartbeat, time.Now().Unix(), heartbeatTTL).Err(); err != nil && ctx.Err() == nil {
+				d.logger.Printf("Worker %d: Failed to send heartbeat: %v", workerID, err)
+			}
+			d.processJob(ctx, workerID, processing)
+		}
+	}
+}
+
+func (d *Dispatcher) processJob(ctx context.Context, workerID int, processing string) {
+	data, err := d.redis.BLMove(ctx, queueName, processing, "RIGHT", "LEFT", 5*time.Second).Result()
+	if err != nil {
+		if err != redis.Nil && ctx.Err() == nil {
+			d.logger.Printf("Worker %d: Failed to dequeue: %v", workerID, err)
+			time.Sleep(time.Second)
+		}
+		return
+	}
+
+	// The job is finished even if the dispatcher is being stopped
+	jobCtx, cancel := context.WithTimeout(context.Background(), d.cfg.Timeout+10*time.Second)
+	defer cancel()
+
+	var j job
+	if err := json.Unmarshal([]byte(data), &j); err != nil {
+		d.logger.Printf("Worker %d: Failed to unmarshal: %v", workerID, err)
+	} else if retry := d.attempt(jobCtx, workerID, &j); retry {
+		j.Attempt++
+		if err := d.scheduleRetry(jobCtx, j); err != nil {
+			d.logger.Printf("Worker %d: Failed to schedule retry: %v", workerID, err)
+		}
+	}
+
+	if err := d.redis.LRem(jobCtx, processing, 1, data).Err(); err != nil {
+		d.logger.Printf("Worker %d: Failed to acknowledge: %v", workerID, err)
+	}
+}
+
+// attempt delivers a job once, logs the delivery and reports whether it should be retried
+func (d *Dispatcher) attempt(ctx context.Context, workerID int, j *job) bool {
+	webhook, err := d.repo.GetWebhook(j.WebhookID)
+	if errors.Is(err, repository.ErrWebhookNotFound) {
+		// Deleted since the event was queued
+		return false
+	}
+	if err != nil {
+		d.logger.Printf("Worker %d: Failed to load webhook %d: %v", workerID, j.WebhookID, err)
+		return d.retryable(j)
+	}
+	if !webhook.Active && j.Event != EventPing {
+		return false
+	}
+
+	delivery := d.deliver(ctx, webhook, j)
+	if err := d.repo.SaveDelivery(delivery); err != nil {
+		d.logger.Printf("Worker %d: Failed to log delivery: %v", workerID, err)
+	}
+
+	if delivery.Success {
+		return false
+	}
+	return d.retryable(j)
+}
+
+// retryable reports whether a failed job has attempts left
+func (d *Dispatcher) retryable(j *job) bool {
+	if j.Attempt >= d.cfg.MaxAttempts {
+		d.logger.Printf("Giving up on event %s for webhook %d after %d attempts", j.EventID, j.WebhookID, j.Attempt)
+		return false
+	}
+	return true
+}
+
+// deliver POSTs the event to the webhook and describes the outcome
+func (d *Dispatcher) deliver(ctx context.Context, webhook *repository.Webhook, j *job) *repository.WebhookDelivery {
+	delivery := &repository.WebhookDelivery{
+		WebhookID: webhook.ID,
+		EventID:   j.EventID,
+		Event:     j.Event,
+		Attempt:   j.Attempt,
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(j.Body))
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "web-chat-webhooks/1.0")
+	req.Header.Set(HeaderEvent, j.Event)
+	req.Header.Set(HeaderEventID, j.EventID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(webhook.Secret, timestamp, j.Body))
+
+	start := time.Now()
+	resp, err := d.httpClient.Do(req)
+	delivery.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		delivery.Error = truncate(err.Error())
+		return delivery
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	delivery.StatusCode = resp.StatusCode
+	delivery.Success = resp.StatusCode >= 200 && resp.StatusCode < 300
+	if !delivery.Success {
+		delivery.Error = fmt.Sprintf("unexpected status %s", resp.Status)
+	}
+	return delivery
+}
+
+func (d *Dispatcher) enqueue(ctx context.Context, j job) error {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	return d.redis.LPush(ctx, queueName, data).Err()
+}
+
+func (d *Dispatcher) scheduleRetry(ctx context.Context, j job) error {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+
+	at := time.Now().Add(d.backoff(j.Attempt - 1))
+	return d.redis.ZAdd(ctx, retryQueueName, &redis.Z{Score: float64(at.Unix()), Member: data}).Err()
+}
+
+// retryScheduler moves retries that are due back onto the delivery queue
+func (d *Dispatcher) retryScheduler(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.moveDueRetries(ctx); err != nil && ctx.Err() == nil {
+				d.logger.Printf("Failed to move due retries: %v", err)
+			}
+		}
+	}
+}
+
+// moveDueRetriesScript moves due retries onto the queue in one step, so a job is never
+// lost between the two or requeued by two instances
+var moveDueRetriesScript = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, member in ipairs(due) do
+	redis.call('ZREM', KEYS[1], member)
+	redis.call('LPUSH', KEYS[2], member)
+end
+return #due
+`)
+
+func (d *Dispatcher) moveDueRetries(ctx context.Context) error {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	return moveDueRetriesScript.Run(ctx, d.redis, []string{retryQueueName, queueName}, now, 100).Err()
+}
+
+// recoverer puts jobs back on the queue that workers took but never finished
+// because their process crashed or was killed
+func (d *Dispatcher) recoverer(ctx context.Context) {
+	ticker := time.NewTicker(recoverInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.recoverAbandoned(ctx); err != nil && ctx.Err() == nil {
+			d.logger.Printf("Failed to recover abandoned jobs: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *Dispatcher) recoverAbandoned(ctx context.Context) error {
+	iter := d.redis.Scan(ctx, 0, processingPrefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		list := iter.Val()
+		consumer := list[len(processingPrefix):]
+		alive, err := d.redis.Exists(ctx, heartbeatPrefix+consumer).Result()
+		if err != nil {
+			return err
+		}
+		if alive > 0 {
+			continue
+		}
+
+		moved := 0
+		for {
+			err := d.redis.LMove(ctx, list, queueName, "LEFT", "RIGHT").Err()
+			if err == redis.Nil {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			moved++
+		}
+		if moved > 0 {
+			d.logger.Printf("Recovered %d unfinished jobs of consumer %s", moved, consumer)
+		}
+	}
+	return iter.Err()
+}
+
+// backoff returns the delay before the given retry, starting at 1
+func (d *Dispatcher) backoff(retry int) time.Duration {
+	delay := d.cfg.BaseDelay
+	for i := 1; i < retry; i++ {
+		delay *= 2
+		if delay >= d.cfg.MaxDelay {
+			return d.cfg.MaxDelay
+		}
+	}
+	return delay
+}
+
+func newEnvelope(event string, data interface{}) (string, []byte, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, err
+	}
+	eventID := hex.EncodeToString(id)
+
+	body, err := json.Marshal(Envelope{
+		ID:        eventID,
+		Event:     event,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	return eventID, body, err
+}
+
+func truncate(s string) string {
+	if len(s) > maxErrorLength {
+		return s[:maxErrorLength]
+	}
+	return s
+}
@@ -0,0 +1,211 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/meetohin/web-chat/chat-service/internal/repository"
+)
+
+// memoryWebhooks is a WebhookRepository holding a single webhook
+type memoryWebhooks struct {
+	repository.WebhookRepository
+	webhook    repository.Webhook
+	err        error // returned by GetWebhook if set
+	mu         sync.Mutex
+	deliveries []repository.WebhookDelivery
+}
+
+func (m *memoryWebhooks) GetWebhook(id int) (*repository.Webhook, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	webhook := m.webhook
+	return &webhook, nil
+}
+
+func (m *memoryWebhooks) SaveDelivery(delivery *repository.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deliveries = append(m.deliveries, *delivery)
+	return nil
+}
+
+// received is one request seen by the test receiver
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+// newReceiver starts a webhook receiver answering with the given status codes in turn
+func newReceiver(t *testing.T, statuses ...int) (*httptest.Server, chan received) {
+	t.Helper()
+	requests := make(chan received, len(statuses))
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		status := statuses[0]
+		if len(statuses) > 1 {
+			statuses = statuses[1:]
+		}
+		mu.Unlock()
+		requests <- received{header: r.Header.Clone(), body: body}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+func newTestDispatcher(repo *memoryWebhooks, allowPrivate bool) *Dispatcher {
+	cfg := DefaultConfig()
+	cfg.MaxAttempts = 3
+	cfg.Timeout = 5 * time.Second
+	cfg.AllowPrivate = allowPrivate
+	return NewDispatcher(nil, repo, cfg)
+}
+
+func newJob(t *testing.T, event string, data interface{}) *job {
+	t.Helper()
+	eventID, body, err := newEnvelope(event, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &job{WebhookID: 1, EventID: eventID, Event: event, Body: body, Attempt: 1}
+}
+
+func TestDeliverySignatureAndPayload(t *testing.T) {
+	server, requests := newReceiver(t, http.StatusNoContent)
+	repo := &memoryWebhooks{webhook: repository.Webhook{ID: 1, URL: server.URL, Secret: "s3cret", Active: true}}
+	d := newTestDispatcher(repo, true)
+
+	j := newJob(t, EventMessageCreated, map[string]string{"username": "alice", "text": "hi"})
+	if retry := d.attempt(context.Background(), 0, j); retry {
+		t.Fatal("successful delivery was scheduled for retry")
+	}
+
+	req := <-requests
+	if got := req.header.Get(HeaderEvent); got != EventMessageCreated {
+		t.Errorf("%s = %q, want %q", HeaderEvent, got, EventMessageCreated)
+	}
+	if got := req.header.Get(HeaderEventID); got != j.EventID {
+		t.Errorf("%s = %q, want %q", HeaderEventID, got, j.EventID)
+	}
+	timestamp, err := strconv.ParseInt(req.header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		t.Fatalf("invalid %s: %v", HeaderTimestamp, err)
+	}
+	if !Verify("s3cret", timestamp, req.body, req.header.Get(HeaderSignature)) {
+		t.Error("signature does not verify with the webhook secret")
+	}
+	if Verify("other", timestamp, req.body, req.header.Get(HeaderSignature)) {
+		t.Error("signature verifies with a different secret")
+	}
+
+	var envelope struct {
+		ID    string            `json:"id"`
+		Event string            `json:"event"`
+		Data  map[string]string `json:"data"`
+	}
+	if err := json.Unmarshal(req.body, &envelope); err != nil {
+		t.Fatalf("invalid payload: %v", err)
+	}
+	if envelope.ID != j.EventID || envelope.Event != EventMessageCreated || envelope.Data["text"] != "hi" {
+		t.Errorf("unexpected payload %s", req.body)
+	}
+
+	if len(repo.deliveries) != 1 || !repo.deliveries[0].Success || repo.deliveries[0].StatusCode != http.StatusNoContent {
+		t.Errorf("unexpected delivery log %+v", repo.deliveries)
+	}
+}
+
+func TestDeliveryRetries(t *testing.T) {
+	server, _ := newReceiver(t, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable)
+	repo := &memoryWebhooks{webhook: repository.Webhook{ID: 1, URL: server.URL, Active: true}}
+	d := newTestDispatcher(repo, true)
+
+	j := newJob(t, EventUserJoined, map[string]string{"username": "alice"})
+	for want := []bool{true, true, false}; j.Attempt <= len(want); j.Attempt++ {
+		if retry := d.attempt(context.Background(), 0, j); retry != want[j.Attempt-1] {
+			t.Fatalf("attempt %d: retry = %v, want %v", j.Attempt, retry, want[j.Attempt-1])
+		}
+	}
+
+	if len(repo.deliveries) != 3 {
+		t.Fatalf("got %d logged deliveries, want 3", len(repo.deliveries))
+	}
+	for i, delivery := range repo.deliveries {
+		if delivery.Success || delivery.Attempt != i+1 || delivery.Error == "" {
+			t.Errorf("delivery %d: unexpected %+v", i, delivery)
+		}
+	}
+}
+
+func TestDeliveryWebhookLookupErrors(t *testing.T) {
+	repo := &memoryWebhooks{err: repository.ErrWebhookNotFound}
+	d := newTestDispatcher(repo, true)
+
+	j := newJob(t, EventUserJoined, map[string]string{"username": "alice"})
+	if d.attempt(context.Background(), 0, j) {
+		t.Error("job of a deleted webhook is retried")
+	}
+
+	// Anything else, like the database being down, must not lose the job
+	repo.err = errors.New("connection refused")
+	if !d.attempt(context.Background(), 0, j) {
+		t.Error("job is dropped after a failed webhook lookup")
+	}
+	j.Attempt = d.cfg.MaxAttempts
+	if d.attempt(context.Background(), 0, j) {
+		t.Error("failed lookups are retried beyond MaxAttempts")
+	}
+	if len(repo.deliveries) != 0 {
+		t.Errorf("got %d logged deliveries, want none", len(repo.deliveries))
+	}
+}
+
+func TestDeliveryRefusesPrivateAddresses(t *testing.T) {
+	server, requests := newReceiver(t, http.StatusOK)
+	repo := &memoryWebhooks{webhook: repository.Webhook{ID: 1, URL: server.URL, Active: true}}
+	d := newTestDispatcher(repo, false)
+
+	if retry := d.attempt(context.Background(), 0, newJob(t, EventPing, nil)); !retry {
+		t.Error("refused delivery was not scheduled for retry")
+	}
+	select {
+	case <-requests:
+		t.Fatal("request reached a loopback address")
+	default:
+	}
+	if len(repo.deliveries) != 1 || !strings.Contains(repo.deliveries[0].Error, "not allowed") {
+		t.Errorf("unexpected delivery log %+v", repo.deliveries)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d := &Dispatcher{cfg: Config{BaseDelay: 10 * time.Second, MaxDelay: time.Minute}}
+	tests := []struct {
+		retry int
+		want  time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{4, time.Minute},
+		{10, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := d.backoff(tt.retry); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.retry, got, tt.want)
+		}
+	}
+}
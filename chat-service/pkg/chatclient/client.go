@@ -0,0 +1,469 @@
+// Package chatclient is a client for writing chat bots and tools against chat-service.
+//
+// A minimal bot:
+//
+//	c := chatclient.New(chatclient.Config{BaseURL: "http://localhost:8080", APIKey: key})
+//	c.OnMessage(func(m chatclient.Message) {
+//		if !m.Replayed && !m.Own && m.Text == "ping" {
+//			c.Send("pong")
+//		}
+//	})
+//	log.Fatal(c.Run(ctx))
+package chatclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/meetohin/web-chat/chat-service/pkg/protocol"
+)
+
+// closeSessionRevoked is the close code the server uses when the login session was revoked
+const closeSessionRevoked = 4001
+
+var (
+	// ErrNotConnected is returned by the send methods while there is no WebSocket connection
+	ErrNotConnected = errors.New("chatclient: not connected")
+
+	// ErrTwoFactorRequired is returned when the account needs a second factor; use an API key for bots instead
+	ErrTwoFactorRequired = errors.New("chatclient: account requires two-factor authentication")
+)
+
+// APIError is an error response from the server
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("chatclient: %s (%d)", e.Message, e.StatusCode)
+}
+
+// isPermanent reports whether retrying cannot help, e.g. because the credentials were rejected
+func isPermanent(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= 400 && apiErr.StatusCode < 500 && apiErr.StatusCode != http.StatusTooManyRequests
+	}
+	return errors.Is(err, ErrTwoFactorRequired)
+}
+
+// Config configures a Client
+type Config struct {
+	BaseURL string // e.g. http://localhost:8080
+
+	// An API key (recommended for bots), or a username and password. Token may hold
+	// a token from an earlier login, which is used until it expires.
+	APIKey   string
+	Username string
+	Password string
+	Token    string
+
+	// Reconnect backoff, doubled after every failed attempt. Default 1s to 1m.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	HTTPClient *http.Client
+	Dialer     *websocket.Dialer
+	Logger     *log.Logger
+}
+
+// Client keeps a WebSocket connection to the chat and dispatches frames to handlers
+type Client struct {
+	cfg Config
+
+	mu             sync.RWMutex
+	token          string
+	challenge      string // two-factor challenge of a login awaiting its code
+	username       string // as reported by the server once connected
+	conn           *websocket.Conn
+	lastMessageID  int
+	onMessage      func(Message)
+	onNotification func(Notification)
+	onSystem       func(SystemEvent)
+	onTopic        func(Topic)
+	onConnect      func()
+	onDisconnect   func(error)
+
+	writeMu sync.Mutex
+}
+
+// New creates a client. Nothing connects until Run is called.
+func New(cfg Config) *Client {
+	cfg.BaseURL = strings.TrimSuffix(cfg.BaseURL, "/")
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = time.Second
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = time.Minute
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 15 * time.Second}
+	}
+	if cfg.Dialer == nil {
+		cfg.Dialer = &websocket.Dialer{HandshakeTimeout: 15 * time.Second}
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = log.New(io.Discard, "", 0)
+	}
+
+	token := cfg.Token
+	if cfg.APIKey != "" {
+		token = cfg.APIKey
+	}
+	return &Client{cfg: cfg, token: token}
+}
+
+// OnMessage sets the handler for chat messages
+func (c *Client) OnMessage(fn func(Message)) { c.setHandler(func() { c.onMessage = fn }) }
+
+// OnNotification sets the handler for notifications
+func (c *Client) OnNotification(fn func(Notification)) {
+	c.setHandler(func() { c.onNotification = fn })
+}
+
+// OnSystem sets the handler for system lines, including slash command responses
+func (c *Client) OnSystem(fn func(SystemEvent)) { c.setHandler(func() { c.onSystem = fn }) }
+
+// OnTopic sets the handler for topic changes; it is also called with the current topic after connecting
+func (c *Client) OnTopic(fn func(Topic)) { c.setHandler(func() { c.onTopic = fn }) }
+
+// OnConnect sets the handler called once the connection is up and the history has been delivered
+func (c *Client) OnConnect(fn func()) { c.setHandler(func() { c.onConnect = fn }) }
+
+// OnDisconnect sets the handler called when the connection drops
+func (c *Client) OnDisconnect(fn func(error)) { c.setHandler(func() { c.onDisconnect = fn }) }
+
+func (c *Client) setHandler(set func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	set()
+}
+
+// Token returns the token used to connect; it is empty before the first login
+func (c *Client) Token() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.token
+}
+
+// Username returns the name of the connected user. It is known once the first
+// connection is up, also for clients signed in with an API key.
+func (c *Client) Username() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.username
+}
+
+// Login exchanges the username and password for a token. Run calls it when needed.
+// For accounts with two-factor authentication it returns ErrTwoFactorRequired;
+// finish the login with CompleteLogin.
+func (c *Client) Login(ctx context.Context) error {
+	if c.cfg.APIKey != "" {
+		return nil
+	}
+
+	var result struct {
+		Token             string `json:"token"`
+		TwoFactorRequired bool   `json:"two_factor_required"`
+		ChallengeToken    string `json:"challenge_token"`
+	}
+	form := url.Values{"username": {c.cfg.Username}, "password": {c.cfg.Password}}
+	if err := c.postForm(ctx, "/api/login", form, &result); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if result.TwoFactorRequired {
+		c.challenge = result.ChallengeToken
+		return ErrTwoFactorRequired
+	}
+	c.token = result.Token
+	return nil
+}
+
+// CompleteLogin finishes a login that returned ErrTwoFactorRequired with an authenticator or recovery code
+func (c *Client) CompleteLogin(ctx context.Context, code string) error {
+	c.mu.RLock()
+	challenge := c.challenge
+	c.mu.RUnlock()
+	if challenge == "" {
+		return errors.New("chatclient: no login is waiting for a code")
+	}
+
+	var result struct {
+		Token string `json:"token"`
+	}
+	form := url.Values{"challenge_token": {challenge}, "code": {code}}
+	if err := c.postForm(ctx, "/api/login", form, &result); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.token = result.Token
+	c.challenge = ""
+	c.mu.Unlock()
+	return nil
+}
+
+// Run connects and keeps reconnecting with backoff until ctx is cancelled or the credentials are rejected
+func (c *Client) Run(ctx context.Context) error {
+	backoff := c.cfg.MinBackoff
+
+	for {
+		connected, err := c.runOnce(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if isPermanent(err) {
+			return err
+		}
+
+		if connected {
+			backoff = c.cfg.MinBackoff
+		}
+		delay := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		c.cfg.Logger.Printf("chatclient: disconnected (%v), reconnecting in %s", err, delay.Round(time.Millisecond))
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		backoff *= 2
+		if backoff > c.cfg.MaxBackoff {
+			backoff = c.cfg.MaxBackoff
+		}
+	}
+}
+
+// runOnce makes one connection and reads from it until it drops. It reports whether the connection came up.
+func (c *Client) runOnce(ctx context.Context) (bool, error) {
+	if c.Token() == "" {
+		if err := c.Login(ctx); err != nil {
+			return false, err
+		}
+	}
+
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.Lock()
+	c.conn = conn
+	c.mu.Unlock()
+
+	// Unblock the read loop when ctx is cancelled
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.writeMu.Lock()
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+			c.writeMu.Unlock()
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	err = c.readLoop(conn)
+	close(done)
+
+	c.mu.Lock()
+	c.conn = nil
+	c.mu.Unlock()
+	conn.Close()
+
+	if websocket.IsCloseError(err, closeSessionRevoked) {
+		// The token is dead; log in again on the next attempt if there is a password to do it with
+		c.mu.Lock()
+		c.token = ""
+		c.mu.Unlock()
+		if c.cfg.Password == "" {
+			err = &APIError{StatusCode: http.StatusUnauthorized, Message: "session revoked"}
+		}
+	}
+
+	c.mu.RLock()
+	onDisconnect := c.onDisconnect
+	c.mu.RUnlock()
+	if onDisconnect != nil {
+		onDisconnect(err)
+	}
+	return true, err
+}
+
+func (c *Client) dial(ctx context.Context) (*websocket.Conn, error) {
+	wsURL, err := url.Parse(c.cfg.BaseURL + "/ws")
+	if err != nil {
+		return nil, err
+	}
+	switch wsURL.Scheme {
+	case "https":
+		wsURL.Scheme = "wss"
+	default:
+		wsURL.Scheme = "ws"
+	}
+	wsURL.RawQuery = url.Values{"token": {c.Token()}}.Encode()
+
+	conn, resp, err := c.cfg.Dialer.DialContext(ctx, wsURL.String(), nil)
+	if err != nil {
+		if resp != nil && (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) {
+			if c.cfg.APIKey != "" || c.cfg.Password == "" || resp.StatusCode == http.StatusForbidden {
+				return nil, &APIError{StatusCode: resp.StatusCode, Message: "connection refused"}
+			}
+			// The token expired; log in again on the next attempt
+			c.mu.Lock()
+			c.token = ""
+			c.mu.Unlock()
+		}
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (c *Client) readLoop(conn *websocket.Conn) error {
+	replaying := true
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+
+		var f frame
+		if err := json.Unmarshal(data, &f); err != nil {
+			c.cfg.Logger.Printf("chatclient: ignoring invalid frame: %v", err)
+			continue
+		}
+
+		c.mu.RLock()
+		onMessage, onNotification, onSystem, onTopic, onConnect := c.onMessage, c.onNotification, c.onSystem, c.onTopic, c.onConnect
+		c.mu.RUnlock()
+
+		switch f.Type {
+		case "":
+			var msg Message
+			if err := json.Unmarshal(data, &msg.Message); err != nil {
+				continue
+			}
+			if replaying && !c.markSeen(msg.ID) {
+				continue // already delivered before a reconnect
+			}
+			if !replaying {
+				c.markSeen(msg.ID)
+			}
+			msg.Replayed = replaying
+			msg.Own = msg.Username == c.Username()
+			if onMessage != nil {
+				onMessage(msg)
+			}
+
+		case protocol.FrameNotification:
+			var n Notification
+			if err := json.Unmarshal(f.Data, &n); err != nil {
+				continue
+			}
+			if onNotification != nil {
+				onNotification(n)
+			}
+
+		case protocol.FrameSystem:
+			if onSystem != nil {
+				onSystem(SystemEvent{Text: f.Text, Ephemeral: f.Ephemeral, Timestamp: f.Timestamp})
+			}
+
+		case protocol.FrameTopic:
+			if onTopic != nil && f.Topic != nil {
+				onTopic(*f.Topic)
+			}
+
+		case protocol.FrameReady:
+			replaying = false
+			if f.Username != "" {
+				c.mu.Lock()
+				c.username = f.Username
+				c.mu.Unlock()
+			}
+			if onConnect != nil {
+				onConnect()
+			}
+		}
+	}
+}
+
+// markSeen records the highest message ID delivered and reports whether id is new
+func (c *Client) markSeen(id int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if id <= c.lastMessageID {
+		return false
+	}
+	c.lastMessageID = id
+	return true
+}
+
+// Send posts a chat message. Text starting with a slash runs a command; use SendText to post it literally.
+func (c *Client) Send(text string) error {
+	return c.write(protocol.ClientMessage{Text: text})
+}
+
+// SendText posts text as a message even if it starts with a slash
+func (c *Client) SendText(text string) error {
+	if strings.HasPrefix(text, "/") {
+		text = "/" + text
+	}
+	return c.write(protocol.ClientMessage{Text: text})
+}
+
+// Command runs a slash command, e.g. Command("topic", "Release day")
+func (c *Client) Command(name, args string) error {
+	text := "/" + strings.TrimPrefix(name, "/")
+	if args != "" {
+		text += " " + args
+	}
+	return c.write(protocol.ClientMessage{Text: text})
+}
+
+// Action posts a /me message
+func (c *Client) Action(text string) error {
+	return c.Command("me", text)
+}
+
+// SetPresence reports whether the user is looking at the chat, one of the protocol.Presence
+// states. Connections start active; users who are not get notifications for new messages.
+func (c *Client) SetPresence(state string) error {
+	return c.write(protocol.ClientMessage{Type: protocol.ClientPresence, State: state})
+}
+
+func (c *Client) write(v interface{}) error {
+	c.mu.RLock()
+	conn := c.conn
+	c.mu.RUnlock()
+	if conn == nil {
+		return ErrNotConnected
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return conn.WriteJSON(v)
+}
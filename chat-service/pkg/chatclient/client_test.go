@@ -0,0 +1,257 @@
+package chatclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/meetohin/web-chat/chat-service/pkg/protocol"
+)
+
+// fakeChat serves the parts of the chat-service API the client uses: /api/login and /ws.
+// Every connection gets the history, a ready frame and then the live messages of the test.
+type fakeChat struct {
+	t        *testing.T
+	server   *httptest.Server
+	upgrader websocket.Upgrader
+
+	mu          sync.Mutex
+	history     []protocol.Message
+	live        []protocol.Message
+	received    chan protocol.ClientMessage
+	connections int
+	dropAfter   int // connections closed right after the live messages; later ones stay open
+}
+
+func newFakeChat(t *testing.T) *fakeChat {
+	chat := &fakeChat{t: t, received: make(chan protocol.ClientMessage, 10)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/login", chat.login)
+	mux.HandleFunc("/ws", chat.websocket)
+	chat.server = httptest.NewServer(mux)
+	t.Cleanup(chat.server.Close)
+	return chat
+}
+
+func (f *fakeChat) login(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.FormValue("challenge_token") == "challenge" && r.FormValue("code") == "123456":
+		json.NewEncoder(w).Encode(map[string]string{"token": "token-bot"})
+	case r.FormValue("username") == "bot" && r.FormValue("password") == "secret":
+		json.NewEncoder(w).Encode(map[string]string{"token": "token-bot"})
+	case r.FormValue("username") == "guarded" && r.FormValue("password") == "secret":
+		json.NewEncoder(w).Encode(map[string]interface{}{"two_factor_required": true, "challenge_token": "challenge"})
+	default:
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+	}
+}
+
+func (f *fakeChat) websocket(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("token") != "token-bot" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	conn, err := f.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	f.mu.Lock()
+	f.connections++
+	drop := f.connections <= f.dropAfter
+	history := append([]protocol.Message(nil), f.history...)
+	live := append([]protocol.Message(nil), f.live...)
+	f.mu.Unlock()
+
+	for _, msg := range history {
+		conn.WriteJSON(msg)
+	}
+	conn.WriteJSON(protocol.SystemFrame{Type: protocol.FrameReady, Username: "bot", Timestamp: time.Now()})
+	for _, msg := range live {
+		conn.WriteJSON(msg)
+	}
+	if drop {
+		return
+	}
+
+	for {
+		var msg protocol.ClientMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			return
+		}
+		f.received <- msg
+	}
+}
+
+func message(id int, username, text string) protocol.Message {
+	return protocol.Message{ID: id, Username: username, Text: text, Timestamp: time.Now()}
+}
+
+func newTestClient(chat *fakeChat, username string) *Client {
+	return New(Config{
+		BaseURL:    chat.server.URL,
+		Username:   username,
+		Password:   "secret",
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 10 * time.Millisecond,
+	})
+}
+
+// collect runs the client until want messages arrived and returns them
+func collect(t *testing.T, c *Client, want int) []Message {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var mu sync.Mutex
+	var messages []Message
+	c.OnMessage(func(m Message) {
+		mu.Lock()
+		defer mu.Unlock()
+		messages = append(messages, m)
+		if len(messages) == want {
+			cancel()
+		}
+	})
+
+	err := c.Run(ctx)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(messages) != want {
+		t.Fatalf("got %d messages before %v, want %d", len(messages), err, want)
+	}
+	return messages
+}
+
+func TestHistoryAndLiveMessages(t *testing.T) {
+	chat := newFakeChat(t)
+	chat.history = []protocol.Message{message(1, "alice", "hello"), message(2, "bot", "hi")}
+	chat.live = []protocol.Message{message(3, "alice", "!ping"), message(4, "bot", "pong")}
+
+	c := newTestClient(chat, "bot")
+	messages := collect(t, c, 4)
+
+	want := []struct {
+		id       int
+		replayed bool
+		own      bool
+	}{
+		{1, true, false},
+		{2, true, false}, // the user is only known once the ready frame arrived
+		{3, false, false},
+		{4, false, true},
+	}
+	for i, w := range want {
+		m := messages[i]
+		if m.ID != w.id || m.Replayed != w.replayed || m.Own != w.own {
+			t.Errorf("message %d: got id %d replayed %v own %v, want id %d replayed %v own %v",
+				i, m.ID, m.Replayed, m.Own, w.id, w.replayed, w.own)
+		}
+	}
+	if c.Username() != "bot" {
+		t.Errorf("Username() = %q, want bot", c.Username())
+	}
+	if c.Token() != "token-bot" {
+		t.Errorf("Token() = %q, want the token from the login", c.Token())
+	}
+}
+
+func TestReconnectSkipsDeliveredHistory(t *testing.T) {
+	chat := newFakeChat(t)
+	chat.history = []protocol.Message{message(1, "alice", "one"), message(2, "alice", "two")}
+	chat.dropAfter = 1
+
+	c := newTestClient(chat, "bot")
+	var once sync.Once
+	c.OnConnect(func() {
+		// History gains a message while the client is away
+		once.Do(func() {
+			chat.mu.Lock()
+			chat.history = append(chat.history, message(3, "alice", "three"))
+			chat.mu.Unlock()
+		})
+	})
+	messages := collect(t, c, 3)
+
+	for i, m := range messages {
+		if m.ID != i+1 {
+			t.Fatalf("message %d has id %d, want every message once in order", i, m.ID)
+		}
+	}
+	chat.mu.Lock()
+	defer chat.mu.Unlock()
+	if chat.connections < 2 {
+		t.Errorf("got %d connections, want a reconnect", chat.connections)
+	}
+}
+
+func TestSend(t *testing.T) {
+	chat := newFakeChat(t)
+	c := newTestClient(chat, "bot")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c.OnConnect(func() {
+		c.SendText("/not a command")
+		c.Command("topic", "Release day")
+		c.SetPresence(protocol.PresenceActive)
+	})
+	go c.Run(ctx)
+
+	want := []protocol.ClientMessage{
+		{Text: "//not a command"},
+		{Text: "/topic Release day"},
+		{Type: protocol.ClientPresence, State: protocol.PresenceActive},
+	}
+	for _, w := range want {
+		select {
+		case got := <-chat.received:
+			if got != w {
+				t.Errorf("server received %+v, want %+v", got, w)
+			}
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for the client")
+		}
+	}
+}
+
+func TestRejectedCredentialsStopRun(t *testing.T) {
+	chat := newFakeChat(t)
+	c := New(Config{BaseURL: chat.server.URL, Username: "bot", Password: "wrong"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var apiErr *APIError
+	if err := c.Run(ctx); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Run returned %v, want an APIError with status 401", err)
+	}
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	chat := newFakeChat(t)
+	c := newTestClient(chat, "guarded")
+	ctx := context.Background()
+
+	if err := c.Login(ctx); !errors.Is(err, ErrTwoFactorRequired) {
+		t.Fatalf("Login returned %v, want ErrTwoFactorRequired", err)
+	}
+	if err := c.CompleteLogin(ctx, "000000"); err == nil {
+		t.Fatal("CompleteLogin accepted a wrong code")
+	}
+	if err := c.CompleteLogin(ctx, "123456"); err != nil {
+		t.Fatalf("CompleteLogin: %v", err)
+	}
+	if c.Token() != "token-bot" {
+		t.Errorf("Token() = %q after completing the login", c.Token())
+	}
+}
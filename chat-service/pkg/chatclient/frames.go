@@ -0,0 +1,38 @@
+package chatclient
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/meetohin/web-chat/chat-service/pkg/protocol"
+)
+
+// Message is a chat message as passed to the OnMessage handler
+type Message struct {
+	protocol.Message
+
+	// Replayed is set for history the server sends right after connecting
+	Replayed bool `json:"-"`
+
+	// Own is set for messages posted by the client's own user, so bots can avoid answering themselves
+	Own bool `json:"-"`
+}
+
+// Notification is a notification delivered over the WebSocket
+type Notification = protocol.Notification
+
+// Topic is the chat room's topic
+type Topic = protocol.Topic
+
+// SystemEvent is a line from the server that is not a chat message, such as a command response
+type SystemEvent struct {
+	Text      string
+	Ephemeral bool // shown only to this client
+	Timestamp time.Time
+}
+
+// frame is the union of all WebSocket frames the server sends
+type frame struct {
+	protocol.SystemFrame
+	Data json.RawMessage `json:"data"` // notification frames
+}
@@ -0,0 +1,88 @@
+package chatclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/meetohin/web-chat/chat-service/pkg/protocol"
+)
+
+// Register creates an account. The email is optional.
+func (c *Client) Register(ctx context.Context, username, email, password string) error {
+	form := url.Values{"username": {username}, "password": {password}}
+	if email != "" {
+		form.Set("email", email)
+	}
+	return c.postForm(ctx, "/api/register", form, nil)
+}
+
+// PostMessage posts a message over HTTP without a WebSocket connection.
+// Unlike Send, text starting with a slash is posted as is.
+func (c *Client) PostMessage(ctx context.Context, text string) (*protocol.Message, error) {
+	body, _ := json.Marshal(protocol.ClientMessage{Text: text})
+
+	message := &protocol.Message{}
+	if err := c.do(ctx, http.MethodPost, "/api/messages", "application/json", bytes.NewReader(body), message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// RecentMessages returns up to limit of the latest messages, oldest first
+func (c *Client) RecentMessages(ctx context.Context, limit int) ([]protocol.Message, error) {
+	var result struct {
+		Messages []protocol.Message `json:"messages"`
+	}
+	path := "/api/messages?limit=" + strconv.Itoa(limit)
+	if err := c.do(ctx, http.MethodGet, path, "", nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Messages, nil
+}
+
+func (c *Client) postForm(ctx context.Context, path string, form url.Values, out interface{}) error {
+	return c.do(ctx, http.MethodPost, path, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()), out)
+}
+
+// do sends an authenticated request and decodes the JSON response into out
+func (c *Client) do(ctx context.Context, method, path, contentType string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.cfg.BaseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if token := c.Token(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("chatclient: invalid response from %s: %w", path, err)
+	}
+	return nil
+}
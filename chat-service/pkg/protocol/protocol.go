@@ -0,0 +1,92 @@
+// Package protocol defines the JSON frames chat-service exchanges with clients over
+// the WebSocket and the REST message API. Both the server and pkg/chatclient use it.
+package protocol
+
+import "time"
+
+// Frame types. Chat messages are sent without a type.
+const (
+	FrameNotification = "notification"
+	FrameSystem       = "system"
+	FrameTopic        = "topic"
+	FrameReady        = "ready" // the history is complete and live messages follow
+)
+
+// Message is a chat message
+type Message struct {
+	ID        int       `json:"id"`
+	Username  string    `json:"username"`
+	Text      string    `json:"text"`
+	Timestamp time.Time `json:"timestamp"`
+
+	DisplayName string `json:"display_name,omitempty"` // set with /nick, not stored with the message
+}
+
+// Name returns the author's display name, or the username when none is set
+func (m Message) Name() string {
+	if m.DisplayName != "" {
+		return m.DisplayName
+	}
+	return m.Username
+}
+
+// IsAction reports whether the message was sent with /me
+func (m Message) IsAction() bool {
+	return len(m.Text) > 4 && m.Text[:4] == "/me "
+}
+
+// Notification is a notification published by notification-service
+type Notification struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	Title     string    `json:"title"`
+	Message   string    `json:"message"`
+	Type      string    `json:"type"`
+	Sender    string    `json:"sender,omitempty"`
+	Count     int       `json:"count"` // notifications folded into this one
+	IsRead    bool      `json:"is_read"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NotificationFrame carries a notification to the user's connections
+type NotificationFrame struct {
+	Type string       `json:"type"` // FrameNotification
+	Data Notification `json:"data"`
+}
+
+// Topic is the chat room's topic
+type Topic struct {
+	Text  string    `json:"text"`
+	SetBy string    `json:"set_by"`
+	SetAt time.Time `json:"set_at"`
+}
+
+// SystemFrame is a server frame that is not a chat message: a system line, a topic change or the ready marker
+type SystemFrame struct {
+	Type      string    `json:"type"`
+	Text      string    `json:"text,omitempty"`
+	Ephemeral bool      `json:"ephemeral,omitempty"` // shown only to the client that caused it
+	Topic     *Topic    `json:"topic,omitempty"`
+	Username  string    `json:"username,omitempty"` // the connected user, in ready frames
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Client frame types. Messages and slash commands are sent without a type.
+const (
+	ClientPresence = "presence"
+)
+
+// Presence states clients report. Users who are not active get notifications for new messages.
+const (
+	PresenceActive = "active"
+	PresenceIdle   = "idle"   // no input for a while
+	PresenceHidden = "hidden" // the chat is not visible, e.g. a background tab
+)
+
+// ClientMessage is what clients send to post a message or run a slash command,
+// or, with Type ClientPresence, to report whether the user is looking at the chat
+type ClientMessage struct {
+	Type  string `json:"type,omitempty"`
+	Text  string `json:"text,omitempty"`
+	State string `json:"state,omitempty"`
+}
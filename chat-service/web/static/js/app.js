@@ -7,6 +7,9 @@ class ChatApp {
         this.reconnectDelay = 1000;
         this.notifications = [];
         this.unreadCount = 0;
+        this.presence = document.hidden ? 'hidden' : 'active';
+        this.idleTimer = null;
+        this.idleTimeout = 5 * 60 * 1000;
         this.init();
     }
 
@@ -17,6 +20,7 @@ class ChatApp {
         }
 
         this.setupEventListeners();
+        this.setupPresenceTracking();
         this.connectWebSocket();
         this.loadStats();
     }
@@ -60,6 +64,44 @@ class ChatApp {
         });
     }
 
+    // Сервер присылает уведомления о новых сообщениях, только когда пользователь не смотрит в чат
+    setupPresenceTracking() {
+        const activity = () => {
+            clearTimeout(this.idleTimer);
+            this.idleTimer = setTimeout(() => {
+                if (!document.hidden) {
+                    this.setPresence('idle');
+                }
+            }, this.idleTimeout);
+
+            if (this.presence === 'idle') {
+                this.setPresence('active');
+            }
+        };
+
+        ['mousemove', 'keydown', 'click', 'touchstart', 'scroll'].forEach(event => {
+            document.addEventListener(event, activity, { passive: true });
+        });
+        document.addEventListener('visibilitychange', () => {
+            this.setPresence(document.hidden ? 'hidden' : 'active');
+            activity();
+        });
+        activity();
+    }
+
+    setPresence(state) {
+        if (this.presence !== state) {
+            this.presence = state;
+            this.sendPresence();
+        }
+    }
+
+    sendPresence() {
+        if (this.ws && this.ws.readyState === WebSocket.OPEN) {
+            this.ws.send(JSON.stringify({ type: 'presence', state: this.presence }));
+        }
+    }
+
     connectWebSocket() {
         const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
         const wsUrl = `${protocol}//${window.location.host}/ws?token=${this.token}`;
@@ -70,6 +112,7 @@ class ChatApp {
             console.log('WebSocket connected');
             this.reconnectAttempts = 0;
             this.updateConnectionStatus(true);
+            this.sendPresence();
         };
 
         this.ws.onmessage = (event) => {
@@ -79,7 +122,11 @@ class ChatApp {
                 // Проверяем, является ли это уведомлением
                 if (data.type === 'notification') {
                     this.handleNotification(data.data);
-                } else {
+                } else if (data.type === 'system') {
+                    this.displaySystemMessage(data);
+                } else if (data.type === 'topic') {
+                    this.displayTopic(data.topic);
+                } else if (!data.type) {
                     // Обычное сообщение чата
                     this.displayMessage(data);
                 }
@@ -92,6 +139,13 @@ class ChatApp {
             console.log('WebSocket disconnected');
             this.updateConnectionStatus(false);
 
+            if (event.code === 4001) {
+                // Session was logged out from another device
+                localStorage.removeItem('token');
+                window.location.href = '/login';
+                return;
+            }
+
             if (event.code === 1006 || event.code === 1000) {
                 this.handleReconnect();
             }
@@ -104,6 +158,12 @@ class ChatApp {
     }
 
     handleNotification(notification) {
+        // Несколько сообщений от одного отправителя приходят как обновление одного уведомления
+        const existing = this.notifications.findIndex(n => n.id === notification.id);
+        if (existing !== -1) {
+            this.notifications.splice(existing, 1);
+        }
+
         // Добавляем уведомление в список
         this.notifications.unshift(notification);
 
@@ -113,7 +173,9 @@ class ChatApp {
         }
 
         // Увеличиваем счетчик непрочитанных
-        this.unreadCount++;
+        if (existing === -1) {
+            this.unreadCount++;
+        }
         this.updateNotificationBadge();
 
         // Обновляем список уведомлений
@@ -129,6 +191,7 @@ class ChatApp {
         if (Notification.permission === 'granted') {
             const browserNotification = new Notification(notification.title, {
                 body: notification.message,
+                tag: notification.id, // заменяет предыдущее уведомление с тем же id
                 icon: '/static/favicon.ico' // добавьте фавикон если есть
             });
 
@@ -270,19 +333,60 @@ class ChatApp {
         messageElement.className = 'message';
 
         const timestamp = new Date(message.timestamp).toLocaleTimeString();
+        // Имя аккаунта показывается всегда, ник — рядом с ним, чтобы ником нельзя было выдать себя за другого
+        let name = this.escapeHtml(message.username);
+        if (message.display_name && message.display_name !== message.username) {
+            name = `${this.escapeHtml(message.display_name)} <span class="message-account">(${this.escapeHtml(message.username)})</span>`;
+        }
 
-        messageElement.innerHTML = `
-            <div class="message-header">
-                <span class="message-username">${this.escapeHtml(message.username)}</span>
-                <span class="message-time">${timestamp}</span>
-            </div>
-            <div class="message-text">${this.escapeHtml(message.text)}</div>
-        `;
+        // Сообщения входящих вебхуков помечаются, чтобы их нельзя было принять за сообщения пользователей
+        let badge = '';
+        if (message.username.endsWith('@hook')) {
+            name = this.escapeHtml(message.username.slice(0, -'@hook'.length));
+            badge = '<span class="message-bot-badge">hook</span>';
+            messageElement.classList.add('message-bot');
+        }
+
+        // Сообщения /me показываются как действие
+        if (message.text.startsWith('/me ')) {
+            messageElement.classList.add('message-action');
+            messageElement.innerHTML = `
+                <div class="message-text">* ${name} ${badge}${this.escapeHtml(message.text.slice(4))}</div>
+            `;
+        } else {
+            messageElement.innerHTML = `
+                <div class="message-header">
+                    <span class="message-username">${name}</span>
+                    ${badge}
+                    <span class="message-time">${timestamp}</span>
+                </div>
+                <div class="message-text">${this.escapeHtml(message.text)}</div>
+            `;
+        }
 
         messagesContainer.appendChild(messageElement);
         messagesContainer.scrollTop = messagesContainer.scrollHeight;
     }
 
+    displaySystemMessage(data) {
+        const messagesContainer = document.getElementById('messages');
+
+        const element = document.createElement('div');
+        element.className = 'system-message' + (data.ephemeral ? ' system-message-ephemeral' : '');
+        element.textContent = data.text;
+
+        messagesContainer.appendChild(element);
+        messagesContainer.scrollTop = messagesContainer.scrollHeight;
+    }
+
+    displayTopic(topic) {
+        const topicElement = document.getElementById('topic');
+        if (topicElement && topic) {
+            topicElement.textContent = topic.text;
+            topicElement.title = `Set by ${topic.set_by}`;
+        }
+    }
+
     escapeHtml(text) {
         const div = document.createElement('div');
         div.textContent = text;
@@ -2,14 +2,24 @@ package main
 
 import (
 	"context"
+	_ "expvar"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
+	_ "time/tzdata" // quiet hours use the users' time zones, the image has no zoneinfo
 
+	"github.com/meetohin/web-chat/notification-service/internal/api"
+	"github.com/meetohin/web-chat/notification-service/internal/auth"
+	"github.com/meetohin/web-chat/notification-service/internal/channel"
 	"github.com/meetohin/web-chat/notification-service/internal/config"
+	"github.com/meetohin/web-chat/notification-service/internal/digest"
 	"github.com/meetohin/web-chat/notification-service/internal/redis"
 	"github.com/meetohin/web-chat/notification-service/internal/repository"
+	"github.com/meetohin/web-chat/notification-service/internal/retention"
+	"github.com/meetohin/web-chat/notification-service/internal/templates"
 	"github.com/meetohin/web-chat/notification-service/internal/worker"
 )
 
@@ -26,6 +36,11 @@ func main() {
 	}
 	defer repo.Close()
 
+	if err := repo.Migrate(context.Background(), cfg.MigrationsDir); err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
+	log.Println("Database migrations applied")
+
 	// Connect to Redis
 	redisClient, err := redis.New(cfg.RedisURL)
 	if err != nil {
@@ -33,8 +48,33 @@ func main() {
 	}
 	defer redisClient.Close()
 
+	// Auth client for the notification API
+	authClient, err := auth.New(cfg.AuthServiceURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to auth service: %v", err)
+	}
+	defer authClient.Close()
+
+	// Localized notification texts
+	catalog, err := templates.Load()
+	if err != nil {
+		log.Fatalf("Failed to load notification templates: %v", err)
+	}
+
+	// Delivery channels outside the chat
+	mailer := newMailer(cfg)
+	channels := channel.NewRouter(repo, newChannels(cfg, mailer, catalog)...)
+
 	// Create and run workers
-	w := worker.New(redisClient, repo, cfg.Workers)
+	w := worker.New(redisClient, repo, channels, catalog, worker.Config{
+		Workers:         cfg.Workers,
+		DeliveryWorkers: cfg.DeliveryWorkers,
+		MaxAttempts:     cfg.MaxAttempts,
+		BaseDelay:       cfg.RetryBaseDelay,
+		MaxDelay:        cfg.RetryMaxDelay,
+
+		CoalesceWindow: cfg.CoalesceWindow,
+	})
 
 	// Graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
@@ -48,6 +88,55 @@ func main() {
 		cancel()
 	}()
 
+	// Retention of stored notifications
+	retentionConfig := retention.Config{
+		MaxAge:     time.Duration(cfg.RetentionDays) * 24 * time.Hour,
+		MaxPerUser: cfg.RetentionMaxPerUser,
+		Interval:   cfg.RetentionInterval,
+		BatchSize:  cfg.RetentionBatchSize,
+		BatchPause: 100 * time.Millisecond,
+	}
+	if retentionConfig.Enabled() {
+		go retention.New(repo, redisClient, retentionConfig).Start(ctx)
+	}
+
+	// Digest emails for users who have been away
+	digestConfig := digest.Config{
+		Interval:     cfg.DigestInterval,
+		OfflineAfter: cfg.DigestOfflineAfter,
+		ChatURL:      cfg.ChatURL,
+	}
+	if digestConfig.Enabled() && mailer != nil {
+		go digest.New(repo, redisClient, mailer, catalog, digestConfig).Start(ctx)
+	}
+
+	// Metrics (expvar) at /debug/vars
+	if cfg.MetricsAddr != "" {
+		go func() {
+			if err := http.ListenAndServe(cfg.MetricsAddr, nil); err != nil {
+				log.Printf("Metrics server stopped: %v", err)
+			}
+		}()
+	}
+
+	// Notification API
+	apiServer := &http.Server{
+		Addr:    cfg.HTTPAddr,
+		Handler: api.New(repo, authClient, channels, catalog, cfg.CORSOrigins).Routes(),
+	}
+	go func() {
+		log.Printf("Notification API listening on %s", cfg.HTTPAddr)
+		if err := apiServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Notification API failed: %v", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		apiServer.Shutdown(shutdownCtx)
+	}()
+
 	log.Printf("Notification Service started with %d workers", cfg.Workers)
 
 	if err := w.Start(ctx); err != nil {
@@ -56,3 +145,53 @@ func main() {
 
 	log.Println("Notification Service stopped")
 }
+
+// newMailer creates the mailer selected by MAILER, or nil if email is turned off
+func newMailer(cfg *config.Config) channel.Mailer {
+	var mailer channel.Mailer
+	var err error
+	switch cfg.Mailer {
+	case "smtp":
+		mailer, err = channel.NewSMTPMailer(channel.SMTPConfig{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.SMTPFrom,
+		})
+	case "file":
+		mailer, err = channel.NewFileMailer(cfg.MailerDir)
+	case "none":
+		return nil
+	default:
+		log.Fatalf("Unknown mailer %q", cfg.Mailer)
+	}
+	if err != nil {
+		log.Fatalf("Failed to create mailer: %v", err)
+	}
+	return mailer
+}
+
+// newChannels creates the delivery channels the configuration enables
+func newChannels(cfg *config.Config, mailer channel.Mailer, catalog *templates.Catalog) []channel.Channel {
+	channels := []channel.Channel{channel.NewWebhook(cfg.WebhookAllowPrivate)}
+	if mailer != nil {
+		channels = append(channels, channel.NewEmail(mailer, catalog, cfg.ChatURL))
+	}
+
+	if cfg.VAPIDPrivateKey != "" {
+		push, err := channel.NewPush(channel.VAPIDConfig{
+			PublicKey:  cfg.VAPIDPublicKey,
+			PrivateKey: cfg.VAPIDPrivateKey,
+			Subject:    cfg.VAPIDSubject,
+		}, catalog, cfg.ChatURL)
+		if err != nil {
+			log.Fatalf("Failed to configure Web Push: %v", err)
+		}
+		channels = append(channels, push)
+	} else {
+		log.Println("Web Push disabled: VAPID_PRIVATE_KEY not set")
+	}
+
+	return channels
+}
@@ -0,0 +1,82 @@
+// Command redrive inspects the notification dead-letter queue and moves dead letters
+// back onto the notification queue once the cause of the failures is fixed.
+//
+//	redrive -list            show the oldest dead letters
+//	redrive [-limit N]       replay the oldest N dead letters, all of them by default
+//	redrive -deliveries ...  the same for failed email, webhook and push deliveries
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/meetohin/web-chat/notification-service/internal/config"
+	"github.com/meetohin/web-chat/notification-service/internal/redis"
+	"github.com/meetohin/web-chat/notification-service/internal/worker"
+)
+
+func main() {
+	list := flag.Bool("list", false, "list dead letters instead of replaying them")
+	limit := flag.Int("limit", 0, "number of dead letters to list or replay, oldest first (default: 20 listed, all replayed)")
+	deliveries := flag.Bool("deliveries", false, "use the dead letters of deliveries outside the chat")
+	flag.Parse()
+
+	queue, deadLetters := worker.QueueName, worker.DeadLetterQueueName
+	if *deliveries {
+		queue, deadLetters = worker.DeliveryQueueName, worker.DeliveryDeadLetterQueueName
+	}
+
+	client, err := redis.New(config.Load().RedisURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to Redis: %v", err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+
+	if *list {
+		if *limit <= 0 {
+			*limit = 20
+		}
+		if err := printDeadLetters(ctx, client, deadLetters, *limit); err != nil {
+			log.Fatalf("Failed to list dead letters: %v", err)
+		}
+		return
+	}
+
+	// Dead letters are valid queue entries, the worker retries them from the first attempt
+	moved, err := client.Move(ctx, deadLetters, queue, *limit)
+	if err != nil {
+		log.Fatalf("Redrove %d dead letters before failing: %v", moved, err)
+	}
+	log.Printf("Redrove %d dead letters", moved)
+}
+
+func printDeadLetters(ctx context.Context, client *redis.Client, deadLetters string, limit int) error {
+	total, err := client.QueueSize(ctx, deadLetters)
+	if err != nil {
+		return err
+	}
+
+	// The oldest entries are at the tail
+	entries, err := client.Range(ctx, deadLetters, -int64(limit), -1)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stdout, "%d dead letters\n", total)
+	for i := len(entries) - 1; i >= 0; i-- {
+		var dl worker.DeadLetter
+		if err := json.Unmarshal([]byte(entries[i]), &dl); err != nil {
+			fmt.Fprintf(os.Stdout, "\n(unreadable) %s\n", entries[i])
+			continue
+		}
+		fmt.Fprintf(os.Stdout, "\n%s  attempts: %d  error: %s\n  %s\n",
+			dl.FailedAt.Format("2006-01-02 15:04:05"), dl.Attempts, dl.Error, dl.Payload)
+	}
+	return nil
+}
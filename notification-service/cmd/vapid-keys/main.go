@@ -0,0 +1,21 @@
+// Command vapid-keys generates the VAPID key pair that identifies the notification
+// service to browser push services. Set the printed variables once and keep them:
+// changing the keys invalidates every existing push subscription.
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/meetohin/web-chat/notification-service/internal/channel"
+)
+
+func main() {
+	public, private, err := channel.GenerateVAPIDKeys()
+	if err != nil {
+		log.Fatalf("Failed to generate keys: %v", err)
+	}
+
+	fmt.Printf("VAPID_PUBLIC_KEY=%s\n", public)
+	fmt.Printf("VAPID_PRIVATE_KEY=%s\n", private)
+}
@@ -0,0 +1,325 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/meetohin/web-chat/notification-service/internal/auth"
+	"github.com/meetohin/web-chat/notification-service/internal/channel"
+	"github.com/meetohin/web-chat/notification-service/internal/model"
+)
+
+// maxEndpoints limits the endpoints a user can register on one channel
+const maxEndpoints = 10
+
+// listChannels returns the user's endpoints, which channel is used for which notification
+// type, and the key browsers need to subscribe to push notifications
+func (h *Handler) listChannels(w http.ResponseWriter, r *http.Request, userID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	endpoints, err := h.repo.ListEndpoints(r.Context(), userID, "")
+	if err != nil {
+		h.logger.Printf("Failed to list endpoints of %s: %v", userID, err)
+		http.Error(w, "Failed to list channels", http.StatusInternalServerError)
+		return
+	}
+	prefs, err := h.repo.ChannelPreferences(r.Context(), userID)
+	if err != nil {
+		h.logger.Printf("Failed to load channel preferences of %s: %v", userID, err)
+		http.Error(w, "Failed to list channels", http.StatusInternalServerError)
+		return
+	}
+
+	available := h.availableChannels()
+	preferences := channelMatrix(&model.Preferences{Channels: prefs}, available)
+
+	response := map[string]interface{}{
+		"available":   available,
+		"endpoints":   endpoints,
+		"preferences": preferences,
+	}
+	if endpoints == nil {
+		response["endpoints"] = []interface{}{}
+	}
+	if push, ok := h.channels.Channel(model.ChannelPush).(*channel.Push); ok {
+		response["vapid_public_key"] = push.PublicKey()
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// setChannelPreference turns a channel on or off for a notification type (POST type, channel, enabled)
+func (h *Handler) setChannelPreference(w http.ResponseWriter, r *http.Request, userID string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	notificationType := r.FormValue("type")
+	name := r.FormValue("channel")
+	enabled, err := strconv.ParseBool(r.FormValue("enabled"))
+	if err != nil {
+		http.Error(w, "enabled must be true or false", http.StatusBadRequest)
+		return
+	}
+	if !contains(model.Types, notificationType) {
+		http.Error(w, "Unknown notification type", http.StatusBadRequest)
+		return
+	}
+	if !contains(model.Channels, name) {
+		http.Error(w, "Unknown channel", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.repo.SetChannelPreference(r.Context(), userID, notificationType, name, enabled); err != nil {
+		h.logger.Printf("Failed to save channel preference of %s: %v", userID, err)
+		http.Error(w, "Failed to save preference", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"type": notificationType, "channel": name, "enabled": enabled})
+}
+
+// addEmail sends notifications to the caller's account email address. Only verified
+// addresses can be used, so notifications cannot be sent to someone else's inbox.
+func (h *Handler) addEmail(w http.ResponseWriter, r *http.Request, identity *auth.Identity) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.channels.Available(model.ChannelEmail) {
+		http.Error(w, "Email notifications are not available", http.StatusNotFound)
+		return
+	}
+	if identity.Email == "" || !identity.EmailVerified {
+		http.Error(w, "Verify your email address first", http.StatusConflict)
+		return
+	}
+
+	endpoint := &model.Endpoint{
+		UserID:  identity.Username,
+		Channel: model.ChannelEmail,
+		Address: identity.Email,
+	}
+	if h.saveEndpoint(w, r, endpoint) {
+		writeJSON(w, http.StatusCreated, map[string]interface{}{"endpoint": endpoint})
+	}
+}
+
+// addWebhook registers a webhook URL (POST url) and returns the secret its requests are signed with
+func (h *Handler) addWebhook(w http.ResponseWriter, r *http.Request, userID string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.channels.Available(model.ChannelWebhook) {
+		http.Error(w, "Webhook notifications are not available", http.StatusNotFound)
+		return
+	}
+
+	url := r.FormValue("url")
+	if err := channel.ValidateURL(url, false); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		http.Error(w, "Failed to generate secret", http.StatusInternalServerError)
+		return
+	}
+
+	endpoint := &model.Endpoint{
+		UserID:  userID,
+		Channel: model.ChannelWebhook,
+		Address: url,
+		Secret:  hex.EncodeToString(secret),
+	}
+	if h.saveEndpoint(w, r, endpoint) {
+		// Only shown once; registering the URL again generates a new secret
+		writeJSON(w, http.StatusCreated, map[string]interface{}{"endpoint": endpoint, "secret": endpoint.Secret})
+	}
+}
+
+// subscribePush stores a browser push subscription, the JSON of PushSubscription
+func (h *Handler) subscribePush(w http.ResponseWriter, r *http.Request, userID string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.channels.Available(model.ChannelPush) {
+		http.Error(w, "Push notifications are not available", http.StatusNotFound)
+		return
+	}
+
+	var subscription struct {
+		Endpoint string `json:"endpoint"`
+		Keys     struct {
+			P256dh string `json:"p256dh"`
+			Auth   string `json:"auth"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&subscription); err != nil {
+		http.Error(w, "Invalid subscription", http.StatusBadRequest)
+		return
+	}
+	if err := channel.ValidateSubscription(subscription.Endpoint, subscription.Keys.P256dh, subscription.Keys.Auth); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	endpoint := &model.Endpoint{
+		UserID:  userID,
+		Channel: model.ChannelPush,
+		Address: subscription.Endpoint,
+		P256dh:  subscription.Keys.P256dh,
+		Auth:    subscription.Keys.Auth,
+	}
+	if h.saveEndpoint(w, r, endpoint) {
+		writeJSON(w, http.StatusCreated, map[string]interface{}{"endpoint": endpoint})
+	}
+}
+
+// unsubscribePush removes a browser push subscription (POST JSON with its endpoint)
+func (h *Handler) unsubscribePush(w http.ResponseWriter, r *http.Request, userID string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var subscription struct {
+		Endpoint string `json:"endpoint"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&subscription); err != nil || subscription.Endpoint == "" {
+		http.Error(w, "Invalid subscription", http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := h.repo.DeleteUserEndpoint(r.Context(), userID, model.ChannelPush, subscription.Endpoint)
+	if err != nil {
+		h.logger.Printf("Failed to delete push subscription of %s: %v", userID, err)
+		http.Error(w, "Failed to unsubscribe", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"deleted": deleted})
+}
+
+// deleteEndpoint removes one of the user's endpoints (POST id)
+func (h *Handler) deleteEndpoint(w http.ResponseWriter, r *http.Request, userID string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid endpoint id", http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := h.repo.DeleteEndpoint(r.Context(), userID, id)
+	if err != nil {
+		h.logger.Printf("Failed to delete endpoint of %s: %v", userID, err)
+		http.Error(w, "Failed to delete endpoint", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, "Endpoint not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"deleted": true})
+}
+
+// deliveries returns how a notification was delivered outside the chat (GET id)
+func (h *Handler) deliveries(w http.ResponseWriter, r *http.Request, userID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if _, err := uuid.Parse(id); err != nil {
+		http.Error(w, "Invalid notification id", http.StatusBadRequest)
+		return
+	}
+
+	deliveries, err := h.repo.ListDeliveries(r.Context(), userID, id)
+	if err != nil {
+		h.logger.Printf("Failed to list deliveries of notification %s: %v", id, err)
+		http.Error(w, "Failed to list deliveries", http.StatusInternalServerError)
+		return
+	}
+	if deliveries == nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"deliveries": []interface{}{}})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"deliveries": deliveries})
+}
+
+// saveEndpoint stores an endpoint unless the user has too many on its channel.
+// It writes the error response itself and reports whether the caller should respond.
+func (h *Handler) saveEndpoint(w http.ResponseWriter, r *http.Request, endpoint *model.Endpoint) bool {
+	existing, err := h.repo.ListEndpoints(r.Context(), endpoint.UserID, endpoint.Channel)
+	if err != nil {
+		h.logger.Printf("Failed to list endpoints of %s: %v", endpoint.UserID, err)
+		http.Error(w, "Failed to save endpoint", http.StatusInternalServerError)
+		return false
+	}
+	known := false
+	for _, e := range existing {
+		known = known || e.Address == endpoint.Address
+	}
+	if !known && len(existing) >= maxEndpoints {
+		http.Error(w, "Too many endpoints on this channel", http.StatusConflict)
+		return false
+	}
+
+	if err := h.repo.SaveEndpoint(r.Context(), endpoint); err != nil {
+		h.logger.Printf("Failed to save %s endpoint of %s: %v", endpoint.Channel, endpoint.UserID, err)
+		http.Error(w, "Failed to save endpoint", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// availableChannels returns the channels configured on this server
+func (h *Handler) availableChannels() []string {
+	available := []string{}
+	for _, name := range model.Channels {
+		if h.channels.Available(name) {
+			available = append(available, name)
+		}
+	}
+	return available
+}
+
+// channelMatrix returns whether each channel is used for each notification type, with the defaults filled in
+func channelMatrix(prefs *model.Preferences, channels []string) map[string]map[string]bool {
+	matrix := make(map[string]map[string]bool)
+	for _, notificationType := range model.Types {
+		matrix[notificationType] = make(map[string]bool)
+		for _, name := range channels {
+			matrix[notificationType][name] = prefs.ChannelEnabled(notificationType, name)
+		}
+	}
+	return matrix
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
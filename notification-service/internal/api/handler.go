@@ -0,0 +1,314 @@
+// Package api serves the notification HTTP API for signed-in users
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/meetohin/web-chat/notification-service/internal/auth"
+	"github.com/meetohin/web-chat/notification-service/internal/channel"
+	"github.com/meetohin/web-chat/notification-service/internal/repository"
+	"github.com/meetohin/web-chat/notification-service/internal/templates"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// tokenValidator is implemented by *auth.Client
+type tokenValidator interface {
+	ValidateToken(ctx context.Context, token string) (*auth.Identity, error)
+}
+
+type Handler struct {
+	repo       *repository.Repository
+	authClient tokenValidator
+	channels   *channel.Router
+	templates  *templates.Catalog
+	origins    map[string]bool
+	logger     *log.Logger
+}
+
+// New creates the API handler. Browsers on allowedOrigins may call the API cross-origin.
+func New(repo *repository.Repository, authClient *auth.Client, channels *channel.Router, catalog *templates.Catalog, allowedOrigins []string) *Handler {
+	origins := make(map[string]bool)
+	for _, origin := range allowedOrigins {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins[origin] = true
+		}
+	}
+
+	return &Handler{
+		repo:       repo,
+		authClient: authClient,
+		channels:   channels,
+		templates:  catalog,
+		origins:    origins,
+		logger:     log.New(os.Stdout, "API: ", log.LstdFlags),
+	}
+}
+
+// Routes returns the HTTP handler of the API
+func (h *Handler) Routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/notifications", h.authenticated(h.list))
+	mux.HandleFunc("/api/notifications/unread-count", h.authenticated(h.unreadCount))
+	mux.HandleFunc("/api/notifications/read", h.authenticated(h.markRead))
+	mux.HandleFunc("/api/notifications/delete", h.authenticated(h.delete))
+	mux.HandleFunc("/api/notifications/deliveries", h.authenticated(h.deliveries))
+	mux.HandleFunc("/api/preferences", h.authenticated(h.preferences))
+	mux.HandleFunc("/api/channels", h.authenticated(h.listChannels))
+	mux.HandleFunc("/api/channels/preferences", h.authenticated(h.setChannelPreference))
+	mux.HandleFunc("/api/channels/email", h.identified(h.addEmail))
+	mux.HandleFunc("/api/channels/webhook", h.authenticated(h.addWebhook))
+	mux.HandleFunc("/api/channels/delete", h.authenticated(h.deleteEndpoint))
+	mux.HandleFunc("/api/push/subscribe", h.authenticated(h.subscribePush))
+	mux.HandleFunc("/api/push/unsubscribe", h.authenticated(h.unsubscribePush))
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	return h.cors(mux)
+}
+
+// list returns a page of notifications (GET limit, cursor, unread, type)
+func (h *Handler) list(w http.ResponseWriter, r *http.Request, userID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	opts := repository.ListOptions{
+		Limit:      defaultPageSize,
+		UnreadOnly: query.Get("unread") == "true",
+		Type:       query.Get("type"),
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			http.Error(w, "Limit must be between 1 and 100", http.StatusBadRequest)
+			return
+		}
+		opts.Limit = limit
+	}
+	if cursor := query.Get("cursor"); cursor != "" {
+		var err error
+		if opts.BeforeTime, opts.BeforeID, err = decodeCursor(cursor); err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
+
+	notifications, err := h.repo.ListNotifications(r.Context(), userID, opts)
+	if err != nil {
+		h.logger.Printf("Failed to list notifications of %s: %v", userID, err)
+		http.Error(w, "Failed to list notifications", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{"notifications": notifications}
+	if len(notifications) == opts.Limit {
+		last := notifications[len(notifications)-1]
+		response["next_cursor"] = encodeCursor(last.CreatedAt, last.ID)
+	}
+	if notifications == nil {
+		response["notifications"] = []interface{}{}
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// unreadCount returns the number of unread notifications, in total and per type
+func (h *Handler) unreadCount(w http.ResponseWriter, r *http.Request, userID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	counts, err := h.repo.GetUnreadCountsByType(r.Context(), userID)
+	if err != nil {
+		h.logger.Printf("Failed to count unread notifications of %s: %v", userID, err)
+		http.Error(w, "Failed to count notifications", http.StatusInternalServerError)
+		return
+	}
+
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"unread_count": total, "by_type": counts})
+}
+
+// markRead marks notifications as read (POST id, repeatable, or all=true)
+func (h *Handler) markRead(w http.ResponseWriter, r *http.Request, userID string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	all, ids, err := selection(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var updated int64
+	if all {
+		updated, err = h.repo.MarkAllAsRead(r.Context(), userID)
+	} else {
+		updated, err = h.repo.MarkAsRead(r.Context(), userID, ids)
+	}
+	if err != nil {
+		h.logger.Printf("Failed to mark notifications of %s as read: %v", userID, err)
+		http.Error(w, "Failed to update notifications", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"updated": updated})
+}
+
+// delete deletes notifications (POST id, repeatable, or all=true)
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request, userID string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	all, ids, err := selection(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var deleted int64
+	if all {
+		deleted, err = h.repo.DeleteAllNotifications(r.Context(), userID)
+	} else {
+		deleted, err = h.repo.DeleteNotifications(r.Context(), userID, ids)
+	}
+	if err != nil {
+		h.logger.Printf("Failed to delete notifications of %s: %v", userID, err)
+		http.Error(w, "Failed to delete notifications", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"deleted": deleted})
+}
+
+// authenticated validates the bearer token and passes the caller's user ID to next
+func (h *Handler) authenticated(next func(w http.ResponseWriter, r *http.Request, userID string)) http.HandlerFunc {
+	return h.identified(func(w http.ResponseWriter, r *http.Request, identity *auth.Identity) {
+		next(w, r, identity.Username)
+	})
+}
+
+// identified validates the bearer token and passes the caller's identity to next.
+// Requests other than GET change data and need the messages:write scope from API keys.
+func (h *Handler) identified(next func(w http.ResponseWriter, r *http.Request, identity *auth.Identity)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || strings.TrimSpace(token) == "" {
+			http.Error(w, "Token required", http.StatusUnauthorized)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		identity, err := h.authClient.ValidateToken(ctx, strings.TrimSpace(token))
+		if err != nil {
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return
+		}
+		if !identity.CanReadNotifications() {
+			http.Error(w, "API key lacks the messages:read scope", http.StatusForbidden)
+			return
+		}
+		if r.Method != http.MethodGet && !identity.CanChangeNotifications() {
+			http.Error(w, "API key lacks the messages:write scope", http.StatusForbidden)
+			return
+		}
+
+		next(w, r, identity)
+	}
+}
+
+// cors lets browsers on the allowed origins call the API
+func (h *Handler) cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if origin := r.Header.Get("Origin"); h.origins[origin] {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST")
+			w.Header().Add("Vary", "Origin")
+		}
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// selection reads which notifications a request applies to: all of them or the listed IDs
+func selection(r *http.Request) (bool, []string, error) {
+	if err := r.ParseForm(); err != nil {
+		return false, nil, errors.New("invalid form")
+	}
+	if r.PostForm.Get("all") == "true" {
+		return true, nil, nil
+	}
+
+	ids := r.PostForm["id"]
+	if len(ids) == 0 {
+		return false, nil, errors.New("id or all=true required")
+	}
+	if len(ids) > maxPageSize {
+		return false, nil, errors.New("too many ids")
+	}
+	for _, id := range ids {
+		if _, err := uuid.Parse(id); err != nil {
+			return false, nil, errors.New("invalid notification id")
+		}
+	}
+	return false, ids, nil
+}
+
+// Cursors are opaque to clients; they hold the position of the last notification of a page
+func encodeCursor(createdAt time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(createdAt.Format(time.RFC3339Nano) + "|" + id))
+}
+
+func decodeCursor(cursor string) (time.Time, string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+
+	value, id, ok := strings.Cut(string(data), "|")
+	if !ok {
+		return time.Time{}, "", errors.New("invalid cursor")
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return time.Time{}, "", err
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, value)
+	return createdAt, id, err
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
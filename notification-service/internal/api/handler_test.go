@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/meetohin/web-chat/notification-service/internal/auth"
+)
+
+// fakeValidator accepts the tokens it knows
+type fakeValidator map[string]*auth.Identity
+
+func (v fakeValidator) ValidateToken(ctx context.Context, token string) (*auth.Identity, error) {
+	if identity, ok := v[token]; ok {
+		return identity, nil
+	}
+	return nil, errors.New("invalid token")
+}
+
+func newTestHandler() http.Handler {
+	h := New(nil, nil, nil, nil, nil)
+	h.authClient = fakeValidator{
+		"user":       {Username: "alice"},
+		"read-key":   {Username: "bot", Bot: true, Scopes: []string{"messages:read"}},
+		"write-key":  {Username: "bot", Bot: true, Scopes: []string{"messages:read", "messages:write"}},
+		"no-scope":   {Username: "bot", Bot: true},
+		"write-only": {Username: "bot", Bot: true, Scopes: []string{"messages:write"}},
+	}
+	return h.Routes()
+}
+
+func serve(handler http.Handler, method, path, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(""))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestReadScopedKeyCannotChangeData(t *testing.T) {
+	handler := newTestHandler()
+	routes := []string{
+		"/api/notifications/read",
+		"/api/notifications/delete",
+		"/api/preferences",
+		"/api/channels/preferences",
+		"/api/channels/email",
+		"/api/channels/webhook",
+		"/api/channels/delete",
+		"/api/push/subscribe",
+		"/api/push/unsubscribe",
+	}
+	for _, route := range routes {
+		if w := serve(handler, http.MethodPost, route, "read-key"); w.Code != http.StatusForbidden {
+			t.Errorf("POST %s with a messages:read key returned %d, want 403", route, w.Code)
+		}
+	}
+}
+
+func TestScopes(t *testing.T) {
+	handler := newTestHandler()
+	tests := []struct {
+		method, path, token string
+		want                int
+	}{
+		{http.MethodGet, "/api/notifications", "", http.StatusUnauthorized},
+		{http.MethodGet, "/api/notifications", "unknown", http.StatusUnauthorized},
+		{http.MethodGet, "/api/notifications", "no-scope", http.StatusForbidden},
+		{http.MethodGet, "/api/notifications", "write-only", http.StatusForbidden},
+		// Requests past the scope checks fail validation before the repository is used
+		{http.MethodGet, "/api/notifications/read", "read-key", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/api/notifications/read", "write-key", http.StatusBadRequest},
+		{http.MethodPost, "/api/notifications/delete", "user", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if w := serve(handler, tt.method, tt.path, tt.token); w.Code != tt.want {
+			t.Errorf("%s %s with token %q returned %d, want %d", tt.method, tt.path, tt.token, w.Code, tt.want)
+		}
+	}
+}
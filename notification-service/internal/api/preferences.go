@@ -0,0 +1,157 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/meetohin/web-chat/notification-service/internal/model"
+	"github.com/meetohin/web-chat/notification-service/internal/templates"
+)
+
+// preferencesUpdate changes the fields it contains and keeps the others.
+// "quiet_hours": null turns do-not-disturb off.
+type preferencesUpdate struct {
+	Types        map[string]bool            `json:"types"`
+	Channels     map[string]map[string]bool `json:"channels"`
+	MutedSenders *[]string                  `json:"muted_senders"`
+	QuietHours   json.RawMessage            `json:"quiet_hours"`
+	Digest       *bool                      `json:"digest"`
+	Locale       *string                    `json:"locale"` // "" for the default
+}
+
+// preferences returns (GET) or updates (POST JSON) the user's notification preferences
+func (h *Handler) preferences(w http.ResponseWriter, r *http.Request, userID string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		prefs, err := h.repo.GetPreferences(r.Context(), userID)
+		if err != nil {
+			h.logger.Printf("Failed to load preferences of %s: %v", userID, err)
+			http.Error(w, "Failed to load preferences", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, h.preferencesView(prefs))
+		return
+	}
+
+	var update preferencesUpdate
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&update); err != nil {
+		http.Error(w, "Invalid preferences", http.StatusBadRequest)
+		return
+	}
+
+	// The update is merged into the stored preferences while they are locked
+	var invalid error
+	prefs, err := h.repo.UpdatePreferences(r.Context(), userID, func(prefs *model.Preferences) error {
+		invalid = update.apply(prefs, h.templates)
+		return invalid
+	})
+	if invalid != nil {
+		http.Error(w, invalid.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.logger.Printf("Failed to save preferences of %s: %v", userID, err)
+		http.Error(w, "Failed to save preferences", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, h.preferencesView(prefs))
+}
+
+// apply validates the update and merges it into prefs. Locales must be available in catalog.
+func (u *preferencesUpdate) apply(prefs *model.Preferences, catalog *templates.Catalog) error {
+	for notificationType, enabled := range u.Types {
+		if !contains(model.Types, notificationType) {
+			return fmt.Errorf("unknown notification type %q", notificationType)
+		}
+		prefs.Types[notificationType] = enabled
+	}
+
+	for notificationType, channels := range u.Channels {
+		if !contains(model.Types, notificationType) {
+			return fmt.Errorf("unknown notification type %q", notificationType)
+		}
+		for name, enabled := range channels {
+			if !contains(model.Channels, name) {
+				return fmt.Errorf("unknown channel %q", name)
+			}
+			if prefs.Channels[notificationType] == nil {
+				prefs.Channels[notificationType] = make(map[string]bool)
+			}
+			prefs.Channels[notificationType][name] = enabled
+		}
+	}
+
+	if u.MutedSenders != nil {
+		seen := make(map[string]bool)
+		prefs.MutedSenders = nil
+		for _, sender := range *u.MutedSenders {
+			sender = strings.TrimSpace(sender)
+			if sender == "" || seen[sender] {
+				continue
+			}
+			seen[sender] = true
+			prefs.MutedSenders = append(prefs.MutedSenders, sender)
+		}
+		if len(prefs.MutedSenders) > model.MaxMutedSenders {
+			return fmt.Errorf("at most %d senders can be muted", model.MaxMutedSenders)
+		}
+	}
+
+	if len(u.QuietHours) > 0 {
+		var quiet *model.QuietHours
+		if err := json.Unmarshal(u.QuietHours, &quiet); err != nil {
+			return errors.New("invalid quiet_hours")
+		}
+		if quiet != nil {
+			if err := quiet.Validate(); err != nil {
+				return fmt.Errorf("invalid quiet_hours: %w", err)
+			}
+		}
+		prefs.QuietHours = quiet
+	}
+
+	if u.Digest != nil {
+		prefs.Digest = *u.Digest
+	}
+
+	if u.Locale != nil {
+		locale := templates.Normalize(*u.Locale)
+		if locale != "" && (len(locale) > 35 || !templates.Valid(locale) || !catalog.Supports(locale)) {
+			return fmt.Errorf("unsupported locale %q", *u.Locale)
+		}
+		prefs.Locale = locale
+	}
+	return nil
+}
+
+// preferencesView lists every notification type and available channel, with the defaults filled in
+func (h *Handler) preferencesView(prefs *model.Preferences) map[string]interface{} {
+	types := make(map[string]bool)
+	for _, notificationType := range model.Types {
+		types[notificationType] = prefs.Receives(notificationType)
+	}
+	muted := prefs.MutedSenders
+	if muted == nil {
+		muted = []string{}
+	}
+
+	return map[string]interface{}{
+		"types":         types,
+		"channels":      channelMatrix(prefs, h.availableChannels()),
+		"muted_senders": muted,
+		"quiet_hours":   prefs.QuietHours,
+		"quiet_now":     prefs.Quiet(time.Now()),
+		"digest":        prefs.Digest,
+		"locale":        prefs.Locale,
+		"locales":       h.templates.Locales(),
+	}
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"context"
+	"errors"
+
+	pb "github.com/meetohin/web-chat/auth-service/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// API key scopes that allow reading notifications and changing them, the
+// preferences and the endpoints notifications are delivered to
+const (
+	scopeMessagesRead  = "messages:read"
+	scopeMessagesWrite = "messages:write"
+)
+
+// Identity describes the owner of a valid token
+type Identity struct {
+	Username      string
+	Email         string
+	EmailVerified bool
+	Bot           bool     // authenticated with an API key
+	Scopes        []string // API key scopes
+}
+
+// CanReadNotifications reports whether the identity may use the notification API.
+// User tokens always may; API keys need the messages:read scope.
+func (i *Identity) CanReadNotifications() bool {
+	return i.hasScope(scopeMessagesRead)
+}
+
+// CanChangeNotifications reports whether the identity may mark read or delete notifications
+// and change preferences and endpoints. User tokens always may; API keys need messages:write.
+func (i *Identity) CanChangeNotifications() bool {
+	return i.hasScope(scopeMessagesWrite)
+}
+
+func (i *Identity) hasScope(scope string) bool {
+	if !i.Bot {
+		return true
+	}
+	for _, s := range i.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Client validates tokens through auth-service
+type Client struct {
+	client pb.AuthServiceClient
+	conn   *grpc.ClientConn
+}
+
+func New(address string) (*Client, error) {
+	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		client: pb.NewAuthServiceClient(conn),
+		conn:   conn,
+	}, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) ValidateToken(ctx context.Context, token string) (*Identity, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	resp, err := c.client.ValidateToken(ctx, &pb.ValidateTokenRequest{Token: token})
+	if err != nil {
+		return nil, err
+	}
+
+	if !resp.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	return &Identity{
+		Username:      resp.Username,
+		Email:         resp.Email,
+		EmailVerified: resp.EmailVerified,
+		Bot:           resp.Bot,
+		Scopes:        resp.Scopes,
+	}, nil
+}
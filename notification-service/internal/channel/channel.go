@@ -0,0 +1,145 @@
+// Package channel delivers notifications outside the chat: by email, to webhooks and as Web Push
+package channel
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/meetohin/web-chat/notification-service/internal/model"
+	"github.com/meetohin/web-chat/notification-service/internal/repository"
+	"github.com/meetohin/web-chat/notification-service/internal/templates"
+)
+
+const sendTimeout = 10 * time.Second
+
+// ErrGone is returned by Send when the endpoint no longer exists and should be removed
+var ErrGone = errors.New("endpoint no longer exists")
+
+// ErrUndeliverable is returned by Send for notifications the channel can never deliver,
+// so sending them again is pointless
+var ErrUndeliverable = errors.New("notification cannot be delivered")
+
+// Metrics are published at /debug/vars under "deliveries", e.g. "email_sent"
+var metrics = expvar.NewMap("deliveries")
+
+// Channel sends notifications to one kind of endpoint
+type Channel interface {
+	Name() string
+	Send(ctx context.Context, endpoint *model.Endpoint, notification *model.Notification) error
+}
+
+// Router sends notifications on the channels users enabled for their type and
+// records the outcome of every delivery
+type Router struct {
+	repo     *repository.Repository
+	channels map[string]Channel
+	logger   *log.Logger
+}
+
+func NewRouter(repo *repository.Repository, channels ...Channel) *Router {
+	r := &Router{
+		repo:     repo,
+		channels: make(map[string]Channel),
+		logger:   log.New(os.Stdout, "Channels: ", log.LstdFlags),
+	}
+	for _, ch := range channels {
+		r.channels[ch.Name()] = ch
+	}
+	return r
+}
+
+// Available reports whether a channel is configured on this server
+func (r *Router) Available(name string) bool {
+	return r.channels[name] != nil
+}
+
+// Channel returns a configured channel, or nil
+func (r *Router) Channel(name string) Channel {
+	return r.channels[name]
+}
+
+// Endpoints returns the user's endpoints on the channels enabled in prefs for the notification
+func (r *Router) Endpoints(ctx context.Context, notification *model.Notification, prefs *model.Preferences) ([]*model.Endpoint, error) {
+	var endpoints []*model.Endpoint
+	for _, name := range model.Channels {
+		if r.channels[name] == nil || !prefs.ChannelEnabled(notification.Type, name) {
+			continue
+		}
+
+		found, err := r.repo.ListEndpoints(ctx, notification.UserID, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s endpoints: %w", name, err)
+		}
+		endpoints = append(endpoints, found...)
+	}
+	return endpoints, nil
+}
+
+// Send sends the notification to one endpoint and records the outcome. Endpoints that no
+// longer exist are removed; other failures are returned for the caller to retry.
+func (r *Router) Send(ctx context.Context, endpoint *model.Endpoint, notification *model.Notification) error {
+	ch := r.channels[endpoint.Channel]
+	if ch == nil {
+		// The channel was turned off on this server since the delivery was queued
+		return nil
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+	err := ch.Send(sendCtx, endpoint, notification)
+	cancel()
+
+	delivery := &model.Delivery{
+		NotificationID: notification.ID,
+		Channel:        ch.Name(),
+		Address:        endpoint.Address,
+		Status:         model.DeliverySent,
+	}
+	if err != nil {
+		delivery.Status = model.DeliveryFailed
+		delivery.Error = err.Error()
+		r.logger.Printf("Failed to send notification %s by %s: %v", notification.ID, ch.Name(), err)
+	}
+	metrics.Add(ch.Name()+"_"+delivery.Status, 1)
+
+	if err := r.repo.RecordDelivery(ctx, delivery); err != nil {
+		r.logger.Printf("Failed to record delivery of notification %s: %v", notification.ID, err)
+	}
+
+	if errors.Is(err, ErrGone) {
+		if _, err := r.repo.DeleteEndpoint(ctx, endpoint.UserID, endpoint.ID); err != nil {
+			r.logger.Printf("Failed to remove %s endpoint %d: %v", ch.Name(), endpoint.ID, err)
+		}
+		return nil
+	}
+	return err
+}
+
+// render renders a channel variant of the notification's text in the locale it was created in,
+// the variant for many if several notifications were folded into it. Notifications queued
+// with a ready title and message have no variables and keep their text.
+func render(catalog *templates.Catalog, notification *model.Notification, field, chatURL, stored string) (string, error) {
+	if notification.Variables == nil {
+		return stored, nil
+	}
+	if notification.Count > 1 {
+		field = templates.Many(field)
+	}
+	return catalog.Render(notification.Locale, notification.Type, field, variables(notification, chatURL))
+}
+
+// variables returns the notification's template variables and those every channel provides
+func variables(notification *model.Notification, chatURL string) map[string]string {
+	vars := make(map[string]string, len(notification.Variables)+2)
+	for name, value := range notification.Variables {
+		vars[name] = value
+	}
+	vars["chat_url"] = chatURL
+	vars["count"] = strconv.Itoa(notification.Count)
+	return vars
+}
@@ -0,0 +1,163 @@
+package channel
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/meetohin/web-chat/notification-service/internal/model"
+	"github.com/meetohin/web-chat/notification-service/internal/templates"
+)
+
+// Mailer sends an email with a plain text body and, unless html is empty, an HTML alternative
+type Mailer interface {
+	Send(to, subject, text, html string) error
+}
+
+// Email sends notifications to the verified email addresses of users
+type Email struct {
+	mailer    Mailer
+	templates *templates.Catalog
+	chatURL   string
+}
+
+// NewEmail creates the email channel. Messages are rendered from the email templates
+// in catalog and link to the chat at chatURL.
+func NewEmail(mailer Mailer, catalog *templates.Catalog, chatURL string) *Email {
+	return &Email{mailer: mailer, templates: catalog, chatURL: chatURL}
+}
+
+func (e *Email) Name() string { return model.ChannelEmail }
+
+func (e *Email) Send(ctx context.Context, endpoint *model.Endpoint, notification *model.Notification) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	subject, err := render(e.templates, notification, templates.FieldEmailSubject, e.chatURL, notification.Title)
+	if err != nil {
+		return err
+	}
+	text, err := render(e.templates, notification, templates.FieldEmailText, e.chatURL,
+		fmt.Sprintf("%s\n\nOpen the chat: %s\n", notification.Message, e.chatURL))
+	if err != nil {
+		return err
+	}
+
+	var html string
+	if notification.Variables != nil {
+		field := templates.FieldEmailHTML
+		if notification.Count > 1 {
+			field = templates.Many(field)
+		}
+		html, err = e.templates.RenderHTML(notification.Locale, notification.Type, field, variables(notification, e.chatURL))
+		if err != nil && !errors.Is(err, templates.ErrNotFound) {
+			return err
+		}
+	}
+	return e.mailer.Send(endpoint.Address, subject, text, html)
+}
+
+// SMTPConfig holds SMTP server settings
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string // empty disables authentication
+	Password string
+	From     string
+}
+
+// SMTPMailer sends messages through an SMTP server
+type SMTPMailer struct {
+	cfg SMTPConfig
+}
+
+// NewSMTPMailer creates a mailer that sends messages through an SMTP server
+func NewSMTPMailer(cfg SMTPConfig) (*SMTPMailer, error) {
+	if cfg.Host == "" || cfg.From == "" {
+		return nil, fmt.Errorf("smtp host and from address are required")
+	}
+	if cfg.Port == "" {
+		cfg.Port = "587"
+	}
+	return &SMTPMailer{cfg: cfg}, nil
+}
+
+func (m *SMTPMailer) Send(to, subject, text, html string) error {
+	var auth smtp.Auth
+	if m.cfg.Username != "" {
+		auth = smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
+	}
+
+	addr := net.JoinHostPort(m.cfg.Host, m.cfg.Port)
+	return smtp.SendMail(addr, auth, m.cfg.From, []string{to}, formatMessage(m.cfg.From, to, subject, text, html))
+}
+
+// FileMailer stores every message as a separate .eml file in a directory, for local development
+type FileMailer struct {
+	dir string
+}
+
+// NewFileMailer creates a mailer that writes messages to dir
+func NewFileMailer(dir string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileMailer{dir: dir}, nil
+}
+
+func (m *FileMailer) Send(to, subject, text, html string) error {
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), sanitizeFilename(to))
+	return os.WriteFile(filepath.Join(m.dir, name), formatMessage("notifications@localhost", to, subject, text, html), 0o644)
+}
+
+// formatMessage builds a plain text message, or a multipart/alternative one when there is an HTML body
+func formatMessage(from, to, subject, text, html string) []byte {
+	// Header values come from notification titles, keep them on one line
+	subject = mime.QEncoding.Encode("utf-8", strings.NewReplacer("\r", " ", "\n", " ").Replace(subject))
+	text = strings.ReplaceAll(text, "\n", "\r\n")
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\n",
+		from, to, subject, time.Now().Format(time.RFC1123Z))
+	if html == "" {
+		fmt.Fprintf(&b, "Content-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n", text)
+		return b.Bytes()
+	}
+
+	var parts bytes.Buffer
+	w := multipart.NewWriter(&parts)
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=UTF-8", text},
+		{"text/html; charset=UTF-8", html},
+	} {
+		pw, _ := w.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType}})
+		fmt.Fprintf(pw, "%s\r\n", part.body)
+	}
+	w.Close()
+
+	fmt.Fprintf(&b, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", w.Boundary())
+	b.Write(parts.Bytes())
+	return b.Bytes()
+}
+
+func sanitizeFilename(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_', r == '@':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
@@ -0,0 +1,119 @@
+package channel
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/meetohin/web-chat/auth-service/pkg/netguard"
+	"github.com/meetohin/web-chat/notification-service/internal/model"
+)
+
+// Headers of webhook requests. The signature is computed the same way as for chat webhooks:
+// "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body)).
+const (
+	HeaderTimestamp = "X-Notification-Timestamp"
+	HeaderSignature = "X-Notification-Signature"
+)
+
+// Webhook POSTs notifications as JSON to URLs chosen by users
+type Webhook struct {
+	client *http.Client
+}
+
+// NewWebhook creates the webhook channel. Unless allowPrivate is set, requests to
+// loopback and private network addresses are refused, since users choose the URLs.
+func NewWebhook(allowPrivate bool) *Webhook {
+	return &Webhook{client: newHTTPClient(allowPrivate)}
+}
+
+func (wh *Webhook) Name() string { return model.ChannelWebhook }
+
+func (wh *Webhook) Send(ctx context.Context, endpoint *model.Endpoint, notification *model.Notification) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"event":        "notification",
+		"notification": notification,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.Address, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "web-chat-notifications/1.0")
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(endpoint.Secret, timestamp, body))
+
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusGone:
+		return ErrGone
+	default:
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+}
+
+// Sign returns the signature header value for a request body
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ValidateURL checks that a user-supplied webhook or push URL is absolute and uses HTTP(S)
+func ValidateURL(raw string, requireHTTPS bool) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return errors.New("invalid URL")
+	}
+	if requireHTTPS && u.Scheme != "https" {
+		return errors.New("URL must use https")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("URL must use http or https")
+	}
+	return nil
+}
+
+// newHTTPClient returns a client for user-supplied URLs
+func newHTTPClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if !allowPrivate {
+		dialer.Control = netguard.Control
+	}
+
+	return &http.Client{
+		Timeout: sendTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+			MaxIdleConnsPerHost: 2,
+		},
+	}
+}
@@ -0,0 +1,339 @@
+package channel
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/meetohin/web-chat/notification-service/internal/model"
+	"github.com/meetohin/web-chat/notification-service/internal/templates"
+)
+
+const (
+	// pushRecordSize is the record size of the encrypted body; the whole payload must fit into one record
+	pushRecordSize = 4096
+	// maxPushPayload leaves room in the record for the padding delimiter and the AEAD tag
+	maxPushPayload = pushRecordSize - 16 - 1
+	pushTTL        = 24 * time.Hour
+)
+
+// VAPIDConfig identifies this server to push services (RFC 8292). Keys are
+// unpadded base64url: the uncompressed P-256 public key and the private scalar.
+type VAPIDConfig struct {
+	PublicKey  string
+	PrivateKey string
+	Subject    string // mailto: or https: contact for push service operators
+}
+
+// Push sends notifications as Web Push messages to browser subscriptions
+type Push struct {
+	key       *ecdsa.PrivateKey
+	publicKey string
+	subject   string
+	templates *templates.Catalog
+	chatURL   string
+	client    *http.Client
+}
+
+// NewPush creates the Web Push channel. Notifications use the short push texts of catalog
+// and open chatURL when clicked.
+func NewPush(cfg VAPIDConfig, catalog *templates.Catalog, chatURL string) (*Push, error) {
+	d, err := decodeBase64URL(cfg.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+	private, err := ecdh.P256().NewPrivateKey(d)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+
+	public := private.PublicKey().Bytes()
+	if cfg.PublicKey != "" && cfg.PublicKey != base64.RawURLEncoding.EncodeToString(public) {
+		return nil, errors.New("VAPID public key does not match the private key")
+	}
+	if cfg.Subject == "" {
+		return nil, errors.New("VAPID subject required")
+	}
+
+	// public is 0x04 || X || Y
+	key := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(public[1:33]),
+			Y:     new(big.Int).SetBytes(public[33:]),
+		},
+		D: new(big.Int).SetBytes(d),
+	}
+
+	return &Push{
+		key:       key,
+		publicKey: base64.RawURLEncoding.EncodeToString(public),
+		subject:   cfg.Subject,
+		templates: catalog,
+		chatURL:   chatURL,
+		client:    newHTTPClient(false),
+	}, nil
+}
+
+// GenerateVAPIDKeys returns a new public and private key pair for VAPIDConfig
+func GenerateVAPIDKeys() (string, string, error) {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()),
+		base64.RawURLEncoding.EncodeToString(key.Bytes()), nil
+}
+
+// PublicKey returns the key browsers pass as applicationServerKey when subscribing
+func (p *Push) PublicKey() string {
+	return p.publicKey
+}
+
+func (p *Push) Name() string { return model.ChannelPush }
+
+func (p *Push) Send(ctx context.Context, endpoint *model.Endpoint, notification *model.Notification) error {
+	title, err := render(p.templates, notification, templates.FieldPushTitle, p.chatURL, notification.Title)
+	if err != nil {
+		return err
+	}
+	text, err := render(p.templates, notification, templates.FieldPushBody, p.chatURL, notification.Message)
+	if err != nil {
+		return err
+	}
+
+	payload, err := pushPayload(notification, title, text, p.chatURL)
+	if err != nil {
+		return err
+	}
+
+	body, err := encryptPush(endpoint.P256dh, endpoint.Auth, payload)
+	if err != nil {
+		return err
+	}
+
+	authorization, err := p.vapidAuthorization(endpoint.Address)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.Address, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", fmt.Sprint(int(pushTTL.Seconds())))
+	if notification.Type != model.TypeMessage {
+		req.Header.Set("Urgency", "high")
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrGone
+	default:
+		return fmt.Errorf("push service returned %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	}
+}
+
+// ValidateSubscription checks a browser push subscription before it is stored
+func ValidateSubscription(endpoint, p256dh, authSecret string) error {
+	if err := ValidateURL(endpoint, true); err != nil {
+		return err
+	}
+	key, err := decodeBase64URL(p256dh)
+	if err != nil {
+		return errors.New("invalid subscription key")
+	}
+	if _, err := ecdh.P256().NewPublicKey(key); err != nil {
+		return errors.New("invalid subscription key")
+	}
+	if secret, err := decodeBase64URL(authSecret); err != nil || len(secret) != 16 {
+		return errors.New("invalid subscription secret")
+	}
+	return nil
+}
+
+// vapidAuthorization returns the Authorization header with a signed JWT for the push service
+func (p *Push) vapidAuthorization(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`))
+	claims, err := json.Marshal(map[string]interface{}{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": time.Now().Add(12 * time.Hour).Unix(),
+		"sub": p.subject,
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, p.key, digest[:])
+	if err != nil {
+		return "", err
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+
+	token := unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)
+	return "vapid t=" + token + ", k=" + p.publicKey, nil
+}
+
+// pushPayload encodes a push message, shortening its body until it fits into one record.
+// Messages that do not fit even without a body fail with ErrUndeliverable.
+func pushPayload(notification *model.Notification, title, text, chatURL string) ([]byte, error) {
+	for {
+		payload, err := json.Marshal(map[string]string{
+			"id":    notification.ID,
+			"type":  notification.Type,
+			"title": title,
+			"body":  text,
+			"url":   chatURL,
+		})
+		if err != nil {
+			return nil, err
+		}
+		excess := len(payload) - maxPushPayload
+		if excess <= 0 {
+			return payload, nil
+		}
+		if text == "" {
+			return nil, fmt.Errorf("%w: push payload of %d bytes", ErrUndeliverable, len(payload))
+		}
+		// JSON escapes make some characters take more room in the payload than in the text,
+		// so the text is cut in proportion to its encoded size; it gets shorter every round
+		encoded, _ := json.Marshal(text)
+		cut := (excess + len("…")) * len(text) / (len(encoded) - 2)
+		text = shorten(text, len(text)-cut-len("…")-1)
+	}
+}
+
+// shorten cuts text to at most n bytes on a character boundary and marks the cut with an ellipsis
+func shorten(text string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	for n > 0 && !utf8.RuneStart(text[n]) {
+		n--
+	}
+	return strings.TrimRight(text[:n], " ") + "…"
+}
+
+// encryptPush encrypts a payload for a subscription as defined by RFC 8291
+func encryptPush(p256dh, authSecret string, payload []byte) ([]byte, error) {
+	if len(payload) > maxPushPayload {
+		return nil, fmt.Errorf("%w: push payload of %d bytes", ErrUndeliverable, len(payload))
+	}
+
+	uaPublicBytes, err := decodeBase64URL(p256dh)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subscription key: %w", err)
+	}
+	uaPublic, err := ecdh.P256().NewPublicKey(uaPublicBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subscription key: %w", err)
+	}
+	auth, err := decodeBase64URL(authSecret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subscription secret: %w", err)
+	}
+
+	// A new key pair and salt for every message
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	sharedSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	keyInfo := "WebPush: info\x00" + string(uaPublicBytes) + string(asPublic)
+	prkKey, err := hkdf.Extract(sha256.New, sharedSecret, auth)
+	if err != nil {
+		return nil, err
+	}
+	ikm, err := hkdf.Expand(sha256.New, prkKey, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// A single record, terminated by the last-record delimiter
+	plaintext := append(append([]byte{}, payload...), 0x02)
+
+	// Header: salt, record size, key ID length and the key ID, which is our public key
+	body := make([]byte, 0, 16+4+1+len(asPublic)+len(plaintext)+gcm.Overhead())
+	body = append(body, salt...)
+	body = binary.BigEndian.AppendUint32(body, pushRecordSize)
+	body = append(body, byte(len(asPublic)))
+	body = append(body, asPublic...)
+	return gcm.Seal(body, nonce, plaintext, nil), nil
+}
+
+// decodeBase64URL accepts base64url with or without padding, as browsers are not consistent
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
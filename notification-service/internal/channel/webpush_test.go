@@ -0,0 +1,79 @@
+package channel
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/meetohin/web-chat/notification-service/internal/model"
+)
+
+// subscriptionKeys returns the keys of a browser push subscription
+func subscriptionKeys(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := make([]byte, 16)
+	rand.Read(secret)
+	return base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()), base64.RawURLEncoding.EncodeToString(secret)
+}
+
+func TestPushPayloadShortensLongBodies(t *testing.T) {
+	p256dh, auth := subscriptionKeys(t)
+	notification := &model.Notification{ID: "3f0e1a5e-8f4b-4c43-9a53-3d0f2b7c1e7a", Type: model.TypeMessage}
+
+	bodies := map[string]string{
+		"ascii":     strings.Repeat("hello ", 1000),
+		"cyrillic":  strings.Repeat("привет ", 1000),
+		"escaped":   strings.Repeat("<&>", 1700), // each character takes six bytes in JSON
+		"emoji":     strings.Repeat("👋", 1250),
+		"short":     "hi",
+		"exact fit": strings.Repeat("a", maxPushPayload-150),
+	}
+	for name, body := range bodies {
+		payload, err := pushPayload(notification, "New message from bob", body, "https://chat.example")
+		if err != nil {
+			t.Errorf("%s: pushPayload: %v", name, err)
+			continue
+		}
+		if len(payload) > maxPushPayload {
+			t.Errorf("%s: payload of %d bytes does not fit", name, len(payload))
+		}
+		var message map[string]string
+		if err := json.Unmarshal(payload, &message); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !utf8.ValidString(message["body"]) {
+			t.Errorf("%s: body was cut inside a character", name)
+		}
+		if message["body"] != body && !strings.HasSuffix(message["body"], "…") {
+			t.Errorf("%s: body was cut without an ellipsis", name)
+		}
+		if len(body) < 100 && message["body"] != body {
+			t.Errorf("%s: short body changed to %q", name, message["body"])
+		}
+		if _, err := encryptPush(p256dh, auth, payload); err != nil {
+			t.Errorf("%s: encryptPush: %v", name, err)
+		}
+	}
+}
+
+func TestPushPayloadTooLarge(t *testing.T) {
+	notification := &model.Notification{ID: "3f0e1a5e-8f4b-4c43-9a53-3d0f2b7c1e7a", Type: model.TypeMessage}
+	_, err := pushPayload(notification, strings.Repeat("title ", 1000), "body", "https://chat.example")
+	if !errors.Is(err, ErrUndeliverable) {
+		t.Errorf("pushPayload with an oversized title returned %v, want ErrUndeliverable", err)
+	}
+
+	p256dh, auth := subscriptionKeys(t)
+	if _, err := encryptPush(p256dh, auth, make([]byte, maxPushPayload+1)); !errors.Is(err, ErrUndeliverable) {
+		t.Errorf("encryptPush of an oversized payload returned %v, want ErrUndeliverable", err)
+	}
+}
@@ -4,22 +4,99 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	DatabaseURL string
-	RedisURL    string
-	Workers     int
+	DatabaseURL     string
+	MigrationsDir   string // applied at startup
+	RedisURL        string
+	Workers         int
+	DeliveryWorkers int    // send to email, webhook and push endpoints
+	MetricsAddr     string // serves /debug/vars; empty disables it
+
+	// Queue retries; failed notifications are dead-lettered after MaxAttempts
+	MaxAttempts    int
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+
+	// Message notifications from one sender within the window are folded into one; zero disables it
+	CoalesceWindow time.Duration
+
+	// Digest emails of unread notifications for users away longer than DigestOfflineAfter; zero disables them
+	DigestInterval     time.Duration
+	DigestOfflineAfter time.Duration
+
+	// Notification API
+	HTTPAddr       string
+	AuthServiceURL string
+	CORSOrigins    []string // browser origins allowed to call the API
+
+	// Delivery channels outside the chat
+	ChatURL             string // linked from emails and push notifications
+	Mailer              string // smtp, file or none
+	MailerDir           string
+	SMTPHost            string
+	SMTPPort            string
+	SMTPUsername        string
+	SMTPPassword        string
+	SMTPFrom            string
+	VAPIDPublicKey      string // Web Push is disabled without a VAPID key pair
+	VAPIDPrivateKey     string
+	VAPIDSubject        string
+	WebhookAllowPrivate bool // allow webhooks to loopback and private addresses, for development
+
+	// Retention of stored notifications; zero disables a rule
+	RetentionDays       int
+	RetentionMaxPerUser int
+	RetentionInterval   time.Duration
+	RetentionBatchSize  int
 }
 
 func Load() *Config {
 	config := &Config{
-		DatabaseURL: getEnv("DATABASE_URL", "postgres://localhost/notifications?sslmode=disable"),
-		RedisURL:    getEnv("REDIS_URL", "redis://localhost:6379/1"),
-		Workers:     getIntEnv("WORKERS", 2),
+		DatabaseURL:     getEnv("DATABASE_URL", "postgres://localhost/notifications?sslmode=disable"),
+		MigrationsDir:   getEnv("MIGRATIONS_DIR", "migrations"),
+		RedisURL:        getEnv("REDIS_URL", "redis://localhost:6379/1"),
+		Workers:         getIntEnv("WORKERS", 2),
+		DeliveryWorkers: getIntEnv("DELIVERY_WORKERS", 4),
+		MetricsAddr:     getEnv("METRICS_ADDR", ":9102"),
+
+		MaxAttempts:    getIntEnv("NOTIFICATION_MAX_ATTEMPTS", 5),
+		RetryBaseDelay: getDurationEnv("NOTIFICATION_RETRY_BASE_DELAY", 2*time.Second),
+		RetryMaxDelay:  getDurationEnv("NOTIFICATION_RETRY_MAX_DELAY", 5*time.Minute),
+
+		CoalesceWindow: getDurationEnv("NOTIFICATION_COALESCE_WINDOW", time.Minute),
+
+		DigestInterval:     getDurationEnv("DIGEST_INTERVAL", time.Hour),
+		DigestOfflineAfter: getDurationEnv("DIGEST_OFFLINE_AFTER", 24*time.Hour),
+
+		HTTPAddr:       getEnv("HTTP_ADDR", ":8081"),
+		AuthServiceURL: getEnv("AUTH_SERVICE_URL", "localhost:50051"),
+		CORSOrigins:    strings.Split(getEnv("CORS_ORIGINS", "http://localhost:8080"), ","),
+
+		ChatURL:             getEnv("CHAT_URL", "http://localhost:8080"),
+		Mailer:              getEnv("MAILER", "file"),
+		MailerDir:           getEnv("MAILER_DIR", "mail"),
+		SMTPHost:            getEnv("SMTP_HOST", ""),
+		SMTPPort:            getEnv("SMTP_PORT", "587"),
+		SMTPUsername:        getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:        getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:            getEnv("SMTP_FROM", ""),
+		VAPIDPublicKey:      getEnv("VAPID_PUBLIC_KEY", ""),
+		VAPIDPrivateKey:     getEnv("VAPID_PRIVATE_KEY", ""),
+		VAPIDSubject:        getEnv("VAPID_SUBJECT", "mailto:admin@localhost"),
+		WebhookAllowPrivate: getEnv("WEBHOOK_ALLOW_PRIVATE", "false") == "true",
+
+		RetentionDays:       getIntEnv("NOTIFICATION_RETENTION_DAYS", 0),
+		RetentionMaxPerUser: getIntEnv("NOTIFICATION_RETENTION_MAX_PER_USER", 0),
+		RetentionInterval:   getDurationEnv("RETENTION_INTERVAL", time.Hour),
+		RetentionBatchSize:  getIntEnv("RETENTION_BATCH_SIZE", 1000),
 	}
 
-	log.Printf("Config loaded: Workers=%d", config.Workers)
+	log.Printf("Config loaded: Workers=%d RetentionDays=%d RetentionMaxPerUser=%d",
+		config.Workers, config.RetentionDays, config.RetentionMaxPerUser)
 	return config
 }
 
@@ -38,3 +115,12 @@ func getIntEnv(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
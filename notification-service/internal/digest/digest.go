@@ -0,0 +1,224 @@
+// Package digest emails users who have been away a summary of their unread notifications
+package digest
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/meetohin/web-chat/notification-service/internal/channel"
+	"github.com/meetohin/web-chat/notification-service/internal/model"
+	"github.com/meetohin/web-chat/notification-service/internal/redis"
+	"github.com/meetohin/web-chat/notification-service/internal/repository"
+	"github.com/meetohin/web-chat/notification-service/internal/templates"
+)
+
+const (
+	pageSize = 500
+	maxItems = 20 // notifications listed in one digest, the rest are only counted
+
+	// templateType holds the digest texts in the template catalog
+	templateType = "digest"
+)
+
+// Config controls who gets a digest and how often. A zero OfflineAfter disables digests.
+type Config struct {
+	Interval     time.Duration // how often users are checked; also the least time between two digests
+	OfflineAfter time.Duration // how long a user has to be away
+	ChatURL      string
+}
+
+// Enabled reports whether digests are configured
+func (c Config) Enabled() bool {
+	return c.OfflineAfter > 0
+}
+
+// Metrics are published at /debug/vars under "digest"
+var metrics = expvar.NewMap("digest")
+
+type Sender struct {
+	repo      *repository.Repository
+	redis     *redis.Client
+	mailer    channel.Mailer
+	templates *templates.Catalog
+	cfg       Config
+	logger    *log.Logger
+}
+
+func New(repo *repository.Repository, redis *redis.Client, mailer channel.Mailer, catalog *templates.Catalog, cfg Config) *Sender {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Hour
+	}
+
+	return &Sender{
+		repo:      repo,
+		redis:     redis,
+		mailer:    mailer,
+		templates: catalog,
+		cfg:       cfg,
+		logger:    log.New(os.Stdout, "Digest: ", log.LstdFlags),
+	}
+}
+
+// Start sends digests every interval until ctx is cancelled
+func (s *Sender) Start(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.RunOnce(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// RunOnce sends a digest to every user who is due one
+func (s *Sender) RunOnce(ctx context.Context) {
+	metrics.Add("runs", 1)
+
+	sent := 0
+	after := ""
+	for ctx.Err() == nil {
+		candidates, err := s.repo.ListDigestCandidates(ctx, after, pageSize)
+		if err != nil {
+			metrics.Add("errors", 1)
+			s.logger.Printf("Failed to list digest candidates: %v", err)
+			return
+		}
+
+		for _, candidate := range candidates {
+			ok, err := s.send(ctx, candidate)
+			if err != nil {
+				metrics.Add("errors", 1)
+				s.logger.Printf("Failed to send digest to %s: %v", candidate.UserID, err)
+			}
+			if ok {
+				sent++
+			}
+		}
+
+		if len(candidates) < pageSize {
+			break
+		}
+		after = candidates[len(candidates)-1].UserID
+	}
+
+	if sent > 0 {
+		s.logger.Printf("Sent %d digests", sent)
+	}
+}
+
+// send emails the user a digest if they have been away long enough and want one
+func (s *Sender) send(ctx context.Context, candidate repository.DigestCandidate) (bool, error) {
+	now := time.Now()
+	// Half an interval, so ticker jitter does not skip a round but two instances do not both send
+	if candidate.LastDigest != nil && now.Sub(*candidate.LastDigest) < s.cfg.Interval/2 {
+		return false, nil
+	}
+
+	lastSeen, known, err := s.redis.LastSeen(ctx, candidate.UserID)
+	if err != nil {
+		return false, err
+	}
+	// Users who never connected since presence is tracked could be online right now
+	if !known || now.Sub(lastSeen) < s.cfg.OfflineAfter {
+		return false, nil
+	}
+
+	prefs, err := s.repo.GetPreferences(ctx, candidate.UserID)
+	if err != nil {
+		return false, err
+	}
+	if !prefs.Digest || prefs.Quiet(now) {
+		return false, nil
+	}
+
+	// Only what arrived since the user left or got the last digest
+	since := lastSeen
+	if candidate.LastDigest != nil && candidate.LastDigest.After(since) {
+		since = *candidate.LastDigest
+	}
+	notifications, total, err := s.repo.ListUnreadSince(ctx, candidate.UserID, since, maxItems)
+	if err != nil {
+		return false, err
+	}
+	if total == 0 {
+		return false, nil
+	}
+
+	endpoints, err := s.repo.ListEndpoints(ctx, candidate.UserID, model.ChannelEmail)
+	if err != nil || len(endpoints) == 0 {
+		return false, err
+	}
+
+	claimed, err := s.repo.ClaimDigest(ctx, candidate.UserID, candidate.LastDigest)
+	if err != nil || !claimed {
+		return false, err
+	}
+
+	vars := map[string]string{"count": strconv.Itoa(total), "chat_url": s.cfg.ChatURL}
+	subject, err := s.templates.Render(prefs.Locale, templateType, templates.FieldEmailSubject, vars)
+	if err != nil {
+		return false, err
+	}
+	body, err := s.body(prefs.Locale, notifications, total, vars)
+	if err != nil {
+		return false, err
+	}
+	for _, endpoint := range endpoints {
+		if err := s.mailer.Send(endpoint.Address, subject, body, ""); err != nil {
+			metrics.Add("failed", 1)
+			return false, err
+		}
+	}
+	metrics.Add("sent", 1)
+	return true, nil
+}
+
+// body lists the notifications between the intro, more and footer texts of the user's locale
+func (s *Sender) body(locale string, notifications []*model.Notification, total int, vars map[string]string) (string, error) {
+	text := func(field string) (string, error) {
+		return s.templates.Render(locale, templateType, field, vars)
+	}
+
+	intro, err := text("intro")
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n\n", intro)
+	for _, n := range notifications {
+		fmt.Fprintf(&b, "- %s (%s)\n  %s\n", n.Title, n.CreatedAt.UTC().Format("2006-01-02 15:04 MST"), n.Message)
+	}
+	if listed := countOf(notifications); total > listed {
+		vars["more"] = strconv.Itoa(total - listed)
+		more, err := text("more")
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "\n%s\n", more)
+	}
+	footer, err := text("footer")
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(&b, "\n%s\n", footer)
+	return b.String(), nil
+}
+
+// countOf returns how many notifications the listed ones fold together
+func countOf(notifications []*model.Notification) int {
+	n := 0
+	for _, notification := range notifications {
+		n += notification.Count
+	}
+	return n
+}
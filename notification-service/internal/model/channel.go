@@ -0,0 +1,54 @@
+package model
+
+import "time"
+
+// Delivery channels besides the in-app WebSocket notification
+const (
+	ChannelEmail   = "email"
+	ChannelWebhook = "webhook"
+	ChannelPush    = "push"
+)
+
+// Channels lists the delivery channels in the order they are tried
+var Channels = []string{ChannelEmail, ChannelWebhook, ChannelPush}
+
+// Types lists the notification types users can configure
+var Types = []string{TypeMessage, TypeMention, TypeDirectMessage}
+
+// Delivery states
+const (
+	DeliverySent   = "sent"
+	DeliveryFailed = "failed"
+)
+
+// Endpoint is where a user receives notifications on a channel: an email address,
+// a webhook URL or a Web Push subscription
+type Endpoint struct {
+	ID        int64     `json:"id"`
+	UserID    string    `json:"-"`
+	Channel   string    `json:"channel"`
+	Address   string    `json:"address"` // email address, webhook URL or push endpoint
+	Secret    string    `json:"-"`       // webhook signing secret
+	P256dh    string    `json:"-"`       // push subscription public key
+	Auth      string    `json:"-"`       // push subscription authentication secret
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Delivery is the outcome of sending a notification to one endpoint
+type Delivery struct {
+	NotificationID string    `json:"notification_id"`
+	Channel        string    `json:"channel"`
+	Address        string    `json:"address"`
+	Status         string    `json:"status"`
+	Error          string    `json:"error,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// DefaultChannelEnabled reports whether a channel is used for a notification type
+// when the user has not chosen otherwise. Every chat message would be too many emails.
+func DefaultChannelEnabled(channel, notificationType string) bool {
+	if channel == ChannelEmail {
+		return notificationType != TypeMessage
+	}
+	return true
+}
@@ -11,27 +11,50 @@ type Notification struct {
 	Title     string    `json:"title" db:"title"`
 	Message   string    `json:"message" db:"message"`
 	Type      string    `json:"type" db:"type"`
+	Sender    string    `json:"sender,omitempty" db:"sender"`
+	Count     int       `json:"count" db:"count"` // notifications folded into this one
 	IsRead    bool      `json:"is_read" db:"is_read"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
+
+	// Template variables and locale the notification was rendered with, for channels to render their variants
+	Variables map[string]string `json:"-" db:"-"`
+	Locale    string            `json:"-" db:"-"`
 }
 
 type NotificationRequest struct {
-	UserID  string `json:"user_id"`
-	Title   string `json:"title"`
-	Message string `json:"message"`
-	Type    string `json:"type,omitempty"`
+	UserID string `json:"user_id"`
+	// Title and Message are rendered from the templates of Type in the user's locale when
+	// left empty; Variables are the values the templates use, e.g. "sender" and "text"
+	Title     string            `json:"title,omitempty"`
+	Message   string            `json:"message,omitempty"`
+	Variables map[string]string `json:"variables,omitempty"`
+	Type      string            `json:"type,omitempty"`
+	Sender    string            `json:"sender,omitempty"` // user whose action caused the notification
+	// IdempotencyKey identifies the event; a user gets one notification per key
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
 }
 
 func (n *NotificationRequest) Validate() error {
 	if n.UserID == "" {
 		return errors.New("user_id is required")
 	}
-	if n.Title == "" {
+	if n.Title == "" && len(n.Variables) == 0 {
 		return errors.New("title is required")
 	}
-	if n.Message == "" {
+	if n.Message == "" && len(n.Variables) == 0 {
 		return errors.New("message is required")
 	}
+	if len(n.Variables) > MaxVariables {
+		return errors.New("too many variables")
+	}
+	for name, value := range n.Variables {
+		if len(name) > 50 || len(value) > 5000 {
+			return errors.New("variable " + name + " is too long")
+		}
+	}
+	if len(n.IdempotencyKey) > 200 {
+		return errors.New("idempotency_key is too long")
+	}
 	if n.Type == "" {
 		n.Type = "message"
 	}
@@ -43,6 +66,9 @@ type WebSocketMessage struct {
 	Data Notification `json:"data"`
 }
 
+// MaxVariables limits the template variables of a request
+const MaxVariables = 20
+
 // Константы
 const (
 	TypeMessage       = "message"
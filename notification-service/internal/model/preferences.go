@@ -0,0 +1,113 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MaxMutedSenders limits how many senders a user can mute
+const MaxMutedSenders = 200
+
+// Preferences controls which notifications reach a user and how
+type Preferences struct {
+	Types        map[string]bool            `json:"types"`    // notification types the user receives
+	Channels     map[string]map[string]bool `json:"channels"` // channels used per notification type
+	MutedSenders []string                   `json:"muted_senders"`
+	QuietHours   *QuietHours                `json:"quiet_hours"` // nil when do-not-disturb is off
+	Digest       bool                       `json:"digest"`      // email a digest of unread notifications while away
+	Locale       string                     `json:"locale"`      // language of notification texts, empty for the default
+}
+
+// QuietHours is a daily do-not-disturb period in the user's time zone. Notifications are
+// still stored, but are neither shown in real time nor delivered on other channels.
+type QuietHours struct {
+	Start    string `json:"start"` // HH:MM
+	End      string `json:"end"`   // HH:MM, before Start for periods that span midnight
+	TimeZone string `json:"time_zone"`
+}
+
+// Receives reports whether the user wants notifications of a type stored at all
+func (p *Preferences) Receives(notificationType string) bool {
+	enabled, ok := p.Types[notificationType]
+	return !ok || enabled
+}
+
+// ChannelEnabled reports whether a channel is used for a notification type
+func (p *Preferences) ChannelEnabled(notificationType, channel string) bool {
+	enabled, ok := p.Channels[notificationType][channel]
+	if !ok {
+		return DefaultChannelEnabled(channel, notificationType)
+	}
+	return enabled
+}
+
+// Muted reports whether the user muted a sender
+func (p *Preferences) Muted(sender string) bool {
+	if sender == "" {
+		return false
+	}
+	for _, muted := range p.MutedSenders {
+		if muted == sender {
+			return true
+		}
+	}
+	return false
+}
+
+// Quiet reports whether t falls into the user's quiet hours
+func (p *Preferences) Quiet(t time.Time) bool {
+	if p.QuietHours == nil {
+		return false
+	}
+	return p.QuietHours.Contains(t)
+}
+
+// Validate checks the times and the time zone
+func (q *QuietHours) Validate() error {
+	if _, err := parseClock(q.Start); err != nil {
+		return fmt.Errorf("invalid start: %w", err)
+	}
+	if _, err := parseClock(q.End); err != nil {
+		return fmt.Errorf("invalid end: %w", err)
+	}
+	if q.Start == q.End {
+		return errors.New("start and end must differ")
+	}
+	if _, err := time.LoadLocation(q.TimeZone); err != nil || q.TimeZone == "" {
+		return fmt.Errorf("unknown time zone %q", q.TimeZone)
+	}
+	return nil
+}
+
+// Contains reports whether t is within the quiet hours. Invalid settings never match.
+func (q *QuietHours) Contains(t time.Time) bool {
+	start, err := parseClock(q.Start)
+	if err != nil {
+		return false
+	}
+	end, err := parseClock(q.End)
+	if err != nil {
+		return false
+	}
+	location, err := time.LoadLocation(q.TimeZone)
+	if err != nil {
+		return false
+	}
+
+	local := t.In(location)
+	now := local.Hour()*60 + local.Minute()
+	if start < end {
+		return now >= start && now < end
+	}
+	return now >= start || now < end
+}
+
+// parseClock returns the minutes since midnight of an HH:MM time
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, errors.New("time must be HH:MM")
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
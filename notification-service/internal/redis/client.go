@@ -73,17 +73,35 @@ func (c *Client) Dequeue(ctx context.Context, queue string, timeout time.Duratio
 	return []byte(result[1]), nil
 }
 
-func (c *Client) Publish(ctx context.Context, channel string, data interface{}) error {
+// Publish sends data as JSON to a channel and returns how many subscribers received it
+func (c *Client) Publish(ctx context.Context, channel string, data interface{}) (int64, error) {
 	if ctx.Err() != nil {
-		return ctx.Err()
+		return 0, ctx.Err()
 	}
 
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return 0, err
+	}
+
+	return c.rdb.Publish(ctx, channel, jsonData).Result()
+}
+
+// PushCapped adds data as JSON to the head of a list that keeps its newest max entries
+// and expires ttl after the last push
+func (c *Client) PushCapped(ctx context.Context, key string, data interface{}, max int64, ttl time.Duration) error {
 	jsonData, err := json.Marshal(data)
 	if err != nil {
 		return err
 	}
 
-	return c.rdb.Publish(ctx, channel, jsonData).Err()
+	_, err = c.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(ctx, key, jsonData)
+		pipe.LTrim(ctx, key, 0, max-1)
+		pipe.Expire(ctx, key, ttl)
+		return nil
+	})
+	return err
 }
 
 func (c *Client) QueueSize(ctx context.Context, queue string) (int64, error) {
@@ -93,3 +111,20 @@ func (c *Client) QueueSize(ctx context.Context, queue string) (int64, error) {
 
 	return c.rdb.LLen(ctx, queue).Result()
 }
+
+// presenceKey is the sorted set in which chat-service scores users by the Unix time
+// they were last connected
+const presenceKey = "presence:last_seen"
+
+// LastSeen returns when the user was last connected to the chat. It reports false
+// for users chat-service has not seen since it started tracking presence.
+func (c *Client) LastSeen(ctx context.Context, username string) (time.Time, bool, error) {
+	score, err := c.rdb.ZScore(ctx, presenceKey, username).Result()
+	if err == redis.Nil {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return time.Unix(int64(score), 0), true, nil
+}
@@ -0,0 +1,142 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// DequeueTo atomically moves the oldest entry of queue to the head of processing and
+// returns it. The entry stays in processing until it is acknowledged with Ack, so it
+// survives a crash of the consumer.
+func (c *Client) DequeueTo(ctx context.Context, queue, processing string, timeout time.Duration) ([]byte, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	result, err := c.rdb.BLMove(ctx, queue, processing, "RIGHT", "LEFT", timeout).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil // Timeout
+		}
+		return nil, err
+	}
+
+	return []byte(result), nil
+}
+
+// Ack removes a processed entry from the processing list
+func (c *Client) Ack(ctx context.Context, processing string, data []byte) error {
+	return c.rdb.LRem(ctx, processing, 1, data).Err()
+}
+
+// Requeue moves every entry of list back to be consumed next from queue and returns how many were moved
+func (c *Client) Requeue(ctx context.Context, list, queue string) (int, error) {
+	moved := 0
+	for {
+		err := c.rdb.LMove(ctx, list, queue, "LEFT", "RIGHT").Err()
+		if err == redis.Nil {
+			return moved, nil
+		}
+		if err != nil {
+			return moved, err
+		}
+		moved++
+	}
+}
+
+// Move moves up to limit entries from the tail of one list to the head of another,
+// one at a time and atomically each. A limit of 0 moves all of them.
+func (c *Client) Move(ctx context.Context, from, to string, limit int) (int, error) {
+	moved := 0
+	for limit <= 0 || moved < limit {
+		err := c.rdb.LMove(ctx, from, to, "RIGHT", "LEFT").Err()
+		if err == redis.Nil {
+			break
+		}
+		if err != nil {
+			return moved, err
+		}
+		moved++
+	}
+	return moved, nil
+}
+
+// Schedule adds data to a sorted set of delayed entries, due at the given time
+func (c *Client) Schedule(ctx context.Context, key string, data []byte, at time.Time) error {
+	return c.rdb.ZAdd(ctx, key, &redis.Z{Score: float64(at.UnixMilli()), Member: data}).Err()
+}
+
+// enqueueDueScript moves due entries from a sorted set onto a list in one step, so an
+// entry is never lost between the two or requeued by two instances
+var enqueueDueScript = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, member in ipairs(due) do
+	redis.call('ZREM', KEYS[1], member)
+	redis.call('LPUSH', KEYS[2], member)
+end
+return #due
+`)
+
+// EnqueueDue moves up to limit due entries of a sorted set created by Schedule onto queue
+func (c *Client) EnqueueDue(ctx context.Context, key, queue string, limit int64) (int, error) {
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	moved, err := enqueueDueScript.Run(ctx, c.rdb, []string{key, queue}, now, limit).Int()
+	if err != nil {
+		return 0, err
+	}
+	return moved, nil
+}
+
+// PushRaw adds already encoded data to the head of a list
+func (c *Client) PushRaw(ctx context.Context, list string, data []byte) error {
+	return c.rdb.LPush(ctx, list, data).Err()
+}
+
+// Range returns the entries of a list between start and stop, as LRANGE does
+func (c *Client) Range(ctx context.Context, list string, start, stop int64) ([]string, error) {
+	return c.rdb.LRange(ctx, list, start, stop).Result()
+}
+
+// Heartbeat marks a consumer as alive for ttl
+func (c *Client) Heartbeat(ctx context.Context, key string, ttl time.Duration) error {
+	return c.rdb.Set(ctx, key, time.Now().Unix(), ttl).Err()
+}
+
+// Alive reports whether a heartbeat key has not expired
+func (c *Client) Alive(ctx context.Context, key string) (bool, error) {
+	return c.Exists(ctx, key)
+}
+
+// Keys returns the keys matching pattern, scanning instead of blocking Redis with KEYS
+func (c *Client) Keys(ctx context.Context, pattern string) ([]string, error) {
+	var keys []string
+	iter := c.rdb.Scan(ctx, 0, pattern, 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	return keys, iter.Err()
+}
+
+// SortedSetSize returns the number of entries of a sorted set
+func (c *Client) SortedSetSize(ctx context.Context, key string) (int64, error) {
+	return c.rdb.ZCard(ctx, key).Result()
+}
+
+// Exists reports whether a key exists
+func (c *Client) Exists(ctx context.Context, key string) (bool, error) {
+	n, err := c.rdb.Exists(ctx, key).Result()
+	return n > 0, err
+}
+
+// Members returns the members of a set
+func (c *Client) Members(ctx context.Context, key string) ([]string, error) {
+	return c.rdb.SMembers(ctx, key).Result()
+}
+
+// SetExpiring creates a marker key that expires after ttl
+func (c *Client) SetExpiring(ctx context.Context, key string, ttl time.Duration) error {
+	return c.rdb.Set(ctx, key, 1, ttl).Err()
+}
@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/meetohin/web-chat/notification-service/internal/model"
+)
+
+// ListEndpoints returns the user's endpoints on a channel, or on all channels if channel is empty
+func (r *Repository) ListEndpoints(ctx context.Context, userID, channel string) ([]*model.Endpoint, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT id, user_id, channel, address, secret, p256dh, auth, created_at
+        FROM notification_endpoints
+        WHERE user_id = $1 AND ($2 = '' OR channel = $2)
+        ORDER BY channel, id`, userID, channel)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var endpoints []*model.Endpoint
+	for rows.Next() {
+		e := &model.Endpoint{}
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Channel, &e.Address, &e.Secret, &e.P256dh, &e.Auth, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, e)
+	}
+	return endpoints, rows.Err()
+}
+
+// GetEndpoint returns one of the user's endpoints, or nil if it no longer exists
+func (r *Repository) GetEndpoint(ctx context.Context, userID string, id int64) (*model.Endpoint, error) {
+	e := &model.Endpoint{}
+	err := r.db.QueryRowContext(ctx, `
+        SELECT id, user_id, channel, address, secret, p256dh, auth, created_at
+        FROM notification_endpoints
+        WHERE user_id = $1 AND id = $2`, userID, id,
+	).Scan(&e.ID, &e.UserID, &e.Channel, &e.Address, &e.Secret, &e.P256dh, &e.Auth, &e.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return e, err
+}
+
+// SaveEndpoint adds an endpoint or updates the keys of an existing one with the same address.
+// A push subscription belongs to one browser, so it is taken away from any other user.
+func (r *Repository) SaveEndpoint(ctx context.Context, e *model.Endpoint) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if e.Channel == model.ChannelPush {
+		_, err := tx.ExecContext(ctx,
+			`DELETE FROM notification_endpoints WHERE channel = $1 AND address = $2 AND user_id <> $3`,
+			e.Channel, e.Address, e.UserID)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.QueryRowContext(ctx, `
+        INSERT INTO notification_endpoints (user_id, channel, address, secret, p256dh, auth, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, NOW())
+        ON CONFLICT (user_id, channel, address)
+        DO UPDATE SET secret = EXCLUDED.secret, p256dh = EXCLUDED.p256dh, auth = EXCLUDED.auth
+        RETURNING id, created_at`,
+		e.UserID, e.Channel, e.Address, e.Secret, e.P256dh, e.Auth,
+	).Scan(&e.ID, &e.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteEndpoint removes one of the user's endpoints
+func (r *Repository) DeleteEndpoint(ctx context.Context, userID string, id int64) (bool, error) {
+	result, err := r.db.ExecContext(ctx,
+		`DELETE FROM notification_endpoints WHERE user_id = $1 AND id = $2`, userID, id)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+// DeleteUserEndpoint removes the user's endpoint with an address, e.g. when a browser unsubscribes
+func (r *Repository) DeleteUserEndpoint(ctx context.Context, userID, channel, address string) (bool, error) {
+	result, err := r.db.ExecContext(ctx,
+		`DELETE FROM notification_endpoints WHERE user_id = $1 AND channel = $2 AND address = $3`,
+		userID, channel, address)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+// ChannelPreferences returns the channels the user turned on or off, by notification type
+func (r *Repository) ChannelPreferences(ctx context.Context, userID string) (map[string]map[string]bool, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT type, channel, enabled FROM notification_channel_preferences WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	prefs := make(map[string]map[string]bool)
+	for rows.Next() {
+		var notificationType, channel string
+		var enabled bool
+		if err := rows.Scan(&notificationType, &channel, &enabled); err != nil {
+			return nil, err
+		}
+		if prefs[notificationType] == nil {
+			prefs[notificationType] = make(map[string]bool)
+		}
+		prefs[notificationType][channel] = enabled
+	}
+	return prefs, rows.Err()
+}
+
+// SetChannelPreference turns a channel on or off for a notification type
+func (r *Repository) SetChannelPreference(ctx context.Context, userID, notificationType, channel string, enabled bool) error {
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO notification_channel_preferences (user_id, type, channel, enabled)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (user_id, type, channel) DO UPDATE SET enabled = EXCLUDED.enabled`,
+		userID, notificationType, channel, enabled)
+	return err
+}
+
+// RecordDelivery stores the outcome of sending a notification to an endpoint
+func (r *Repository) RecordDelivery(ctx context.Context, d *model.Delivery) error {
+	return r.db.QueryRowContext(ctx, `
+        INSERT INTO notification_deliveries (notification_id, channel, address, status, error, created_at)
+        VALUES ($1, $2, $3, $4, $5, NOW())
+        RETURNING created_at`,
+		d.NotificationID, d.Channel, d.Address, d.Status, d.Error,
+	).Scan(&d.CreatedAt)
+}
+
+// ListDeliveries returns the deliveries of one of the user's notifications
+func (r *Repository) ListDeliveries(ctx context.Context, userID, notificationID string) ([]*model.Delivery, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT d.notification_id, d.channel, d.address, d.status, d.error, d.created_at
+        FROM notification_deliveries d
+        JOIN notifications n ON n.id = d.notification_id
+        WHERE n.user_id = $1 AND d.notification_id = $2
+        ORDER BY d.id`, userID, notificationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*model.Delivery
+	for rows.Next() {
+		d := &model.Delivery{}
+		if err := rows.Scan(&d.NotificationID, &d.Channel, &d.Address, &d.Status, &d.Error, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/meetohin/web-chat/notification-service/internal/model"
+)
+
+// SaveCoalesced folds the request into the user's newest unread notification of the same
+// type from the same sender if that one changed within window, and stores it as a new
+// notification otherwise. title returns the title of a notification that folds count
+// notifications. It reports whether an existing notification was updated, and fails with
+// ErrDuplicate if the request's idempotency key was stored before.
+func (r *Repository) SaveCoalesced(ctx context.Context, req *model.NotificationRequest, window time.Duration, title func(count int) string) (*model.Notification, bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	// Serializes workers handling notifications for the same user and sender, so
+	// concurrent messages end up in one notification
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`,
+		req.UserID+"\x00"+req.Type+"\x00"+req.Sender); err != nil {
+		return nil, false, err
+	}
+
+	notification := &model.Notification{}
+	err = tx.QueryRowContext(ctx, `
+        SELECT id, user_id, title, message, type, sender, count, is_read, created_at
+        FROM notifications
+        WHERE user_id = $1 AND type = $2 AND sender = $3 AND is_read = FALSE
+          AND COALESCE(updated_at, created_at) > $4
+        ORDER BY created_at DESC
+        LIMIT 1`,
+		req.UserID, req.Type, req.Sender, time.Now().Add(-window),
+	).Scan(
+		&notification.ID,
+		&notification.UserID,
+		&notification.Title,
+		&notification.Message,
+		&notification.Type,
+		&notification.Sender,
+		&notification.Count,
+		&notification.IsRead,
+		&notification.CreatedAt,
+	)
+	coalesced := err == nil
+	switch {
+	case coalesced:
+		notification.Count++
+		notification.Title = title(notification.Count)
+		notification.Message = req.Message
+		_, err = tx.ExecContext(ctx, `
+            UPDATE notifications SET count = $2, title = $3, message = $4, updated_at = NOW()
+            WHERE id = $1`,
+			notification.ID, notification.Count, notification.Title, notification.Message)
+	case err == sql.ErrNoRows:
+		notification, err = insertNotification(ctx, tx, req)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if err := claimIdempotencyKey(ctx, tx, req, notification.ID); err != nil {
+		return nil, false, err
+	}
+
+	return notification, coalesced, tx.Commit()
+}
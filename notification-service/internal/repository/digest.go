@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/meetohin/web-chat/notification-service/internal/model"
+)
+
+// DigestCandidate is a user with an email endpoint and unread notifications newer than their last digest
+type DigestCandidate struct {
+	UserID     string
+	LastDigest *time.Time // nil if the user never got a digest
+}
+
+// ListDigestCandidates returns up to limit candidates with user IDs above afterUserID, in user ID order
+func (r *Repository) ListDigestCandidates(ctx context.Context, afterUserID string, limit int) ([]DigestCandidate, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT e.user_id, d.sent_at
+        FROM (SELECT DISTINCT user_id FROM notification_endpoints WHERE channel = $1) e
+        LEFT JOIN notification_digests d ON d.user_id = e.user_id
+        WHERE e.user_id > $2 AND EXISTS (
+            SELECT 1 FROM notifications n
+            WHERE n.user_id = e.user_id AND n.is_read = FALSE
+              AND COALESCE(n.updated_at, n.created_at) > COALESCE(d.sent_at, 'epoch'))
+        ORDER BY e.user_id
+        LIMIT $3`, model.ChannelEmail, afterUserID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candidates []DigestCandidate
+	for rows.Next() {
+		var c DigestCandidate
+		var sentAt sql.NullTime
+		if err := rows.Scan(&c.UserID, &sentAt); err != nil {
+			return nil, err
+		}
+		if sentAt.Valid {
+			c.LastDigest = &sentAt.Time
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, rows.Err()
+}
+
+// ListUnreadSince returns the user's newest unread notifications created or folded into
+// after since, up to limit, and how many there are in total
+func (r *Repository) ListUnreadSince(ctx context.Context, userID string, since time.Time, limit int) ([]*model.Notification, int, error) {
+	var total int
+	err := r.db.QueryRowContext(ctx, `
+        SELECT COALESCE(SUM(count), 0) FROM notifications
+        WHERE user_id = $1 AND is_read = FALSE AND COALESCE(updated_at, created_at) > $2`, userID, since,
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT id, user_id, title, message, type, sender, count, is_read, created_at
+        FROM notifications
+        WHERE user_id = $1 AND is_read = FALSE AND COALESCE(updated_at, created_at) > $2
+        ORDER BY COALESCE(updated_at, created_at) DESC
+        LIMIT $3`, userID, since, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var notifications []*model.Notification
+	for rows.Next() {
+		n := &model.Notification{}
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Title, &n.Message, &n.Type, &n.Sender, &n.Count, &n.IsRead, &n.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, total, rows.Err()
+}
+
+// ClaimDigest records that a digest is being sent to the user now. It fails to claim,
+// returning false, if another instance sent one since lastDigest was read.
+func (r *Repository) ClaimDigest(ctx context.Context, userID string, lastDigest *time.Time) (bool, error) {
+	var previous sql.NullTime
+	if lastDigest != nil {
+		previous = sql.NullTime{Time: *lastDigest, Valid: true}
+	}
+
+	result, err := r.db.ExecContext(ctx, `
+        INSERT INTO notification_digests (user_id, sent_at) VALUES ($1, NOW())
+        ON CONFLICT (user_id) DO UPDATE SET sent_at = NOW()
+        WHERE notification_digests.sent_at = $2`, userID, previous)
+	if err != nil {
+		return false, err
+	}
+	claimed, err := result.RowsAffected()
+	return claimed > 0, err
+}
@@ -3,10 +3,13 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/meetohin/web-chat/notification-service/internal/model"
 )
 
@@ -31,30 +34,125 @@ func (r *Repository) Close() error {
 	return r.db.Close()
 }
 
+// ErrDuplicate is returned when the user already has a notification for the request's idempotency key
+var ErrDuplicate = errors.New("duplicate notification")
+
+// CreateNotification stores a notification. It fails with ErrDuplicate if the request's
+// idempotency key was stored before. The key counts as unpublished until MarkPublished.
 func (r *Repository) CreateNotification(ctx context.Context, req *model.NotificationRequest) (*model.Notification, error) {
 	if ctx.Err() != nil {
 		return nil, ctx.Err()
 	}
+	if req.IdempotencyKey == "" {
+		return insertNotification(ctx, r.db, req)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	notification, err := insertNotification(ctx, tx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := claimIdempotencyKey(ctx, tx, req, notification.ID); err != nil {
+		return nil, err
+	}
+	return notification, tx.Commit()
+}
+
+// claimIdempotencyKey records that the request's key produced the notification.
+// A concurrent claim of the same key waits for this transaction and then fails.
+func claimIdempotencyKey(ctx context.Context, db execer, req *model.NotificationRequest, notificationID string) error {
+	if req.IdempotencyKey == "" {
+		return nil
+	}
+
+	result, err := db.ExecContext(ctx, `
+        INSERT INTO notification_idempotency_keys (user_id, idempotency_key, notification_id, published, created_at)
+        VALUES ($1, $2, $3, FALSE, NOW())
+        ON CONFLICT (user_id, idempotency_key) DO NOTHING`,
+		req.UserID, req.IdempotencyKey, notificationID)
+	if err != nil {
+		return err
+	}
+	claimed, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if claimed == 0 {
+		return ErrDuplicate
+	}
+	return nil
+}
+
+// UnpublishedNotification returns the notification the user's idempotency key produced if
+// it was never published, because its worker died after storing it, and nil otherwise
+func (r *Repository) UnpublishedNotification(ctx context.Context, userID, idempotencyKey string) (*model.Notification, error) {
+	notification := &model.Notification{}
+	err := r.db.QueryRowContext(ctx, `
+        SELECT n.id, n.user_id, n.title, n.message, n.type, n.sender, n.count, n.is_read, n.created_at
+        FROM notification_idempotency_keys k
+        JOIN notifications n ON n.id = k.notification_id
+        WHERE k.user_id = $1 AND k.idempotency_key = $2 AND NOT k.published`,
+		userID, idempotencyKey,
+	).Scan(
+		&notification.ID,
+		&notification.UserID,
+		&notification.Title,
+		&notification.Message,
+		&notification.Type,
+		&notification.Sender,
+		&notification.Count,
+		&notification.IsRead,
+		&notification.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return notification, err
+}
+
+// MarkPublished records that the notification of the user's idempotency key was published
+func (r *Repository) MarkPublished(ctx context.Context, userID, idempotencyKey string) error {
+	_, err := r.db.ExecContext(ctx, `
+        UPDATE notification_idempotency_keys SET published = TRUE
+        WHERE user_id = $1 AND idempotency_key = $2`, userID, idempotencyKey)
+	return err
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func insertNotification(ctx context.Context, db execer, req *model.NotificationRequest) (*model.Notification, error) {
 	notification := &model.Notification{
 		ID:        uuid.New().String(),
 		UserID:    req.UserID,
 		Title:     req.Title,
 		Message:   req.Message,
 		Type:      req.Type,
+		Sender:    req.Sender,
+		Count:     1,
 		IsRead:    false,
 		CreatedAt: time.Now(),
 	}
 
 	query := `
-        INSERT INTO notifications (id, user_id, title, message, type, is_read, created_at)
-        VALUES ($1, $2, $3, $4, $5, $6, $7)`
+        INSERT INTO notifications (id, user_id, title, message, type, sender, count, is_read, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9)`
 
-	_, err := r.db.ExecContext(ctx, query,
+	_, err := db.ExecContext(ctx, query,
 		notification.ID,
 		notification.UserID,
 		notification.Title,
 		notification.Message,
 		notification.Type,
+		notification.Sender,
+		notification.Count,
 		notification.IsRead,
 		notification.CreatedAt,
 	)
@@ -67,7 +165,7 @@ func (r *Repository) GetUserNotifications(ctx context.Context, userID string, li
 		return nil, ctx.Err()
 	}
 	query := `
-        SELECT id, user_id, title, message, type, is_read, created_at
+        SELECT id, user_id, title, message, type, sender, count, is_read, created_at
         FROM notifications 
         WHERE user_id = $1 
         ORDER BY created_at DESC 
@@ -88,6 +186,8 @@ func (r *Repository) GetUserNotifications(ctx context.Context, userID string, li
 			&notification.Title,
 			&notification.Message,
 			&notification.Type,
+			&notification.Sender,
+			&notification.Count,
 			&notification.IsRead,
 			&notification.CreatedAt,
 		)
@@ -100,25 +200,23 @@ func (r *Repository) GetUserNotifications(ctx context.Context, userID string, li
 	return notifications, nil
 }
 
-func (r *Repository) MarkAsRead(ctx context.Context, userID string, notificationIDs []string) error {
+// MarkAsRead marks the user's notifications with the given IDs as read and returns how many changed
+func (r *Repository) MarkAsRead(ctx context.Context, userID string, notificationIDs []string) (int64, error) {
 	if ctx.Err() != nil {
-		return ctx.Err()
+		return 0, ctx.Err()
 	}
 
 	if len(notificationIDs) == 0 {
-		return nil
+		return 0, nil
 	}
 
-	query := `UPDATE notifications SET is_read = TRUE WHERE user_id = $1 AND id = $2`
+	query := `UPDATE notifications SET is_read = TRUE WHERE user_id = $1 AND id = ANY($2::uuid[]) AND is_read = FALSE`
 
-	for _, id := range notificationIDs {
-		_, err := r.db.ExecContext(ctx, query, userID, id)
-		if err != nil {
-			return err
-		}
+	result, err := r.db.ExecContext(ctx, query, userID, pq.Array(notificationIDs))
+	if err != nil {
+		return 0, err
 	}
-
-	return nil
+	return result.RowsAffected()
 }
 
 func (r *Repository) GetUnreadCount(ctx context.Context, userID string) (int, error) {
@@ -127,3 +225,121 @@ func (r *Repository) GetUnreadCount(ctx context.Context, userID string) (int, er
 	err := r.db.QueryRowContext(ctx, query, userID).Scan(&count)
 	return count, err
 }
+
+// ListOptions selects a page of a user's notifications, newest first
+type ListOptions struct {
+	Limit      int
+	UnreadOnly bool
+	Type       string // empty for all types
+	// Continue after this notification, taken from the last one of the previous page
+	BeforeTime time.Time
+	BeforeID   string
+}
+
+// ListNotifications returns a page of the user's notifications
+func (r *Repository) ListNotifications(ctx context.Context, userID string, opts ListOptions) ([]*model.Notification, error) {
+	conditions := []string{"user_id = $1"}
+	args := []interface{}{userID}
+
+	if opts.UnreadOnly {
+		conditions = append(conditions, "is_read = FALSE")
+	}
+	if opts.Type != "" {
+		args = append(args, opts.Type)
+		conditions = append(conditions, fmt.Sprintf("type = $%d", len(args)))
+	}
+	if !opts.BeforeTime.IsZero() {
+		args = append(args, opts.BeforeTime, opts.BeforeID)
+		conditions = append(conditions, fmt.Sprintf("(created_at, id) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+	args = append(args, opts.Limit)
+
+	query := fmt.Sprintf(`
+        SELECT id, user_id, title, message, type, sender, count, is_read, created_at
+        FROM notifications
+        WHERE %s
+        ORDER BY created_at DESC, id DESC
+        LIMIT $%d`, strings.Join(conditions, " AND "), len(args))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []*model.Notification
+	for rows.Next() {
+		notification := &model.Notification{}
+		err := rows.Scan(
+			&notification.ID,
+			&notification.UserID,
+			&notification.Title,
+			&notification.Message,
+			&notification.Type,
+			&notification.Sender,
+			&notification.Count,
+			&notification.IsRead,
+			&notification.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, notification)
+	}
+
+	return notifications, rows.Err()
+}
+
+// MarkAllAsRead marks every unread notification of the user as read
+func (r *Repository) MarkAllAsRead(ctx context.Context, userID string) (int64, error) {
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE notifications SET is_read = TRUE WHERE user_id = $1 AND is_read = FALSE`, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// DeleteNotifications deletes the user's notifications with the given IDs
+func (r *Repository) DeleteNotifications(ctx context.Context, userID string, notificationIDs []string) (int64, error) {
+	if len(notificationIDs) == 0 {
+		return 0, nil
+	}
+
+	result, err := r.db.ExecContext(ctx,
+		`DELETE FROM notifications WHERE user_id = $1 AND id = ANY($2::uuid[])`, userID, pq.Array(notificationIDs))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// DeleteAllNotifications deletes every notification of the user
+func (r *Repository) DeleteAllNotifications(ctx context.Context, userID string) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM notifications WHERE user_id = $1`, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetUnreadCountsByType returns the number of unread notifications of each type
+func (r *Repository) GetUnreadCountsByType(ctx context.Context, userID string) (map[string]int, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT type, COUNT(*) FROM notifications WHERE user_id = $1 AND is_read = FALSE GROUP BY type`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var notificationType string
+		var count int
+		if err := rows.Scan(&notificationType, &count); err != nil {
+			return nil, err
+		}
+		counts[notificationType] = count
+	}
+	return counts, rows.Err()
+}
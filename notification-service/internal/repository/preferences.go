@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+	"github.com/meetohin/web-chat/notification-service/internal/model"
+)
+
+// querier runs single-row queries on the database or in a transaction
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// GetPreferences returns the user's notification preferences; users who never changed
+// them get empty preferences, which use the defaults
+func (r *Repository) GetPreferences(ctx context.Context, userID string) (*model.Preferences, error) {
+	return getPreferences(ctx, r.db, userID)
+}
+
+// getPreferences loads all of the user's preferences in one query, the worker needs them
+// for every notification
+func getPreferences(ctx context.Context, db querier, userID string) (*model.Preferences, error) {
+	prefs := &model.Preferences{
+		Types:    make(map[string]bool),
+		Channels: make(map[string]map[string]bool),
+	}
+
+	var disabled, channelTypes, channels []string
+	var enabled []bool
+	var start, end, timeZone sql.NullString
+	err := db.QueryRowContext(ctx, `
+        SELECT p.disabled_types, p.quiet_start, p.quiet_end, p.time_zone,
+               COALESCE(p.digest, TRUE), COALESCE(p.locale, ''),
+               ARRAY(SELECT sender FROM notification_muted_senders WHERE user_id = u.id ORDER BY sender),
+               ARRAY(SELECT type FROM notification_channel_preferences WHERE user_id = u.id ORDER BY type, channel),
+               ARRAY(SELECT channel FROM notification_channel_preferences WHERE user_id = u.id ORDER BY type, channel),
+               ARRAY(SELECT enabled FROM notification_channel_preferences WHERE user_id = u.id ORDER BY type, channel)
+        FROM (SELECT $1::text AS id) u
+        LEFT JOIN notification_preferences p ON p.user_id = u.id`, userID,
+	).Scan(pq.Array(&disabled), &start, &end, &timeZone, &prefs.Digest, &prefs.Locale,
+		pq.Array(&prefs.MutedSenders), pq.Array(&channelTypes), pq.Array(&channels), pq.Array(&enabled))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, notificationType := range disabled {
+		prefs.Types[notificationType] = false
+	}
+	if start.Valid && end.Valid && timeZone.Valid {
+		prefs.QuietHours = &model.QuietHours{Start: start.String, End: end.String, TimeZone: timeZone.String}
+	}
+	if len(prefs.MutedSenders) == 0 {
+		prefs.MutedSenders = nil
+	}
+	for i, notificationType := range channelTypes {
+		if prefs.Channels[notificationType] == nil {
+			prefs.Channels[notificationType] = make(map[string]bool)
+		}
+		prefs.Channels[notificationType][channels[i]] = enabled[i]
+	}
+	return prefs, nil
+}
+
+// UpdatePreferences loads the user's preferences, lets update change them and saves them.
+// The user's preferences are locked meanwhile, so concurrent updates do not overwrite
+// each other's changes. Nothing is saved if update fails.
+func (r *Repository) UpdatePreferences(ctx context.Context, userID string, update func(prefs *model.Preferences) error) (*model.Preferences, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Users without saved preferences get the default row, so there is a row to lock
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO notification_preferences (user_id) VALUES ($1) ON CONFLICT (user_id) DO NOTHING`, userID)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx,
+		`SELECT 1 FROM notification_preferences WHERE user_id = $1 FOR UPDATE`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	prefs, err := getPreferences(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := update(prefs); err != nil {
+		return nil, err
+	}
+	if err := savePreferences(ctx, tx, userID, prefs); err != nil {
+		return nil, err
+	}
+	return prefs, tx.Commit()
+}
+
+// savePreferences replaces all of the user's notification preferences
+func savePreferences(ctx context.Context, tx *sql.Tx, userID string, prefs *model.Preferences) error {
+	disabled := []string{}
+	for notificationType, enabled := range prefs.Types {
+		if !enabled {
+			disabled = append(disabled, notificationType)
+		}
+	}
+	var start, end, timeZone sql.NullString
+	if q := prefs.QuietHours; q != nil {
+		start = sql.NullString{String: q.Start, Valid: true}
+		end = sql.NullString{String: q.End, Valid: true}
+		timeZone = sql.NullString{String: q.TimeZone, Valid: true}
+	}
+
+	_, err := tx.ExecContext(ctx, `
+        INSERT INTO notification_preferences (user_id, disabled_types, quiet_start, quiet_end, time_zone, digest, locale, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+        ON CONFLICT (user_id) DO UPDATE SET
+            disabled_types = EXCLUDED.disabled_types, quiet_start = EXCLUDED.quiet_start,
+            quiet_end = EXCLUDED.quiet_end, time_zone = EXCLUDED.time_zone,
+            digest = EXCLUDED.digest, locale = EXCLUDED.locale, updated_at = NOW()`,
+		userID, pq.Array(disabled), start, end, timeZone, prefs.Digest, prefs.Locale)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM notification_muted_senders WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if len(prefs.MutedSenders) > 0 {
+		_, err := tx.ExecContext(ctx, `
+            INSERT INTO notification_muted_senders (user_id, sender)
+            SELECT $1, unnest($2::text[]) ON CONFLICT DO NOTHING`,
+			userID, pq.Array(prefs.MutedSenders))
+		if err != nil {
+			return err
+		}
+	}
+
+	for notificationType, channels := range prefs.Channels {
+		for channel, enabled := range channels {
+			_, err := tx.ExecContext(ctx, `
+                INSERT INTO notification_channel_preferences (user_id, type, channel, enabled)
+                VALUES ($1, $2, $3, $4)
+                ON CONFLICT (user_id, type, channel) DO UPDATE SET enabled = EXCLUDED.enabled`,
+				userID, notificationType, channel, enabled)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
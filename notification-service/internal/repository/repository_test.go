@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meetohin/web-chat/notification-service/internal/model"
+)
+
+// newTestRepository migrates a schema of its own in the Postgres database of
+// TEST_DATABASE_URL, e.g. postgres://localhost/notifications_test?sslmode=disable,
+// and drops it after the test. Tests are skipped without the variable.
+func newTestRepository(t *testing.T) *Repository {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	admin, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := "test_" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+	// lib/pq passes unknown parameters on as run-time parameters
+	separator := "?"
+	if strings.Contains(url, "?") {
+		separator = "&"
+	}
+	repo, err := New(url + separator + "search_path=" + schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	if err := repo.Migrate(context.Background(), "../../migrations"); err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func TestMigrateTwice(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	// Applied migrations are skipped, so restarts leave the schema alone
+	if err := repo.Migrate(ctx, "../../migrations"); err != nil {
+		t.Fatalf("second Migrate: %v", err)
+	}
+	var applied int
+	if err := repo.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM schema_migrations").Scan(&applied); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob("../../migrations/*.sql")
+	if applied != len(files) {
+		t.Errorf("%d migrations recorded, want %d", applied, len(files))
+	}
+}
+
+func request(userID, sender, key, text string) *model.NotificationRequest {
+	return &model.NotificationRequest{
+		UserID:         userID,
+		Title:          "New message from " + sender,
+		Message:        text,
+		Type:           model.TypeMessage,
+		Sender:         sender,
+		IdempotencyKey: key,
+	}
+}
+
+func countTitle(count int) string {
+	return fmt.Sprintf("%d new messages", count)
+}
+
+func TestCreateNotificationIdempotency(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	first, err := repo.CreateNotification(ctx, request("alice", "bob", "message:1", "hi"))
+	if err != nil {
+		t.Fatalf("CreateNotification: %v", err)
+	}
+	if _, err := repo.CreateNotification(ctx, request("alice", "bob", "message:1", "hi")); !errors.Is(err, ErrDuplicate) {
+		t.Fatalf("second CreateNotification returned %v, want ErrDuplicate", err)
+	}
+
+	// Keys belong to one user, and requests without a key are never duplicates
+	if _, err := repo.CreateNotification(ctx, request("carol", "bob", "message:1", "hi")); err != nil {
+		t.Errorf("same key for another user: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := repo.CreateNotification(ctx, request("alice", "bob", "", "no key")); err != nil {
+			t.Errorf("request without key: %v", err)
+		}
+	}
+	notifications, err := repo.GetUserNotifications(ctx, "alice", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notifications) != 3 {
+		t.Errorf("alice has %d notifications, want 3", len(notifications))
+	}
+
+	// The duplicate is handed out again until its notification was published
+	unpublished, err := repo.UnpublishedNotification(ctx, "alice", "message:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unpublished == nil || unpublished.ID != first.ID {
+		t.Fatalf("UnpublishedNotification = %+v, want notification %s", unpublished, first.ID)
+	}
+	if err := repo.MarkPublished(ctx, "alice", "message:1"); err != nil {
+		t.Fatal(err)
+	}
+	if unpublished, err := repo.UnpublishedNotification(ctx, "alice", "message:1"); err != nil || unpublished != nil {
+		t.Errorf("UnpublishedNotification after MarkPublished = %+v, %v, want nil", unpublished, err)
+	}
+}
+
+func TestSaveCoalesced(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	first, coalesced, err := repo.SaveCoalesced(ctx, request("alice", "bob", "message:1", "one"), time.Minute, countTitle)
+	if err != nil {
+		t.Fatalf("SaveCoalesced: %v", err)
+	}
+	if coalesced || first.Count != 1 {
+		t.Fatalf("first notification: coalesced %v, count %d", coalesced, first.Count)
+	}
+
+	second, coalesced, err := repo.SaveCoalesced(ctx, request("alice", "bob", "message:2", "two"), time.Minute, countTitle)
+	if err != nil {
+		t.Fatalf("SaveCoalesced: %v", err)
+	}
+	if !coalesced || second.ID != first.ID || second.Count != 2 {
+		t.Fatalf("second notification: coalesced %v, id %s, count %d; want it folded into %s", coalesced, second.ID, second.Count, first.ID)
+	}
+	if second.Title != countTitle(2) || second.Message != "two" {
+		t.Errorf("folded notification has title %q and message %q", second.Title, second.Message)
+	}
+
+	// A redelivered request neither counts twice nor creates a notification
+	if _, _, err := repo.SaveCoalesced(ctx, request("alice", "bob", "message:2", "two"), time.Minute, countTitle); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("duplicate SaveCoalesced returned %v, want ErrDuplicate", err)
+	}
+	if unpublished, err := repo.UnpublishedNotification(ctx, "alice", "message:2"); err != nil || unpublished == nil || unpublished.Count != 2 {
+		t.Errorf("UnpublishedNotification = %+v, %v; want the folded notification", unpublished, err)
+	}
+
+	// Other senders, read notifications and ones outside the window are not folded into
+	other, coalesced, err := repo.SaveCoalesced(ctx, request("alice", "carol", "message:3", "hey"), time.Minute, countTitle)
+	if err != nil || coalesced || other.ID == first.ID {
+		t.Errorf("notification from another sender: coalesced %v, err %v", coalesced, err)
+	}
+	if _, err := repo.MarkAsRead(ctx, "alice", []string{first.ID}); err != nil {
+		t.Fatal(err)
+	}
+	afterRead, coalesced, err := repo.SaveCoalesced(ctx, request("alice", "bob", "message:4", "four"), time.Minute, countTitle)
+	if err != nil || coalesced || afterRead.ID == first.ID {
+		t.Errorf("notification after reading: coalesced %v, err %v", coalesced, err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	late, coalesced, err := repo.SaveCoalesced(ctx, request("alice", "bob", "message:5", "five"), time.Millisecond, countTitle)
+	if err != nil || coalesced || late.ID == afterRead.ID {
+		t.Errorf("notification outside the window: coalesced %v, err %v", coalesced, err)
+	}
+}
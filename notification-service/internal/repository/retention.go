@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// PurgeNotificationsBefore deletes up to batchSize notifications older than cutoff,
+// skipping users on legal hold
+func (r *Repository) PurgeNotificationsBefore(ctx context.Context, cutoff time.Time, batchSize int) (int64, error) {
+	query := `
+        DELETE FROM notifications WHERE id IN (
+            SELECT id FROM notifications
+            WHERE created_at < $1
+              AND user_id::text NOT IN (SELECT user_id FROM notification_legal_holds)
+            LIMIT $2
+        )`
+
+	return r.purge(ctx, query, cutoff, batchSize)
+}
+
+// PurgeNotificationsBeyondCount deletes up to batchSize notifications beyond each user's newest keep,
+// skipping users on legal hold
+func (r *Repository) PurgeNotificationsBeyondCount(ctx context.Context, keep, batchSize int) (int64, error) {
+	query := `
+        DELETE FROM notifications WHERE id IN (
+            SELECT id FROM (
+                SELECT id, user_id,
+                       ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY created_at DESC, id DESC) AS position
+                FROM notifications
+            ) ranked
+            WHERE position > $1
+              AND user_id::text NOT IN (SELECT user_id FROM notification_legal_holds)
+            LIMIT $2
+        )`
+
+	return r.purge(ctx, query, keep, batchSize)
+}
+
+// ReplaceLegalHolds makes the given users the only ones on legal hold
+func (r *Repository) ReplaceLegalHolds(ctx context.Context, userIDs []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM notification_legal_holds"); err != nil {
+		return err
+	}
+	for _, userID := range userIDs {
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO notification_legal_holds (user_id, reason) VALUES ($1, $2)",
+			userID, "legal hold in chat-service",
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *Repository) purge(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
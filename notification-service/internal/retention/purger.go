@@ -0,0 +1,153 @@
+// Package retention deletes notifications that are past their retention period
+package retention
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"log"
+	"os"
+	"time"
+
+	"github.com/meetohin/web-chat/notification-service/internal/redis"
+	"github.com/meetohin/web-chat/notification-service/internal/repository"
+)
+
+// Legal holds are placed in chat-service, which publishes the held usernames to these Redis keys
+const (
+	legalHoldsKey          = "retention:legal_holds"
+	legalHoldsPublishedKey = "retention:legal_holds:published"
+)
+
+// Config controls what is purged. A zero MaxAge or MaxPerUser disables that rule.
+type Config struct {
+	MaxAge     time.Duration
+	MaxPerUser int
+	Interval   time.Duration
+	BatchSize  int
+	BatchPause time.Duration // pause between batches so other queries get the table
+}
+
+// Enabled reports whether any retention rule is configured
+func (c Config) Enabled() bool {
+	return c.MaxAge > 0 || c.MaxPerUser > 0
+}
+
+// Metrics are published at /debug/vars under "retention"
+var metrics = expvar.NewMap("retention")
+
+type Purger struct {
+	repo   *repository.Repository
+	redis  *redis.Client
+	cfg    Config
+	logger *log.Logger
+}
+
+func New(repo *repository.Repository, redis *redis.Client, cfg Config) *Purger {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 1000
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Hour
+	}
+
+	return &Purger{
+		repo:   repo,
+		redis:  redis,
+		cfg:    cfg,
+		logger: log.New(os.Stdout, "Retention: ", log.LstdFlags),
+	}
+}
+
+// Start purges right away and then every interval until ctx is cancelled
+func (p *Purger) Start(ctx context.Context) {
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		p.RunOnce(ctx)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// RunOnce applies every configured rule once. Nothing is purged unless the legal holds are known.
+func (p *Purger) RunOnce(ctx context.Context) {
+	started := time.Now()
+	metrics.Add("runs", 1)
+
+	if err := p.syncLegalHolds(ctx); err != nil {
+		if ctx.Err() == nil {
+			metrics.Add("errors", 1)
+			p.logger.Printf("Skipping purge, legal holds unavailable: %v", err)
+		}
+		return
+	}
+
+	if p.cfg.MaxAge > 0 {
+		cutoff := time.Now().Add(-p.cfg.MaxAge)
+		p.purge(ctx, "notifications_purged_age", func() (int64, error) {
+			return p.repo.PurgeNotificationsBefore(ctx, cutoff, p.cfg.BatchSize)
+		})
+	}
+	if p.cfg.MaxPerUser > 0 {
+		p.purge(ctx, "notifications_purged_count", func() (int64, error) {
+			return p.repo.PurgeNotificationsBeyondCount(ctx, p.cfg.MaxPerUser, p.cfg.BatchSize)
+		})
+	}
+
+	lastRun := new(expvar.Int)
+	lastRun.Set(started.Unix())
+	metrics.Set("last_run_unix", lastRun)
+}
+
+// syncLegalHolds copies the legal holds published by chat-service into notification_legal_holds
+func (p *Purger) syncLegalHolds(ctx context.Context) error {
+	published, err := p.redis.Exists(ctx, legalHoldsPublishedKey)
+	if err != nil {
+		return err
+	}
+	if !published {
+		return errors.New("chat-service has not published legal holds yet")
+	}
+
+	userIDs, err := p.redis.Members(ctx, legalHoldsKey)
+	if err != nil {
+		return err
+	}
+	return p.repo.ReplaceLegalHolds(ctx, userIDs)
+}
+
+// purge runs batches until one deletes fewer rows than the batch size
+func (p *Purger) purge(ctx context.Context, metric string, batch func() (int64, error)) {
+	var total int64
+	for ctx.Err() == nil {
+		deleted, err := batch()
+		if err != nil {
+			if ctx.Err() == nil {
+				metrics.Add("errors", 1)
+				p.logger.Printf("Purge failed: %v", err)
+			}
+			break
+		}
+
+		total += deleted
+		metrics.Add(metric, deleted)
+		if deleted < int64(p.cfg.BatchSize) {
+			break
+		}
+
+		select {
+		case <-time.After(p.cfg.BatchPause):
+		case <-ctx.Done():
+		}
+	}
+
+	if total > 0 {
+		p.logger.Printf("Purged %d notifications (%s)", total, metric)
+	}
+}
@@ -0,0 +1,293 @@
+// Package templates renders notification texts from templates keyed by notification type
+// and locale. Each locale is a JSON file in locales/ mapping types to fields, e.g.
+//
+//	{"message": {"title": "New message from {{.sender}}", "push_body": "{{truncate 80 .text}}"}}
+//
+// Templates use text/template, except email_html fields which use html/template. Variables
+// come from the notification request; a missing variable renders as an empty string.
+package templates
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"unicode/utf8"
+)
+
+// DefaultLocale is used for users without a locale and for texts their locale lacks
+const DefaultLocale = "en"
+
+// Fields every notification type can define. Channel variants fall back to the generic field.
+const (
+	FieldTitle        = "title"
+	FieldTitleMany    = "title_many" // title of a notification that folds .count notifications
+	FieldBody         = "body"
+	FieldPushTitle    = "push_title"
+	FieldPushBody     = "push_body"
+	FieldEmailSubject = "email_subject"
+	FieldEmailText    = "email_text"
+	FieldEmailHTML    = "email_html"
+
+	// Variants for notifications that fold .count notifications
+	FieldPushTitleMany    = "push_title_many"
+	FieldEmailSubjectMany = "email_subject_many"
+	FieldEmailTextMany    = "email_text_many"
+	FieldEmailHTMLMany    = "email_html_many"
+)
+
+// many maps fields to their variant for notifications that fold several
+var many = map[string]string{
+	FieldPushTitle:    FieldPushTitleMany,
+	FieldEmailSubject: FieldEmailSubjectMany,
+	FieldEmailText:    FieldEmailTextMany,
+	FieldEmailHTML:    FieldEmailHTMLMany,
+}
+
+// fallbacks lists the fields tried, in order, when a locale does not define a field
+var fallbacks = map[string][]string{
+	FieldTitleMany:    {FieldTitle},
+	FieldPushTitle:    {FieldTitle},
+	FieldPushBody:     {FieldBody},
+	FieldEmailSubject: {FieldTitle},
+	FieldEmailText:    {FieldBody},
+
+	FieldPushTitleMany:    {FieldTitleMany, FieldPushTitle, FieldTitle},
+	FieldEmailSubjectMany: {FieldTitleMany, FieldEmailSubject, FieldTitle},
+	FieldEmailTextMany:    {FieldEmailText, FieldBody},
+	FieldEmailHTMLMany:    {FieldEmailHTML},
+}
+
+// localePattern matches normalized BCP 47 language tags: a language, optionally followed
+// by a script, a region and variants, e.g. "en", "pt-BR", "zh-Hant-TW" or "de-CH-1996"
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z][a-z]{3})?(-[A-Z]{2}|-[0-9]{3})?(-[a-z0-9]{5,8}|-[0-9][a-z0-9]{3})*$`)
+
+// ErrNotFound is returned when no locale has a template for a type and field
+var ErrNotFound = errors.New("template not found")
+
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+var funcs = map[string]interface{}{
+	"plural":   plural,
+	"truncate": truncate,
+}
+
+// Catalog holds the parsed templates of all locales
+type Catalog struct {
+	text map[string]map[string]map[string]*texttemplate.Template // locale, type, field
+	html map[string]map[string]map[string]*htmltemplate.Template // locale, type, field
+}
+
+// Load parses the templates of every locale
+func Load() (*Catalog, error) {
+	files, err := localeFiles.ReadDir("locales")
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Catalog{
+		text: make(map[string]map[string]map[string]*texttemplate.Template),
+		html: make(map[string]map[string]map[string]*htmltemplate.Template),
+	}
+	for _, file := range files {
+		locale := strings.TrimSuffix(file.Name(), ".json")
+		data, err := localeFiles.ReadFile(path.Join("locales", file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if err := c.parse(locale, data); err != nil {
+			return nil, fmt.Errorf("locale %s: %w", locale, err)
+		}
+	}
+
+	if c.text[DefaultLocale] == nil {
+		return nil, fmt.Errorf("default locale %s missing", DefaultLocale)
+	}
+	return c, nil
+}
+
+func (c *Catalog) parse(locale string, data []byte) error {
+	var types map[string]map[string]string
+	if err := json.Unmarshal(data, &types); err != nil {
+		return err
+	}
+
+	c.text[locale] = make(map[string]map[string]*texttemplate.Template)
+	c.html[locale] = make(map[string]map[string]*htmltemplate.Template)
+	for notificationType, fields := range types {
+		c.text[locale][notificationType] = make(map[string]*texttemplate.Template)
+		c.html[locale][notificationType] = make(map[string]*htmltemplate.Template)
+		for field, source := range fields {
+			name := notificationType + "." + field
+			if field == FieldEmailHTML || field == FieldEmailHTMLMany {
+				t, err := htmltemplate.New(name).Option("missingkey=zero").Funcs(funcs).Parse(source)
+				if err != nil {
+					return err
+				}
+				c.html[locale][notificationType][field] = t
+				continue
+			}
+
+			t, err := texttemplate.New(name).Option("missingkey=zero").Funcs(funcs).Parse(source)
+			if err != nil {
+				return err
+			}
+			c.text[locale][notificationType][field] = t
+		}
+	}
+	return nil
+}
+
+// Locales returns the available locales
+func (c *Catalog) Locales() []string {
+	locales := make([]string, 0, len(c.text))
+	for locale := range c.text {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Supports reports whether texts in the locale or its language are available
+func (c *Catalog) Supports(locale string) bool {
+	for _, l := range parents(locale) {
+		if c.text[l] != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Render executes the template for a type and field in the user's locale, falling back
+// to the locale's language, the default locale and then to the fields in fallbacks
+func (c *Catalog) Render(locale, notificationType, field string, vars map[string]string) (string, error) {
+	fields := append([]string{field}, fallbacks[field]...)
+	for _, l := range c.chain(locale) {
+		for _, f := range fields {
+			if t := c.text[l][notificationType][f]; t != nil {
+				var b strings.Builder
+				if err := t.Execute(&b, vars); err != nil {
+					return "", err
+				}
+				return b.String(), nil
+			}
+		}
+	}
+	return "", ErrNotFound
+}
+
+// RenderHTML executes an HTML email template for a type, FieldEmailHTML or FieldEmailHTMLMany,
+// with the same fallbacks as Render
+func (c *Catalog) RenderHTML(locale, notificationType, field string, vars map[string]string) (string, error) {
+	fields := append([]string{field}, fallbacks[field]...)
+	for _, l := range c.chain(locale) {
+		for _, f := range fields {
+			if t := c.html[l][notificationType][f]; t != nil {
+				var b strings.Builder
+				if err := t.Execute(&b, vars); err != nil {
+					return "", err
+				}
+				return b.String(), nil
+			}
+		}
+	}
+	return "", ErrNotFound
+}
+
+// Many returns the variant of a field for notifications that fold several, or the field
+// itself if it has none
+func Many(field string) string {
+	if variant, ok := many[field]; ok {
+		return variant
+	}
+	return field
+}
+
+// chain returns the available locales to try for a user's locale, most specific first:
+// "pt-BR" tries pt-BR, pt and the default locale
+func (c *Catalog) chain(locale string) []string {
+	var chain []string
+	for _, l := range parents(locale) {
+		if c.text[l] != nil && l != DefaultLocale {
+			chain = append(chain, l)
+		}
+	}
+	return append(chain, DefaultLocale)
+}
+
+// parents returns the locale and the more general ones it falls back to: "zh-Hant-TW", "zh-Hant", "zh"
+func parents(locale string) []string {
+	var locales []string
+	for locale = Normalize(locale); locale != ""; {
+		locales = append(locales, locale)
+		i := strings.LastIndex(locale, "-")
+		if i < 0 {
+			break
+		}
+		locale = locale[:i]
+	}
+	return locales
+}
+
+// Normalize turns "pt_br" and "PT-br" into "pt-BR", and "zh-hant-tw" into "zh-Hant-TW"
+func Normalize(locale string) string {
+	parts := strings.Split(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"), "-")
+	parts[0] = strings.ToLower(parts[0])
+	for i := 1; i < len(parts); i++ {
+		switch part := strings.ToLower(parts[i]); {
+		case len(part) == 2:
+			parts[i] = strings.ToUpper(part)
+		case len(part) == 4 && i == 1 && part[0] >= 'a' && part[0] <= 'z':
+			parts[i] = strings.ToUpper(part[:1]) + part[1:]
+		default:
+			parts[i] = part
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// Valid reports whether a normalized locale is a well-formed language tag
+func Valid(locale string) bool {
+	return localePattern.MatchString(locale)
+}
+
+// plural picks the word form for n: with two forms English rules ("one", "other"),
+// with three the rules of Russian and other Slavic languages ("one", "few", "many")
+func plural(n interface{}, forms ...string) string {
+	count, _ := strconv.Atoi(fmt.Sprint(n))
+	switch len(forms) {
+	case 0:
+		return ""
+	case 1, 2:
+		if count == 1 || len(forms) == 1 {
+			return forms[0]
+		}
+		return forms[1]
+	default:
+		switch {
+		case count%10 == 1 && count%100 != 11:
+			return forms[0]
+		case count%10 >= 2 && count%10 <= 4 && (count%100 < 12 || count%100 > 14):
+			return forms[1]
+		default:
+			return forms[2]
+		}
+	}
+}
+
+// truncate shortens text to at most n characters, ending it with an ellipsis
+func truncate(n int, text string) string {
+	if utf8.RuneCountInString(text) <= n {
+		return text
+	}
+	runes := []rune(text)
+	return strings.TrimSpace(string(runes[:n-1])) + "…"
+}
@@ -0,0 +1,187 @@
+package templates
+
+import (
+	"errors"
+	htmltemplate "html/template"
+	"strings"
+	"testing"
+	texttemplate "text/template"
+)
+
+// newCatalog parses locales given as JSON, like the files in locales/
+func newCatalog(t *testing.T, locales map[string]string) *Catalog {
+	t.Helper()
+	c := &Catalog{
+		text: make(map[string]map[string]map[string]*texttemplate.Template),
+		html: make(map[string]map[string]map[string]*htmltemplate.Template),
+	}
+	for locale, data := range locales {
+		if err := c.parse(locale, []byte(data)); err != nil {
+			t.Fatalf("locale %s: %v", locale, err)
+		}
+	}
+	return c
+}
+
+func TestRenderFallbacks(t *testing.T) {
+	c := newCatalog(t, map[string]string{
+		"en": `{"message": {"title": "en title", "title_many": "en {{.count}} messages", "body": "en body",
+		        "email_html": "<p>en {{.text}}</p>"}}`,
+		"pt":    `{"message": {"title": "pt title", "email_html": "<p>pt {{.text}}</p>"}}`,
+		"pt-BR": `{"message": {"body": "pt-BR body"}}`,
+	})
+	vars := map[string]string{"count": "3", "text": "<b>hi</b>"}
+
+	tests := []struct {
+		locale, field, want string
+	}{
+		{"pt-BR", FieldBody, "pt-BR body"},
+		{"pt-BR", FieldTitle, "pt title"},       // pt-BR lacks it, pt has it
+		{"pt_br", FieldTitle, "pt title"},       // locales are normalized
+		{"pt", FieldBody, "en body"},            // neither pt nor pt-BR, the default locale
+		{"fr-CA", FieldTitle, "en title"},       // unknown locales use the default
+		{"", FieldBody, "en body"},              // users without a locale
+		{"pt-BR", FieldPushTitle, "pt title"},   // a field missing everywhere falls back to title
+		{"pt-BR", FieldEmailText, "pt-BR body"}, // ... or to body
+		{"en", FieldEmailSubjectMany, "en 3 messages"},
+		{"pt", FieldEmailSubjectMany, "pt title"}, // the locale's own texts come before the default's
+		{"en", FieldEmailTextMany, "en body"},
+	}
+	for _, tt := range tests {
+		got, err := c.Render(tt.locale, "message", tt.field, vars)
+		if err != nil || got != tt.want {
+			t.Errorf("Render(%q, %s) = %q, %v; want %q", tt.locale, tt.field, got, err, tt.want)
+		}
+	}
+
+	if _, err := c.Render("en", "mention", FieldTitle, vars); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Render of an unknown type returned %v, want ErrNotFound", err)
+	}
+
+	html, err := c.RenderHTML("pt-BR", "message", FieldEmailHTMLMany, vars)
+	if err != nil || html != "<p>pt &lt;b&gt;hi&lt;/b&gt;</p>" {
+		t.Errorf("RenderHTML = %q, %v; want the escaped pt template", html, err)
+	}
+}
+
+func TestPlural(t *testing.T) {
+	russian := []string{"сообщение", "сообщения", "сообщений"}
+	tests := []struct {
+		n     int
+		forms []string
+		want  string
+	}{
+		{1, russian, "сообщение"},
+		{2, russian, "сообщения"},
+		{4, russian, "сообщения"},
+		{5, russian, "сообщений"},
+		{11, russian, "сообщений"},
+		{12, russian, "сообщений"},
+		{14, russian, "сообщений"},
+		{21, russian, "сообщение"},
+		{22, russian, "сообщения"},
+		{111, russian, "сообщений"},
+		{0, russian, "сообщений"},
+		{1, []string{"message", "messages"}, "message"},
+		{2, []string{"message", "messages"}, "messages"},
+		{0, []string{"message", "messages"}, "messages"},
+		{21, []string{"message", "messages"}, "messages"},
+	}
+	for _, tt := range tests {
+		if got := plural(tt.n, tt.forms...); got != tt.want {
+			t.Errorf("plural(%d, %q) = %q, want %q", tt.n, tt.forms, got, tt.want)
+		}
+	}
+	// Template variables are strings
+	if got := plural("3", russian...); got != "сообщения" {
+		t.Errorf(`plural("3") = %q`, got)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		n          int
+		text, want string
+	}{
+		{10, "short", "short"},
+		{5, "hello", "hello"},
+		{7, "hello world", "hello…"}, // the space before the ellipsis is dropped
+		{5, "привет мир", "прив…"},
+		{3, "日本語テキスト", "日本…"},
+		{4, "👋👋👋👋👋", "👋👋👋…"},
+	}
+	for _, tt := range tests {
+		got := truncate(tt.n, tt.text)
+		if got != tt.want {
+			t.Errorf("truncate(%d, %q) = %q, want %q", tt.n, tt.text, got, tt.want)
+		}
+		if !strings.HasSuffix(got, "…") && got != tt.text {
+			t.Errorf("truncate(%d, %q) cut the text without an ellipsis", tt.n, tt.text)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct{ locale, want string }{
+		{"en", "en"},
+		{" EN ", "en"},
+		{"pt_br", "pt-BR"},
+		{"PT-br", "pt-BR"},
+		{"zh-hant-tw", "zh-Hant-TW"},
+		{"es-419", "es-419"},
+		{"de-ch-1996", "de-CH-1996"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.locale); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.locale, got, tt.want)
+		}
+	}
+}
+
+func TestValid(t *testing.T) {
+	for _, locale := range []string{"en", "pt-BR", "zh-Hant", "zh-Hant-TW", "es-419", "de-CH-1996", "sl-rozaj"} {
+		if !Valid(Normalize(locale)) {
+			t.Errorf("Valid(%q) = false, want true", locale)
+		}
+	}
+	for _, locale := range []string{"en-!!!", "english", "e", "en-", "en--US", "12", "en-US-x", "en US", "pt-BR-"} {
+		if Valid(Normalize(locale)) {
+			t.Errorf("Valid(%q) = true, want false", locale)
+		}
+	}
+}
+
+func TestEmbeddedLocales(t *testing.T) {
+	c, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	vars := map[string]string{"sender": "bob", "count": "21", "text": "hi", "chat_url": "https://chat.example"}
+
+	tests := []struct {
+		locale, field, want string
+	}{
+		{"en", FieldEmailSubject, "New message from bob"},
+		{"en", FieldEmailSubjectMany, "21 new messages from bob"},
+		{"en", FieldPushTitleMany, "21 new messages from bob"},
+		{"ru", FieldEmailSubjectMany, "21 новое сообщение от bob"},
+		{"ru-RU", FieldTitleMany, "21 новое сообщение от bob"},
+	}
+	for _, tt := range tests {
+		got, err := c.Render(tt.locale, "message", tt.field, vars)
+		if err != nil || got != tt.want {
+			t.Errorf("Render(%q, %s) = %q, %v; want %q", tt.locale, tt.field, got, err, tt.want)
+		}
+	}
+
+	text, err := c.Render("en", "message", FieldEmailTextMany, vars)
+	if err != nil || !strings.HasPrefix(text, "bob sent you 21 messages. The latest:") {
+		t.Errorf("email text for many = %q, %v", text, err)
+	}
+	for _, locale := range c.Locales() {
+		if !Valid(locale) {
+			t.Errorf("locale file %s is not a valid language tag", locale)
+		}
+	}
+}
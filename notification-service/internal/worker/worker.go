@@ -2,34 +2,167 @@ package worker
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"expvar"
 	"fmt"
 	"log"
 	"os"
+	"strconv"
 	"sync"
 	"time"
 
+	"github.com/meetohin/web-chat/notification-service/internal/channel"
 	"github.com/meetohin/web-chat/notification-service/internal/model"
 	"github.com/meetohin/web-chat/notification-service/internal/redis"
 	"github.com/meetohin/web-chat/notification-service/internal/repository"
+	"github.com/meetohin/web-chat/notification-service/internal/templates"
 )
 
+// Redis keys of the notification queue
+const (
+	QueueName           = "notifications"
+	RetryQueueName      = "notifications:retry" // sorted set scored by the time of the next attempt
+	DeadLetterQueueName = "notifications:dead"
+	processingPrefix    = "notifications:processing:" // one list per consumer
+	heartbeatPrefix     = "notifications:consumer:"
+	dedupPrefix         = "notifications:dedup:" // idempotency keys processed recently
+)
+
+// Redis keys of the queue of deliveries by email, webhook and Web Push, one entry per endpoint
+const (
+	DeliveryQueueName           = "notifications:deliveries"
+	DeliveryRetryQueueName      = "notifications:deliveries:retry"
+	DeliveryDeadLetterQueueName = "notifications:deliveries:dead"
+	deliveryProcessingPrefix    = "notifications:deliveries:processing:"
+	deliveryHeartbeatPrefix     = "notifications:deliveries:consumer:"
+)
+
+const (
+	heartbeatTTL    = time.Minute
+	recoverInterval = 30 * time.Second
+	processTimeout  = 15 * time.Second
+	// Duplicates are usually retries within seconds; older ones are caught by the database
+	dedupTTL = 15 * time.Minute
+
+	// Notifications held for users without a chat connection
+	maxPending = 100
+	pendingTTL = 7 * 24 * time.Hour
+)
+
+// Metrics are published at /debug/vars under "notification_queue"
+var metrics = expvar.NewMap("notification_queue")
+
+// Config controls concurrency and retries
+type Config struct {
+	Workers         int
+	DeliveryWorkers int           // send to email, webhook and push endpoints, which can be slow
+	MaxAttempts     int           // attempts before a notification is dead-lettered
+	BaseDelay       time.Duration // delay before the first retry, doubled on each next one
+	MaxDelay        time.Duration
+	// Message notifications from the same sender within this window are folded into one; zero disables it
+	CoalesceWindow time.Duration
+}
+
+// queuedNotification is a queue entry. chat-service queues bare notification requests;
+// the worker wraps them when they have to be retried.
+type queuedNotification struct {
+	Payload json.RawMessage `json:"payload"`
+	Attempt int             `json:"attempt"` // failed attempts so far
+}
+
+// DeadLetter is a notification that could not be processed. Its payload field makes it
+// a valid queue entry again, so dead letters are redriven by moving them back unchanged.
+type DeadLetter struct {
+	Payload  json.RawMessage `json:"payload"`
+	Attempts int             `json:"attempts"`
+	Error    string          `json:"error"`
+	FailedAt time.Time       `json:"failed_at"`
+}
+
+// deliveryJob sends a stored notification to one endpoint outside the chat
+type deliveryJob struct {
+	Notification *model.Notification `json:"notification"`
+	EndpointID   int64               `json:"endpoint_id"`
+	// The notification's template variables and locale are not stored with it
+	Variables map[string]string `json:"variables,omitempty"`
+	Locale    string            `json:"locale,omitempty"`
+}
+
+// permanentError marks failures that retrying cannot fix
+type permanentError struct{ error }
+
+// queue is a reliable queue with its retries, dead letters and the workers consuming it
+type queue struct {
+	name       string
+	retry      string // sorted set scored by the time of the next attempt
+	deadLetter string
+	processing string // prefix of the processing lists, one per consumer
+	heartbeat  string // prefix of the consumers' heartbeat keys
+	metric     string // prefix of the queue's metrics
+	label      string // names its workers in logs
+	workers    int
+	handle     func(ctx context.Context, workerID int, payload []byte) error
+}
+
+// Worker consumes the notification queue and the queue of deliveries outside the chat
+// it fills. Every entry is moved to a processing list of its consumer and only removed
+// once handled, entries of consumers that died are put back on their queue. Failures
+// are retried with exponential backoff and end up in the queue's dead letters after
+// Config.MaxAttempts attempts.
 type Worker struct {
 	redis     *redis.Client
 	repo      *repository.Repository
+	channels  *channel.Router
+	templates *templates.Catalog
 	logger    *log.Logger
-	workers   int
-	queueName string
+	cfg       Config
+	consumer  string
+	queues    []*queue
 }
 
-func New(redis *redis.Client, repo *repository.Repository, workers int) *Worker {
-	return &Worker{
+func New(redis *redis.Client, repo *repository.Repository, channels *channel.Router, catalog *templates.Catalog, cfg Config) *Worker {
+	hostname, _ := os.Hostname()
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+
+	w := &Worker{
 		redis:     redis,
 		repo:      repo,
+		channels:  channels,
+		templates: catalog,
 		logger:    log.New(os.Stdout, "Worker: ", log.LstdFlags),
-		workers:   workers,
-		queueName: "notifications",
+		cfg:       cfg,
+		// Random, so a restarted process with the same PID (common in containers) never
+		// takes the processing lists of its previous run for its own and leaves them behind
+		consumer: fmt.Sprintf("%s:%d:%s", hostname, os.Getpid(), hex.EncodeToString(suffix)),
+	}
+	w.queues = []*queue{
+		{
+			name:       QueueName,
+			retry:      RetryQueueName,
+			deadLetter: DeadLetterQueueName,
+			processing: processingPrefix,
+			heartbeat:  heartbeatPrefix,
+			label:      "Worker",
+			workers:    cfg.Workers,
+			handle:     w.handle,
+		},
+		{
+			name:       DeliveryQueueName,
+			retry:      DeliveryRetryQueueName,
+			deadLetter: DeliveryDeadLetterQueueName,
+			processing: deliveryProcessingPrefix,
+			heartbeat:  deliveryHeartbeatPrefix,
+			metric:     "delivery_",
+			label:      "Delivery worker",
+			workers:    cfg.DeliveryWorkers,
+			handle:     w.deliver,
+		},
 	}
+	return w
 }
 
 func (w *Worker) Start(ctx context.Context) error {
@@ -37,16 +170,28 @@ func (w *Worker) Start(ctx context.Context) error {
 		return ctx.Err()
 	}
 
-	w.logger.Printf("Starting %d workers", w.workers)
+	w.logger.Printf("Starting %d workers and %d delivery workers", w.cfg.Workers, w.cfg.DeliveryWorkers)
 
 	var wg sync.WaitGroup
 
-	for i := 0; i < w.workers; i++ {
-		wg.Add(1)
-		go func(workerID int) {
-			defer wg.Done()
-			w.worker(ctx, workerID)
-		}(i)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		w.retryScheduler(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		w.recoverer(ctx)
+	}()
+
+	for _, q := range w.queues {
+		for i := 0; i < q.workers; i++ {
+			wg.Add(1)
+			go func(q *queue, workerID int) {
+				defer wg.Done()
+				w.worker(ctx, q, workerID)
+			}(q, i)
+		}
 	}
 
 	wg.Wait()
@@ -54,32 +199,42 @@ func (w *Worker) Start(ctx context.Context) error {
 	return nil
 }
 
-func (w *Worker) worker(ctx context.Context, workerID int) {
+func (w *Worker) worker(ctx context.Context, q *queue, workerID int) {
 	if ctx.Err() != nil {
 		return
 	}
 
-	w.logger.Printf("Worker %d started", workerID)
+	consumer := fmt.Sprintf("%s:%d", w.consumer, workerID)
+	processing := q.processing + consumer
+	heartbeat := q.heartbeat + consumer
+
+	w.logger.Printf("%s %d started", q.label, workerID)
 
 	for {
 		select {
 		case <-ctx.Done():
-			w.logger.Printf("Worker %d stopped", workerID)
+			w.logger.Printf("%s %d stopped", q.label, workerID)
 			return
 		default:
-			w.processMessage(ctx, workerID)
+			if err := w.redis.Heartbeat(ctx, heartbeat, heartbeatTTL); err != nil && ctx.Err() == nil {
+				w.logger.Printf("%s %d: Failed to send heartbeat: %v", q.label, workerID, err)
+			}
+			w.processMessage(ctx, q, workerID, processing)
 		}
 	}
 }
 
-func (w *Worker) processMessage(ctx context.Context, workerID int) {
+func (w *Worker) processMessage(ctx context.Context, q *queue, workerID int, processing string) {
 	if ctx.Err() != nil {
 		return
 	}
 
-	data, err := w.redis.Dequeue(ctx, w.queueName, 5*time.Second)
+	data, err := w.redis.DequeueTo(ctx, q.name, processing, 5*time.Second)
 	if err != nil {
-		w.logger.Printf("Worker %d: Failed to dequeue: %v", workerID, err)
+		if ctx.Err() == nil {
+			w.logger.Printf("%s %d: Failed to dequeue: %v", q.label, workerID, err)
+			time.Sleep(time.Second)
+		}
 		return
 	}
 
@@ -87,27 +242,360 @@ func (w *Worker) processMessage(ctx context.Context, workerID int) {
 		return
 	}
 
+	// The entry is finished even if the worker is being stopped
+	processCtx, cancel := context.WithTimeout(context.Background(), processTimeout)
+	defer cancel()
+
+	entry := decodeEntry(data)
+	err = q.handle(processCtx, workerID, entry.Payload)
+
+	switch {
+	case err == nil:
+		metrics.Add(q.metric+"processed", 1)
+	case errors.As(err, new(permanentError)):
+		w.deadLetter(processCtx, q, workerID, entry, err)
+	case entry.Attempt+1 >= w.cfg.MaxAttempts:
+		w.deadLetter(processCtx, q, workerID, entry, err)
+	default:
+		w.retry(processCtx, q, workerID, entry, err)
+	}
+
+	if err := w.redis.Ack(processCtx, processing, data); err != nil {
+		w.logger.Printf("%s %d: Failed to acknowledge: %v", q.label, workerID, err)
+	}
+}
+
+// handle stores the notification and publishes it to the user, as far as their preferences allow
+func (w *Worker) handle(ctx context.Context, workerID int, payload []byte) error {
 	var req model.NotificationRequest
-	if err := json.Unmarshal(data, &req); err != nil {
-		w.logger.Printf("Worker %d: Failed to unmarshal: %v", workerID, err)
-		return
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return permanentError{fmt.Errorf("invalid notification: %w", err)}
+	}
+	if err := req.Validate(); err != nil {
+		return permanentError{fmt.Errorf("invalid notification: %w", err)}
 	}
 
 	w.logger.Printf("Worker %d: Processing notification for user %s", workerID, req.UserID)
 
-	notification, err := w.repo.CreateNotification(ctx, &req)
+	dedupKey := dedupPrefix + req.UserID + ":" + req.IdempotencyKey
+	if req.IdempotencyKey != "" {
+		seen, err := w.redis.Exists(ctx, dedupKey)
+		if err != nil {
+			w.logger.Printf("Worker %d: Failed to check for duplicate: %v", workerID, err)
+		}
+		if seen {
+			w.logger.Printf("Worker %d: Skipped duplicate notification %q for user %s", workerID, req.IdempotencyKey, req.UserID)
+			metrics.Add("duplicates", 1)
+			return nil
+		}
+	}
+
+	prefs, err := w.repo.GetPreferences(ctx, req.UserID)
 	if err != nil {
-		w.logger.Printf("Worker %d: Failed to save notification: %v", workerID, err)
+		return fmt.Errorf("failed to load preferences: %w", err)
+	}
+	if !prefs.Receives(req.Type) || prefs.Muted(req.Sender) {
+		w.logger.Printf("Worker %d: Dropped %s notification for user %s by their preferences", workerID, req.Type, req.UserID)
+		metrics.Add("filtered", 1)
+		return nil
+	}
+
+	if err := w.render(&req, prefs.Locale); err != nil {
+		return permanentError{fmt.Errorf("failed to render notification: %w", err)}
+	}
+
+	notification, coalesced, err := w.save(ctx, &req, prefs.Locale)
+	if errors.Is(err, repository.ErrDuplicate) {
+		// The worker of the first request may have died after storing the notification
+		notification, err = w.repo.UnpublishedNotification(ctx, req.UserID, req.IdempotencyKey)
+		if err != nil {
+			return fmt.Errorf("failed to load duplicate notification: %w", err)
+		}
+		if notification == nil {
+			w.logger.Printf("Worker %d: Skipped duplicate notification %q for user %s", workerID, req.IdempotencyKey, req.UserID)
+			metrics.Add("duplicates", 1)
+			w.markProcessed(ctx, dedupKey)
+			return nil
+		}
+		w.logger.Printf("Worker %d: Resuming unpublished notification %s", workerID, notification.ID)
+		metrics.Add("resumed", 1)
+		// A notification folded into since went out on every channel with the first request
+		coalesced = notification.Count > 1
+	} else if err != nil {
+		return fmt.Errorf("failed to save notification: %w", err)
+	}
+	notification.Variables = req.Variables
+	notification.Locale = prefs.Locale
+
+	w.publish(ctx, workerID, notification, prefs, coalesced)
+
+	// Only now the request is done; a redelivery before this publishes the notification again
+	if req.IdempotencyKey != "" {
+		if err := w.repo.MarkPublished(ctx, req.UserID, req.IdempotencyKey); err != nil {
+			w.logger.Printf("Worker %d: Failed to mark notification %s published: %v", workerID, notification.ID, err)
+		}
+		w.markProcessed(ctx, dedupKey)
+	}
+
+	w.logger.Printf("Worker %d: Successfully processed notification %s", workerID, notification.ID)
+	return nil
+}
+
+// publish sends a stored notification to the user's chat connections and queues its
+// deliveries on other channels, as far as their preferences allow
+func (w *Worker) publish(ctx context.Context, workerID int, notification *model.Notification, prefs *model.Preferences, coalesced bool) {
+	// During quiet hours the notification only waits in the user's list and for their next connection
+	if prefs.Quiet(time.Now()) {
+		w.logger.Printf("Worker %d: Stored notification %s silently during quiet hours", workerID, notification.ID)
+		metrics.Add("quiet", 1)
+		if err := w.holdNotification(ctx, notification); err != nil {
+			w.logger.Printf("Worker %d: Failed to hold notification: %v", workerID, err)
+		}
 		return
 	}
 
+	// The notification is stored, failing here would save it twice on retry
 	if err := w.sendWebSocketNotification(ctx, notification); err != nil {
 		w.logger.Printf("Worker %d: Failed to send WebSocket notification: %v", workerID, err)
 	}
 
-	w.logger.Printf("Worker %d: Successfully processed notification %s", workerID, notification.ID)
+	// Clients replace the notification they have; the first one already went out on every channel
+	if coalesced {
+		w.logger.Printf("Worker %d: Folded notification into %s (%d)", workerID, notification.ID, notification.Count)
+		metrics.Add("coalesced", 1)
+		return
+	}
+
+	// Email, webhook and push deliveries can be slow, they must not hold up the queue
+	w.queueDeliveries(ctx, workerID, notification, prefs)
+}
+
+// queueDeliveries queues the notification for each endpoint of the channels enabled in prefs
+func (w *Worker) queueDeliveries(ctx context.Context, workerID int, notification *model.Notification, prefs *model.Preferences) {
+	endpoints, err := w.channels.Endpoints(ctx, notification, prefs)
+	if err != nil {
+		w.logger.Printf("Worker %d: Failed to queue deliveries of notification %s: %v", workerID, notification.ID, err)
+		return
+	}
+
+	for _, endpoint := range endpoints {
+		job := deliveryJob{
+			Notification: notification,
+			EndpointID:   endpoint.ID,
+			Variables:    notification.Variables,
+			Locale:       notification.Locale,
+		}
+		if err := w.redis.Enqueue(ctx, DeliveryQueueName, job); err != nil {
+			w.logger.Printf("Worker %d: Failed to queue %s delivery of notification %s: %v", workerID, endpoint.Channel, notification.ID, err)
+		}
+	}
 }
 
+// deliver sends a notification to one endpoint; failed sends are retried like notifications
+func (w *Worker) deliver(ctx context.Context, workerID int, payload []byte) error {
+	var job deliveryJob
+	if err := json.Unmarshal(payload, &job); err != nil || job.Notification == nil {
+		return permanentError{errors.New("invalid delivery")}
+	}
+	notification := job.Notification
+	notification.Variables = job.Variables
+	notification.Locale = job.Locale
+
+	endpoint, err := w.repo.GetEndpoint(ctx, notification.UserID, job.EndpointID)
+	if err != nil {
+		return fmt.Errorf("failed to load endpoint: %w", err)
+	}
+	if endpoint == nil {
+		w.logger.Printf("Delivery worker %d: Endpoint %d of notification %s was removed", workerID, job.EndpointID, notification.ID)
+		return nil
+	}
+	err = w.channels.Send(ctx, endpoint, notification)
+	if errors.Is(err, channel.ErrUndeliverable) {
+		return permanentError{err}
+	}
+	return err
+}
+
+// markProcessed remembers an idempotency key for a while, so duplicates are dropped
+// before they reach the database
+func (w *Worker) markProcessed(ctx context.Context, dedupKey string) {
+	if err := w.redis.SetExpiring(ctx, dedupKey, dedupTTL); err != nil {
+		w.logger.Printf("Failed to remember idempotency key: %v", err)
+	}
+}
+
+// render fills in the title and message of a request that only carries template variables
+func (w *Worker) render(req *model.NotificationRequest, locale string) error {
+	if req.Variables == nil {
+		return nil
+	}
+	if _, ok := req.Variables["sender"]; !ok && req.Sender != "" {
+		req.Variables["sender"] = req.Sender
+	}
+
+	var err error
+	if req.Title == "" {
+		if req.Title, err = w.templates.Render(locale, req.Type, templates.FieldTitle, req.Variables); err != nil {
+			return err
+		}
+	}
+	if req.Message == "" {
+		if req.Message, err = w.templates.Render(locale, req.Type, templates.FieldBody, req.Variables); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// save stores the notification, folding message notifications into a recent one from the same sender
+func (w *Worker) save(ctx context.Context, req *model.NotificationRequest, locale string) (*model.Notification, bool, error) {
+	if w.cfg.CoalesceWindow <= 0 || req.Type != model.TypeMessage || req.Sender == "" {
+		notification, err := w.repo.CreateNotification(ctx, req)
+		return notification, false, err
+	}
+
+	return w.repo.SaveCoalesced(ctx, req, w.cfg.CoalesceWindow, func(count int) string {
+		vars := map[string]string{"sender": req.Sender}
+		for name, value := range req.Variables {
+			vars[name] = value
+		}
+		vars["count"] = strconv.Itoa(count)
+		title, err := w.templates.Render(locale, req.Type, templates.FieldTitleMany, vars)
+		if err != nil {
+			w.logger.Printf("Failed to render title of coalesced notification: %v", err)
+			return req.Title
+		}
+		return title
+	})
+}
+
+func (w *Worker) retry(ctx context.Context, q *queue, workerID int, entry queuedNotification, cause error) {
+	entry.Attempt++
+	delay := w.backoff(entry.Attempt)
+
+	data, err := json.Marshal(entry)
+	if err == nil {
+		err = w.redis.Schedule(ctx, q.retry, data, time.Now().Add(delay))
+	}
+	if err != nil {
+		// The entry is acknowledged either way, keep it as a dead letter rather than lose it
+		w.logger.Printf("%s %d: Failed to schedule retry: %v", q.label, workerID, err)
+		w.deadLetter(ctx, q, workerID, entry, cause)
+		return
+	}
+
+	metrics.Add(q.metric+"retried", 1)
+	w.logger.Printf("%s %d: Attempt %d failed, retrying in %s: %v", q.label, workerID, entry.Attempt, delay, cause)
+}
+
+func (w *Worker) deadLetter(ctx context.Context, q *queue, workerID int, entry queuedNotification, cause error) {
+	data, err := json.Marshal(DeadLetter{
+		Payload:  entry.Payload,
+		Attempts: entry.Attempt + 1,
+		Error:    cause.Error(),
+		FailedAt: time.Now().UTC(),
+	})
+	if err == nil {
+		err = w.redis.PushRaw(ctx, q.deadLetter, data)
+	}
+	if err != nil {
+		w.logger.Printf("%s %d: Failed to dead-letter entry (%v): %s", q.label, workerID, err, entry.Payload)
+		return
+	}
+
+	metrics.Add(q.metric+"dead_lettered", 1)
+	w.logger.Printf("%s %d: Entry dead-lettered after %d attempts: %v", q.label, workerID, entry.Attempt+1, cause)
+}
+
+// backoff returns the delay before the given retry, starting at 1
+func (w *Worker) backoff(retry int) time.Duration {
+	delay := w.cfg.BaseDelay
+	for i := 1; i < retry; i++ {
+		delay *= 2
+		if delay >= w.cfg.MaxDelay {
+			return w.cfg.MaxDelay
+		}
+	}
+	return delay
+}
+
+// retryScheduler moves retries that are due back onto their queues
+func (w *Worker) retryScheduler(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, q := range w.queues {
+				if _, err := w.redis.EnqueueDue(ctx, q.retry, q.name, 100); err != nil && ctx.Err() == nil {
+					w.logger.Printf("Failed to move due retries to %s: %v", q.name, err)
+				}
+			}
+		}
+	}
+}
+
+// recoverer puts entries back on the queue that consumers took but never finished
+// because they crashed or were killed
+func (w *Worker) recoverer(ctx context.Context) {
+	ticker := time.NewTicker(recoverInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, q := range w.queues {
+			w.recoverAbandoned(ctx, q)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Worker) recoverAbandoned(ctx context.Context, q *queue) {
+	lists, err := w.redis.Keys(ctx, q.processing+"*")
+	if err != nil {
+		if ctx.Err() == nil {
+			w.logger.Printf("Failed to list processing queues: %v", err)
+		}
+		return
+	}
+
+	for _, list := range lists {
+		consumer := list[len(q.processing):]
+		alive, err := w.redis.Alive(ctx, q.heartbeat+consumer)
+		if err != nil || alive {
+			continue
+		}
+
+		moved, err := w.redis.Requeue(ctx, list, q.name)
+		if err != nil {
+			w.logger.Printf("Failed to recover entries of %s on %s: %v", consumer, q.name, err)
+			continue
+		}
+		if moved > 0 {
+			metrics.Add(q.metric+"recovered", int64(moved))
+			w.logger.Printf("Recovered %d unfinished entries of consumer %s on %s", moved, consumer, q.name)
+		}
+	}
+}
+
+// decodeEntry unwraps a queue entry; bare notification requests are first attempts
+func decodeEntry(data []byte) queuedNotification {
+	var entry queuedNotification
+	if err := json.Unmarshal(data, &entry); err != nil || len(entry.Payload) == 0 {
+		return queuedNotification{Payload: data}
+	}
+	return entry
+}
+
+// sendWebSocketNotification publishes the notification to the user's chat connections.
+// If none received it, it is held until the user reconnects.
 func (w *Worker) sendWebSocketNotification(ctx context.Context, notification *model.Notification) error {
 	if ctx.Err() != nil {
 		return ctx.Err()
@@ -120,7 +608,26 @@ func (w *Worker) sendWebSocketNotification(ctx context.Context, notification *mo
 		Data: *notification,
 	}
 
-	return w.redis.Publish(ctx, channel, message)
+	receivers, err := w.redis.Publish(ctx, channel, message)
+	if err != nil {
+		return err
+	}
+	if receivers == 0 {
+		return w.holdNotification(ctx, notification)
+	}
+	return nil
+}
+
+// holdNotification keeps the notification for chat-service to send when the user reconnects
+func (w *Worker) holdNotification(ctx context.Context, notification *model.Notification) error {
+	key := fmt.Sprintf("user:%s:notifications:pending", notification.UserID)
+	message := model.WebSocketMessage{
+		Type: "notification",
+		Data: *notification,
+	}
+
+	metrics.Add("held", 1)
+	return w.redis.PushCapped(ctx, key, message, maxPending, pendingTTL)
 }
 
 func (w *Worker) GetStats(ctx context.Context) (map[string]interface{}, error) {
@@ -128,13 +635,25 @@ func (w *Worker) GetStats(ctx context.Context) (map[string]interface{}, error) {
 		return nil, ctx.Err()
 	}
 
-	size, err := w.redis.QueueSize(ctx, w.queueName)
-	if err != nil {
-		return nil, err
-	}
+	stats := make(map[string]interface{})
+	for _, q := range w.queues {
+		size, err := w.redis.QueueSize(ctx, q.name)
+		if err != nil {
+			return nil, err
+		}
+		retries, err := w.redis.SortedSetSize(ctx, q.retry)
+		if err != nil {
+			return nil, err
+		}
+		deadLetters, err := w.redis.QueueSize(ctx, q.deadLetter)
+		if err != nil {
+			return nil, err
+		}
 
-	return map[string]interface{}{
-		"queue_size": size,
-		"workers":    w.workers,
-	}, nil
+		stats[q.metric+"queue_size"] = size
+		stats[q.metric+"retry_size"] = retries
+		stats[q.metric+"dead_letter_size"] = deadLetters
+		stats[q.metric+"workers"] = q.workers
+	}
+	return stats, nil
 }
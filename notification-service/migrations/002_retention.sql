@@ -0,0 +1,10 @@
+-- Notifications of users on legal hold are never purged by retention. The retention purger
+-- refreshes this table from the legal holds chat-service publishes to Redis before every run.
+CREATE TABLE IF NOT EXISTS notification_legal_holds (
+    user_id TEXT PRIMARY KEY,
+    reason TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW()
+    );
+
+CREATE INDEX IF NOT EXISTS idx_notifications_created_at ON notifications(created_at);
+CREATE INDEX IF NOT EXISTS idx_notifications_user_created ON notifications(user_id, created_at DESC);
@@ -0,0 +1,2 @@
+-- chat-service identifies users by username, which is not a UUID
+ALTER TABLE notifications ALTER COLUMN user_id TYPE TEXT USING user_id::text;
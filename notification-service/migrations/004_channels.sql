@@ -0,0 +1,33 @@
+-- Where users receive notifications outside the chat: email addresses, webhook URLs and Web Push subscriptions
+CREATE TABLE IF NOT EXISTS notification_endpoints (
+    id BIGSERIAL PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    channel VARCHAR(20) NOT NULL,
+    address TEXT NOT NULL,
+    secret TEXT NOT NULL DEFAULT '',
+    p256dh TEXT NOT NULL DEFAULT '',
+    auth TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT NOW(),
+    UNIQUE (user_id, channel, address)
+    );
+
+-- Channels users turned on or off per notification type; missing rows use the defaults
+CREATE TABLE IF NOT EXISTS notification_channel_preferences (
+    user_id TEXT NOT NULL,
+    type VARCHAR(50) NOT NULL,
+    channel VARCHAR(20) NOT NULL,
+    enabled BOOLEAN NOT NULL,
+    PRIMARY KEY (user_id, type, channel)
+    );
+
+CREATE TABLE IF NOT EXISTS notification_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    notification_id UUID NOT NULL REFERENCES notifications(id) ON DELETE CASCADE,
+    channel VARCHAR(20) NOT NULL,
+    address TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT NOW()
+    );
+
+CREATE INDEX IF NOT EXISTS idx_notification_deliveries_notification ON notification_deliveries(notification_id);
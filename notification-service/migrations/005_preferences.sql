@@ -0,0 +1,19 @@
+-- User whose action caused a notification, so recipients can mute them
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS sender TEXT NOT NULL DEFAULT '';
+
+-- Notification types users turned off and their do-not-disturb schedule
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id TEXT PRIMARY KEY,
+    disabled_types TEXT[] NOT NULL DEFAULT '{}',
+    quiet_start VARCHAR(5),
+    quiet_end VARCHAR(5),
+    time_zone VARCHAR(64),
+    updated_at TIMESTAMP DEFAULT NOW()
+    );
+
+CREATE TABLE IF NOT EXISTS notification_muted_senders (
+    user_id TEXT NOT NULL,
+    sender TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (user_id, sender)
+    );
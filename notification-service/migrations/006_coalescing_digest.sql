@@ -0,0 +1,14 @@
+-- Message notifications from the same sender are folded into one within a short window
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS count INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_notifications_coalesce ON notifications(user_id, type, sender) WHERE is_read = FALSE;
+
+-- Users can opt out of digest emails
+ALTER TABLE notification_preferences ADD COLUMN IF NOT EXISTS digest BOOLEAN NOT NULL DEFAULT TRUE;
+
+-- When each user was last sent a digest of their unread notifications
+CREATE TABLE IF NOT EXISTS notification_digests (
+    user_id TEXT PRIMARY KEY,
+    sent_at TIMESTAMP NOT NULL
+    );
@@ -0,0 +1,11 @@
+-- Events already turned into a notification, so a request delivered twice is stored once.
+-- A coalesced notification holds the keys of every request folded into it.
+CREATE TABLE IF NOT EXISTS notification_idempotency_keys (
+    user_id TEXT NOT NULL,
+    idempotency_key TEXT NOT NULL,
+    notification_id UUID NOT NULL REFERENCES notifications(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (user_id, idempotency_key)
+    );
+
+CREATE INDEX IF NOT EXISTS idx_notification_idempotency_keys_notification ON notification_idempotency_keys(notification_id);
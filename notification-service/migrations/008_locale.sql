@@ -0,0 +1,2 @@
+-- Language notification texts are rendered in, e.g. "en" or "pt-BR"; empty uses the default
+ALTER TABLE notification_preferences ADD COLUMN IF NOT EXISTS locale VARCHAR(35) NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+-- Whether the notification of an idempotency key was published to the user. A request
+-- redelivered after its worker died between storing and publishing is published again.
+-- Keys stored before this column existed were published.
+ALTER TABLE notification_idempotency_keys ADD COLUMN IF NOT EXISTS published BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE notification_idempotency_keys ALTER COLUMN published SET DEFAULT FALSE;